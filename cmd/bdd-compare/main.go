@@ -0,0 +1,96 @@
+// Command bdd-compare compares the phase durations and spec results of a run of the BDD tests with a baseline of
+// previous runs, such as the last nightly runs, and exits non-zero if a phase of a quickstart is significantly slower
+// or a spec which passed in the latest baseline run failed.
+//
+// The run is read from the JSON reports of the suites, which default to the reports directory. Use -update to add
+// the run to the baseline once it has been compared.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/baseline"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	defaults := baseline.DefaultOptions()
+	flags := flag.NewFlagSet("bdd-compare", flag.ContinueOnError)
+	baselineFile := flags.String("baseline", "", "the baseline JSON file of the previous runs")
+	update := flags.Bool("update", false, "add the run to the baseline once it has been compared")
+	maxRuns := flags.Int("max-runs", 10, "the number of runs kept in the baseline when using -update")
+	minRuns := flags.Int("min-runs", defaults.MinRuns, "the number of baseline runs of a phase needed to compare it")
+	ratio := flags.Float64("ratio", defaults.Ratio, "how many times longer than the baseline mean a phase has to take to be slower")
+	sigmas := flags.Float64("sigmas", defaults.Sigmas, "how many standard deviations above the baseline mean a phase has to take to be slower")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: bdd-compare -baseline <file> [flags] [<suite>.json...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *baselineFile == "" {
+		return fmt.Errorf("no baseline specified, use -baseline")
+	}
+	if *ratio <= 1 {
+		return fmt.Errorf("invalid -ratio %v: should be greater than 1", *ratio)
+	}
+
+	reportFiles := flags.Args()
+	if len(reportFiles) == 0 {
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+		reportFiles, err = filepath.Glob(filepath.Join(cfg.ReportsDir, "*.json"))
+		if err != nil {
+			return err
+		}
+		if len(reportFiles) == 0 {
+			return fmt.Errorf("no JSON reports found in %s, check json is one of BDD_REPORT_FORMATS", cfg.ReportsDir)
+		}
+	}
+	current, err := baseline.LoadRun(reportFiles...)
+	if err != nil {
+		return err
+	}
+	b, err := baseline.Load(*baselineFile)
+	if err != nil {
+		return err
+	}
+
+	comparison := baseline.Compare(b, current, baseline.Options{MinRuns: *minRuns, Ratio: *ratio, Sigmas: *sigmas})
+	fmt.Printf("comparing %d reports with %d baseline runs\n\n", len(reportFiles), len(b.Runs))
+	err = comparison.WriteDiff(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if *update {
+		b.Add(current, *maxRuns)
+		err = b.Save(*baselineFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added the run to the baseline %s which has %d runs\n", *baselineFile, len(b.Runs))
+	}
+	if n := comparison.Regressions(); n > 0 {
+		return fmt.Errorf("%d regressions compared to the baseline", n)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Command bdd-gc lists and removes the resources left behind by aborted BDD test runs, such as git repositories,
+// SourceRepositories, PipelineActivities, preview namespaces and their Preview resources and applications in the
+// staging and production environments whose names start with the bdd- prefix.
+//
+// By default the stale resources are only listed. Use -delete to remove them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gc"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"k8s.io/client-go/kubernetes"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("bdd-gc", flag.ContinueOnError)
+	prefix := flags.String("prefix", "bdd-", "the prefix of the repositories created by the BDD tests")
+	olderThan := flags.String("older-than", "24h", "the minimum age of a resource to remove, in minutes or as a Go duration")
+	owner := flags.String("owner", "", "the git organisation or user of the test repositories, defaults to git.organisation of the configuration")
+	namespace := flags.String("namespace", "", "the dev namespace, defaults to the current namespace")
+	skipRepos := flags.Bool("skip-repos", false, "do not look for git repositories")
+	deleteResources := flags.Bool("delete", false, "remove the stale resources rather than just listing them")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	age, err := config.ParseDuration(*olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid -older-than: %w", err)
+	}
+	cfg, err := config.Current()
+	if err != nil {
+		return err
+	}
+	kubeClient, ns, err := kube.LazyCreateKubeClientAndNamespace(nil, *namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kubeClient: %w", err)
+	}
+	jxClient, err := jxclient.LazyCreateJXClient(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create jxClient: %w", err)
+	}
+	dynamicClient, err := kube.LazyCreateDynamicClient(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamicClient: %w", err)
+	}
+
+	c := &gc.Collector{
+		Prefix:        *prefix,
+		OlderThan:     age,
+		Namespace:     ns,
+		Owner:         *owner,
+		KubeClient:    kubeClient,
+		JXClient:      jxClient,
+		DynamicClient: dynamicClient,
+		DeleteApplication: func(ctx context.Context, name string) error {
+			r := runner.New(".", nil, 0)
+			_, err := r.RunContext(ctx, runner.RunOptions{}, "application", "delete", "--no-source", "--repo", name)
+			return err
+		},
+	}
+	if c.Owner == "" {
+		c.Owner = cfg.Git.Organisation
+	}
+	if !*skipRepos {
+		if c.Owner == "" {
+			return fmt.Errorf("no git organisation specified, use -owner, GIT_ORGANISATION or -skip-repos")
+		}
+		provider, err := newGitProvider(cfg, kubeClient)
+		if err != nil {
+			return err
+		}
+		c.Repositories = provider
+	}
+
+	ctx := context.Background()
+	resources, err := c.Find(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("found %d resources starting with %s older than %s\n", len(resources), c.Prefix, age.String())
+	err = gc.WriteTable(os.Stdout, resources, time.Now())
+	if err != nil {
+		return err
+	}
+	if !*deleteResources {
+		if len(resources) > 0 {
+			fmt.Println("run again with -delete to remove them")
+		}
+		return nil
+	}
+	removed, err := c.Delete(ctx, resources)
+	fmt.Printf("removed %d of %d resources\n", len(removed), len(resources))
+	return err
+}
+
+func newGitProvider(cfg *config.Config, kubeClient kubernetes.Interface) (gits.Provider, error) {
+	username, token, err := gits.FindCredentials(kubeClient, cfg.Git.Username, cfg.Git.Token, cfg.Git.ForceLocalAuthConfig)
+	if err != nil {
+		return nil, err
+	}
+	serverURL := cfg.Git.ProviderURL
+	if serverURL == "" {
+		serverURL = "https://github.com"
+	}
+	return gits.NewProvider(cfg.Git.Kind, serverURL, username, token)
+}
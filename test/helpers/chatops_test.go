@@ -0,0 +1,182 @@
+package helpers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakescm"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chatOpsRepo = "bdd-nh"
+	bot         = "bdd-bot"
+	approver    = "bdd-approver"
+)
+
+// scmServer starts a fake git server with lighthouse and points the git configuration at it for the duration of the
+// test. The pipeline user is the bot and lighthouse comments as the owner.
+func scmServer(t *testing.T) *fakescm.Server {
+	s := fakescm.New(t)
+	s.AddUser(owner, "owner-token")
+	s.AddUser(bot, "bot-token")
+	s.AddUser(approver, "approver-token")
+	s.AddRepository(owner, chatOpsRepo)
+	lighthouse := &fakescm.Lighthouse{Bot: owner, Merge: true}
+	s.AddHook(lighthouse.Hook())
+
+	git, baseReportURL := helpers.Config.Git, helpers.Config.LighthouseBaseReportURL
+	helpers.Config.Git.Kind, helpers.Config.Git.ProviderURL = "", s.URL
+	helpers.Config.Git.Username, helpers.Config.Git.Token = bot, "bot-token"
+	helpers.Config.Git.ApproverUsername, helpers.Config.Git.ApproverToken = approver, "approver-token"
+	oldInvitationDelay, oldProwActionWait, oldPipelineActivityComplete, oldUrlReturns := helpers.InvitationDelay, helpers.TimeoutProwActionWait, helpers.TimeoutPipelineActivityComplete, helpers.TimeoutUrlReturns
+	helpers.InvitationDelay, helpers.TimeoutProwActionWait, helpers.TimeoutPipelineActivityComplete, helpers.TimeoutUrlReturns = 0, 10*time.Second, 10*time.Second, 10*time.Second
+	t.Cleanup(func() {
+		helpers.Config.Git, helpers.Config.LighthouseBaseReportURL = git, baseReportURL
+		helpers.InvitationDelay, helpers.TimeoutProwActionWait, helpers.TimeoutPipelineActivityComplete, helpers.TimeoutUrlReturns = oldInvitationDelay, oldProwActionWait, oldPipelineActivityComplete, oldUrlReturns
+	})
+	return s
+}
+
+// gitProviders returns the providers of the pipeline and approver users
+func gitProviders(t *testing.T, o *helpers.TestOptions) (gits.Provider, gits.Provider) {
+	provider, err := o.GetGitProvider()
+	require.NoError(t, err)
+	approverProvider, err := o.GetApproverGitProvider()
+	require.NoError(t, err)
+	return provider, approverProvider
+}
+
+// newPullRequest creates a pull request of the bot and returns it as the provider would
+func newPullRequest(t *testing.T, s *fakescm.Server, provider gits.Provider, title string) *gits.PullRequest {
+	created := s.CreatePullRequest(owner, chatOpsRepo, fakescm.PullRequest{Issue: fakescm.Issue{Title: title, Author: bot}})
+	pr, err := provider.GetPullRequest(owner, chatOpsRepo, created.Number)
+	require.NoError(t, err)
+	return pr
+}
+
+func TestApprovePullRequestFromLogOutput(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, approverProvider := gitProviders(t, o)
+	pr := newPullRequest(t, s, provider, "chore: my change")
+
+	output := "pushed the changes\nCreated Pull Request: " + s.PullRequestURL(owner, chatOpsRepo, pr.Number) + "\n"
+	o.ApprovePullRequestFromLogOutput(provider, approverProvider, output)
+	assert.Equal(t, []string{approver}, s.Repository(owner, chatOpsRepo).Collaborators, "the approver should have accepted the invitation")
+	assert.Empty(t, s.Invitations())
+
+	o.WaitForCreatedPullRequestToMerge(provider, output)
+	merged := s.PullRequest(owner, chatOpsRepo, pr.Number)
+	assert.Contains(t, merged.Labels, fakescm.LabelApproved)
+	assert.True(t, merged.Merged)
+	assert.Equal(t, "/approve", s.Comments(owner, chatOpsRepo, pr.Number)[0].Body)
+}
+
+func TestChatOpsCommands(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, approverProvider := gitProviders(t, o)
+	pr := newPullRequest(t, s, provider, "chore: my change")
+
+	require.NoError(t, o.AttemptToLGTMOwnPullRequest(provider, pr))
+	require.NoError(t, o.AddHoldLabelToPullRequestWithChatOpsCommand(provider, pr))
+	require.NoError(t, o.AddWIPLabelToPullRequestByUpdatingTitle(provider, pr))
+	require.NoError(t, o.AddReviewerToPullRequestWithChatOpsCommand(provider, approverProvider, pr, approver))
+
+	var comments []string
+	for _, c := range s.Comments(owner, chatOpsRepo, pr.Number) {
+		comments = append(comments, c.Author+": "+c.Body)
+	}
+	assert.Equal(t, []string{
+		bot + ": /lgtm",
+		owner + ": @" + bot + " " + fakescm.CannotLGTMOwnPullRequest,
+		bot + ": /hold",
+		bot + ": /hold cancel",
+		bot + ": /cc " + approver,
+		bot + ": /uncc " + approver,
+	}, comments)
+
+	current := s.PullRequest(owner, chatOpsRepo, pr.Number)
+	assert.Equal(t, "chore: my change", current.Title)
+	assert.Empty(t, current.Labels)
+	assert.Empty(t, current.Reviewers)
+	assert.False(t, current.Merged)
+}
+
+func TestExpectThatPullRequestHasLabelTimesOut(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	helpers.TimeoutProwActionWait = time.Second
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, _ := gitProviders(t, o)
+	pr := newPullRequest(t, s, provider, "chore: my change")
+
+	err := o.ExpectThatPullRequestHasLabel(provider, pr.Number, owner, chatOpsRepo, fakescm.LabelApproved)
+	require.Error(t, err)
+	assert.Equal(t, "the pull request has no labels", err.Error())
+
+	require.NoError(t, s.AddLabel(owner, chatOpsRepo, pr.Number, fakescm.LabelHold))
+	err = o.ExpectThatPullRequestDoesNotHaveLabel(provider, pr.Number, owner, chatOpsRepo, fakescm.LabelHold)
+	require.Error(t, err)
+	assert.Equal(t, "the pull request has the specified label do-not-merge/hold but shouldn't", err.Error())
+}
+
+func TestCreateIssueAndAssignToUserWithChatOpsCommand(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, _ := gitProviders(t, o)
+
+	err := o.CreateIssueAndAssignToUserWithChatOpsCommand(owner, chatOpsRepo, &scm.IssueInput{Title: "my issue", Body: "please look"}, provider)
+	require.NoError(t, err)
+	issue := s.Issue(owner, chatOpsRepo, 1)
+	require.NotNil(t, issue)
+	assert.Equal(t, "my issue", issue.Title)
+	assert.Equal(t, []string{bot}, issue.Assignees)
+	assert.Equal(t, "/assign "+bot, s.Comments(owner, chatOpsRepo, 1)[0].Body)
+}
+
+func TestWaitForPullRequestCommitStatus(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	helpers.Config.LighthouseBaseReportURL = "https://dashboard.example.com"
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, _ := gitProviders(t, o)
+	pr := newPullRequest(t, s, provider, "chore: my change")
+
+	target := "https://dashboard.example.com/teams/jx/projects/" + owner + "/" + chatOpsRepo + "/PR-1/2"
+	s.SetStatus(owner, chatOpsRepo, pr.Sha, fakescm.Status{Context: "pr-build", State: "pending"})
+	s.SetStatus(owner, chatOpsRepo, pr.Sha, fakescm.Status{Context: "lint", State: "success", TargetURL: target})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.SetStatus(owner, chatOpsRepo, pr.Sha, fakescm.Status{Context: "pr-build", State: "success", TargetURL: target})
+	}()
+
+	o.WaitForPullRequestCommitStatus(provider, pr, []string{"pr-build", "lint"}, "success")
+	assert.Contains(t, s.Requests(), "GET repos/"+owner+"/"+chatOpsRepo+"/statuses/"+pr.Sha)
+}
+
+func TestMostRecentOpenPullRequestForOwnerAndRepo(t *testing.T) {
+	setup(t)
+	s := scmServer(t)
+	o := &helpers.TestOptions{ApplicationName: chatOpsRepo}
+	provider, _ := gitProviders(t, o)
+	newPullRequest(t, s, provider, "first")
+	newPullRequest(t, s, provider, "second")
+	require.NoError(t, s.MergePullRequest(owner, chatOpsRepo, 2))
+
+	pr, err := o.MostRecentOpenPullRequestForOwnerAndRepo(provider, owner, chatOpsRepo)
+	require.NoError(t, err)
+	assert.Equal(t, "first", pr.Title)
+
+	pr, err = o.GetPullRequestWithTitle(provider, owner, chatOpsRepo, "second")
+	require.NoError(t, err)
+	assert.Nil(t, pr, "the merged pull request is not open")
+}
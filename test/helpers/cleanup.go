@@ -0,0 +1,272 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/gomega"
+)
+
+// ResourceKind is the kind of resource created by a spec which needs to be removed afterwards
+type ResourceKind string
+
+const (
+	// ResourceRepository is a git repository, removed if DeleteRepos is true
+	ResourceRepository ResourceKind = "repository"
+	// ResourceBranch is a git branch pushed for a pull request, removed if DeleteRepos is true
+	ResourceBranch ResourceKind = "branch"
+	// ResourceApplication is an application deployed to the environments, removed if DeleteApplications is true
+	ResourceApplication ResourceKind = "application"
+	// ResourcePreview is a preview environment namespace, removed if DeleteApplications is true
+	ResourcePreview ResourceKind = "preview"
+)
+
+// Resource is a resource registered for cleanup
+type Resource struct {
+	Kind   ResourceKind
+	Name   string
+	Delete func() error
+}
+
+// String returns the kind and name of the resource
+func (r *Resource) String() string {
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// CleanupRegistry keeps track of the resources created by a spec so they are removed, in the reverse order they
+// were created, even if the spec fails part way through
+type CleanupRegistry struct {
+	lock      sync.Mutex
+	resources []*Resource
+}
+
+var (
+	registries     []*CleanupRegistry
+	registriesLock sync.Mutex
+)
+
+// NewCleanupRegistry creates a new registry. Any resources still registered when the suite finishes are removed by
+// SynchronizedAfterSuiteAllNodesCallback on the ginkgo node which created it.
+func NewCleanupRegistry() *CleanupRegistry {
+	r := &CleanupRegistry{}
+	registriesLock.Lock()
+	registries = append(registries, r)
+	registriesLock.Unlock()
+	return r
+}
+
+// Register registers a resource to be deleted with the given function
+func (r *CleanupRegistry) Register(kind ResourceKind, name string, deleteFn func() error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.resources = append(r.resources, &Resource{
+		Kind:   kind,
+		Name:   name,
+		Delete: deleteFn,
+	})
+}
+
+// Resources returns the resources which have not been removed yet in the order they were registered
+func (r *CleanupRegistry) Resources() []*Resource {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*Resource{}, r.resources...)
+}
+
+// Run removes the registered resources in reverse order, keeping any the configuration says to keep, and returns the
+// resources it removed. Every resource is attempted even if removing an earlier one fails.
+func (r *CleanupRegistry) Run() ([]*Resource, error) {
+	r.lock.Lock()
+	resources := r.resources
+	r.resources = nil
+	r.lock.Unlock()
+
+	var removed []*Resource
+	var errs []error
+	for i := len(resources) - 1; i >= 0; i-- {
+		resource := resources[i]
+		if !shouldDelete(resource.Kind) {
+			utils.LogInfof("keeping %s as its deletion is disabled\n", resource.String())
+			continue
+		}
+		err := resource.Delete()
+		if err != nil {
+			utils.LogInfof("WARNING: failed to remove %s: %s\n", resource.String(), err.Error())
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", resource.String(), err))
+			continue
+		}
+		utils.LogInfof("removed %s\n", resource.String())
+		removed = append(removed, resource)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// RunNow removes the registered resource with the kind and name straight away, as part of the spec, rather than once
+// the spec completes. If removing it fails the resource stays registered so it is retried after the spec. It returns
+// false if there is no such resource or its deletion is disabled.
+func (r *CleanupRegistry) RunNow(kind ResourceKind, name string) (bool, error) {
+	r.lock.Lock()
+	var resource *Resource
+	for _, res := range r.resources {
+		if res.Kind == kind && res.Name == name {
+			resource = res
+		}
+	}
+	r.lock.Unlock()
+	if resource == nil || !shouldDelete(kind) {
+		return false, nil
+	}
+
+	err := resource.Delete()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove %s: %w", resource.String(), err)
+	}
+	r.lock.Lock()
+	r.resources = slices.DeleteFunc(r.resources, func(res *Resource) bool {
+		return res == resource
+	})
+	r.lock.Unlock()
+	utils.LogInfof("removed %s\n", resource.String())
+	return true, nil
+}
+
+func shouldDelete(kind ResourceKind) bool {
+	switch kind {
+	case ResourceRepository, ResourceBranch:
+		return Config.Tests.DeleteRepos
+	case ResourceApplication, ResourcePreview:
+		return Config.Tests.DeleteApplications
+	}
+	return true
+}
+
+// RunPendingCleanups removes any resources still registered with any registry, such as when a spec was interrupted
+// before its AfterEach ran
+func RunPendingCleanups() error {
+	registriesLock.Lock()
+	pending := registries
+	registries = nil
+	registriesLock.Unlock()
+
+	var errs []error
+	for _, r := range pending {
+		_, err := r.Run()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cleanups returns the cleanup registry of the test, creating it if required
+func (t *TestOptions) Cleanups() *CleanupRegistry {
+	if t.Cleanup == nil {
+		t.Cleanup = NewCleanupRegistry()
+	}
+	return t.Cleanup
+}
+
+// CleanupResources removes the resources registered by the spec. It is intended to be called from AfterEach so
+// failures are logged rather than failing the spec. Specs which get that far delete their application themselves
+// with DeleteApplication so that failing to delete it fails the spec.
+func (t *TestOptions) CleanupResources() []*Resource {
+	if t.Cleanup == nil {
+		return nil
+	}
+	Step("removing the resources created by the spec")
+	removed, err := t.Cleanup.Run()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+	return removed
+}
+
+// RegisterRepositoryCleanup registers the git repository to be deleted once the spec completes
+func (t *TestOptions) RegisterRepositoryCleanup(owner string, repo string) {
+	t.Cleanups().Register(ResourceRepository, owner+"/"+repo, func() error {
+		provider, err := t.GetGitProvider()
+		if err != nil {
+			return err
+		}
+		return provider.DeleteRepository(owner, repo)
+	})
+}
+
+// RegisterApplicationCleanup registers the application to be deleted from the environments once the spec completes,
+// leaving its source repository alone.
+func (t *TestOptions) RegisterApplicationCleanup(applicationName string) {
+	t.Cleanups().Register(ResourceApplication, applicationName, func() error {
+		r := runner.New(t.WorkDir, &TimeoutSessionWait, 0)
+		_, err := r.RunContext(context.TODO(), runner.RunOptions{}, "application", "delete", "--no-source", "--repo", applicationName)
+		return err
+	})
+}
+
+// DeleteApplication deletes the application registered with RegisterApplicationCleanup as part of the spec, unless
+// deleting applications is disabled, so that failing to delete it fails the spec. Unless the cluster repository check
+// is disabled the application has to be removed from the helmfiles of the cluster repository too. The cleanup registry
+// only removes the application if the spec fails before getting here.
+func (t *TestOptions) DeleteApplication(applicationName string) {
+	if !t.DeleteApplications() {
+		utils.LogInfof("not deleting the application %s as its deletion is disabled\n", applicationName)
+		return
+	}
+	Step(fmt.Sprintf("deleting the application %s", applicationName), func() {
+		deleted, err := t.Cleanups().RunNow(ResourceApplication, applicationName)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(deleted).Should(BeTrue(), "the application %s should be registered with RegisterApplicationCleanup", applicationName)
+	})
+	if t.ShouldTestClusterRepo() {
+		Expect(t.TheClusterRepoDoesNotHaveTheApplication(applicationName, promotionEnvironments...)).Should(Succeed())
+	}
+}
+
+// RegisterPreviewCleanup registers the namespace of a preview environment to be deleted once the spec completes
+func (t *TestOptions) RegisterPreviewCleanup(namespace string) {
+	t.Cleanups().Register(ResourcePreview, namespace, func() error {
+		if KubeClient == nil {
+			return fmt.Errorf("no kubernetes client to delete namespace %s", namespace)
+		}
+		err := KubeClient.CoreV1().Namespaces().Delete(context.TODO(), namespace, metav1.DeleteOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// RegisterBranchCleanup registers the branch pushed from the given git working directory to be deleted from the
+// remote once the spec completes
+func (t *TestOptions) RegisterBranchCleanup(dir string, branch string) {
+	t.Cleanups().Register(ResourceBranch, branch, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), TimeoutCmdLine)
+		defer cancel()
+		command := exec.CommandContext(ctx, "git", "push", "origin", "--delete", branch)
+		command.Dir = dir
+		command.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		entry, err := transcript.Run("git", command)
+		if err == nil && entry.ExitCode != 0 {
+			err = fmt.Errorf("exited with %d", entry.ExitCode)
+		}
+		if err != nil {
+			output := ""
+			if entry != nil {
+				output = strings.TrimSpace(entry.Stdout + entry.Stderr)
+			}
+			return fmt.Errorf("git push origin --delete %s: %s: %w", branch, output, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,201 @@
+package helpers_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteSettings overrides the deletion settings for the duration of the test
+func deleteSettings(t *testing.T, repos, applications bool) {
+	oldRepos, oldApplications := helpers.Config.Tests.DeleteRepos, helpers.Config.Tests.DeleteApplications
+	helpers.Config.Tests.DeleteRepos, helpers.Config.Tests.DeleteApplications = repos, applications
+	t.Cleanup(func() {
+		helpers.Config.Tests.DeleteRepos, helpers.Config.Tests.DeleteApplications = oldRepos, oldApplications
+	})
+}
+
+func recordDelete(deleted *[]string, name string, err error) func() error {
+	return func() error {
+		*deleted = append(*deleted, name)
+		return err
+	}
+}
+
+func TestCleanupRegistryRemovesInReverseOrder(t *testing.T) {
+	deleteSettings(t, true, true)
+	var deleted []string
+	r := &helpers.CleanupRegistry{}
+	r.Register(helpers.ResourceRepository, "repo", recordDelete(&deleted, "repo", nil))
+	r.Register(helpers.ResourceApplication, "app", recordDelete(&deleted, "app", nil))
+	r.Register(helpers.ResourcePreview, "preview", recordDelete(&deleted, "preview", nil))
+
+	removed, err := r.Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"preview", "app", "repo"}, deleted)
+	assert.Len(t, removed, 3)
+	assert.Empty(t, r.Resources(), "resources should only be removed once")
+}
+
+func TestCleanupRegistryKeepsDisabledKinds(t *testing.T) {
+	testCases := []struct {
+		name         string
+		repos        bool
+		applications bool
+		expected     []string
+	}{
+		{name: "keep everything", expected: nil},
+		{name: "repos only", repos: true, expected: []string{"branch", "repo"}},
+		{name: "applications only", applications: true, expected: []string{"preview", "app"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deleteSettings(t, tc.repos, tc.applications)
+			var deleted []string
+			r := &helpers.CleanupRegistry{}
+			r.Register(helpers.ResourceRepository, "repo", recordDelete(&deleted, "repo", nil))
+			r.Register(helpers.ResourceApplication, "app", recordDelete(&deleted, "app", nil))
+			r.Register(helpers.ResourceBranch, "branch", recordDelete(&deleted, "branch", nil))
+			r.Register(helpers.ResourcePreview, "preview", recordDelete(&deleted, "preview", nil))
+
+			_, err := r.Run()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, deleted)
+		})
+	}
+}
+
+func TestCleanupRegistryContinuesAfterFailures(t *testing.T) {
+	deleteSettings(t, true, true)
+	var deleted []string
+	r := &helpers.CleanupRegistry{}
+	r.Register(helpers.ResourceRepository, "repo", recordDelete(&deleted, "repo", nil))
+	r.Register(helpers.ResourceApplication, "app", recordDelete(&deleted, "app", errors.New("boom")))
+	r.Register(helpers.ResourcePreview, "preview", recordDelete(&deleted, "preview", errors.New("bang")))
+
+	removed, err := r.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to remove application app: boom")
+	assert.Contains(t, err.Error(), "failed to remove preview preview: bang")
+	assert.Equal(t, []string{"preview", "app", "repo"}, deleted)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "repo", removed[0].Name)
+}
+
+func TestCleanupRegistryRunNow(t *testing.T) {
+	deleteSettings(t, true, true)
+	var deleted []string
+	r := &helpers.CleanupRegistry{}
+	r.Register(helpers.ResourceRepository, "repo", recordDelete(&deleted, "repo", nil))
+	r.Register(helpers.ResourceApplication, "app", recordDelete(&deleted, "app", nil))
+
+	ok, err := r.RunNow(helpers.ResourceApplication, "app")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"app"}, deleted)
+	require.Len(t, r.Resources(), 1, "the application should no longer be registered")
+	assert.Equal(t, "repo", r.Resources()[0].Name)
+
+	ok, err = r.RunNow(helpers.ResourceApplication, "app")
+	require.NoError(t, err)
+	assert.False(t, ok, "the application has already been removed")
+}
+
+func TestCleanupRegistryRunNowKeepsFailuresAsFallback(t *testing.T) {
+	deleteSettings(t, true, true)
+	var deleted []string
+	r := &helpers.CleanupRegistry{}
+	r.Register(helpers.ResourceApplication, "app", recordDelete(&deleted, "app", errors.New("boom")))
+
+	ok, err := r.RunNow(helpers.ResourceApplication, "app")
+	require.Error(t, err)
+	assert.Equal(t, "failed to remove application app: boom", err.Error())
+	assert.False(t, ok)
+	assert.Len(t, r.Resources(), 1, "the application should be retried after the spec")
+
+	deleteSettings(t, true, false)
+	ok, err = r.RunNow(helpers.ResourceApplication, "app")
+	require.NoError(t, err)
+	assert.False(t, ok, "deleting applications is disabled")
+	assert.Equal(t, []string{"app"}, deleted)
+}
+
+func TestRunPendingCleanups(t *testing.T) {
+	deleteSettings(t, true, true)
+	var deleted []string
+	first := helpers.NewCleanupRegistry()
+	first.Register(helpers.ResourceRepository, "first", recordDelete(&deleted, "first", nil))
+	second := helpers.NewCleanupRegistry()
+	second.Register(helpers.ResourceRepository, "second", recordDelete(&deleted, "second", nil))
+
+	_, err := first.Run()
+	require.NoError(t, err)
+
+	err = helpers.RunPendingCleanups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, deleted)
+}
+
+func TestRegisterPreviewCleanup(t *testing.T) {
+	deleteSettings(t, true, true)
+	setup(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "jx-preview-pr-1"}})
+
+	T := &helpers.TestOptions{ApplicationName: "myapp"}
+	T.RegisterPreviewCleanup("jx-preview-pr-1")
+	T.RegisterPreviewCleanup("jx-preview-pr-2")
+
+	removed := T.CleanupResources()
+	assert.Len(t, removed, 2, "a missing namespace is treated as already removed")
+
+	_, err := helpers.KubeClient.CoreV1().Namespaces().Get(context.TODO(), "jx-preview-pr-1", metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestRegisterBranchCleanup(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	deleteSettings(t, true, true)
+	workDir := t.TempDir()
+	origin := filepath.Join(workDir, "app.git")
+	git(t, workDir, "init", "--bare", origin)
+	git(t, workDir, "clone", origin, "app")
+	dir := filepath.Join(workDir, "app")
+	git(t, dir, "config", "user.email", "bdd@jenkins-x.io")
+	git(t, dir, "config", "user.name", "bdd")
+	git(t, dir, "commit", "--allow-empty", "-m", "chore: initial commit")
+	git(t, dir, "push", "origin", "HEAD:refs/heads/changes-abcde")
+
+	var lock sync.Mutex
+	var pushes []string
+	transcript.AddObserver(func(e *transcript.Entry) {
+		lock.Lock()
+		defer lock.Unlock()
+		if e.Command == "git" && e.Dir == dir {
+			pushes = append(pushes, strings.Join(e.Args, " "))
+		}
+	})
+
+	T := &helpers.TestOptions{ApplicationName: "app"}
+	T.RegisterBranchCleanup(dir, "changes-abcde")
+	removed := T.CleanupResources()
+	assert.Len(t, removed, 1)
+
+	out, err := exec.Command("git", "-C", origin, "branch", "--list", "changes-abcde").CombinedOutput()
+	require.NoError(t, err)
+	assert.Empty(t, strings.TrimSpace(string(out)), "the branch should be deleted from the remote")
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"push origin --delete changes-abcde"}, pushes, "the push should be recorded in the transcript")
+}
@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/deployments"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/gomega"
+)
+
+// EnvironmentNamespace returns the namespace of the environment such as staging, which defaults to jx-<environment>
+// if there is no such Environment
+func EnvironmentNamespace(environment string) (string, error) {
+	defaultNamespace := "jx-" + environment
+	if JXClient == nil {
+		return defaultNamespace, nil
+	}
+	env, err := JXClient.JenkinsV1().Environments(Namespace).Get(context.TODO(), environment, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return defaultNamespace, nil
+		}
+		return "", fmt.Errorf("failed to get the environment %s in namespace %s: %w", environment, Namespace, err)
+	}
+	if env.Spec.Namespace == "" {
+		return defaultNamespace, nil
+	}
+	return env.Spec.Namespace, nil
+}
+
+// WaitForDeploymentRollout waits for the deployment in the namespace to roll out. Wait timeout can be set via
+// BDD_TIMEOUT_DEPLOYMENT_ROLLOUT.
+func (t *TestOptions) WaitForDeploymentRollout(namespace string, deployment string) {
+	Step(fmt.Sprintf("waiting for the deployment %s in namespace %s to roll out", deployment, namespace), func() {
+		_, err := deployments.WaitForRollout(context.TODO(), KubeClient, namespace, deployment, TimeoutDeploymentRollout)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+}
+
+// TheApplicationIsDeployed asserts that the deployment of the application in the namespace has rolled out with the
+// pods and the version reported by jx get applications and that its containers have not restarted more than
+// BDD_MAX_POD_RESTARTS times
+func (t *TestOptions) TheApplicationIsDeployed(namespace string, application *parsers.Application) {
+	if KubeClient == nil {
+		utils.LogInfof("WARNING: not verifying the deployment of %s as there is no kubernetes client\n", application.Name)
+		return
+	}
+	applicationName := t.GetApplicationName()
+	Step(fmt.Sprintf("verifying the deployment of %s in namespace %s", applicationName, namespace), func() {
+		ctx := context.TODO()
+		d, err := deployments.Find(ctx, KubeClient, namespace, applicationName)
+		Expect(err).ShouldNot(HaveOccurred())
+		d, err = deployments.WaitForRollout(ctx, KubeClient, namespace, d.Name, TimeoutDeploymentRollout)
+		Expect(err).ShouldNot(HaveOccurred())
+		err = deployments.Verify(ctx, KubeClient, d, deployments.Expectation{
+			Version:     application.Version,
+			DesiredPods: application.DesiredPods,
+			RunningPods: application.RunningPods,
+			MaxRestarts: int32(Config.Tests.MaxPodRestarts),
+		})
+		Expect(err).ShouldNot(HaveOccurred(), "deployment %s in namespace %s", d.Name, namespace)
+	})
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/diagnostics"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+
+	. "github.com/onsi/ginkgo"
+)
+
+// CollectDiagnosticsOnFailure writes a diagnostics bundle for the application to REPORTS_DIR/<spec> if the current
+// spec has failed. It should be called from AfterEach before CleanupResources so the resources are still there.
+func (t *TestOptions) CollectDiagnosticsOnFailure() {
+	spec := CurrentGinkgoTestDescription()
+	if !spec.Failed {
+		return
+	}
+	t.CollectDiagnostics(diagnostics.SpecDir(Config.ReportsDir, spec.FullTestText))
+}
+
+// CollectDiagnostics writes the PipelineActivities, SourceRepositories, tekton PipelineRuns and TaskRuns, pod logs
+// and events of the application in its environments and previews along with the output of jx get applications into
+// the given directory. Failures are logged rather than failing the spec.
+func (t *TestOptions) CollectDiagnostics(dir string) {
+	if KubeClient == nil || JXClient == nil {
+		utils.LogInfof("WARNING: not collecting diagnostics as the kubernetes clients have not been created\n")
+		return
+	}
+	c := &diagnostics.Collector{
+		Dir:           dir,
+		Application:   t.ApplicationName,
+		Namespace:     Namespace,
+		KubeClient:    KubeClient,
+		JXClient:      JXClient,
+		DynamicClient: DynamicClient,
+		Jx: func(args ...string) (string, error) {
+			r := runner.New(t.WorkDir, &TimeoutSessionWait, 0)
+			result, err := r.RunContext(context.TODO(), runner.RunOptions{}, args...)
+			if err != nil {
+				return "", err
+			}
+			return result.Stdout, nil
+		},
+	}
+	utils.LogInfof("collecting diagnostics for %s into %s\n", t.ApplicationName, dir)
+	err := c.Collect(context.TODO())
+	if err != nil {
+		utils.LogInfof("WARNING: failed to collect some diagnostics: %s\n", err.Error())
+	}
+}
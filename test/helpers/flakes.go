@@ -0,0 +1,63 @@
+package helpers
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+
+	. "github.com/onsi/ginkgo"
+)
+
+// quarantine are the specs whose failures are reported but do not fail the suite
+var quarantine = reports.Quarantine{}
+
+// configureFlakes loads the quarantine file and makes ginkgo retry failed specs as many times as configured, unless
+// more attempts were asked for with -ginkgo.flakeAttempts
+func configureFlakes() error {
+	q, err := reports.LoadQuarantine(Config.Flakes.QuarantineFile)
+	if err != nil {
+		return err
+	}
+	quarantine = q
+	if len(quarantine) > 0 {
+		utils.LogInfof("%d specs are quarantined by %s\n", len(quarantine), Config.Flakes.QuarantineFile)
+	}
+	attempts := Config.Flakes.Retries + 1
+	if attempts > ginkgoconfig.GinkgoConfig.FlakeAttempts {
+		ginkgoconfig.GinkgoConfig.FlakeAttempts = attempts
+	}
+	return nil
+}
+
+// failHandler fails the running spec like ginkgo's Fail unless it is quarantined, in which case the failure is
+// recorded for the reports and the spec is skipped so that it does not fail the suite
+func failHandler(message string, callerSkip ...int) {
+	skip := 0
+	if len(callerSkip) > 0 {
+		skip = callerSkip[0]
+	}
+	description := CurrentGinkgoTestDescription()
+	if !quarantine.Contains(description.FullTestText) {
+		Fail(message, skip+1)
+		return
+	}
+	location := ""
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		location = fmt.Sprintf("%s:%d", file, line)
+	}
+	reports.QuarantineSpec(&reports.Failure{Message: message, Location: location})
+	utils.LogInfof("WARNING: the quarantined spec %s failed: %s\n", reports.NormalizeSpecName(description.FullTestText), message)
+	Skip("quarantined: "+message, skip+1)
+}
+
+// retrySpec removes anything left behind by the failed attempt of a spec before it is retried
+func retrySpec(name string, attempt int) {
+	utils.LogInfof("retrying %s, attempt %d of %d\n", name, attempt, ginkgoconfig.GinkgoConfig.FlakeAttempts)
+	err := RunPendingCleanups()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gitops"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// promotionEnvironments are the environments applications are promoted to whose helmfiles are checked once an
+// application is deleted
+var promotionEnvironments = []string{"staging", "production"}
+
+// GitOpsDevRepo returns the URL of the cluster git repository from the source of the dev environment. An empty
+// string is returned if there is no dev environment or it has no source.
+func (t *TestOptions) GitOpsDevRepo() (string, error) {
+	if JXClient == nil {
+		return "", nil
+	}
+	env, err := JXClient.JenkinsV1().Environments(Namespace).Get(context.TODO(), "dev", metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get the dev environment in namespace %s: %w", Namespace, err)
+	}
+	return env.Spec.Source.URL, nil
+}
+
+// GitOpsEnabled returns true if the current cluster is GitOps enabled, false otherwise.
+func (t *TestOptions) GitOpsEnabled() bool {
+	u, err := t.GitOpsDevRepo()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+	return u != ""
+}
+
+// ShouldTestClusterRepo should we check that promotions and deleting applications change the cluster repository
+func (t *TestOptions) ShouldTestClusterRepo() bool {
+	if !Config.Tests.ClusterRepoCheck {
+		return false
+	}
+	if Config.Transcript.Replay != "" {
+		utils.LogInfof("not checking the cluster repository as the commands are replayed\n")
+		return false
+	}
+	return t.GitOpsEnabled()
+}
+
+// TheClusterRepoHasTheApplication asserts that the helmfile of the namespace of the environment in the cluster
+// repository has the release of the application with the version, which the promotion to the environment added
+func (t *TestOptions) TheClusterRepoHasTheApplication(environment string, version string) {
+	namespace, err := EnvironmentNamespace(environment)
+	Expect(err).ShouldNot(HaveOccurred(), "namespace of environment %s", environment)
+	applicationName := t.GetApplicationName()
+	Step(fmt.Sprintf("verifying that the cluster repository has version %s of %s in %s", version, applicationName, gitops.HelmfilePath("", namespace)), func() {
+		err := t.checkClusterRepo(func(dir string) error {
+			return gitops.ExpectRelease(dir, namespace, applicationName, version)
+		})
+		Expect(err).ShouldNot(HaveOccurred(), "the promotion to %s should change the cluster repository", environment)
+	})
+}
+
+// TheClusterRepoDoesNotHaveTheApplication returns an error unless the releases of the application are removed from
+// the helmfiles of the namespaces of the environments in the cluster repository, such as after jx application delete
+func (t *TestOptions) TheClusterRepoDoesNotHaveTheApplication(applicationName string, environments ...string) error {
+	var namespaces []string
+	for _, environment := range environments {
+		namespace, err := EnvironmentNamespace(environment)
+		if err != nil {
+			return err
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	Step(fmt.Sprintf("verifying that %s has been removed from the cluster repository", applicationName))
+	return t.checkClusterRepo(func(dir string) error {
+		for _, namespace := range namespaces {
+			err := gitops.ExpectNoRelease(dir, namespace, applicationName)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkClusterRepo clones the cluster repository and runs the check against it, cloning it again until the check
+// passes as the change may still be in a pull request which has to be merged
+func (t *TestOptions) checkClusterRepo(check func(dir string) error) error {
+	f := func() (any, error) {
+		dir, err := t.cloneClusterRepo()
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		err = check(dir)
+		if err != nil {
+			utils.LogInfof("%s\n", err.Error())
+		}
+		return nil, err
+	}
+	return RetryExponentialBackoff(TimeoutPipelineActivityComplete, f)
+}
+
+// gitCredentialHelper answers git with the credentials in the environment of the git command, so the token is not
+// in the arguments of the command or the remote of the clone
+const gitCredentialHelper = `!f() { test "$1" = get && echo "username=${BDD_GIT_USERNAME}" && echo "password=${BDD_GIT_TOKEN}"; }; f`
+
+// cloneClusterRepo clones the latest commit of the cluster repository into a new directory of the work directory
+func (t *TestOptions) cloneClusterRepo() (string, error) {
+	repoURL, err := t.GitOpsDevRepo()
+	if err != nil {
+		return "", err
+	}
+	if repoURL == "" {
+		return "", fmt.Errorf("the dev environment in namespace %s has no cluster repository", Namespace)
+	}
+	env, err := t.gitCredentialsEnv(repoURL)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(t.WorkDir, "cluster-repo-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a directory to clone the cluster repository: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutCmdLine)
+	defer cancel()
+	command := exec.CommandContext(ctx, "git", "-c", "credential.helper=", "-c", "credential.helper="+gitCredentialHelper, "clone", "--depth", "1", repoURL, dir)
+	command.Env = append(os.Environ(), append(env, "GIT_TERMINAL_PROMPT=0")...)
+	command.Stdout = GinkgoWriter
+	command.Stderr = GinkgoWriter
+	entry, err := transcript.Run("git", command)
+	if err == nil && entry.ExitCode != 0 {
+		err = fmt.Errorf("git clone exited with %d", entry.ExitCode)
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to clone the cluster repository %s: %w", repoURL, err)
+	}
+	return dir, nil
+}
+
+// gitCredentialsEnv returns the environment variables with the credentials of the pipeline user which
+// gitCredentialHelper passes to git for an http or https git URL. The token is masked as it may have been read from
+// the cluster rather than the configuration.
+func (t *TestOptions) gitCredentialsEnv(repoURL string) ([]string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git URL %s: %w", repoURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil
+	}
+	username, token, err := t.getGitCredentials()
+	if err != nil {
+		return nil, err
+	}
+	transcript.AddSecret(token)
+	return []string{"BDD_GIT_USERNAME=" + username, "BDD_GIT_TOKEN=" + token}, nil
+}
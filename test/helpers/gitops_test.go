@@ -0,0 +1,206 @@
+package helpers_test
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gitops"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const stagingHelmfile = `namespace: jx-staging
+releases:
+- chart: dev/bdd-spring
+  version: 0.0.1
+  name: bdd-spring
+`
+
+// newClusterRepo creates a bare cluster repository with the helmfile of the staging namespace, returning it and a
+// clone of it to push changes from
+func newClusterRepo(t *testing.T) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	workDir := t.TempDir()
+	origin := filepath.Join(workDir, "cluster.git")
+	git(t, workDir, "init", "--bare", origin)
+	git(t, workDir, "clone", origin, "cluster")
+	dir := filepath.Join(workDir, "cluster")
+	git(t, dir, "config", "user.email", "bdd@jenkins-x.io")
+	git(t, dir, "config", "user.name", "bdd")
+	pushHelmfile(t, dir, stagingHelmfile)
+	return origin, dir
+}
+
+// pushHelmfile commits the helmfile of the staging namespace and pushes it to the cluster repository
+func pushHelmfile(t *testing.T, dir string, content string) {
+	path := gitops.HelmfilePath(dir, "jx-staging")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-m", "chore: promote")
+	git(t, dir, "push", "origin", "HEAD")
+}
+
+func newDevEnvironment(source string) *v1.Environment {
+	return &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: ns},
+		Spec: v1.EnvironmentSpec{
+			Namespace: ns,
+			Source:    v1.EnvironmentRepository{URL: source},
+		},
+	}
+}
+
+// clusterRepoTimeout shortens the time the cluster repository is cloned again for the duration of the test
+func clusterRepoTimeout(t *testing.T, timeout time.Duration) {
+	oldTimeout := helpers.TimeoutPipelineActivityComplete
+	helpers.TimeoutPipelineActivityComplete = timeout
+	t.Cleanup(func() {
+		helpers.TimeoutPipelineActivityComplete = oldTimeout
+	})
+}
+
+// serveGitOverHTTP serves the bare repositories in the directory over http with git http-backend, only to clients
+// using the username and token, returning the URL of the server
+func serveGitOverHTTP(t *testing.T, root string, username string, token string) string {
+	out, err := exec.Command("git", "--exec-path").Output()
+	require.NoError(t, err)
+	backend := filepath.Join(strings.TrimSpace(string(out)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend is not installed")
+	}
+	handler := &cgi.Handler{Path: backend, Env: []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"}}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestCloneClusterRepoDoesNotRecordTheToken(t *testing.T) {
+	origin, _ := newClusterRepo(t)
+	serverURL := serveGitOverHTTP(t, filepath.Dir(origin), "bdd-bot", "b00t-t0k3n")
+	bootSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: gits.BootSecretName, Namespace: gits.BootSecretNamespace},
+		Data:       map[string][]byte{"username": []byte("bdd-bot"), "password": []byte("b00t-t0k3n")},
+	}
+	setup(t, newDevEnvironment(serverURL+"/cluster.git"), bootSecret)
+	clusterRepoTimeout(t, 200*time.Millisecond)
+	git := helpers.Config.Git
+	helpers.Config.Git.Username, helpers.Config.Git.Token, helpers.Config.Git.ForceLocalAuthConfig = "", "", false
+	t.Cleanup(func() {
+		helpers.Config.Git = git
+	})
+
+	var lock sync.Mutex
+	var clones []*transcript.Entry
+	transcript.AddObserver(func(e *transcript.Entry) {
+		lock.Lock()
+		defer lock.Unlock()
+		if e.Command == "git" && strings.Contains(strings.Join(e.Args, " "), serverURL) {
+			clones = append(clones, e)
+		}
+	})
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	require.NoError(t, o.TheClusterRepoDoesNotHaveTheApplication("bdd-gh", "staging"), "the clone should use the token from the boot secret")
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, clones, 1)
+	e := clones[0]
+	assert.Equal(t, 0, e.ExitCode)
+	for _, text := range append(append(e.Args, e.Env...), e.Stdout, e.Stderr) {
+		assert.NotContains(t, text, "b00t-t0k3n")
+	}
+	assert.Contains(t, e.Env, "BDD_GIT_TOKEN=********")
+}
+
+func TestShouldTestClusterRepo(t *testing.T) {
+	setup(t)
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	assert.False(t, o.ShouldTestClusterRepo(), "there is no dev environment")
+
+	setup(t, newDevEnvironment("https://github.com/cb-kubecd/jx3-kubernetes.git"))
+	assert.True(t, o.ShouldTestClusterRepo())
+
+	oldClusterRepoCheck := helpers.Config.Tests.ClusterRepoCheck
+	helpers.Config.Tests.ClusterRepoCheck = false
+	t.Cleanup(func() {
+		helpers.Config.Tests.ClusterRepoCheck = oldClusterRepoCheck
+	})
+	assert.False(t, o.ShouldTestClusterRepo())
+}
+
+func TestTheClusterRepoHasTheApplication(t *testing.T) {
+	origin, _ := newClusterRepo(t)
+	setup(t, newDevEnvironment(origin))
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.TheClusterRepoHasTheApplication("staging", "0.0.1")
+}
+
+func TestTheClusterRepoDoesNotHaveTheApplication(t *testing.T) {
+	origin, dir := newClusterRepo(t)
+	setup(t, newDevEnvironment(origin))
+	clusterRepoTimeout(t, 200*time.Millisecond)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	require.NoError(t, o.TheClusterRepoDoesNotHaveTheApplication("bdd-gh", "staging", "production"))
+
+	err := o.TheClusterRepoDoesNotHaveTheApplication("bdd-spring", "staging", "production")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the release bdd-spring of bdd-spring is still in helmfiles/jx-staging/helmfile.yaml")
+
+	pushHelmfile(t, dir, "namespace: jx-staging\nreleases: []\n")
+	assert.NoError(t, o.TheClusterRepoDoesNotHaveTheApplication("bdd-spring", "staging", "production"))
+}
+
+func TestDeleteApplicationChecksTheClusterRepo(t *testing.T) {
+	deleteSettings(t, true, true)
+	origin, dir := newClusterRepo(t)
+	fake := setup(t, newDevEnvironment(origin))
+	pushHelmfile(t, dir, "namespace: jx-staging\nreleases: []\n")
+	fake.Expect("application", "delete", "--no-source", "--repo", "bdd-spring")
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.RegisterApplicationCleanup("bdd-spring")
+
+	o.DeleteApplication("bdd-spring")
+	assert.Equal(t, []string{"application delete --no-source --repo bdd-spring"}, fake.InvokedArgs())
+	assert.Empty(t, o.Cleanups().Resources(), "the application should not be deleted again after the spec")
+}
+
+func TestRegisterApplicationCleanupDoesNotCheckTheClusterRepo(t *testing.T) {
+	deleteSettings(t, true, true)
+	fake := setup(t)
+	fake.Expect("application", "delete", "--no-source", "--repo", "bdd-spring")
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.RegisterApplicationCleanup("bdd-spring")
+
+	removed := o.CleanupResources()
+	assert.Len(t, removed, 1, "the cleanup after a failed spec only deletes the application")
+}
@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/activities"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+
+	. "github.com/onsi/gomega"
+)
+
+// ShouldTestMergePullRequest should we approve and merge a pull request and check its release is promoted
+func (t *TestOptions) ShouldTestMergePullRequest() bool {
+	return Config.Tests.MergePullRequest
+}
+
+// MergePullRequestAndExpectRelease creates a pull request with a local change, approves it as the approver user and
+// waits for lighthouse keeper to merge it. The release built from the merged commit then has to replace the version
+// running in staging. Unless the teardown check is disabled the pull request has to have a preview before it is
+// approved, which has to be removed once it is merged.
+func (t *TestOptions) MergePullRequestAndExpectRelease(statusCode int) {
+	applicationName := t.GetApplicationName()
+	branch := t.GetDefaultBranch()
+	jobName := t.GetGitOrganisation() + "/" + applicationName + "/" + branch
+
+	var previousVersion string
+	Step(fmt.Sprintf("getting the version of %s running in staging", applicationName), func() {
+		application, err := t.applicationInEnvironment("staging")
+		Expect(err).ShouldNot(HaveOccurred())
+		previousVersion = application.Version
+		utils.LogInfof("version %s of %s is running in staging\n", previousVersion, applicationName)
+	})
+	lastBuild := t.NextBuildNumber(jobName) - 1
+
+	workDir := filepath.Join(t.WorkDir, applicationName)
+	Step(fmt.Sprintf("checking out the latest %s in directory %s", branch, workDir), func() {
+		t.ExpectCommandExecution(workDir, TimeoutCmdLine, 0, "git", "checkout", branch)
+		t.ExpectCommandExecution(workDir, TimeoutCmdLine, 0, "git", "pull", "origin", branch)
+	})
+
+	prTitle := "chore: change the readme to release a new version"
+	created := t.CreatePullRequestWithLocalChange(prTitle, func(workDir string) {
+		fileName := "README.md"
+		readme := filepath.Join(workDir, fileName)
+		f, err := os.OpenFile(readme, os.O_APPEND|os.O_CREATE|os.O_WRONLY, files.DefaultFileWritePermissions)
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = fmt.Fprintf(f, "\n%s\n", prTitle)
+		Expect(f.Close()).Should(Succeed())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		t.ExpectCommandExecution(workDir, TimeoutCmdLine, 0, "git", "add", fileName)
+	})
+
+	provider, err := t.GetGitProvider()
+	Expect(err).ShouldNot(HaveOccurred())
+	approverProvider, err := t.GetApproverGitProvider()
+	Expect(err).ShouldNot(HaveOccurred())
+
+	pr, err := provider.GetPullRequest(created.Owner, created.Repository, created.PullRequestNumber)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	// the preview is found before merging so that a preview which is never created fails rather than looks removed
+	var preview *previews.Preview
+	if t.ShouldTestPreviewTeardown() {
+		preview = t.WaitForPreview(created)
+	}
+	t.Phase(PhasePullRequestMerge, func() {
+		Step(fmt.Sprintf("approving %s as %s", created.Url, approverProvider.CurrentUsername()), func() {
+			err := t.ApprovePullRequest(provider, approverProvider, pr)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		Step(fmt.Sprintf("waiting for lighthouse keeper to merge %s", created.Url), func() {
+			t.WaitForPullRequestToMerge(provider, created.Owner, created.Repository, created.PullRequestNumber, created.Url)
+		})
+	})
+	merged, err := provider.GetPullRequest(created.Owner, created.Repository, created.PullRequestNumber)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	var buildNumber int
+	Step(fmt.Sprintf("waiting for the release build of %s after #%d", jobName, lastBuild), func() {
+		buildNumber = t.ThereShouldBeAJobAfterBuildThatCompletesSuccessfully(jobName, lastBuild, TimeoutBuildCompletes)
+	})
+	version := t.expectReleaseOfMergedCommit(jobName, buildNumber, merged)
+
+	checkVersion := NotVersion(previousVersion)
+	if version != "" {
+		checkVersion = ExactVersion(version)
+	}
+	Step(fmt.Sprintf("verifying that staging moves from version %s to the new release", previousVersion), func() {
+		t.TheApplicationVersionIsRunning(statusCode, "staging", checkVersion)
+	})
+
+	if preview != nil {
+		t.ExpectPreviewRemoved(preview)
+	}
+}
+
+// expectReleaseOfMergedCommit asserts that the release build was built from the merge commit of the pull request,
+// when both are known, and returns the version it released, if any
+func (t *TestOptions) expectReleaseOfMergedCommit(jobName string, buildNumber int, merged *gits.PullRequest) string {
+	job, err := activities.ParseJob(jobName)
+	Expect(err).ShouldNot(HaveOccurred())
+	activity, err := activities.NewWatcher(JXClient, Namespace).Build(context.TODO(), job, buildNumber)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(activity).ShouldNot(BeNil(), "no PipelineActivity for build #%d of %s", buildNumber, jobName)
+
+	sha := activity.Spec.LastCommitSHA
+	if merged.MergeSha != "" && sha != "" {
+		Step(fmt.Sprintf("checking that %s #%d was built from the merge commit %s", jobName, buildNumber, merged.MergeSha), func() {
+			Expect(sha).Should(Equal(merged.MergeSha), "the release should be built from the merged pull request")
+		})
+	}
+	return activity.Spec.Version
+}
+
+// applicationInEnvironment returns the application reported by jx get applications in the environment
+func (t *TestOptions) applicationInEnvironment(environment string) (*parsers.Application, error) {
+	args := []string{"get", "applications", "-e", environment}
+	r := runner.New(t.WorkDir, nil, 0)
+	out, err := RunJxWithStructuredOutput(r, args...)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := parsers.ParseApplications(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the output of jx %s: %w", strings.Join(args, " "), err)
+	}
+	return getApplication(t.GetApplicationName(), applications)
+}
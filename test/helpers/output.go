@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+)
+
+// unstructuredOutputCommands remembers the jx commands which do not support -o json/-o yaml so we only try once
+var unstructuredOutputCommands sync.Map
+
+// RunJxWithStructuredOutput runs the given jx command preferring the structured output format defined by
+// BDD_JX_OUTPUT_FORMAT. If the jx version in use rejects the output flag of the command, or prints a table anyway, then
+// the command is run again with the default table output, as it is for the rest of the run. Any other failure is
+// returned as it is and empty output is returned as an empty list. The output can be parsed by the format detecting
+// parsers, such as parsers.ParseApplications.
+func RunJxWithStructuredOutput(r *runner.JxRunner, args ...string) (string, error) {
+	format := parsers.OutputFormat(strings.ToLower(Config.JxOutputFormat))
+	command := jxCommandName(args)
+	if format == parsers.OutputFormatTable {
+		return r.RunWithOutput(args...)
+	}
+	if _, unsupported := unstructuredOutputCommands.Load(command); unsupported {
+		return r.RunWithOutput(args...)
+	}
+	structuredArgs := append(append([]string{}, args...), "-o", string(format))
+	out, err := r.RunWithOutput(structuredArgs...)
+	switch {
+	case err != nil:
+		if !rejectsOutputFlag(err.Error()) {
+			return "", err
+		}
+	case strings.TrimSpace(out) == "":
+		return "[]", nil
+	case parsers.DetectOutputFormat(out) != parsers.OutputFormatTable:
+		return out, nil
+	}
+	utils.LogInfof("jx %s does not support -o %s so falling back to table output\n", command, format)
+	unstructuredOutputCommands.Store(command, true)
+	return r.RunWithOutput(args...)
+}
+
+// rejectsOutputFlag returns true if the output of a failed jx command shows it does not have the -o flag
+func rejectsOutputFlag(output string) bool {
+	for _, message := range []string{"unknown shorthand flag", "unknown flag", "flag provided but not defined"} {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// jxCommandName returns the sub command of the given arguments without any flags
+func jxCommandName(args []string) string {
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		names = append(names, arg)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,40 @@
+package helpers_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJxWithStructuredOutputReturnsOtherFailures(t *testing.T) {
+	fake := setup(t)
+	fake.Expect("get", "previews", "-o", "json").Fails(1, "error: failed to list previews: connection refused").Once()
+	fake.Expect("get", "previews", "-o", "json")
+	r := runner.New(t.TempDir(), nil, 0)
+
+	_, err := helpers.RunJxWithStructuredOutput(r, "get", "previews")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	out, err := helpers.RunJxWithStructuredOutput(r, "get", "previews")
+	require.NoError(t, err)
+	assert.Equal(t, "[]", out, "empty output should be an empty list")
+	assert.Equal(t, []string{"get previews -o json", "get previews -o json"}, fake.InvokedArgs(), "a failure should not stop using -o json")
+}
+
+func TestRunJxWithStructuredOutputFallsBackToTables(t *testing.T) {
+	fake := setup(t)
+	fake.Expect("get", "environments", "-o", "json").Fails(1, "Error: unknown shorthand flag: 'o' in -o")
+	fake.Expect("get", "environments").Returns("NAME    KIND\nstaging Permanent")
+	r := runner.New(t.TempDir(), nil, 0)
+
+	for i := 0; i < 2; i++ {
+		out, err := helpers.RunJxWithStructuredOutput(r, "get", "environments")
+		require.NoError(t, err)
+		assert.Equal(t, "NAME    KIND\nstaging Permanent", out)
+	}
+	assert.Equal(t, []string{"get environments -o json", "get environments", "get environments"}, fake.InvokedArgs(), "-o json should only be tried once")
+}
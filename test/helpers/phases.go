@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+)
+
+// the phases of the Jenkins X workflow whose durations are exported as metrics
+const (
+	// PhaseQuickstartCreation is creating the application from a quickstart or with jx project
+	PhaseQuickstartCreation = "quickstart_creation"
+	// PhaseFirstReleaseBuild is the first release build of the application completing
+	PhaseFirstReleaseBuild = "first_release_build"
+	// PhaseStagingPromotion is the application being promoted to staging until its URL works
+	PhaseStagingPromotion = "staging_promotion"
+	// PhasePullRequestBuild is the build of a pull request on the application completing
+	PhasePullRequestBuild = "pull_request_build"
+	// PhasePreviewURLAvailable is the preview environment of a pull request being created until its URL works
+	PhasePreviewURLAvailable = "preview_url_available"
+	// PhasePullRequestMerge is a pull request being approved until lighthouse keeper merges it
+	PhasePullRequestMerge = "pull_request_merge"
+	// PhasePreviewRemoved is the preview environment of a closed or merged pull request being garbage collected
+	PhasePreviewRemoved = "preview_removed"
+	// PhaseProductionPromotion is the application being promoted to production until its URL works
+	PhaseProductionPromotion = "production_promotion"
+)
+
+// environmentPhases are the phases of promoting an application to each environment
+var environmentPhases = map[string]string{
+	"staging":    PhaseStagingPromotion,
+	"production": PhaseProductionPromotion,
+}
+
+// Phase runs the body as a phase of the Jenkins X workflow, recording how long it took labelled by the quickstart
+// and git kind. Phases are not nested so a phase which is already running, such as the promotion to production
+// waiting for the application to be running in production, is only recorded once.
+func (t *TestOptions) Phase(name string, body func()) {
+	end := reports.BeginPhase(name, map[string]string{
+		"quickstart": t.Quickstart,
+		"git_kind":   Config.Git.Kind,
+	})
+	failed := true
+	defer func() {
+		end(failed)
+	}()
+	body()
+	failed = false
+}
@@ -0,0 +1,99 @@
+package helpers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordSpec records the phases of a spec with a new recorder
+func recordSpec(t *testing.T) *reports.Recorder {
+	r := reports.NewRecorder("create_quickstarts", 0)
+	reports.SetCurrent(r)
+	t.Cleanup(func() {
+		reports.SetCurrent(nil)
+	})
+	r.StartSpec("quickstart node-http creates a new source repository and promotes it to staging", "")
+	return r
+}
+
+func TestPhasesOfTheFirstRelease(t *testing.T) {
+	fake := setup(t,
+		newActivity("bdd-nh", "master", "1", v1.ActivityStatusTypeSucceeded),
+		newDeployment("jx-staging", "bdd-nh", "0.0.1"),
+	)
+	server := newApplicationServer(t)
+	jobName := owner + "/bdd-nh/master"
+	fake.Expect("get", "build", "logs", "--wait", jobName)
+	fake.Expect("get", "applications", "-e", "staging", "-o", "json").
+		Returns(`[{"name": "bdd-nh", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`)
+	r := recordSpec(t)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-nh", WorkDir: t.TempDir(), Quickstart: "node-http"}
+	o.TheFirstReleaseShouldCompleteSuccessfully(jobName, helpers.TimeoutBuildCompletes)
+	o.Phase(helpers.PhaseStagingPromotion, func() {
+		// the phase is already running so it is only recorded once
+		o.TheApplicationIsRunningInStaging(http.StatusOK)
+	})
+	r.EndSpec(reports.StatePassed, nil)
+
+	phases := r.Result().Phases
+	require.Len(t, phases, 2)
+	assert.Equal(t, helpers.PhaseFirstReleaseBuild, phases[0].Name)
+	assert.Equal(t, map[string]string{"quickstart": "node-http", "git_kind": helpers.Config.Git.Kind}, phases[0].Labels)
+	assert.Equal(t, helpers.PhaseStagingPromotion, phases[1].Name)
+	assert.False(t, phases[1].Failed)
+}
+
+func TestOtherReleaseBuildsAreNotTheFirstRelease(t *testing.T) {
+	fake := setup(t, newActivity("bdd-nh", "master", "1", v1.ActivityStatusTypeSucceeded))
+	jobName := owner + "/bdd-nh/master"
+	fake.Expect("get", "build", "logs", "--wait", jobName)
+	r := recordSpec(t)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-nh", WorkDir: t.TempDir(), Quickstart: "node-http"}
+	o.ThereShouldBeAJobThatCompletesSuccessfully(jobName, helpers.TimeoutBuildCompletes)
+	r.EndSpec(reports.StatePassed, nil)
+
+	assert.Empty(t, r.Result().Phases)
+}
+
+func TestPushMetrics(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	oldMetrics := helpers.Config.Metrics
+	helpers.Config.Metrics.PushURL = server.URL
+	t.Cleanup(func() {
+		helpers.Config.Metrics = oldMetrics
+	})
+	parallelNode(t, 2, 3)
+
+	dir := t.TempDir()
+	r := helpers.NewResultReporter(dir, "create_quickstarts", []string{"openmetrics"})
+	r.SpecSuiteWillBegin(ginkgoconfig.GinkgoConfig, &types.SuiteSummary{})
+	r.SpecWillRun(&types.SpecSummary{ComponentTexts: []string{"[Top Level]", "quickstart node-http"}})
+	o := &helpers.TestOptions{Quickstart: "node-http"}
+	o.Phase(helpers.PhaseQuickstartCreation, func() {})
+	r.SpecDidComplete(&types.SpecSummary{State: types.SpecStatePassed})
+	r.SpecSuiteDidEnd(&types.SuiteSummary{})
+
+	assert.Equal(t, "/metrics/job/bdd-jx3/node/2/suite/create_quickstarts", path)
+	assert.Contains(t, body, `bdd_phase_duration_seconds{git_kind="`+helpers.Config.Git.Kind+`",phase="quickstart_creation",quickstart="node-http",result="succeeded"} `)
+	assert.FileExists(t, filepath.Join(dir, "create_quickstarts.2.metrics.txt"))
+}
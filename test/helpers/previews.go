@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	"github.com/jenkins-x/go-scm/scm"
+
+	. "github.com/onsi/gomega"
+)
+
+// usePreviewResources returns true if the previews are looked up as jx-preview Preview resources rather than by
+// parsing jx get previews, which is still used when replaying commands or without a dynamic client
+func usePreviewResources() bool {
+	return DynamicClient != nil && Config.Transcript.Replay == ""
+}
+
+// ShouldTestPreviewTeardown should we close the pull request once its preview works and check that the preview is
+// garbage collected
+func (t *TestOptions) ShouldTestPreviewTeardown() bool {
+	if !Config.Tests.PreviewTeardownCheck {
+		return false
+	}
+	if !usePreviewResources() {
+		utils.LogInfof("not checking the preview is removed as the Preview resources cannot be looked up\n")
+		return false
+	}
+	return true
+}
+
+// PreviewForPullRequest returns the jx-preview Preview resource of the pull request or nil if there is none yet
+func (t *TestOptions) PreviewForPullRequest(pr *parsers.CreatePullRequest) (*previews.Preview, error) {
+	return previews.Find(context.TODO(), DynamicClient, Namespace, pr.Owner, pr.Repository, pr.PullRequestNumber)
+}
+
+// WaitForPreview waits for the pipeline of the pull request to create its jx-preview Preview resource, failing if
+// there is none within BDD_TIMEOUT_PREVIEW_URL_RETURNS, and registers the preview namespace to be removed
+func (t *TestOptions) WaitForPreview(pr *parsers.CreatePullRequest) *previews.Preview {
+	var preview *previews.Preview
+	Step(fmt.Sprintf("waiting for the preview of %s", pr.Url), func() {
+		var err error
+		preview, err = Retry(TimeoutPreviewUrlReturns, func() (*previews.Preview, error) {
+			p, err := t.PreviewForPullRequest(pr)
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				return nil, fmt.Errorf("no Preview resource for %s in namespace %s", pr.Url, Namespace)
+			}
+			return p, nil
+		})
+		Expect(err).ShouldNot(HaveOccurred(), "the pull request should have a preview")
+	})
+	t.RegisterPreviewCleanup(preview.PreviewNamespace)
+	return preview
+}
+
+// ClosePullRequestAndExpectPreviewRemoved closes the pull request as the pipeline user and asserts that its preview
+// environment is garbage collected
+func (t *TestOptions) ClosePullRequestAndExpectPreviewRemoved(pr *parsers.CreatePullRequest) {
+	var preview *previews.Preview
+	Step(fmt.Sprintf("finding the preview of %s", pr.Url), func() {
+		var err error
+		preview, err = t.PreviewForPullRequest(pr)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(preview).ShouldNot(BeNil(), "no Preview resource for %s", pr.Url)
+	})
+	Step(fmt.Sprintf("closing %s", pr.Url), func() {
+		provider, err := t.GetGitProvider()
+		Expect(err).ShouldNot(HaveOccurred())
+		err = provider.ClosePullRequest(&gits.PullRequest{
+			PullRequest: &scm.PullRequest{Number: pr.PullRequestNumber},
+			Owner:       pr.Owner,
+			Repo:        pr.Repository,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	t.ExpectPreviewRemoved(preview)
+}
+
+// ExpectPreviewRemoved asserts that the Preview resource, the preview namespace and the helm releases in it are
+// garbage collected within BDD_TIMEOUT_PREVIEW_REMOVED, once the pull request of the preview is merged or closed
+func (t *TestOptions) ExpectPreviewRemoved(preview *previews.Preview) {
+	t.Phase(PhasePreviewRemoved, func() {
+		Step(fmt.Sprintf("verifying that the preview of %s in namespace %s is removed", preview.PullRequestURL, preview.PreviewNamespace), func() {
+			err := previews.WaitForRemoval(context.TODO(), DynamicClient, KubeClient, preview, TimeoutPreviewRemoved)
+			Expect(err).ShouldNot(HaveOccurred(), "the preview of a closed pull request should be garbage collected")
+		})
+	})
+}
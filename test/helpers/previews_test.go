@@ -0,0 +1,202 @@
+package helpers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// previewClient sets up a fake dynamic client with the Preview resources for the duration of the test
+func previewClient(t *testing.T, objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{previews.GroupVersionResource: "PreviewList"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+	oldDynamicClient, oldPollInterval, oldTimeout := helpers.DynamicClient, previews.PollInterval, helpers.TimeoutPreviewRemoved
+	helpers.DynamicClient, previews.PollInterval, helpers.TimeoutPreviewRemoved = dynamicClient, 10*time.Millisecond, 10*time.Second
+	t.Cleanup(func() {
+		helpers.DynamicClient, previews.PollInterval, helpers.TimeoutPreviewRemoved = oldDynamicClient, oldPollInterval, oldTimeout
+	})
+	return dynamicClient
+}
+
+func newPreview(repo string, number int64, previewNamespace string, url string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "preview.jenkins.io/v1alpha1",
+		"kind":       "Preview",
+		"metadata": map[string]interface{}{
+			"name":      previewNamespace,
+			"namespace": ns,
+		},
+		"spec": map[string]interface{}{
+			"pullRequest": map[string]interface{}{
+				"number":     number,
+				"owner":      owner,
+				"repository": repo,
+				"url":        "https://github.com/" + owner + "/" + repo + "/pull/1",
+			},
+			"resources": map[string]interface{}{
+				"namespace": previewNamespace,
+				"url":       url,
+			},
+		},
+	}}
+}
+
+// gitServer sets up a GitHub API server for the duration of the test whose handler is called when a pull request is
+// closed
+func gitServer(t *testing.T, onClose func(path string)) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			http.NotFound(w, r)
+			return
+		}
+		onClose(r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"number": 1, "state": "closed"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	git := helpers.Config.Git
+	helpers.Config.Git.ProviderURL, helpers.Config.Git.Username, helpers.Config.Git.Token = server.URL, "bdd-bot", "secret"
+	t.Cleanup(func() {
+		helpers.Config.Git = git
+	})
+}
+
+func TestCreatePullRequestClosesItAndExpectsThePreviewRemoved(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	const app = "bdd-nh"
+	previewNamespace := "jx-" + owner + "-" + app + "-pr-1"
+	fake := setup(t,
+		newActivity(app, "PR-1", "1", v1.ActivityStatusTypeSucceeded),
+		newDeployment(previewNamespace, app, "0.0.0-SNAPSHOT-PR-1-1"),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: previewNamespace}},
+	)
+	server := newApplicationServer(t)
+	dynamicClient := previewClient(t,
+		newPreview("bdd-gh", 1, "jx-"+owner+"-bdd-gh-pr-1", "http://bdd-gh.example.com"),
+		newPreview(app, 1, previewNamespace, server.URL),
+	)
+
+	var mutex sync.Mutex
+	var closed []string
+	gitServer(t, func(path string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		closed = append(closed, path)
+
+		// the preview gc removes the preview of the closed pull request
+		ctx := context.TODO()
+		_ = dynamicClient.Resource(previews.GroupVersionResource).Namespace(ns).Delete(ctx, previewNamespace, metav1.DeleteOptions{})
+		_ = helpers.KubeClient.CoreV1().Namespaces().Delete(ctx, previewNamespace, metav1.DeleteOptions{})
+	})
+
+	oldPipelineActivityCheck := helpers.Config.Tests.PipelineActivityCheck
+	helpers.Config.Tests.PipelineActivityCheck = false
+	t.Cleanup(func() {
+		helpers.Config.Tests.PipelineActivityCheck = oldPipelineActivityCheck
+	})
+
+	workDir := newApplicationRepo(t, app)
+	fake.Expect("create", "pullrequest", "-b", "--title", "My First PR commit", "--body", "PR comments").
+		Returns("https://github.com/" + owner + "/" + app + "/pull/1")
+	fake.Expect("get", "build", "logs", "--wait", owner+"/"+app+"/PR-1")
+
+	o := &helpers.TestOptions{ApplicationName: app, WorkDir: workDir}
+	require.True(t, o.ShouldTestPreviewTeardown())
+	err := o.CreatePullRequestAndGetPreviewEnvironment(http.StatusOK)
+	require.NoError(t, err)
+
+	assert.NotContains(t, fake.InvokedArgs(), "get previews -o json", "the preview should be found from its Preview resource")
+	var branches []string
+	for _, r := range o.Cleanups().Resources() {
+		if r.Kind == helpers.ResourceBranch {
+			branches = append(branches, r.Name)
+		}
+	}
+	assert.Equal(t, []string{"changes-" + app + "-1"}, branches, "the branch should be named after the application so transcripts can be replayed")
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"/api/v3/repos/" + owner + "/" + app + "/pulls/1"}, closed)
+}
+
+func TestWaitForPreview(t *testing.T) {
+	const app = "bdd-nh"
+	previewNamespace := "jx-" + owner + "-" + app + "-pr-1"
+	setup(t)
+	dynamicClient := previewClient(t)
+	oldTimeout := helpers.TimeoutPreviewUrlReturns
+	helpers.TimeoutPreviewUrlReturns = 5 * time.Second
+	t.Cleanup(func() {
+		helpers.TimeoutPreviewUrlReturns = oldTimeout
+	})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		preview := newPreview(app, 1, previewNamespace, "http://bdd-nh.example.com")
+		_, _ = dynamicClient.Resource(previews.GroupVersionResource).Namespace(ns).Create(context.TODO(), preview, metav1.CreateOptions{})
+	}()
+
+	o := &helpers.TestOptions{ApplicationName: app}
+	pr := &parsers.CreatePullRequest{Owner: owner, Repository: app, PullRequestNumber: 1, Url: "https://github.com/" + owner + "/" + app + "/pull/1"}
+	preview := o.WaitForPreview(pr)
+	assert.Equal(t, previewNamespace, preview.PreviewNamespace)
+
+	resources := o.Cleanups().Resources()
+	require.Len(t, resources, 1)
+	assert.Equal(t, helpers.ResourcePreview, resources[0].Kind)
+	assert.Equal(t, previewNamespace, resources[0].Name)
+}
+
+func TestWaitForPreviewFailsWithoutPreview(t *testing.T) {
+	setup(t)
+	previewClient(t)
+	oldTimeout := helpers.TimeoutPreviewUrlReturns
+	helpers.TimeoutPreviewUrlReturns = 500 * time.Millisecond
+	t.Cleanup(func() {
+		helpers.TimeoutPreviewUrlReturns = oldTimeout
+	})
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-nh"}
+	pr := &parsers.CreatePullRequest{Owner: owner, Repository: "bdd-nh", PullRequestNumber: 1, Url: "https://github.com/" + owner + "/bdd-nh/pull/1"}
+	err := gomega.InterceptGomegaFailure(func() {
+		o.WaitForPreview(pr)
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the pull request should have a preview")
+	assert.Empty(t, o.Cleanups().Resources())
+}
+
+func TestShouldTestPreviewTeardown(t *testing.T) {
+	setup(t)
+	o := &helpers.TestOptions{ApplicationName: "bdd-nh"}
+	assert.False(t, o.ShouldTestPreviewTeardown(), "there is no dynamic client")
+
+	previewClient(t)
+	assert.True(t, o.ShouldTestPreviewTeardown())
+
+	oldPreviewTeardownCheck := helpers.Config.Tests.PreviewTeardownCheck
+	helpers.Config.Tests.PreviewTeardownCheck = false
+	t.Cleanup(func() {
+		helpers.Config.Tests.PreviewTeardownCheck = oldPreviewTeardownCheck
+	})
+	assert.False(t, o.ShouldTestPreviewTeardown())
+}
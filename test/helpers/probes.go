@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/probe"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+)
+
+// ContentCheck is a request to a deployed application checking that it serves its content rather than an error page
+type ContentCheck struct {
+	// Path is appended to the URL of the application, such as /actuator/health
+	Path     string
+	Matchers []probe.Matcher
+}
+
+var (
+	// springErrorPage is the page spring boot returns for any error, such as a 404 for a path without a controller
+	springErrorPage = probe.BodyNotContains("Whitelabel Error Page")
+
+	// SpringActuatorHealth checks the health endpoint of a spring boot application with the actuator dependency
+	SpringActuatorHealth = &ContentCheck{
+		Path: "/actuator/health",
+		Matchers: []probe.Matcher{
+			probe.Status(200),
+			probe.Header("Content-Type", "json"),
+			probe.JSONPath("status", "UP"),
+		},
+	}
+
+	// QuickstartContent are the content checks of the quickstarts keyed by the name of the quickstart
+	QuickstartContent = map[string]*ContentCheck{
+		"golang-http": {
+			Matchers: []probe.Matcher{probe.BodyContains("Hello from:  Jenkins X golang http example")},
+		},
+		"node-http": {
+			Matchers: []probe.Matcher{probe.Header("Content-Type", "text/html"), probe.BodyMatches("(?i)<html")},
+		},
+		"spring-boot-http-gradle": {
+			Matchers: []probe.Matcher{springErrorPage},
+		},
+		"spring-boot-rest-prometheus-java11": {
+			Matchers: []probe.Matcher{springErrorPage},
+		},
+	}
+)
+
+// urlProbe requests the URLs of the deployed applications, reusing its connections between retries
+var urlProbe *probe.Probe
+
+// newURLProbe creates the probe of the URLs of the deployed applications from the configuration
+func newURLProbe() *probe.Probe {
+	o := probe.Options{
+		Timeout:            Config.Probe.RequestTimeout.Duration(),
+		InsecureSkipVerify: Config.URLInsecureSkipVerify,
+		BearerToken:        Config.Probe.BearerToken,
+	}
+	if Config.Probe.BasicAuth {
+		o.Username = Config.Probe.Username
+		o.Password = Config.Probe.Password
+	}
+	return probe.New(o)
+}
+
+func getURLProbe() *probe.Probe {
+	if urlProbe == nil {
+		urlProbe = newURLProbe()
+	}
+	return urlProbe
+}
+
+// ExpectUrlReturns expects that the given URL returns the given status code within the given time period
+func (t *TestOptions) ExpectUrlReturns(url string, expectedStatusCode int, maxDuration time.Duration) error {
+	return t.ExpectUrl(url, maxDuration, probe.Status(expectedStatusCode))
+}
+
+// ExpectUrl expects that the given URL returns a response satisfying all the matchers within the given time period.
+// The status code and the start of the body are logged whenever the status code changes and when the time is up.
+func (t *TestOptions) ExpectUrl(url string, maxDuration time.Duration, matchers ...probe.Matcher) error {
+	lastLoggedStatus := -1
+	f := func() (any, error) {
+		response, err := getURLProbe().Check(context.TODO(), url, matchers...)
+		if response != nil && response.StatusCode != lastLoggedStatus {
+			lastLoggedStatus = response.StatusCode
+			utils.LogInfof("Invoked %s and got return code: %s %s\n", termcolor.ColorInfo(url), termcolor.ColorInfo(strconv.Itoa(response.StatusCode)), response.Snippet())
+		}
+		return nil, err
+	}
+	err := RetryExponentialBackoff(maxDuration, f)
+	if err != nil {
+		var mismatch *probe.MismatchError
+		if errors.As(err, &mismatch) {
+			utils.LogInfof("WARNING: %s\n", err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// ContentCheck returns the check of the content of the application, which defaults to the one of its quickstart
+func (t *TestOptions) ContentCheck() *ContentCheck {
+	if t.Content != nil {
+		return t.Content
+	}
+	return QuickstartContent[t.Quickstart]
+}
+
+// expectApplicationServes expects that the application at the URL returns the status code then that it serves its
+// content, if there is a ContentCheck for it
+func (t *TestOptions) expectApplicationServes(url string, statusCode int, maxDuration time.Duration) error {
+	err := t.ExpectUrlReturns(url, statusCode, maxDuration)
+	if err != nil {
+		return err
+	}
+	check := t.ContentCheck()
+	if check == nil {
+		return nil
+	}
+	contentURL := strings.TrimSuffix(url, "/") + check.Path
+	err = t.ExpectUrl(contentURL, maxDuration, check.Matchers...)
+	if err != nil {
+		return fmt.Errorf("the application at %s does not serve its content: %w", url, err)
+	}
+	return nil
+}
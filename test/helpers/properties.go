@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/homedir"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+)
+
+// setReportProperties adds the environment the suite runs in to the properties of the reports
+func setReportProperties(state *suiteState) {
+	reports.SetProperty("jx.version", state.JxVersion)
+	names := make([]string, 0, len(state.Plugins))
+	for name := range state.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reports.SetProperty("plugin."+name, state.Plugins[name])
+	}
+	reports.SetProperty("git.kind", Config.Git.Kind)
+	reports.SetProperty("git.providerURL", Config.Git.ProviderURL)
+	reports.SetProperty("cluster", state.Cluster)
+	for _, s := range Config.Settings() {
+		if strings.HasPrefix(s.Name, "timeouts.") {
+			reports.SetProperty(s.Name, s.Value())
+		}
+	}
+}
+
+// currentCluster returns the cluster of the current kubernetes context, which is blank when running inside a pod
+func currentCluster() string {
+	config, _, err := kube.LoadConfig()
+	if err != nil {
+		utils.LogInfof("WARNING: failed to load the kubernetes config: %s\n", err.Error())
+		return ""
+	}
+	return kube.Cluster(config)
+}
+
+// pluginBinDir returns the directory jx installs its plugins into
+func pluginBinDir() string {
+	dir := os.Getenv("JX3_HOME")
+	if dir == "" {
+		dir = filepath.Join(homedir.HomeDir(), ".jx3")
+	}
+	return filepath.Join(dir, "plugins", "bin")
+}
+
+// pluginVersions returns the versions of the plugins in the given directory keyed by name. jx installs each version
+// of a plugin as a binary named after the plugin and the version, such as jx-gitops-0.7.20, so the newest version
+// wins when there is more than one.
+func pluginVersions(dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			utils.LogInfof("WARNING: failed to read the jx plugins from %s: %s\n", dir, err.Error())
+		}
+		return nil
+	}
+	answer := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name, version := splitPluginVersion(e.Name())
+		if version == "" {
+			continue
+		}
+		if current, ok := answer[name]; !ok || compareVersions(version, current) > 0 {
+			answer[name] = version
+		}
+	}
+	return answer
+}
+
+// splitPluginVersion splits the name of a plugin binary such as jx-gitops-0.7.20 into the plugin and its version
+func splitPluginVersion(file string) (string, string) {
+	file = strings.TrimSuffix(file, ".exe")
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '-' && i+1 < len(file) && unicode.IsDigit(rune(file[i+1])) {
+			return file[:i], file[i+1:]
+		}
+	}
+	return file, ""
+}
+
+// compareVersions compares the dot separated numeric parts of two versions, falling back to comparing the text
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		if len(as[i]) != len(bs[i]) && isDigits(as[i]) && isDigits(bs[i]) {
+			return len(as[i]) - len(bs[i])
+		}
+		return strings.Compare(as[i], bs[i])
+	}
+	return len(as) - len(bs)
+}
+
+func isDigits(text string) bool {
+	for _, r := range text {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return text != ""
+}
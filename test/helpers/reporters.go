@@ -0,0 +1,243 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+
+	. "github.com/onsi/ginkgo"
+)
+
+// resultWriters write the result of a suite in each of the formats
+var resultWriters = map[string]func(w io.Writer, result *reports.Result) error{
+	"junit": reports.WriteJUnit,
+	"json":  reports.WriteJSON,
+	"html":  reports.WriteHTML,
+	"tap":   reports.WriteTAP,
+	// the durations of the phases of the Jenkins X workflow
+	"openmetrics": reports.WriteOpenMetrics,
+}
+
+// resultExtensions are the extensions of the files of the formats which are not named after the format
+var resultExtensions = map[string]string{
+	"junit":       "junit.xml",
+	"openmetrics": "metrics.txt",
+}
+
+var observeCommands sync.Once
+
+// Step runs the body as a step of the spec, like By, recording when it started and how long it took for the JSON,
+// HTML and TAP reports along with the jx and kubectl commands it ran. A step without a body lasts until the next step.
+func Step(text string, body ...func()) {
+	if len(body) == 0 {
+		reports.BeginStep(text, false)
+		By(text)
+		return
+	}
+	end := reports.BeginStep(text, true)
+	failed := true
+	defer func() {
+		end(failed)
+	}()
+	By(text, body...)
+	failed = false
+}
+
+// reportFile returns the path of a report of the suite, which is specific to the ginkgo node when running in parallel
+func reportFile(reportsDir string, suiteId string, extension string) string {
+	name := fmt.Sprintf("%s.%s", suiteId, extension)
+	if ginkgoconfig.GinkgoConfig.ParallelTotal > 1 {
+		// each parallel node reports its own specs
+		name = fmt.Sprintf("%s.%d.%s", suiteId, ginkgoconfig.GinkgoConfig.ParallelNode, extension)
+	}
+	return filepath.Join(reportsDir, name)
+}
+
+// ResultReporter is a ginkgo reporter which records the steps and commands of each spec and writes the result of
+// the suite in the given formats when it ends
+type ResultReporter struct {
+	recorder *reports.Recorder
+	// files are the files the result is written to keyed by format
+	files map[string]string
+}
+
+// NewResultReporter creates a reporter writing the result of the suite into the reports directory in each of the
+// given formats
+func NewResultReporter(reportsDir string, suiteId string, formats []string) *ResultReporter {
+	r := &ResultReporter{
+		recorder: reports.NewRecorder(suiteId, ginkgoconfig.GinkgoConfig.ParallelNode),
+		files:    map[string]string{},
+	}
+	for _, format := range formats {
+		if resultWriters[format] != nil {
+			extension := resultExtensions[format]
+			if extension == "" {
+				extension = format
+			}
+			r.files[format] = reportFile(reportsDir, suiteId, extension)
+		}
+	}
+	return r
+}
+
+// Recorder returns the recorder of the result
+func (r *ResultReporter) Recorder() *reports.Recorder {
+	return r.recorder
+}
+
+func (r *ResultReporter) SpecSuiteWillBegin(config ginkgoconfig.GinkgoConfigType, summary *types.SuiteSummary) {
+	r.recorder.SetDescription(summary.SuiteDescription)
+	reports.SetCurrent(r.recorder)
+	observeCommands.Do(func() {
+		transcript.AddObserver(func(e *transcript.Entry) {
+			reports.AddCommand(&reports.Command{
+				Command:  e.Command,
+				Args:     e.Args,
+				ExitCode: e.ExitCode,
+				Start:    e.Start,
+				Duration: e.Duration,
+			})
+		})
+	})
+}
+
+func (r *ResultReporter) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {
+	r.recordSetup("BeforeSuite", setupSummary)
+}
+
+func (r *ResultReporter) SpecWillRun(specSummary *types.SpecSummary) {
+	location := ""
+	if n := len(specSummary.ComponentCodeLocations); n > 0 {
+		location = specSummary.ComponentCodeLocations[n-1].String()
+	}
+	name := specName(specSummary.ComponentTexts)
+	if r.recorder.RetrySpec(name, location) {
+		retrySpec(name, r.recorder.Attempt())
+		return
+	}
+	r.recorder.StartSpec(name, location)
+}
+
+func (r *ResultReporter) SpecDidComplete(specSummary *types.SpecSummary) {
+	r.recorder.SetOutput(specSummary.CapturedOutput)
+	r.recorder.EndSpec(specState(specSummary.State), specFailure(specSummary.State, specSummary.Failure))
+}
+
+func (r *ResultReporter) AfterSuiteDidRun(setupSummary *types.SetupSummary) {
+	r.recordSetup("AfterSuite", setupSummary)
+}
+
+func (r *ResultReporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	r.recorder.End()
+	reports.SetCurrent(nil)
+	err := r.WriteFiles()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+	err = r.PushMetrics()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+}
+
+// WriteFiles writes the result in each of the formats
+func (r *ResultReporter) WriteFiles() error {
+	result := r.recorder.Result()
+	var errs []error
+	for format, path := range r.files {
+		f, err := os.Create(path)
+		if err == nil {
+			err = resultWriters[format](f, result)
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to write the %s report %s: %w", format, path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PushMetrics pushes the phase durations to the pushgateway if one is configured, grouped by the suite and the
+// ginkgo node when running in parallel
+func (r *ResultReporter) PushMetrics() error {
+	pushURL := Config.Metrics.PushURL
+	result := r.recorder.Result()
+	if pushURL == "" || len(result.Phases) == 0 {
+		return nil
+	}
+	grouping := map[string]string{"suite": result.Suite}
+	if ginkgoconfig.GinkgoConfig.ParallelTotal > 1 {
+		grouping["node"] = strconv.Itoa(ginkgoconfig.GinkgoConfig.ParallelNode)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+	return reports.PushOpenMetrics(ctx, http.DefaultClient, pushURL, Config.Metrics.Job, grouping, result)
+}
+
+// recordSetup records a failure of the BeforeSuite or AfterSuite as a spec so that it appears in the reports
+func (r *ResultReporter) recordSetup(name string, setupSummary *types.SetupSummary) {
+	if setupSummary.State == types.SpecStatePassed || setupSummary.State == types.SpecStateInvalid {
+		return
+	}
+	r.recorder.StartSpec(name, setupSummary.CodeLocation.String())
+	r.recorder.EndSpec(specState(setupSummary.State), specFailure(setupSummary.State, setupSummary.Failure))
+}
+
+// specName joins the texts of the containers and the spec, skipping ginkgo's top level container
+func specName(componentTexts []string) string {
+	if len(componentTexts) > 1 {
+		componentTexts = componentTexts[1:]
+	}
+	var texts []string
+	for _, text := range componentTexts {
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	return strings.Join(texts, " ")
+}
+
+func specState(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePassed:
+		return reports.StatePassed
+	case types.SpecStateSkipped:
+		return reports.StateSkipped
+	case types.SpecStatePending:
+		return reports.StatePending
+	case types.SpecStatePanicked:
+		return reports.StatePanicked
+	case types.SpecStateTimedOut:
+		return reports.StateTimedOut
+	}
+	return reports.StateFailed
+}
+
+func specFailure(state types.SpecState, failure types.SpecFailure) *reports.Failure {
+	if state != types.SpecStateFailed && state != types.SpecStatePanicked && state != types.SpecStateTimedOut {
+		return nil
+	}
+	message := failure.Message
+	if failure.ForwardedPanic != "" {
+		message = strings.TrimSpace(message + "\n" + failure.ForwardedPanic)
+	}
+	return &reports.Failure{
+		Message:  message,
+		Location: failure.Location.String(),
+	}
+}
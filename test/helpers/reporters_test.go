@@ -0,0 +1,104 @@
+package helpers_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultReporterRecordsStepsAndCommands(t *testing.T) {
+	fake := setup(t)
+	fake.Expect("get", "activities").Returns("STEP STARTED AGO DURATION STATUS")
+	dir := t.TempDir()
+
+	r := helpers.NewResultReporter(dir, "create_spring_application", []string{"junit", "json", "tap"})
+	r.SpecSuiteWillBegin(ginkgoconfig.GinkgoConfig, &types.SuiteSummary{})
+	r.SpecWillRun(&types.SpecSummary{ComponentTexts: []string{"[Top Level]", "create spring\n", "creates a spring application\n"}})
+	application := helpers.NewApplicationName("spring")
+	helpers.Step("waiting for the first release", func() {
+		helpers.Step("getting the activities", func() {
+			_, err := runner.New(dir, nil, 0).RunWithOutput("get", "activities")
+			require.NoError(t, err)
+		})
+	})
+	r.SpecDidComplete(&types.SpecSummary{State: types.SpecStatePassed})
+	r.SpecWillRun(&types.SpecSummary{ComponentTexts: []string{"[Top Level]", "create spring\n", "fails"}})
+	r.SpecDidComplete(&types.SpecSummary{
+		State:   types.SpecStateFailed,
+		Failure: types.SpecFailure{Message: "Expected 404 to equal 200"},
+	})
+	r.SpecSuiteDidEnd(&types.SuiteSummary{})
+
+	data, err := os.ReadFile(filepath.Join(dir, "create_spring_application.json"))
+	require.NoError(t, err)
+	result := &reports.Result{}
+	require.NoError(t, json.Unmarshal(data, result))
+	require.Len(t, result.Specs, 2)
+	assert.Equal(t, 1, result.Passed)
+	assert.Equal(t, 1, result.Failed)
+
+	spec := result.Specs[0]
+	assert.Equal(t, "create spring creates a spring application", spec.Name)
+	require.Len(t, spec.Steps, 1)
+	assert.Equal(t, "waiting for the first release", spec.Steps[0].Text)
+	require.Len(t, spec.Steps[0].Steps, 1)
+	step := spec.Steps[0].Steps[0]
+	require.Len(t, step.Commands, 1, "the jx commands run by a step should be recorded")
+	assert.Equal(t, "jx", step.Commands[0].Command)
+	assert.Equal(t, []string{"get", "activities"}, step.Commands[0].Args)
+	assert.Equal(t, "Expected 404 to equal 200", result.Specs[1].Failure.Message)
+
+	junit, err := os.ReadFile(filepath.Join(dir, "create_spring_application.junit.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(junit), "<system-out>application: "+application+"&#xA;commands:&#xA;  jx get activities (exit 0 in ")
+	assert.Contains(t, string(junit), "<failure type=\"failed\">Expected 404 to equal 200")
+
+	assert.FileExists(t, filepath.Join(dir, "create_spring_application.tap"))
+	assert.NoFileExists(t, filepath.Join(dir, "create_spring_application.html"))
+	assert.Nil(t, reports.Current(), "steps should not be recorded once the suite has ended")
+}
+
+func TestResultReporterRetriesFailedSpecs(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+
+	r := helpers.NewResultReporter(dir, "create_spring_application", []string{"json"})
+	r.SpecSuiteWillBegin(ginkgoconfig.GinkgoConfig, &types.SuiteSummary{})
+	texts := []string{"[Top Level]", "create spring\n", "creates a spring application\n"}
+	r.SpecWillRun(&types.SpecSummary{ComponentTexts: texts})
+	first := helpers.NewApplicationName("spring")
+	r.SpecDidComplete(&types.SpecSummary{
+		State:   types.SpecStateFailed,
+		Failure: types.SpecFailure{Message: "timed out waiting for the first release"},
+	})
+	r.SpecWillRun(&types.SpecSummary{ComponentTexts: texts})
+	retry := helpers.NewApplicationName("spring")
+	r.SpecDidComplete(&types.SpecSummary{State: types.SpecStatePassed})
+	r.SpecSuiteDidEnd(&types.SuiteSummary{})
+
+	assert.NotEqual(t, first, retry, "a retry should not reuse the application of the failed attempt")
+	assert.Regexp(t, "-r1$", retry)
+
+	data, err := os.ReadFile(filepath.Join(dir, "create_spring_application.json"))
+	require.NoError(t, err)
+	result := &reports.Result{}
+	require.NoError(t, json.Unmarshal(data, result))
+	require.Len(t, result.Specs, 1, "the attempts of a spec should be reported as one spec")
+	assert.Equal(t, 1, result.Passed)
+	assert.Equal(t, 0, result.Failed)
+	assert.Equal(t, 1, result.Flaky)
+	spec := result.Specs[0]
+	assert.True(t, spec.Flaky)
+	assert.Equal(t, 2, spec.Attempts)
+	require.Len(t, spec.Retries, 1)
+	assert.Equal(t, "timed out waiting for the first release", spec.Retries[0].Message)
+}
@@ -1,10 +1,10 @@
 package helpers
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -14,82 +14,225 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
 
 	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
-	"github.com/onsi/ginkgo/config"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/coverage"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
 	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
 
-	gr "github.com/onsi/ginkgo/reporters"
-
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+var (
+	// KubeClient is the kubernetes client created when the suite starts
+	KubeClient kubernetes.Interface
+	// JXClient is the jx client created when the suite starts
+	JXClient versioned.Interface
+	// DynamicClient is the dynamic client created when the suite starts, used for resources such as tekton
+	// PipelineRuns which have no typed client in this module
+	DynamicClient dynamic.Interface
+	// Namespace is the namespace of the dev environment
+	Namespace string
+)
+
 func RunWithReporters(t *testing.T, suiteId string) {
-	reportsDir := os.Getenv("REPORTS_DIR")
-	if reportsDir == "" {
-		reportsDir = filepath.Join("../", "build", "reports")
-	}
+	reportsDir := Config.ReportsDir
 	err := os.MkdirAll(reportsDir, 0700)
 	if err != nil {
 		t.Errorf("cannot create %s because %v", reportsDir, err)
 	}
 	reporters := make([]Reporter, 0)
 
-	slowSpecThresholdStr := os.Getenv("SLOW_SPEC_THRESHOLD")
-	if slowSpecThresholdStr == "" {
-		slowSpecThresholdStr = "50000"
-		_ = os.Setenv("SLOW_SPEC_THRESHOLD", slowSpecThresholdStr)
-
-	}
-	slowSpecThreshold, err := strconv.ParseFloat(slowSpecThresholdStr, 64)
+	ginkgoconfig.DefaultReporterConfig.SlowSpecThreshold = Config.SlowSpecThreshold
+	ginkgoconfig.DefaultReporterConfig.Verbose = testing.Verbose()
+	err = configureFlakes()
 	if err != nil {
-		panic(err.Error())
+		t.Errorf("cannot configure the retries and quarantined specs because %v", err)
 	}
-	config.DefaultReporterConfig.SlowSpecThreshold = slowSpecThreshold
-	config.DefaultReporterConfig.Verbose = testing.Verbose()
-	reporters = append(reporters, gr.NewJUnitReporter(filepath.Join(reportsDir, fmt.Sprintf("%s.junit.xml", suiteId))))
-	RegisterFailHandler(Fail)
+	reporters = append(reporters, NewResultReporter(reportsDir, suiteId, Config.ReportFormats))
+	RegisterFailHandler(failHandler)
 	RunSpecsWithDefaultAndCustomReporters(t, fmt.Sprintf("Jenkins X E2E tests: %s", suiteId), reporters)
 }
 
-var BeforeSuiteCallback = func() {
-	err := ensureConfiguration()
+// suiteState is the configuration resolved by the first ginkgo node which is shared with all the parallel nodes
+type suiteState struct {
+	JxVersion          string `json:"jxVersion"`
+	Namespace          string `json:"namespace"`
+	Organisation       string `json:"organisation"`
+	OrganisationSource string `json:"organisationSource,omitempty"`
+	// Cluster is the cluster of the current kubernetes context
+	Cluster string `json:"cluster,omitempty"`
+	// Plugins are the versions of the jx plugins keyed by the name of the plugin
+	Plugins map[string]string `json:"plugins,omitempty"`
+	// CoverageRun is the run the coverage of the jx invocations of every node is collected in
+	CoverageRun string `json:"coverageRun,omitempty"`
+}
+
+// SynchronizedBeforeSuiteNode1Callback runs on the first ginkgo node only. It resolves the parts of the configuration
+// which need jx or the cluster so that they are only resolved once however many parallel nodes there are. Any jx
+// coverage left by a previous run in the same reports directory is removed first.
+var SynchronizedBeforeSuiteNode1Callback = func() []byte {
+	coverageRun, err := coverage.Reset()
 	utils.ExpectNoError(err)
-	WorkDir, err := ioutil.TempDir("", TempDirPrefix)
-	Expect(err).NotTo(HaveOccurred())
-	err = os.MkdirAll(WorkDir, 0760)
+	state, err := resolveConfiguration()
+	utils.ExpectNoError(err)
+	state.CoverageRun = coverageRun
+	data, err := json.Marshal(state)
+	utils.ExpectNoError(err)
+	return data
+}
+
+// SynchronizedBeforeSuiteAllNodesCallback runs on every ginkgo node with the configuration resolved by the first
+// node. It creates the clients of the node and a work directory which is not shared with any other node.
+var SynchronizedBeforeSuiteAllNodesCallback = func(data []byte) {
+	state := &suiteState{}
+	err := json.Unmarshal(data, state)
+	utils.ExpectNoError(err)
+	err = applyConfiguration(state)
+	utils.ExpectNoError(err)
+	err = coverage.SetRun(state.CoverageRun)
+	utils.ExpectNoError(err)
+
+	workDir, err := ioutil.TempDir("", fmt.Sprintf("%snode%d-", TempDirPrefix, ginkgoconfig.GinkgoConfig.ParallelNode))
 	Expect(err).NotTo(HaveOccurred())
-	Expect(WorkDir).To(BeADirectory())
-	AssignWorkDirValue(WorkDir)
+	Expect(workDir).To(BeADirectory())
+	AssignWorkDirValue(workDir)
 }
 
-var SynchronizedAfterSuiteCallback = func() {
+// SynchronizedAfterSuiteAllNodesCallback runs on every ginkgo node once its specs have finished
+var SynchronizedAfterSuiteAllNodesCallback = func() {
+	// remove anything left behind by specs which did not get to run their AfterEach
+	err := RunPendingCleanups()
+	if err != nil {
+		utils.LogInfof("WARNING: %s\n", err.Error())
+	}
+
 	// Cleanup workdir as usual
-	cleanFlag := os.Getenv("JX_DISABLE_CLEAN_DIR")
-	if strings.ToLower(cleanFlag) != "true" {
+	if Config.CleanWorkDir && WorkDir != "" {
 		os.RemoveAll(WorkDir)
 		Expect(WorkDir).ToNot(BeADirectory())
 	}
 }
 
-func ensureConfiguration() error {
-	cwd, err := os.Getwd()
+// SynchronizedAfterSuiteNode1Callback runs on the first ginkgo node once the specs on all the nodes have finished
+var SynchronizedAfterSuiteNode1Callback = func() {
+	report, err := coverage.Merge()
 	if err != nil {
-		return err
+		utils.LogInfof("WARNING: failed to merge the jx coverage: %s\n", err.Error())
+	}
+	if report != nil {
+		utils.LogInfof("merged the jx coverage of %d invocations into %s\n", report.Invocations, report.Profile)
+	}
+}
+
+// NewApplicationName returns a name for an application created by a spec from the given abbreviation. The name is
+// unique to the run of the suite and the ginkgo node so specs running on parallel nodes never create the same
+// repository, and each retry of a spec gets a new name in case the resources of the failed attempt are still being
+// removed. The name is recorded as the application of the running spec in the reports.
+func NewApplicationName(abbreviation string) string {
+	name := TempDirPrefix + abbreviation + "-" + strconv.FormatInt(GinkgoRandomSeed(), 10)
+	if ginkgoconfig.GinkgoConfig.ParallelTotal > 1 {
+		name = fmt.Sprintf("%s-%d", name, ginkgoconfig.GinkgoConfig.ParallelNode)
 	}
+	if attempt := reports.Attempt(); attempt > 1 {
+		name = fmt.Sprintf("%s-r%d", name, attempt-1)
+	}
+	reports.SetApplication(name)
+	return name
+}
 
-	_, found := os.LookupEnv("BDD_JX")
-	if !found {
-		_ = os.Setenv("BDD_JX", runner.Jx)
+// resolveConfiguration checks jx can be run and finds the git organisation from the dev environment if it is not
+// configured
+func resolveConfiguration() (*suiteState, error) {
+	if configErr != nil {
+		return nil, configErr
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
 
 	r := runner.New(cwd, &TimeoutSessionWait, 0)
 	version, err := r.RunWithOutput("version")
+	if err != nil {
+		return nil, err
+	}
+	err = createClients()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &suiteState{
+		JxVersion:    version,
+		Namespace:    Namespace,
+		Organisation: Config.Git.Organisation,
+		Cluster:      currentCluster(),
+		Plugins:      pluginVersions(pluginBinDir()),
+	}
+	if state.Organisation == "" {
+		state.Organisation, err = findDefaultOrganisation(KubeClient, JXClient, Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find gitOrganisation in namespace %s: %w", Namespace, err)
+		}
+		state.OrganisationSource = fmt.Sprintf("dev environment in namespace %s", Namespace)
+		if state.Organisation == "" {
+			state.Organisation = "jenkins-x-tests"
+			state.OrganisationSource = "fallback"
+		}
+	}
+
+	utils.LogInfof("jx version: %s\n", version)
+	if Config.File() != "" {
+		utils.LogInfof("loaded configuration from %s\n", Config.File())
+	}
+	return state, nil
+}
+
+// applyConfiguration applies the configuration resolved by the first ginkgo node and creates the clients
+func applyConfiguration(state *suiteState) error {
+	if configErr != nil {
+		return configErr
+	}
+	if state.OrganisationSource != "" {
+		Config.Git.Organisation = state.Organisation
+		Config.SetSource("git.organisation", state.OrganisationSource)
+	}
+	err := createClients()
 	if err != nil {
 		return err
 	}
+	if state.Namespace != "" {
+		Namespace = state.Namespace
+	}
+	setReportProperties(state)
+	urlProbe = newURLProbe()
+
+	if ginkgoconfig.GinkgoConfig.ParallelNode <= 1 {
+		table := &strings.Builder{}
+		err = Config.WriteTable(table)
+		if err != nil {
+			return fmt.Errorf("failed to write the configuration: %w", err)
+		}
+		utils.LogInfof("effective configuration:\n%s", table.String())
+		if Config.Transcript.Record != "" {
+			utils.LogInfof("recording the jx and kubectl commands to %s\n", Config.Transcript.Record)
+		}
+		if Config.Transcript.Replay != "" {
+			utils.LogInfof("replaying the jx and kubectl commands from %s\n", Config.Transcript.Replay)
+		}
+	}
+	return nil
+}
+
+// createClients creates the kubernetes, jx and dynamic clients unless they have already been created
+func createClients() error {
+	if KubeClient != nil {
+		return nil
+	}
 	kubeClient, ns, err := kube.LazyCreateKubeClientAndNamespace(nil, "")
 	if err != nil {
 		return fmt.Errorf("failed to create kubeClient: %w", err)
@@ -98,104 +241,14 @@ func ensureConfiguration() error {
 	if err != nil {
 		return fmt.Errorf("failed to create jxClient: %w", err)
 	}
-
-	gitOrganisation := os.Getenv("GIT_ORGANISATION")
-	if gitOrganisation == "" {
-		gitOrganisation, err = findDefaultOrganisation(kubeClient, jxClient, ns)
-		if err != nil {
-			return fmt.Errorf("failed to find gitOrganisation in namespace %s: %w", ns, err)
-		}
-		if gitOrganisation == "" {
-			gitOrganisation = "jenkins-x-tests"
-		}
-		_ = os.Setenv("GIT_ORGANISATION", gitOrganisation)
-	}
-	gitProviderUrl := os.Getenv("GIT_PROVIDER_URL")
-	if gitProviderUrl == "" {
-		gitProviderUrl = "https://github.com"
-		_ = os.Setenv("GIT_PROVIDER_URL", gitProviderUrl)
-	}
-	gitKind := os.Getenv("GIT_KIND")
-	if gitKind == "" {
-		gitKind = "github"
-		os.Setenv("GIT_KIND", gitKind)
-	}
-	disableDeleteAppStr := os.Getenv("JX_DISABLE_DELETE_APP")
-	disableDeleteApp := "is not set. Applications will be deleted from staging after they are promoted."
-	if disableDeleteAppStr == "true" || disableDeleteAppStr == "1" || disableDeleteAppStr == "on" {
-		disableDeleteApp = "is set. Apps will NOT be deleted from Staging after they are provisioned"
-	}
-	disableDeleteRepoStr := os.Getenv("JX_DISABLE_DELETE_REPO")
-	disableDeleteRepo := "is set. Repos created in the test run will NOT be deleted"
-	if disableDeleteRepoStr == "true" || disableDeleteRepoStr == "1" || disableDeleteRepoStr == "on" {
-		disableDeleteRepo = "is not set. If you would like to disable the automatic deletion of repos created by the tests set this variable to TRUE."
-	}
-	disableWaitForFirstReleaseStr := os.Getenv("JX_DISABLE_WAIT_FOR_FIRST_RELEASE")
-	disableWaitForFirstRelease := "is set. Will not wait for build to be promoted to staging"
-	if disableWaitForFirstReleaseStr == "true" || disableWaitForFirstReleaseStr == "1" || disableWaitForFirstReleaseStr == "on" {
-		disableWaitForFirstRelease = "is not set. If you would like to disable waiting for the build to be promoted to staging set this variable to TRUE"
-	}
-	enableChatOpsTestLogStr := "is not set. ChatOps tests will not be run as part of quickstart tests. If you would like to run those tests, set this variable to TRUE"
-	if EnableChatOpsTests == "true" {
-		enableChatOpsTestLogStr = "is set. ChatOps tests will be run as part of quickstart tests"
-	}
-	disablePACheckStr := "is not set. PipelineActivity update tests will be run as part of PR-related tests. If you would like to not run those tests, set this variable to TRUE"
-	if DisablePipelineActivityCheck == "true" {
-		disablePACheckStr = "is set. PipelineActivity update tests will NOT be run as part of PR-related tests"
-	}
-	includeAppsStr := os.Getenv("JX_BDD_INCLUDE_APPS")
-	includeApps := "is not set"
-	if includeAppsStr != "" {
-		includeApps = fmt.Sprintf("is set to %s", includeAppsStr)
-	}
-	bddTimeoutBuildCompletes := os.Getenv("BDD_TIMEOUT_BUILD_COMPLETES")
-	if bddTimeoutBuildCompletes == "" {
-		_ = os.Setenv("BDD_TIMEOUT_BUILD_COMPLETES", "60")
-	}
-	bddTimeoutBuildRunningInStaging := os.Getenv("BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING")
-	if bddTimeoutBuildRunningInStaging == "" {
-		_ = os.Setenv("BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING", "60")
-	}
-	bddTimeoutURLReturns := os.Getenv("BDD_TIMEOUT_URL_RETURNS")
-	if bddTimeoutURLReturns == "" {
-		_ = os.Setenv("BDD_TIMEOUT_URL_RETURNS", "5")
-	}
-	bddTimeoutCmdLine := os.Getenv("BDD_TIMEOUT_CMD_LINE")
-	if bddTimeoutCmdLine == "" {
-		_ = os.Setenv("BDD_TIMEOUT_CMD_LINE", "1")
-	}
-	bddTimeoutAppTests := os.Getenv("BDD_TIMEOUT_APP_TESTS")
-	if bddTimeoutAppTests == "" {
-		_ = os.Setenv("BDD_TIMEOUT_APP_TESTS", "60")
-	}
-	bddTimeoutSessionWait := os.Getenv("BDD_TIMEOUT_SESSION_WAIT")
-	if bddTimeoutSessionWait == "" {
-		_ = os.Setenv("BDD_TIMEOUT_SESSION_WAIT", "60")
-	}
-	bddTimeoutDevpod := os.Getenv("BDD_TIMEOUT_DEVPOD")
-	if bddTimeoutDevpod == "" {
-		_ = os.Setenv("BDD_TIMEOUT_DEVPOD", "15")
-	}
-
-	utils.LogInfof("jx version:                                         %s\n", version)
-	utils.LogInfof("GIT_KIND:                                           %s\n", gitKind)
-	utils.LogInfof("GIT_ORGANISATION:                                   %s\n", gitOrganisation)
-	utils.LogInfof("GIT_PROVIDER_URL:                                   %s\n", gitProviderUrl)
-	utils.LogInfof("JX_BDD_INCLUDE_APPS:                                %s\n", includeApps)
-	utils.LogInfof("JX_DISABLE_DELETE_APP:                              %s\n", disableDeleteApp)
-	utils.LogInfof("JX_DISABLE_DELETE_REPO:                             %s\n", disableDeleteRepo)
-	utils.LogInfof("JX_DISABLE_WAIT_FOR_FIRST_RELEASE:                  %s\n", disableWaitForFirstRelease)
-	utils.LogInfof("BDD_ENABLE_TEST_CHATOPS_COMMANDS:                   %s\n", enableChatOpsTestLogStr)
-	utils.LogInfof("BDD_DISABLE_PIPELINEACTIVITY_CHECK:                 %s\n", disablePACheckStr)
-	utils.LogInfof("BDD_JX:                                             %s\n", os.Getenv("BDD_JX"))
-	utils.LogInfof("BDD_LIGHTHOUSE_BASE_REPORT_URL:                     %s\n", LighthouseBaseReportURL)
-	utils.LogInfof("BDD_TIMEOUT_BUILD_COMPLETES timeout value:          %s\n", os.Getenv("BDD_TIMEOUT_BUILD_COMPLETES"))
-	utils.LogInfof("BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING timeout value: %s\n", os.Getenv("BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING"))
-	utils.LogInfof("BDD_TIMEOUT_URL_RETURNS timeout value:              %s\n", os.Getenv("BDD_TIMEOUT_URL_RETURNS"))
-	utils.LogInfof("BDD_TIMEOUT_CMD_LINE timeout value:                 %s\n", os.Getenv("BDD_TIMEOUT_CMD_LINE"))
-	utils.LogInfof("BDD_TIMEOUT_APP_TESTS timeout value:                %s\n", os.Getenv("BDD_TIMEOUT_APP_TESTS"))
-	utils.LogInfof("BDD_TIMEOUT_SESSION_WAIT timeout value:             %s\n", os.Getenv("BDD_TIMEOUT_SESSION_WAIT"))
-	utils.LogInfof("SLOW_SPEC_THRESHOLD:                                %s\n", os.Getenv("SLOW_SPEC_THRESHOLD"))
+	dynamicClient, err := kube.LazyCreateDynamicClient(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamicClient: %w", err)
+	}
+	KubeClient = kubeClient
+	JXClient = jxClient
+	DynamicClient = dynamicClient
+	Namespace = ns
 	return nil
 }
 
@@ -0,0 +1,118 @@
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// parallelNode runs the test as the given node of the given number of parallel ginkgo nodes
+func parallelNode(t *testing.T, node, total int) {
+	oldNode, oldTotal := ginkgoconfig.GinkgoConfig.ParallelNode, ginkgoconfig.GinkgoConfig.ParallelTotal
+	ginkgoconfig.GinkgoConfig.ParallelNode, ginkgoconfig.GinkgoConfig.ParallelTotal = node, total
+	t.Cleanup(func() {
+		ginkgoconfig.GinkgoConfig.ParallelNode, ginkgoconfig.GinkgoConfig.ParallelTotal = oldNode, oldTotal
+	})
+}
+
+func TestNewApplicationName(t *testing.T) {
+	name := helpers.NewApplicationName("spring")
+	assert.True(t, strings.HasPrefix(name, "bdd-spring-"), "name %s", name)
+
+	parallelNode(t, 3, 4)
+	assert.Equal(t, name+"-3", helpers.NewApplicationName("spring"), "names should be unique to each parallel node")
+}
+
+func TestSynchronizedBeforeSuiteSharesConfiguration(t *testing.T) {
+	fake := setup(t, &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: ns},
+		Spec: v1.EnvironmentSpec{
+			Kind:         v1.EnvironmentKindTypeDevelopment,
+			TeamSettings: v1.TeamSettings{Organisation: "my-org"},
+		},
+	})
+	fake.Expect("version").Returns("3.10.0").Once()
+	helpers.Config.Git.Organisation = ""
+	oldWorkDir := helpers.WorkDir
+	t.Cleanup(func() {
+		helpers.AssignWorkDirValue(oldWorkDir)
+	})
+
+	data := helpers.SynchronizedBeforeSuiteNode1Callback()
+
+	// the other nodes only have the data shared by the first node
+	helpers.Config.Git.Organisation = ""
+	parallelNode(t, 2, 2)
+	helpers.SynchronizedBeforeSuiteAllNodesCallback(data)
+	t.Cleanup(func() {
+		os.RemoveAll(helpers.WorkDir)
+	})
+
+	assert.Equal(t, "my-org", helpers.Config.Git.Organisation)
+	assert.Equal(t, []string{"version"}, fake.InvokedArgs(), "jx should only be run by the first node")
+	assert.DirExists(t, helpers.WorkDir)
+	assert.Contains(t, helpers.WorkDir, "bdd-node2-", "each node should have its own work directory")
+
+	helpers.SynchronizedAfterSuiteAllNodesCallback()
+	require.NoDirExists(t, helpers.WorkDir)
+}
+
+func TestSynchronizedBeforeSuiteSetsReportProperties(t *testing.T) {
+	fake := setup(t)
+	fake.Expect("version").Returns("3.10.0").Once()
+	jxHome := t.TempDir()
+	pluginDir := filepath.Join(jxHome, "plugins", "bin")
+	require.NoError(t, os.MkdirAll(pluginDir, 0700))
+	for _, name := range []string{"jx-gitops-0.7.9", "jx-gitops-0.7.20", "jx-pipeline-0.3.1", "README"} {
+		require.NoError(t, os.WriteFile(filepath.Join(pluginDir, name), nil, 0600))
+	}
+	t.Setenv("JX3_HOME", jxHome)
+	kubeConfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeConfig, []byte(`apiVersion: v1
+kind: Config
+current-context: bdd
+contexts:
+- name: bdd
+  context:
+    cluster: bdd-cluster
+clusters:
+- name: bdd-cluster
+  cluster:
+    server: https://127.0.0.1:6443
+`), 0600))
+	t.Setenv("KUBECONFIG", kubeConfig)
+
+	r := reports.NewRecorder("verify_pods", 0)
+	reports.SetCurrent(r)
+	oldWorkDir := helpers.WorkDir
+	t.Cleanup(func() {
+		reports.SetCurrent(nil)
+		helpers.AssignWorkDirValue(oldWorkDir)
+	})
+
+	helpers.SynchronizedBeforeSuiteAllNodesCallback(helpers.SynchronizedBeforeSuiteNode1Callback())
+	t.Cleanup(func() {
+		os.RemoveAll(helpers.WorkDir)
+	})
+
+	properties := map[string]string{}
+	for _, p := range r.Result().Properties {
+		properties[p.Name] = p.Value
+	}
+	assert.Equal(t, "3.10.0", properties["jx.version"])
+	assert.Equal(t, "0.7.20", properties["plugin.jx-gitops"], "the newest version of a plugin should be used")
+	assert.Equal(t, "0.3.1", properties["plugin.jx-pipeline"])
+	assert.NotContains(t, properties, "plugin.README")
+	assert.Equal(t, "bdd-cluster", properties["cluster"])
+	assert.Equal(t, helpers.Config.Git.ProviderURL, properties["git.providerURL"])
+	assert.Equal(t, helpers.Config.Timeouts.BuildCompletes.String(), properties["timeouts.buildCompletes"])
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
+)
+
+// RunSuites runs the registered suites selected by the given comma separated list of suite names and tags, such as
+// the value of JX_BDD_SUITE. Which suites were selected or skipped, and why, is logged and written to the reports
+// directory. The specs of suites which are skipped are never declared. A suite selected by a tag or all is skipped if
+// it is missing a capability, but the test fails if a suite selected by its name cannot run.
+func RunSuites(t *testing.T, selectors string) {
+	if configErr != nil {
+		t.Fatalf("invalid configuration: %s", configErr.Error())
+	}
+	names := suites.ParseSelectors(selectors)
+	decisions, err := suites.Default.Select(names, checkCapability)
+	if err != nil {
+		t.Fatalf("failed to select the suites: %s", err.Error())
+	}
+	suiteId := strings.Join(names, "-")
+	err = writeSuiteDecisions(suiteId, decisions)
+	if err != nil {
+		t.Fatalf("failed to write the selected suites: %s", err.Error())
+	}
+	err = suites.MissingCapabilities(decisions)
+	if err != nil {
+		t.Fatalf("failed to run the selected suites:\n%s", err.Error())
+	}
+	err = applySuiteTimeouts(decisions)
+	if err != nil {
+		t.Fatalf("failed to apply the default timeouts of the suites: %s", err.Error())
+	}
+
+	selected := 0
+	for _, d := range decisions {
+		if d.Selected {
+			d.Suite.Specs()
+			selected++
+		}
+	}
+	if selected == 0 {
+		t.Skipf("none of the suites selected by %s can run", selectors)
+	}
+	RunWithReporters(t, suiteId)
+}
+
+// writeSuiteDecisions logs which suites were selected and writes them to the reports directory
+func writeSuiteDecisions(suiteId string, decisions []*suites.Decision) error {
+	table := &strings.Builder{}
+	err := suites.WriteTable(table, decisions)
+	if err != nil {
+		return err
+	}
+	utils.LogInfof("suites:\n%s", table.String())
+
+	err = os.MkdirAll(Config.ReportsDir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", Config.ReportsDir, err)
+	}
+	path := filepath.Join(Config.ReportsDir, fmt.Sprintf("%s.suites.txt", suiteId))
+	err = os.WriteFile(path, []byte(table.String()), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// applySuiteTimeouts uses the default timeouts of the selected suites for any timeouts which are not configured
+func applySuiteTimeouts(decisions []*suites.Decision) error {
+	timeouts := suites.DefaultTimeouts(decisions)
+	names := make([]string, 0, len(timeouts))
+	for name := range timeouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := Config.SetDefault(name, timeouts[name], "suite default")
+		if err != nil {
+			return err
+		}
+	}
+
+	TimeoutBuildCompletes = Config.Timeouts.BuildCompletes.Duration()
+	TimeoutBuildIsRunningInStaging = Config.Timeouts.BuildRunningInStaging.Duration()
+	TimeoutPipelineActivityComplete = Config.Timeouts.PipelineActivityComplete.Duration()
+	TimeoutUrlReturns = Config.Timeouts.URLReturns.Duration()
+	TimeoutPreviewUrlReturns = Config.Timeouts.PreviewURLReturns.Duration()
+	TimeoutPreviewRemoved = Config.Timeouts.PreviewRemoved.Duration()
+	TimeoutCmdLine = Config.Timeouts.CmdLine.Duration()
+	TimeoutSessionWait = Config.Timeouts.SessionWait.Duration()
+	TimeoutDeploymentRollout = Config.Timeouts.DeploymentRollout.Duration()
+	TimeoutProwActionWait = Config.Timeouts.ProwActionWait.Duration()
+	runner.TimeoutJxRunner = Config.Timeouts.JxRunner.Duration()
+	return nil
+}
+
+// checkCapability returns an error if the cluster or git provider does not have the capability a suite needs
+func checkCapability(c suites.Capability) error {
+	switch c {
+	case suites.CapabilityCluster:
+		return createClients()
+	case suites.CapabilityGitProvider:
+		if Config.Git.Token == "" && !Config.Git.ForceLocalAuthConfig {
+			// the credentials are in the jx-boot secret
+			err := createClients()
+			if err != nil {
+				return err
+			}
+		}
+		_, _, err := gits.FindCredentials(KubeClient, Config.Git.Username, Config.Git.Token, Config.Git.ForceLocalAuthConfig)
+		return err
+	case suites.CapabilityQuickstarts:
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		r := runner.New(cwd, &TimeoutCmdLine, 0)
+		_, err = r.RunWithOutput("get", "quickstarts")
+		return err
+	}
+	return fmt.Errorf("unknown capability %s", c)
+}
@@ -2,30 +2,33 @@ package helpers
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/cli"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 
+	"io"
 	"io/ioutil"
 	"net"
-	"net/http"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/util/rand"
-
 	"github.com/cenkalti/backoff/v5"
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/activities"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
 	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
-	"github.com/onsi/gomega/gexec"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 
 	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
 
@@ -38,8 +41,6 @@ const (
 	BDDPullRequestApproverUsernameEnvVar = "BDD_APPROVER_USERNAME"
 	// BDDPullRequestApproverTokenEnvVar is the environment variable that we look at for the token for the approver in some tests.
 	BDDPullRequestApproverTokenEnvVar = "BDD_APPROVER_ACCESS_TOKEN"
-	// BDDLighthouseBaseReportURLEnvVar is the environment variable we look at to find the possible base URL for status reports in Lighthouse.
-	BDDLighthouseBaseReportURLEnvVar = "BDD_LIGHTHOUSE_BASE_REPORT_URL"
 )
 
 var (
@@ -48,59 +49,42 @@ var (
 	// WorkDir The current working directory
 	WorkDir string
 
-	// all timeout values are in minutes
-	// timeout for a build to complete successfully
-	TimeoutBuildCompletes = utils.GetTimeoutFromEnv("BDD_TIMEOUT_BUILD_COMPLETES", 40)
+	// Config is the configuration of the tests loaded from bdd.yaml and the environment
+	Config, configErr = config.Current()
+
+	// TimeoutBuildCompletes timeout for a build to complete successfully
+	TimeoutBuildCompletes = Config.Timeouts.BuildCompletes.Duration()
 
 	// TimeoutBuildIsRunningInStaging Timeout for promoting an application to staging environment
-	TimeoutBuildIsRunningInStaging = utils.GetTimeoutFromEnv("BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING", 20)
+	TimeoutBuildIsRunningInStaging = Config.Timeouts.BuildRunningInStaging.Duration()
 
 	// TimeoutPipelineActivityComplete for promoting an application to staging environment
-	TimeoutPipelineActivityComplete = utils.GetTimeoutFromEnv("BDD_TIMEOUT_PIPELINE_ACTIVITY_COMPLETE", 15)
+	TimeoutPipelineActivityComplete = Config.Timeouts.PipelineActivityComplete.Duration()
 
 	// TimeoutUrlReturns Timeout for a given URL to return an expected status code
-	TimeoutUrlReturns = utils.GetTimeoutFromEnv("BDD_TIMEOUT_URL_RETURNS", 15)
+	TimeoutUrlReturns = Config.Timeouts.URLReturns.Duration()
 
 	// TimeoutPreviewUrlReturns Timeout for a preview URL to be available
-	TimeoutPreviewUrlReturns = utils.GetTimeoutFromEnv("BDD_TIMEOUT_PREVIEW_URL_RETURNS", 15)
+	TimeoutPreviewUrlReturns = Config.Timeouts.PreviewURLReturns.Duration()
+
+	// TimeoutPreviewRemoved Timeout for the preview environment of a closed or merged pull request to be removed
+	TimeoutPreviewRemoved = Config.Timeouts.PreviewRemoved.Duration()
 
 	// TimeoutCmdLine Timeout to wait for a command line execution to complete
-	TimeoutCmdLine = utils.GetTimeoutFromEnv("BDD_TIMEOUT_CMD_LINE", 1)
+	TimeoutCmdLine = Config.Timeouts.CmdLine.Duration()
 
 	// TimeoutSessionWait Session wait timeout
-	TimeoutSessionWait = utils.GetTimeoutFromEnv("BDD_TIMEOUT_SESSION_WAIT", 60)
+	TimeoutSessionWait = Config.Timeouts.SessionWait.Duration()
 
 	// TimeoutDeploymentRollout defines the timeout waiting for a deployment rollout
-	TimeoutDeploymentRollout = utils.GetTimeoutFromEnv("", 3)
+	TimeoutDeploymentRollout = Config.Timeouts.DeploymentRollout.Duration()
 
-	// InsecureURLSkipVerify skips the TLS verify when checking URLs of deployed applications
-	InsecureURLSkipVerify = utils.GetEnv("BDD_URL_INSECURE_SKIP_VERIFY", "false")
 	// TimeoutProwActionWait defines the timeout for waiting for a prow action to complete
-	TimeoutProwActionWait = utils.GetTimeoutFromEnv("BDD_TIMEOUT_PROW_ACTION_WAIT", 5)
-
-	// EnableChatOpsTests turns on the chatops tests when specified as true
-	EnableChatOpsTests = utils.GetEnv("BDD_ENABLE_TEST_CHATOPS_COMMANDS", "false")
-
-	// DisablePipelineActivityCheck turns off the check for updated PipelineActivity. Meant to be used with static masters.
-	DisablePipelineActivityCheck = utils.GetEnv("BDD_DISABLE_PIPELINEACTIVITY_CHECK", "false")
-
-	// PullRequestApproverUsername is the username used for /approve commands on PRs, since the bot user may not be able to.
-	PullRequestApproverUsername = utils.GetEnv(BDDPullRequestApproverUsernameEnvVar, "")
-
-	// PullRequestApproverToken is the access token used by the PullRequestApproverUsername user.
-	PullRequestApproverToken = utils.GetEnv(BDDPullRequestApproverTokenEnvVar, "")
-
-	// ForceLocalAuthConfig when enabled, the tests will only use the local auth config
-	ForceLocalAuthConfig = utils.GetEnv("BDD_FORCE_LOCAL_AUTH_CONFIG", "false")
-
-	// LighthouseBaseReportURL is the base URL used by Lighthouse for status reporting, if set.
-	LighthouseBaseReportURL = utils.GetEnv(BDDLighthouseBaseReportURLEnvVar, "")
+	TimeoutProwActionWait = Config.Timeouts.ProwActionWait.Duration()
 
-	// JenkinsBasicAuthPassword is the basic auth configured for Jenkins or the UI, if set.
-	JenkinsBasicAuthPassword = utils.GetEnv("JENKINS_PASSWORD", "")
-
-	// UseBasicAuthWithUI is set if the UI will be using basic auth.
-	UseBasicAuthWithUI = utils.GetEnv("JX_APP_UI_TEST_BASIC_AUTH", "false")
+	// InvitationDelay how long to wait for the invitation of the approver user to show up once it is added as a
+	// collaborator
+	InvitationDelay = 15 * time.Second
 )
 
 // TestOptions is the base testing object
@@ -111,6 +95,14 @@ type TestOptions struct {
 	Organisation    string
 	JavaVersion     string
 	ProjectType     string
+	// Quickstart is the quickstart the application was created from, which labels the phase metrics
+	Quickstart string
+	// Content checks what the application serves, defaults to the QuickstartContent of the Quickstart
+	Content *ContentCheck
+	// Cleanup removes the resources created by the spec, see Cleanups
+	Cleanup *CleanupRegistry
+	// pullRequests counts the pull requests created by CreatePullRequestWithLocalChange so each gets its own branch
+	pullRequests int
 }
 
 func AssignWorkDirValue(generatedWorkDir string) {
@@ -136,194 +128,72 @@ func (t *TestOptions) GetFreePort() (int, error) {
 
 // GetGitOrganisation Gets the current git organisation/user
 func (t *TestOptions) GetGitOrganisation() string {
-	org := os.Getenv("GIT_ORGANISATION")
-	return org
+	return Config.Git.Organisation
 }
 
-/*
-// GetLighthouseSCMClient returns a Lighthouse SCM client using the default credentials
-func (t *TestOptions) GetLighthouseSCMClient(provider gits.GitProvider) (*scm.Client, scmprovider.SCMClient, error) {
-	_, config, err := t.getAuthConfig()
-	if err != nil {
-		return nil, nil, err
-	}
-	user := config.CurrentUser(config.CurrentAuthServer(), false)
-	scmClient, err := scmFactory.NewClient(provider.Kind(), provider.ServerURL(), user.ApiToken)
+// GetGitProvider returns a git provider for the pipeline user. The credentials are taken from the GIT_USERNAME and
+// GIT_TOKEN environment variables falling back to the jx-boot secret unless BDD_FORCE_LOCAL_AUTH_CONFIG is enabled.
+func (t *TestOptions) GetGitProvider() (gits.Provider, error) {
+	username, token, err := t.getGitCredentials()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return scmClient, scmprovider.ToClient(scmClient, user.Username), nil
-}
-
-// GetGitProvider returns a git provider that uses default credentials stored in the jx-auth-configmap or in ~/.jx/gitAuth.yaml
-func (t *TestOptions) GetGitProvider() (gits.GitProvider, error) {
-	return t.getGitProviderWithUserFunc(func(service auth.ConfigService, config *auth.AuthConfig, server *auth.AuthServer) (*auth.UserAuth, error) {
-		return config.CurrentUser(server, false), nil
-	})
+	return t.newGitProvider(username, token)
 }
 
 // GetApproverGitProvider returns a git provider that uses credentials for the approver user defined in environment variables
-// We don't use standard user auth here because the user/token isn't defined during boot, so we'll create the credentials
-// for the user on the fly.
-func (t *TestOptions) GetApproverGitProvider() (gits.GitProvider, error) {
-	return t.getGitProviderWithUserFunc(func(service auth.ConfigService, config *auth.AuthConfig, server *auth.AuthServer) (*auth.UserAuth, error) {
-		userAuth := config.FindUserAuth(server.URL, PullRequestApproverUsername)
-		if userAuth == nil {
-			userAuth = config.GetOrCreateUserAuth(server.URL, PullRequestApproverUsername)
-			userAuth.ApiToken = PullRequestApproverToken
-			userAuth.Password = PullRequestApproverToken
-			err := service.SaveConfig()
-			if err != nil {
-				return nil, err
-			}
-		}
-		return userAuth, nil
-	})
-}
-
-func (t *TestOptions) getAuthConfig() (auth.ConfigService, *auth.AuthConfig, error) {
-	factory := cmd.NewFactory()
-	_, ns, err := factory.CreateKubeClient()
-	if err != nil {
-		return nil, nil, err
+func (t *TestOptions) GetApproverGitProvider() (gits.Provider, error) {
+	if Config.Git.ApproverUsername == "" || Config.Git.ApproverToken == "" {
+		return nil, fmt.Errorf("the approver user must be configured with %s and %s", BDDPullRequestApproverUsernameEnvVar, BDDPullRequestApproverTokenEnvVar)
 	}
-	useLocalAuthString := ForceLocalAuthConfig
-	useLocalAuth := false
-	if useLocalAuthString == "true" {
-		useLocalAuth = true
-	}
-
-	var authConfigService auth.ConfigService
-
-	if useLocalAuth {
-		utils.LogInfof("using local git auth config service\n")
-		authConfigService, err = factory.CreateLocalGitAuthConfigService()
-		if err != nil {
-			return nil, nil, err
-		}
-	} else {
-		utils.LogInfof("using git auth config service\n")
-		authConfigService, err = factory.CreateGitAuthConfigService(ns, "")
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	config, err := authConfigService.LoadConfig()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error loading auth config: %s", err)
-	}
-
-	if config == nil {
-		return nil, nil, fmt.Errorf("auth config is nil but no error was returned by LoadConfig")
-	}
-
-	return authConfigService, config, nil
+	return t.newGitProvider(Config.Git.ApproverUsername, Config.Git.ApproverToken)
 }
 
-// getGitProviderWithUserFunc returns a git provider that uses default credentials stored in the jx-auth-configmap or in ~/.jx/gitAuth.yaml
-func (t *TestOptions) getGitProviderWithUserFunc(userAuthFunc func(auth.ConfigService, *auth.AuthConfig, *auth.AuthServer) (*auth.UserAuth, error)) (gits.GitProvider, error) {
-	authConfigService, config, err := t.getAuthConfig()
+func (t *TestOptions) newGitProvider(username string, token string) (gits.Provider, error) {
+	serverURL, err := t.GitProviderURL()
 	if err != nil {
 		return nil, err
 	}
-	authServer := config.CurrentAuthServer()
-	if authServer == nil {
-		return nil, fmt.Errorf("no config for git auth server found")
-	}
-	userAuth, err := userAuthFunc(authConfigService, config, authServer)
+	provider, err := gits.NewProvider(Config.Git.Kind, serverURL, username, token)
 	if err != nil {
 		return nil, err
 	}
-	if userAuth == nil {
-		return nil, fmt.Errorf("no config for git user auth found")
-	}
-
-	utils.LogInfof("using user auth %s\n", userAuth.Username)
-	gitProvider, err := gits.CreateProvider(authServer, userAuth, nil)
-	if err != nil {
-		return nil, err
-	}
-	return gitProvider, nil
+	utils.LogInfof("using %s git provider %s as user %s\n", provider.Kind(), serverURL, provider.CurrentUsername())
+	return provider, nil
 }
 
-// GitHubToken returns the GitHub token for the pipeline user.
-func (t *TestOptions) GitHubToken() string {
-	provider, err := t.GetGitProvider()
-	Expect(err).Should(BeNil())
-
-	return provider.UserAuth().ApiToken
+// getGitCredentials returns the username and API token of the pipeline user
+func (t *TestOptions) getGitCredentials() (string, string, error) {
+	return gits.FindCredentials(KubeClient, Config.Git.Username, Config.Git.Token, Config.Git.ForceLocalAuthConfig)
 }
 
-// GitOpsDevRepo returns repository URL for the gitops environment repo.
-// The empty string is returned in case there is no gitops repo.
-func (t *TestOptions) GitOpsDevRepo() string {
-	args := []string{"get", "environment", "dev", "-o=jsonpath='{.spec.source.url}'"}
-	command := exec.Command("kubectl", args...)
-	session, err := gexec.Start(command, nil, nil)
+// GitHubToken returns the git API token for the pipeline user.
+func (t *TestOptions) GitHubToken() string {
+	_, token, err := t.getGitCredentials()
 	Expect(err).Should(BeNil())
-
-	session.Wait(TimeoutCmdLine)
-	Eventually(session).Should(gexec.Exit(0))
-
-	url := strings.Trim(string(session.Out.Contents()), "'")
-	return url
+	return token
 }
 
-// GitOpsEnabled returns true if the current cluster is GitOps enabled, false otherwise.
-func (t *TestOptions) GitOpsEnabled() bool {
-	url := t.GitOpsDevRepo()
-	if url == "" {
-		return false
-	} else {
-		return true
-	}
-}
-
-// NextBuildNumber returns the next build number for a given repo by looking at the SourceRepository CRD.
-func (t *TestOptions) NextBuildNumber(repo *gits.GitRepository) string {
-	crd := strings.ToLower(fmt.Sprintf("%s-%s", repo.Organisation, repo.Name))
-
-	args := []string{"get", "sourcerepository", crd, "-o", "json"}
-	command := exec.Command("kubectl", args...)
-	session, err := gexec.Start(command, nil, nil)
-	Expect(err).Should(BeNil())
-
-	session.Wait(TimeoutCmdLine)
-	Eventually(session).Should(gexec.Exit(0))
-
-	out := string(session.Out.Contents())
-	sourceRepository := v1.SourceRepository{}
-	err = json.Unmarshal([]byte(out), &sourceRepository)
-	Expect(err).Should(BeNil())
-
-	latestBuild := sourceRepository.Annotations["jenkins.io/last-build-number-for-master"]
-	if latestBuild == "" {
-		latestBuild = "0"
+// NextBuildNumber returns the number of the next build of the job, of the form owner/repository/branch, from its
+// PipelineActivities
+func (t *TestOptions) NextBuildNumber(jobName string) int {
+	job, err := activities.ParseJob(jobName)
+	Expect(err).ShouldNot(HaveOccurred())
+	latest, err := activities.NewWatcher(JXClient, Namespace).Latest(context.TODO(), job)
+	Expect(err).ShouldNot(HaveOccurred())
+	if latest == nil {
+		return 1
 	}
-	latestBuildInt, err := strconv.Atoi(latestBuild)
-	Expect(err).Should(BeNil())
-
-	nextBuildInt := latestBuildInt + 1
-
-	return strconv.Itoa(nextBuildInt)
+	return activities.BuildNumber(latest) + 1
 }
-*/
 
-// GetPullTitleForBranch returns the PullTitle field from the PipelineActivity for the owner/repo/branch
+// GetPullTitleFromActivity returns the PullTitle field from the PipelineActivity for the owner/repo/branch and build
 func (t *TestOptions) GetPullTitleFromActivity(owner string, repo string, branch string, buildNumber int) string {
-	activityName := fmt.Sprintf("%s-%s-%s-%s", owner, repo, branch, strconv.Itoa(buildNumber))
-	args := []string{"get", "pipelineactivity", activityName, "-o=jsonpath='{.spec.pullTitle}'"}
-
-	command := exec.Command("kubectl", args...)
-	session, err := gexec.Start(command, nil, nil)
-	Expect(err).Should(BeNil())
-
-	session.Wait(TimeoutCmdLine)
-	Eventually(session).Should(gexec.Exit(0))
-
-	pullTitle := strings.Trim(string(session.Out.Contents()), "'")
-	return pullTitle
+	job := activities.Job{Owner: owner, Repository: repo, Branch: branch}
+	pa, err := activities.NewWatcher(JXClient, Namespace).Build(context.TODO(), job, buildNumber)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(pa).ShouldNot(BeNil(), "no PipelineActivity for build #%d of %s", buildNumber, job.String())
+	return pa.Spec.PullTitle
 }
 
 func (t *TestOptions) TheApplicationIsRunningInProduction(statusCode int) {
@@ -335,22 +205,64 @@ func (t *TestOptions) TheApplicationIsRunningInStaging(statusCode int) {
 	t.TheApplicationIsRunning(statusCode, "staging")
 }
 
-// TheApplicationIsRunning lets assert that the application is deployed into the passed environment
+// TheApplicationIsRunning lets assert that the application is deployed into the passed environment. It is recorded as
+// the promotion phase of staging and production.
 func (t *TestOptions) TheApplicationIsRunning(statusCode int, environment string) {
+	t.TheApplicationVersionIsRunning(statusCode, environment, nil)
+}
+
+// VersionCheck returns an error if the version of an application is not the one expected
+type VersionCheck func(version string) error
+
+// ExactVersion checks that the application has the version
+func ExactVersion(expected string) VersionCheck {
+	return func(version string) error {
+		if version != expected {
+			return fmt.Errorf("the version is %s rather than %s", version, expected)
+		}
+		return nil
+	}
+}
+
+// NotVersion checks that the application has a version other than the given one, such as the version which was
+// running before a new release
+func NotVersion(previous string) VersionCheck {
+	return func(version string) error {
+		if version == "" || version == previous {
+			return fmt.Errorf("the version is still %s", previous)
+		}
+		return nil
+	}
+}
+
+// TheApplicationVersionIsRunning lets assert that the application is deployed into the passed environment with a
+// version passing the check, waiting for the version to be promoted. A nil check accepts any version.
+func (t *TestOptions) TheApplicationVersionIsRunning(statusCode int, environment string, checkVersion VersionCheck) {
+	if phase := environmentPhases[environment]; phase != "" {
+		t.Phase(phase, func() {
+			t.theApplicationIsRunning(statusCode, environment, checkVersion)
+		})
+		return
+	}
+	t.theApplicationIsRunning(statusCode, environment, checkVersion)
+}
+
+func (t *TestOptions) theApplicationIsRunning(statusCode int, environment string, checkVersion VersionCheck) {
 	u := ""
+	var running *parsers.Application
 	args := []string{"get", "applications", "-e", environment}
 	r := runner.New(t.WorkDir, nil, 0)
 	argsStr := strings.Join(args, " ")
 	f := func() (interface{}, error) {
 		var err error
 		var out string
-		By(fmt.Sprintf("running jx %s", argsStr), func() {
-			out, err = r.RunWithOutput(args...)
+		Step(fmt.Sprintf("running jx %s", argsStr), func() {
+			out, err = RunJxWithStructuredOutput(r, args...)
 			utils.ExpectNoError(err)
 		})
 		var applications map[string]parsers.Application
-		By(fmt.Sprintf("parsing the output of jx %s", argsStr), func() {
-			applications, err = parsers.ParseJxGetApplications(out)
+		Step(fmt.Sprintf("parsing the output of jx %s", argsStr), func() {
+			applications, err = parsers.ParseApplications(out)
 		})
 		if err != nil {
 			// Need to do return an error here to perform a retry and backoff
@@ -360,7 +272,7 @@ func (t *TestOptions) TheApplicationIsRunning(statusCode int, environment string
 
 		applicationName := t.GetApplicationName()
 		var application *parsers.Application
-		By(fmt.Sprintf("validating that the application %s was returned by jx %s", applicationName, argsStr), func() {
+		Step(fmt.Sprintf("validating that the application %s was returned by jx %s", applicationName, argsStr), func() {
 			application, err = getApplication(applicationName, applications)
 		})
 		if err != nil {
@@ -368,37 +280,43 @@ func (t *TestOptions) TheApplicationIsRunning(statusCode int, environment string
 			return nil, err
 		}
 		Expect(application).ShouldNot(BeNil(), "no application found for % in environment %s", applicationName, environment)
-		By(fmt.Sprintf("getting url for application %s", application.Name), func() {
+		Step(fmt.Sprintf("getting url for application %s", application.Name), func() {
 			u = application.Url
+			running = application
 		})
 		if u == "" {
 			return nil, fmt.Errorf("no URL found for environment %s has app: %#v", environment, applications)
 		}
+		if checkVersion != nil {
+			err = checkVersion(application.Version)
+			if err != nil {
+				err = fmt.Errorf("application %s in environment %s: %w", applicationName, environment, err)
+				utils.LogInfof("%s\n", err.Error())
+				return nil, err
+			}
+		}
 		utils.LogInfof("still looking for application %s in env %s\n", applicationName, environment)
 		return nil, nil
 	}
 
-	By(fmt.Sprintf("retrying jx %s with exponential backoff", argsStr), func() {
+	Step(fmt.Sprintf("retrying jx %s with exponential backoff", argsStr), func() {
 		err := RetryExponentialBackoff(TimeoutBuildIsRunningInStaging, f)
 		Expect(err).ShouldNot(HaveOccurred(), "get applications with a URL")
 	})
 
-	By(fmt.Sprintf("getting %s", u), func() {
+	Step(fmt.Sprintf("getting %s", u), func() {
 		Expect(u).ShouldNot(BeEmpty(), "no URL for environment %s", environment)
-		err := t.ExpectUrlReturns(u, statusCode, TimeoutUrlReturns)
-		Expect(err).ShouldNot(HaveOccurred(), fmt.Sprintf("request application URL should return %d", statusCode))
+		err := t.expectApplicationServes(u, statusCode, TimeoutUrlReturns)
+		Expect(err).ShouldNot(HaveOccurred(), fmt.Sprintf("request application URL should return %d and serve its content", statusCode))
 	})
-}
 
-// WaitForDeployment waits for the specified deployment to rollout. Wait timeout can be set via BDD_DEPLOYMENT_ROLLOUT_WAIT.
-func (t *TestOptions) WaitForDeploymentRollout(deployment string) {
-	args := []string{"rollout", "status", "-w", fmt.Sprintf("deployment/%s", deployment)}
-	command := exec.Command("kubectl", args...)
-	session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
-	Expect(err).Should(BeNil())
+	namespace, err := EnvironmentNamespace(environment)
+	Expect(err).ShouldNot(HaveOccurred(), "namespace of environment %s", environment)
+	t.TheApplicationIsDeployed(namespace, running)
 
-	session.Wait(TimeoutDeploymentRollout)
-	Eventually(session).Should(gexec.Exit())
+	if t.ShouldTestClusterRepo() {
+		t.TheClusterRepoHasTheApplication(environment, running.Version)
+	}
 }
 
 func getApplication(applicationName string, runningApplications map[string]parsers.Application) (*parsers.Application, error) {
@@ -425,10 +343,10 @@ func (t *TestOptions) TheApplicationShouldBeBuiltAndPromotedViaCICD(statusCode i
 	branch := t.GetDefaultBranch()
 	jobName := owner + "/" + applicationName + "/" + branch
 
-	By(fmt.Sprintf("checking that job %s completes successfully", jobName), func() {
-		t.ThereShouldBeAJobThatCompletesSuccessfully(jobName, TimeoutBuildCompletes)
+	Step(fmt.Sprintf("checking that job %s completes successfully", jobName), func() {
+		t.TheFirstReleaseShouldCompleteSuccessfully(jobName, TimeoutBuildCompletes)
 	})
-	By("checking that the application is running in staging", func() {
+	Step("checking that the application is running in staging", func() {
 		t.TheApplicationIsRunningInStaging(statusCode)
 	})
 }
@@ -439,22 +357,25 @@ func (t *TestOptions) CreatePullRequestWithLocalChange(prTitle string, makeLocal
 	applicationName := t.GetApplicationName()
 	workDir := filepath.Join(t.WorkDir, applicationName)
 	r := runner.New(workDir, nil, 0)
-	branchName := "changes-" + rand.String(5)
+	// the branch is named after the application rather than randomly so that replayed transcripts match
+	t.pullRequests++
+	branchName := fmt.Sprintf("changes-%s-%d", applicationName, t.pullRequests)
 
-	By(fmt.Sprintf("creating a pull request in directory %s", workDir), func() {
+	Step(fmt.Sprintf("creating a pull request in directory %s", workDir), func() {
 		t.ExpectCommandExecution(workDir, TimeoutCmdLine, 0, "git", "checkout", "-b", branchName)
 	})
 
-	By("making a code change, committing and pushing it", func() {
+	Step("making a code change, committing and pushing it", func() {
 		makeLocalChange(workDir)
 		t.ExpectCommandExecution(workDir, time.Minute, 0, "git", "commit", "-a", "-m", "My first PR commit")
 		t.ExpectCommandExecution(workDir, time.Minute, 0, "git", "push", "--set-upstream", "origin", branchName)
+		t.RegisterBranchCleanup(workDir, branchName)
 	})
 
 	args := []string{"create", "pullrequest", "-b", "--title", prTitle, "--body", "PR comments"}
 	argsStr := strings.Join(args, " ")
 	var out string
-	By(fmt.Sprintf("creating a pull request by running jx %s", argsStr), func() {
+	Step(fmt.Sprintf("creating a pull request by running jx %s", argsStr), func() {
 		var err error
 		out, err = r.RunWithOutputNoTimeout(args...)
 		out = strings.TrimSpace(out)
@@ -470,13 +391,13 @@ func (t *TestOptions) CreatePullRequestWithLocalChange(prTitle string, makeLocal
 
 	var pr *parsers.CreatePullRequest
 	var err error
-	By(fmt.Sprintf("parsing the output %s of jx %s", out, argsStr), func() {
+	Step(fmt.Sprintf("parsing the output %s of jx %s", out, argsStr), func() {
 		pr, err = parsers.ParseJxCreatePullRequest(out)
 		utils.ExpectNoError(err)
 	})
 
 	var prNumber int
-	By(fmt.Sprintf("validating that the pull request %v exists and has a number", pr), func() {
+	Step(fmt.Sprintf("validating that the pull request %v exists and has a number", pr), func() {
 		Expect(pr).ShouldNot(BeNil())
 		prNumber = pr.PullRequestNumber
 		Expect(prNumber).ShouldNot(BeNil())
@@ -486,7 +407,8 @@ func (t *TestOptions) CreatePullRequestWithLocalChange(prTitle string, makeLocal
 }
 
 // CreatePullRequestAndGetPreviewEnvironment asserts that a pull request can be created
-// on the application and the PR goes green and a preview environment is available
+// on the application and the PR goes green and a preview environment is available.
+// Unless the teardown check is disabled the pull request is then closed and its preview has to be removed.
 func (t *TestOptions) CreatePullRequestAndGetPreviewEnvironment(statusCode int) error {
 	applicationName := t.GetApplicationName()
 	workDir := filepath.Join(t.WorkDir, applicationName)
@@ -512,56 +434,47 @@ func (t *TestOptions) CreatePullRequestAndGetPreviewEnvironment(statusCode int)
 	prNumber := pr.PullRequestNumber
 	buildNumber := 0
 	jobName := owner + "/" + applicationName + "/PR-" + strconv.Itoa(prNumber)
-	By(fmt.Sprintf("checking that job %s completes successfully", jobName), func() {
+	Step(fmt.Sprintf("checking that job %s completes successfully", jobName), func() {
 		buildNumber = t.ThereShouldBeAJobThatCompletesSuccessfully(jobName, TimeoutBuildCompletes)
 	})
 	if t.ShouldTestPipelineActivityUpdate() {
-		By("verifying that PipelineActivity has been updated to include the pull request title", func() {
+		Step("verifying that PipelineActivity has been updated to include the pull request title", func() {
 			pullTitle := t.GetPullTitleFromActivity(owner, applicationName, "pr-"+strconv.Itoa(prNumber), buildNumber)
 			Expect(pullTitle).Should(Equal(prTitle))
 		})
 	}
 
-	args := []string{"get", "previews"}
-	argsStr := strings.Join(args, " ")
-	var out string
-	By(fmt.Sprintf("verifying there is a preview environment by running jx %s", argsStr), func() {
-		var err error
-		out, err = r.RunWithOutput(args...)
-		utils.ExpectNoError(err)
+	t.Phase(PhasePreviewURLAvailable, func() {
+		t.previewURLReturns(r, pr, statusCode)
 	})
+	if t.ShouldTestPreviewTeardown() {
+		t.ClosePullRequestAndExpectPreviewRemoved(pr)
+	}
+	return nil
+}
+
+// previewURLReturns waits for the preview environment of the pull request to return the status code
+func (t *TestOptions) previewURLReturns(r *runner.JxRunner, pr *parsers.CreatePullRequest, statusCode int) {
+	findPreview := t.previewFromResource
+	if !usePreviewResources() {
+		findPreview = t.previewFromJxGetPreviews(r)
+	}
 
 	logError := func(err error) error {
 		utils.LogInfof("WARNING: %s\n", err.Error())
 		return err
 	}
 
+	previewNamespace := ""
 	f := func() (interface{}, error) {
-		var err error
-		var previews map[string]parsers.Preview
-
-		utils.LogInfof("parsing the output of jx %s", argsStr)
-		out, err = r.RunWithOutput(args...)
+		previewEnv, err := findPreview(pr)
 		if err != nil {
 			return nil, logError(err)
 		}
-		previews, err = parsers.ParseJxGetPreviews(out)
-		if err != nil {
-			return nil, logError(err)
-		}
-		previewEnv := previews[pr.Url]
 		applicationUrl := previewEnv.Url
-		if applicationUrl == "" {
-			idx := strings.LastIndex(pr.Url, "/")
-			for k, v := range previews {
-				utils.LogInfof("found Preview URL %s with preview %s", k, v.Url)
-				if idx > 0 {
-					if strings.HasSuffix(k, pr.Url[idx:]) {
-						applicationUrl = v.Url
-						utils.LogInfof("for PR %s using preview %s", k, applicationUrl)
-					}
-				}
-			}
+		if previewEnv.Namespace != "" && previewNamespace == "" {
+			previewNamespace = previewEnv.Namespace
+			t.RegisterPreviewCleanup(previewNamespace)
 		}
 		if applicationUrl == "" {
 			return nil, logError(fmt.Errorf("no Preview Application URL found for PR %s", pr.Url))
@@ -569,45 +482,92 @@ func (t *TestOptions) CreatePullRequestAndGetPreviewEnvironment(statusCode int)
 
 		utils.LogInfof("Running Preview Environment application at: %s\n", termcolor.ColorInfo(applicationUrl))
 
-		err = t.ExpectUrlReturns(applicationUrl, statusCode, TimeoutUrlReturns)
+		err = t.expectApplicationServes(applicationUrl, statusCode, TimeoutUrlReturns)
 		if err != nil {
 			return nil, logError(fmt.Errorf("preview URL at %s not working: %s", applicationUrl, err.Error()))
 		}
 		return nil, nil
 	}
 
-	By(fmt.Sprint("retrying waiting for Preview URL to be working with exponential backoff to ensure it completes"), func() {
+	Step(fmt.Sprint("retrying waiting for Preview URL to be working with exponential backoff to ensure it completes"), func() {
 		_, err := Retry(TimeoutPreviewUrlReturns, f)
 		Expect(err).ShouldNot(HaveOccurred(), "preview environment visible at a URL")
 	})
-	return nil
+	if previewNamespace != "" {
+		// the version of a preview is a snapshot of the pull request so only its pods are checked
+		t.TheApplicationIsDeployed(previewNamespace, &parsers.Application{Name: t.GetApplicationName()})
+	}
+}
 
+// previewFromResource returns the preview of the pull request from its jx-preview Preview resource
+func (t *TestOptions) previewFromResource(pr *parsers.CreatePullRequest) (parsers.Preview, error) {
+	preview, err := t.PreviewForPullRequest(pr)
+	if err != nil {
+		return parsers.Preview{}, err
+	}
+	if preview == nil {
+		return parsers.Preview{}, fmt.Errorf("no Preview resource found for PR %s in namespace %s", pr.Url, Namespace)
+	}
+	return parsers.Preview{PullRequest: preview.PullRequestURL, Namespace: preview.PreviewNamespace, Url: preview.URL}, nil
 }
 
-// SetGitHubToken runs jx create git token using the values of GIT_ORGANISATION & GH_ACCESS_TOKEN
+// previewFromJxGetPreviews returns a function which finds the preview of the pull request by parsing jx get previews,
+// matching the pull request URL by its suffix as some git providers report it differently
+func (t *TestOptions) previewFromJxGetPreviews(r *runner.JxRunner) func(pr *parsers.CreatePullRequest) (parsers.Preview, error) {
+	args := []string{"get", "previews"}
+	argsStr := strings.Join(args, " ")
+	Step(fmt.Sprintf("verifying there is a preview environment by running jx %s", argsStr), func() {
+		_, err := r.RunWithOutput(args...)
+		utils.ExpectNoError(err)
+	})
+
+	return func(pr *parsers.CreatePullRequest) (parsers.Preview, error) {
+		utils.LogInfof("parsing the output of jx %s", argsStr)
+		out, err := RunJxWithStructuredOutput(r, args...)
+		if err != nil {
+			return parsers.Preview{}, err
+		}
+		previews, err := parsers.ParsePreviews(out)
+		if err != nil {
+			return parsers.Preview{}, err
+		}
+		previewEnv := previews[pr.Url]
+		if previewEnv.Url == "" {
+			idx := strings.LastIndex(pr.Url, "/")
+			for k, v := range previews {
+				utils.LogInfof("found Preview URL %s with preview %s", k, v.Url)
+				if idx > 0 {
+					if strings.HasSuffix(k, pr.Url[idx:]) {
+						previewEnv = v
+						utils.LogInfof("for PR %s using preview %s", k, v.Url)
+					}
+				}
+			}
+		}
+		return previewEnv, nil
+	}
+}
+
+// SetGitHubToken runs jx create git token using the configured git organisation and token
 func (t *TestOptions) SetGitHubToken() {
-	gitUser, set := os.LookupEnv("GIT_ORGANISATION")
-	if !set {
+	gitUser := Config.Git.Organisation
+	if gitUser == "" {
 		Fail("GIT_ORGANISATION environment variable must be set")
 	}
 
-	token, set := os.LookupEnv("GH_ACCESS_TOKEN")
-	if !set {
+	token := Config.Git.Token
+	if token == "" {
 		Fail("GH_ACCESS_TOKEN environment variable must be set")
 	}
 
 	args := []string{"create", "git", "token", gitUser, "-t", token}
-	command := exec.Command(runner.JxBin(), args...)
-	session, err := gexec.Start(command, nil, nil)
+	entry, err := runCommand("", TimeoutCmdLine, nil, nil, runner.JxBin(), args...)
 	Expect(err).Should(BeNil())
-
-	session.Wait(TimeoutCmdLine)
-	Eventually(session).Should(gexec.Exit(0))
+	Expect(entry.ExitCode).Should(Equal(0), "exit code of jx create git token")
 }
 
-/*
 // GetPullRequestWithTitle Returns a pull request with a matching title
-func (t *TestOptions) GetPullRequestWithTitle(provider gits.GitProvider, repoOwner string, repoName string, title string) (*gits.GitPullRequest, error) {
+func (t *TestOptions) GetPullRequestWithTitle(provider gits.Provider, repoOwner string, repoName string, title string) (*gits.PullRequest, error) {
 	pullRequestList, err := provider.ListOpenPullRequests(repoOwner, repoName)
 	if err != nil {
 		return nil, err
@@ -622,31 +582,26 @@ func (t *TestOptions) GetPullRequestWithTitle(provider gits.GitProvider, repoOwn
 	return nil, nil
 }
 
-// ApprovePullRequestFromLogOutput takes the default provider, the approver user's provider, git info, and the output from a command that
+// ApprovePullRequestFromLogOutput takes the default provider, the approver user's provider and the output from a command that
 // created a PR, and adds the approver user as a collaborator, accepts the invitation, and approves the PR.
-func (t *TestOptions) ApprovePullRequestFromLogOutput(provider gits.GitProvider, approverProvider gits.GitProvider, gitInfo *gits.GitRepository, output string) {
+func (t *TestOptions) ApprovePullRequestFromLogOutput(provider gits.Provider, approverProvider gits.Provider, output string) {
 	createdPR, err := parsers.ParseJxCreatePullRequestFromFullLog(output)
 	Expect(err).ShouldNot(HaveOccurred())
 	Expect(createdPR).ShouldNot(BeNil())
 
-	repoStruct := &gits.GitRepository{
-		Name:         gitInfo.Name,
-		Organisation: gitInfo.Organisation,
-		Project:      gitInfo.Organisation,
-	}
-	pr, err := provider.GetPullRequest(gitInfo.Organisation, repoStruct, createdPR.PullRequestNumber)
+	pr, err := provider.GetPullRequest(createdPR.Owner, createdPR.Repository, createdPR.PullRequestNumber)
 	Expect(err).ShouldNot(HaveOccurred())
 	Expect(pr).ShouldNot(BeNil())
-	Expect(*pr.State).Should(Or(Equal("open"), Equal("opened")))
+	Expect(pr.Closed).Should(BeFalse(), "pull request %s should be open", createdPR.Url)
 
-	By("approving the PR")
+	Step("approving the PR")
 	err = t.ApprovePullRequest(provider, approverProvider, pr)
 	Expect(err).ShouldNot(HaveOccurred())
 }
 
 // AddApproverAsCollaborator adds the approver user as a collaborator to the given repo, and accepts the invitation.
-func (t *TestOptions) AddApproverAsCollaborator(provider gits.GitProvider, approverProvider gits.GitProvider, repoOwner string, repoName string) error {
-	err := provider.AddCollaborator(PullRequestApproverUsername, repoOwner, repoName)
+func (t *TestOptions) AddApproverAsCollaborator(provider gits.Provider, approverProvider gits.Provider, repoOwner string, repoName string) error {
+	err := provider.AddCollaborator(approverProvider.CurrentUsername(), repoOwner, repoName)
 	if err != nil {
 		// Ignore the error and just return if the provider is gitlab and the error contains "Member already exists"
 		if strings.Contains(err.Error(), "Member already exists") {
@@ -659,14 +614,14 @@ func (t *TestOptions) AddApproverAsCollaborator(provider gits.GitProvider, appro
 		return nil
 	}
 	// Sleep a few seconds since the invitation doesn't seem to always show up promptly.
-	time.Sleep(15 * time.Second)
-	invites, _, err := approverProvider.ListInvitations()
+	time.Sleep(InvitationDelay)
+	invites, err := approverProvider.ListInvitations()
 	if err != nil {
 		return err
 	}
 	for _, x := range invites {
-		// Accept all invitations for the pipeline user
-		_, err = approverProvider.AcceptInvitation(*x.ID)
+		// Accept all invitations for the approver user
+		err = approverProvider.AcceptInvitation(x.ID)
 		if err != nil {
 			return err
 		}
@@ -675,37 +630,27 @@ func (t *TestOptions) AddApproverAsCollaborator(provider gits.GitProvider, appro
 }
 
 // GetPullRequestByNumber Returns a pull request with the given owner, repo, and number
-func (t *TestOptions) GetPullRequestByNumber(provider gits.GitProvider, repoOwner string, repoName string, prNumber int) (*gits.GitPullRequest, error) {
-	repoStruct := &gits.GitRepository{
-		Name:         repoName,
-		Organisation: repoOwner,
-		Project:      repoOwner,
-	}
-	pr, err := provider.GetPullRequest(repoOwner, repoStruct, prNumber)
-	if err != nil {
-		return nil, err
-	}
-
-	return pr, nil
+func (t *TestOptions) GetPullRequestByNumber(provider gits.Provider, repoOwner string, repoName string, prNumber int) (*gits.PullRequest, error) {
+	return provider.GetPullRequest(repoOwner, repoName, prNumber)
 }
 
 // WaitForPullRequestCommitStatus checks a pull request until either it reaches a given status in all the contexts supplied
 // or a timeout is reached.
-func (t *TestOptions) WaitForPullRequestCommitStatus(provider gits.GitProvider, pr *gits.GitPullRequest, contexts []string, desiredStatuses ...string) {
-	Expect(pr.LastCommitSha).ShouldNot(Equal(""))
+func (t *TestOptions) WaitForPullRequestCommitStatus(provider gits.Provider, pr *gits.PullRequest, contexts []string, desiredStatuses ...string) {
+	Expect(pr.Sha).ShouldNot(Equal(""))
 
-	checkPRStatuses := func() error {
-		statuses, err := provider.ListCommitStatus(pr.Owner, pr.Repo, pr.LastCommitSha)
+	checkPRStatuses := func() (any, error) {
+		statuses, err := provider.ListCommitStatus(pr.Owner, pr.Repo, pr.Sha)
 		if err != nil {
-			utils.LogInfof("error fetching commit statuses for PR %s/%s/%d: %s\n", pr.Owner, pr.Repo, *pr.Number, err)
-			return err
+			utils.LogInfof("error fetching commit statuses for PR %s/%d: %s\n", pr.FullName(), pr.Number, err)
+			return nil, err
 		}
-		contextStatuses := make(map[string]*gits.GitRepoStatus)
+		contextStatuses := make(map[string]*scm.Status)
 		// For GitHub, only set the status if it's the first one we see for the context, which is always the newest
 		// For GitLab, ordering is actually the inverse,
 
-		var orderedStatuses []*gits.GitRepoStatus
-		if provider.Kind() == "gitlab" {
+		var orderedStatuses []*scm.Status
+		if provider.Kind() == gits.KindGitLab {
 			for i := len(statuses) - 1; i >= 0; i-- {
 				orderedStatuses = append(orderedStatuses, statuses[i])
 			}
@@ -714,53 +659,48 @@ func (t *TestOptions) WaitForPullRequestCommitStatus(provider gits.GitProvider,
 		}
 		for _, status := range orderedStatuses {
 			if status == nil {
-				return err
+				continue
 			}
-			if _, exists := contextStatuses[status.Context]; !exists {
-				contextStatuses[status.Context] = status
+			if _, exists := contextStatuses[status.Label]; !exists {
+				contextStatuses[status.Label] = status
 			}
 		}
 
-		var matchedStatus *gits.GitRepoStatus
+		var matchedStatus *scm.Status
 		var wrongStatuses []string
 
 		for _, c := range contexts {
 			status, ok := contextStatuses[c]
 			if !ok || status == nil {
 				wrongStatuses = append(wrongStatuses, fmt.Sprintf("%s: missing", c))
-			} else if !isADesiredStatus(status.State, desiredStatuses) {
-				wrongStatuses = append(wrongStatuses, fmt.Sprintf("%s: %s", c, status.State))
+			} else if !isADesiredStatus(status.State.String(), desiredStatuses) {
+				wrongStatuses = append(wrongStatuses, fmt.Sprintf("%s: %s", c, status.State.String()))
 			} else {
 				matchedStatus = status
 			}
 		}
 
 		if len(wrongStatuses) > 0 {
-			errMsg := fmt.Sprintf("wrong or missing status for PR %s/%s/%d context(s): %s, expected %s", pr.Owner, pr.Repo, *pr.Number, strings.Join(wrongStatuses, ", "), strings.Join(desiredStatuses, ","))
+			errMsg := fmt.Sprintf("wrong or missing status for PR %s/%d context(s): %s, expected %s", pr.FullName(), pr.Number, strings.Join(wrongStatuses, ", "), strings.Join(desiredStatuses, ","))
 			utils.LogInfof("WARNING: %s\n", errMsg)
-			return errors.New(errMsg)
+			return nil, errors.New(errMsg)
 		}
 
 		// Check if the link exists and has the appropriate prefix, if appropriate
-		if LighthouseBaseReportURL != "" && matchedStatus != nil {
+		if Config.LighthouseBaseReportURL != "" && matchedStatus != nil {
 			// We don't care about the build number.
-			expectedPrefix := fmt.Sprintf("%s/teams/jx/projects/%s/%s/PR-%d/", LighthouseBaseReportURL, strings.ToLower(pr.Owner), pr.Repo, *pr.Number)
-			if !strings.HasPrefix(matchedStatus.TargetURL, expectedPrefix) {
-				errMsg := fmt.Sprintf("wrong or missing build link on status for PR %s/%s/%s. Expected %s, got %s", pr.Owner, pr.Repo, pr.NumberString(), expectedPrefix, matchedStatus.TargetURL)
+			expectedPrefix := fmt.Sprintf("%s/teams/jx/projects/%s/%s/PR-%d/", Config.LighthouseBaseReportURL, strings.ToLower(pr.Owner), pr.Repo, pr.Number)
+			if !strings.HasPrefix(matchedStatus.Target, expectedPrefix) {
+				errMsg := fmt.Sprintf("wrong or missing build link on status for PR %s/%d. Expected %s, got %s", pr.FullName(), pr.Number, expectedPrefix, matchedStatus.Target)
 				utils.LogInfof("WARNING: %s\n", errMsg)
-				return errors.New(errMsg)
+				return nil, errors.New(errMsg)
 			}
 		}
 
-		return nil
+		return nil, nil
 	}
 
-	exponentialBackOff := backoff.NewExponentialBackOff()
-	exponentialBackOff.MaxElapsedTime = TimeoutPipelineActivityComplete
-	exponentialBackOff.MaxInterval = 10 * time.Second
-	exponentialBackOff.Reset()
-	err := backoff.Retry(checkPRStatuses, exponentialBackOff)
-
+	err := RetryExponentialBackoff(TimeoutPipelineActivityComplete, checkPRStatuses)
 	Expect(err).ShouldNot(HaveOccurred())
 }
 
@@ -773,9 +713,7 @@ func isADesiredStatus(status string, desiredStatuses []string) bool {
 	return false
 }
 
-
-
-
+// CreateChatOpsCommands checks that a git provider can be created for running ChatOps commands
 func (t *TestOptions) CreateChatOpsCommands(commands []string) error {
 	gitProvider, err := t.GetGitProvider()
 	if err != nil {
@@ -787,65 +725,55 @@ func (t *TestOptions) CreateChatOpsCommands(commands []string) error {
 	return nil
 }
 
-// CreateIssueAndAssignToUser creates an issue on the configure git provider and assigns it to a user.
-func (t *TestOptions) CreateIssueAndAssignToUserWithChatOpsCommand(issue *gits.GitIssue, provider gits.GitProvider) error {
-
-	createdIssue, err := provider.CreateIssue(issue.Owner, issue.Repo, issue)
+// CreateIssueAndAssignToUserWithChatOpsCommand creates an issue on the configure git provider and assigns it to a user.
+func (t *TestOptions) CreateIssueAndAssignToUserWithChatOpsCommand(owner string, repo string, issue *scm.IssueInput, provider gits.Provider) error {
+	createdIssue, err := provider.CreateIssue(owner, repo, issue)
 	if err != nil {
 		return err
 	}
 
-	utils.LogInfof("created issue with number %d\n", *createdIssue.Number)
+	utils.LogInfof("created issue with number %d\n", createdIssue.Number)
 
 	cmd := "assign"
 	// Deal with GitLab hijacking /assign
-	if provider.Kind() == "gitlab" {
+	if provider.Kind() == gits.KindGitLab {
 		cmd = "lh-" + cmd
 	}
-	err = provider.CreateIssueComment(
-		issue.Owner,
-		issue.Repo,
-		*createdIssue.Number,
-		fmt.Sprintf("/%s %s", cmd, provider.CurrentUsername()),
-	)
+	err = provider.CreateIssueComment(owner, repo, createdIssue.Number, fmt.Sprintf("/%s %s", cmd, provider.CurrentUsername()))
 	if err != nil {
 		return err
 	}
-	utils.LogInfof("create issue comment on issue %d\n", *createdIssue.Number)
-
-	createdIssue.Owner = issue.Owner
-	createdIssue.Repo = issue.Repo
+	utils.LogInfof("create issue comment on issue %d\n", createdIssue.Number)
 
 	return t.ExpectThatIssueIsAssignedToUser(provider, createdIssue, provider.CurrentUsername())
-
 }
 
-// ExpectThatIssueIsAssignedToUser returns an error if
-func (t *TestOptions) ExpectThatIssueIsAssignedToUser(provider gits.GitProvider, issue *gits.GitIssue, username string) error {
-	f := func() error {
-		fetchedIssue, err := provider.GetIssue(issue.Owner, issue.Repo, *issue.Number)
+// ExpectThatIssueIsAssignedToUser returns an error if the issue is not assigned to the user within the timeout
+func (t *TestOptions) ExpectThatIssueIsAssignedToUser(provider gits.Provider, issue *gits.Issue, username string) error {
+	f := func() (any, error) {
+		fetchedIssue, err := provider.GetIssue(issue.Owner, issue.Repo, issue.Number)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if fetchedIssue == nil {
-			return fmt.Errorf("fetched issue is nil but did not throw an error")
+			return nil, fmt.Errorf("fetched issue is nil but did not throw an error")
 		}
 
 		for _, assignee := range fetchedIssue.Assignees {
 			if assignee.Login == username {
-				return nil
+				return nil, nil
 			}
 		}
 
-		return fmt.Errorf("user was not found in issue assignees")
+		return nil, fmt.Errorf("user was not found in issue assignees")
 	}
 	return RetryExponentialBackoff(TimeoutProwActionWait, f)
 }
 
 // MostRecentOpenPullRequestForOwnerAndRepo returns the most recently opened pull request for a given owner/repo. If
 // there aren't any open PRs, it will return nil.
-func (t *TestOptions) MostRecentOpenPullRequestForOwnerAndRepo(provider gits.GitProvider, owner string, repo string) (*gits.GitPullRequest, error) {
+func (t *TestOptions) MostRecentOpenPullRequestForOwnerAndRepo(provider gits.Provider, owner string, repo string) (*gits.PullRequest, error) {
 	pullRequests, err := provider.ListOpenPullRequests(owner, repo)
 	if err != nil {
 		return nil, err
@@ -854,15 +782,7 @@ func (t *TestOptions) MostRecentOpenPullRequestForOwnerAndRepo(provider gits.Git
 		return nil, fmt.Errorf("no open pull requests found for %s/%s", owner, repo)
 	}
 	sort.SliceStable(pullRequests, func(i, j int) bool {
-		iNum := 0
-		jNum := 0
-		if pullRequests[i].Number != nil {
-			iNum = *pullRequests[i].Number
-		}
-		if pullRequests[j].Number != nil {
-			jNum = *pullRequests[j].Number
-		}
-		return iNum > jNum
+		return pullRequests[i].Number > pullRequests[j].Number
 	})
 
 	// The first element in the slice is the open PR with the highest number.
@@ -870,105 +790,83 @@ func (t *TestOptions) MostRecentOpenPullRequestForOwnerAndRepo(provider gits.Git
 }
 
 // ApprovePullRequest attempts to /approve a PR with the given approver git provider, then verify the label is there with the default provider
-func (t *TestOptions) ApprovePullRequest(defaultProvider gits.GitProvider, approverProvider gits.GitProvider, pullRequest *gits.GitPullRequest) error {
-	By("adding the approver user as a collaborator")
+func (t *TestOptions) ApprovePullRequest(defaultProvider gits.Provider, approverProvider gits.Provider, pullRequest *gits.PullRequest) error {
+	Step("adding the approver user as a collaborator")
 	err := t.AddApproverAsCollaborator(defaultProvider, approverProvider, pullRequest.Owner, pullRequest.Repo)
 	Expect(err).ShouldNot(HaveOccurred())
 
-	By("approving the PR")
+	Step("approving the PR")
 	approveCmd := "approve"
-	if approverProvider.Kind() == "gitlab" {
+	if approverProvider.Kind() == gits.KindGitLab {
 		approveCmd = "lh-" + approveCmd
 	}
 
 	err = approverProvider.AddPRComment(pullRequest, fmt.Sprintf("/%s", approveCmd))
 	Expect(err).ShouldNot(HaveOccurred())
 
-	By("waiting for the approved label to appear")
-	return t.ExpectThatPullRequestHasLabel(defaultProvider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "approved")
+	Step("waiting for the approved label to appear")
+	return t.ExpectThatPullRequestHasLabel(defaultProvider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "approved")
 }
 
 // AttemptToLGTMOwnPullRequest return an error if the /lgtm fails to add the lgtm label to PR
-func (t *TestOptions) AttemptToLGTMOwnPullRequest(provider gits.GitProvider, pullRequest *gits.GitPullRequest) error {
+func (t *TestOptions) AttemptToLGTMOwnPullRequest(provider gits.Provider, pullRequest *gits.PullRequest) error {
 	err := provider.AddPRComment(pullRequest, "/lgtm")
 	if err != nil {
 		return err
 	}
 
-	repoStruct := &gits.GitRepository{
-		Name:         pullRequest.Repo,
-		Organisation: pullRequest.Owner,
-		Project:      pullRequest.Owner,
-	}
-	updatedPullRequest, err := provider.GetPullRequest(pullRequest.Owner, repoStruct, *pullRequest.Number)
-	if err != nil {
-		return err
-	}
-
-	return t.ExpectThatPullRequestHasCommentWithText(provider, updatedPullRequest, "you cannot LGTM your own PR.")
+	return t.ExpectThatPullRequestHasCommentWithText(provider, pullRequest, "you cannot LGTM your own PR.")
 }
 
 // ExpectThatPullRequestHasCommentWithText returns an error if the PR does not have a comment with the specified text
-func (t *TestOptions) ExpectThatPullRequestHasCommentWithText(provider gits.GitProvider, pullRequest *gits.GitPullRequest, commentText string) error {
-	f := func() error {
-		userAuth := provider.UserAuth()
-
-		scmClient, err := scmFactory.NewClient(provider.Kind(), provider.ServerURL(), userAuth.ApiToken)
-		if err != nil {
-			return err
-		}
-
-		repoString := fmt.Sprintf("%s/%s", pullRequest.Owner, pullRequest.Repo)
-		comments, _, err := scmClient.PullRequests.ListComments(context.Background(), repoString, *pullRequest.Number, scm.ListOptions{})
-
+func (t *TestOptions) ExpectThatPullRequestHasCommentWithText(provider gits.Provider, pullRequest *gits.PullRequest, commentText string) error {
+	return t.ExpectThatPullRequestHasCommentMatching(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, func(comments []*scm.Comment) error {
 		for _, comment := range comments {
 			if strings.Contains(comment.Body, commentText) {
 				return nil
 			}
 		}
 		return fmt.Errorf("comment text not found in PR")
-	}
-
-	return RetryExponentialBackoff(TimeoutProwActionWait, f)
+	})
 }
 
 // AddHoldLabelToPullRequestWithChatOpsCommand returns an error of the command fails to add the do-not-merge/hold label
-func (t *TestOptions) AddHoldLabelToPullRequestWithChatOpsCommand(provider gits.GitProvider, pullRequest *gits.GitPullRequest) error {
-	By("Adding the /hold comment and waiting for the label to be present")
+func (t *TestOptions) AddHoldLabelToPullRequestWithChatOpsCommand(provider gits.Provider, pullRequest *gits.PullRequest) error {
+	Step("Adding the /hold comment and waiting for the label to be present")
 	err := provider.AddPRComment(pullRequest, "/hold")
 	if err != nil {
 		return err
 	}
 
-	err = t.ExpectThatPullRequestHasLabel(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/hold")
+	err = t.ExpectThatPullRequestHasLabel(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/hold")
 	if err != nil {
 		return err
 	}
 
-	By("Adding the /hold cancel comment and waiting for the label to be gone")
+	Step("Adding the /hold cancel comment and waiting for the label to be gone")
 	err = provider.AddPRComment(pullRequest, "/hold cancel")
 	if err != nil {
 		return err
 	}
 
-	return t.ExpectThatPullRequestDoesNotHaveLabel(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/hold")
+	return t.ExpectThatPullRequestDoesNotHaveLabel(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/hold")
 }
 
 // AddReviewerToPullRequestWithChatOpsCommand returns an error of the command fails to add the reviewer to either the reviewers list or the assignees list
-func (t *TestOptions) AddReviewerToPullRequestWithChatOpsCommand(provider gits.GitProvider, approverProvider gits.GitProvider, pullRequest *gits.GitPullRequest, reviewer string) error {
-	By("adding the approver user as a collaborator")
+func (t *TestOptions) AddReviewerToPullRequestWithChatOpsCommand(provider gits.Provider, approverProvider gits.Provider, pullRequest *gits.PullRequest, reviewer string) error {
+	Step("adding the approver user as a collaborator")
 	err := t.AddApproverAsCollaborator(provider, approverProvider, pullRequest.Owner, pullRequest.Repo)
 	Expect(err).ShouldNot(HaveOccurred())
 
-	By(fmt.Sprintf("Adding the '/cc %s' comment and waiting for %s to be a reviewer", reviewer, reviewer))
+	Step(fmt.Sprintf("Adding the '/cc %s' comment and waiting for %s to be a reviewer", reviewer, reviewer))
 	err = provider.AddPRComment(pullRequest, fmt.Sprintf("/cc %s", reviewer))
 	if err != nil {
 		return err
 	}
 
-	err = t.ExpectThatPullRequestMatches(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, func(request *scm.PullRequest) error {
+	err = t.ExpectThatPullRequestMatches(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, func(request *scm.PullRequest) error {
 		if len(request.Assignees) == 0 && len(request.Reviewers) == 0 {
-			return fmt.Errorf("expected %s as reviewer, but no reviewers or assignees set on PR")
+			return fmt.Errorf("expected %s as reviewer, but no reviewers or assignees set on PR", reviewer)
 		}
 		for _, r := range request.Reviewers {
 			if r.Login == reviewer {
@@ -986,13 +884,13 @@ func (t *TestOptions) AddReviewerToPullRequestWithChatOpsCommand(provider gits.G
 		return err
 	}
 
-	By(fmt.Sprintf("Adding the '/uncc %s' comment and waiting for the user to be gone from reviewers", reviewer))
+	Step(fmt.Sprintf("Adding the '/uncc %s' comment and waiting for the user to be gone from reviewers", reviewer))
 	err = provider.AddPRComment(pullRequest, fmt.Sprintf("/uncc %s", reviewer))
 	if err != nil {
 		return err
 	}
 
-	return t.ExpectThatPullRequestMatches(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, func(request *scm.PullRequest) error {
+	return t.ExpectThatPullRequestMatches(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, func(request *scm.PullRequest) error {
 		if len(request.Assignees) == 0 && len(request.Reviewers) == 0 {
 			return nil
 		}
@@ -1011,41 +909,30 @@ func (t *TestOptions) AddReviewerToPullRequestWithChatOpsCommand(provider gits.G
 }
 
 // AddWIPLabelToPullRequestByUpdatingTitle adds the WIP label by adding WIP to a pull request's title
-func (t *TestOptions) AddWIPLabelToPullRequestByUpdatingTitle(provider gits.GitProvider, pullRequest *gits.GitPullRequest) error {
+func (t *TestOptions) AddWIPLabelToPullRequestByUpdatingTitle(provider gits.Provider, pullRequest *gits.PullRequest) error {
 	originalTitle := pullRequest.Title
 
-	By("Changing the pull request title to start with WIP and waiting for the label to be present")
-	scmClient, _, err := t.GetLighthouseSCMClient(provider)
-	if err != nil {
-		return err
-	}
-
-	input := &scm.PullRequestInput{
-		Title: fmt.Sprintf("WIP %s", originalTitle),
-	}
-	_, _, err = scmClient.PullRequests.Update(context.Background(), fmt.Sprintf("%s/%s", pullRequest.Owner, pullRequest.Repo), *pullRequest.Number, input)
+	Step("Changing the pull request title to start with WIP and waiting for the label to be present")
+	err := provider.UpdatePullRequestTitle(pullRequest, fmt.Sprintf("WIP %s", originalTitle))
 	if err != nil {
 		return err
 	}
-	err = t.ExpectThatPullRequestHasLabel(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/work-in-progress")
+	err = t.ExpectThatPullRequestHasLabel(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/work-in-progress")
 	if err != nil {
 		return err
 	}
 
-	By("Changing the pull request title to remove the WIP and waiting for the label to be gone")
-	input = &scm.PullRequestInput{
-		Title: originalTitle,
-	}
-	_, _, err = scmClient.PullRequests.Update(context.Background(), fmt.Sprintf("%s/%s", pullRequest.Owner, pullRequest.Repo), *pullRequest.Number, input)
+	Step("Changing the pull request title to remove the WIP and waiting for the label to be gone")
+	err = provider.UpdatePullRequestTitle(pullRequest, originalTitle)
 	if err != nil {
 		return err
 	}
 
-	return t.ExpectThatPullRequestDoesNotHaveLabel(provider, *pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/work-in-progress")
+	return t.ExpectThatPullRequestDoesNotHaveLabel(provider, pullRequest.Number, pullRequest.Owner, pullRequest.Repo, "do-not-merge/work-in-progress")
 }
 
 // ExpectThatPullRequestHasLabel returns an error if the PR does not have the specified label
-func (t *TestOptions) ExpectThatPullRequestHasLabel(provider gits.GitProvider, pullRequestNumber int, owner, repo, label string) error {
+func (t *TestOptions) ExpectThatPullRequestHasLabel(provider gits.Provider, pullRequestNumber int, owner, repo, label string) error {
 	return t.ExpectThatPullRequestMatches(provider, pullRequestNumber, owner, repo, func(request *scm.PullRequest) error {
 		if len(request.Labels) < 1 {
 			return fmt.Errorf("the pull request has no labels")
@@ -1061,7 +948,7 @@ func (t *TestOptions) ExpectThatPullRequestHasLabel(provider gits.GitProvider, p
 }
 
 // ExpectThatPullRequestDoesNotHaveLabel returns an error if the PR does have the specified label
-func (t *TestOptions) ExpectThatPullRequestDoesNotHaveLabel(provider gits.GitProvider, pullRequestNumber int, owner, repo, label string) error {
+func (t *TestOptions) ExpectThatPullRequestDoesNotHaveLabel(provider gits.Provider, pullRequestNumber int, owner, repo, label string) error {
 	return t.ExpectThatPullRequestMatches(provider, pullRequestNumber, owner, repo, func(request *scm.PullRequest) error {
 		if len(request.Labels) < 1 {
 			return nil
@@ -1076,81 +963,70 @@ func (t *TestOptions) ExpectThatPullRequestDoesNotHaveLabel(provider gits.GitPro
 	})
 }
 
-// ExpectThatPullRequestMatches returns an error if the PR does not satisfy the provided funciton
-func (t *TestOptions) ExpectThatPullRequestMatches(provider gits.GitProvider, pullRequestNumber int, owner, repo string, matchFunc func(request *scm.PullRequest) error) error {
-	_, lhClient, err := t.GetLighthouseSCMClient(provider)
-	if err != nil {
-		return err
-	}
-	f := func() error {
-		pullRequest, err := lhClient.GetPullRequest(owner, repo, pullRequestNumber)
+// ExpectThatPullRequestMatches returns an error if the PR does not satisfy the provided function
+func (t *TestOptions) ExpectThatPullRequestMatches(provider gits.Provider, pullRequestNumber int, owner, repo string, matchFunc func(request *scm.PullRequest) error) error {
+	f := func() (any, error) {
+		pullRequest, err := provider.GetPullRequest(owner, repo, pullRequestNumber)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return matchFunc(pullRequest)
+		return nil, matchFunc(pullRequest.PullRequest)
 	}
 
 	return RetryExponentialBackoff(TimeoutProwActionWait, f)
 }
 
 // ExpectThatPullRequestHasCommentMatching returns an error if the PR does not have a comment matching the provided function
-func (t *TestOptions) ExpectThatPullRequestHasCommentMatching(provider gits.GitProvider, pullRequestNumber int, owner, repo string, matchFunc func(comments []*scm.Comment) error) error {
-	_, lhClient, err := t.GetLighthouseSCMClient(provider)
-	if err != nil {
-		return err
+func (t *TestOptions) ExpectThatPullRequestHasCommentMatching(provider gits.Provider, pullRequestNumber int, owner, repo string, matchFunc func(comments []*scm.Comment) error) error {
+	pullRequest := &gits.PullRequest{
+		PullRequest: &scm.PullRequest{Number: pullRequestNumber},
+		Owner:       owner,
+		Repo:        repo,
 	}
-	f := func() error {
-		comments, err := lhClient.ListPullRequestComments(owner, repo, pullRequestNumber)
+	f := func() (any, error) {
+		comments, err := provider.ListPullRequestComments(pullRequest)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return matchFunc(comments)
+		return nil, matchFunc(comments)
 	}
 
 	return RetryExponentialBackoff(TimeoutProwActionWait, f)
 }
 
-func (t *TestOptions) WaitForCreatedPullRequestToMerge(provider gits.GitProvider, prCreateOutput string) {
+// WaitForCreatedPullRequestToMerge waits for the pull request created by a command with the given output to merge
+func (t *TestOptions) WaitForCreatedPullRequestToMerge(provider gits.Provider, prCreateOutput string) {
 	createdPR, err := parsers.ParseJxCreatePullRequestFromFullLog(prCreateOutput)
 	Expect(err).ShouldNot(HaveOccurred())
 
 	t.WaitForPullRequestToMerge(provider, createdPR.Owner, createdPR.Repository, createdPR.PullRequestNumber, createdPR.Url)
 }
 
-func (t *TestOptions) WaitForPullRequestToMerge(provider gits.GitProvider, owner string, repo string, prNumber int, prURL string) {
-	repoStruct := &gits.GitRepository{
-		Name:         repo,
-		Organisation: owner,
-		Project:      owner,
-	}
-	waitForMergeFunc := func() error {
-		pr, err := provider.GetPullRequest(owner, repoStruct, prNumber)
+// WaitForPullRequestToMerge waits for the pull request to be merged
+func (t *TestOptions) WaitForPullRequestToMerge(provider gits.Provider, owner string, repo string, prNumber int, prURL string) {
+	waitForMergeFunc := func() (any, error) {
+		pr, err := provider.GetPullRequest(owner, repo, prNumber)
 		if err != nil {
 			utils.LogInfof("WARNING: Error getting pull request: %s\n", err)
-			return err
+			return nil, err
 		}
 		if pr == nil {
 			err = fmt.Errorf("got a nil PR for %s", prURL)
 			utils.LogInfof("WARNING: %s\n", err)
-			return err
+			return nil, err
 		}
-		isMerged := pr.Merged
-		if isMerged != nil && *isMerged {
-			return nil
-		} else {
-			err = fmt.Errorf("PR %s not yet merged", prURL)
-			utils.LogInfof("WARNING: %s, sleeping and retrying\n", err)
-			return err
+		if pr.Merged {
+			return nil, nil
 		}
+		err = fmt.Errorf("PR %s not yet merged", prURL)
+		utils.LogInfof("WARNING: %s, sleeping and retrying\n", err)
+		return nil, err
 	}
 
 	err := RetryExponentialBackoff(TimeoutUrlReturns, waitForMergeFunc)
 	Expect(err).ShouldNot(HaveOccurred())
 }
 
-
-*/
-
 // Retry retries the given function up to the maximum duration
 func Retry[T any](maxElapsedTime time.Duration, f backoff.Operation[T]) (T, error) {
 	bo := backoff.NewExponentialBackOff()
@@ -1185,7 +1061,7 @@ func (t *TestOptions) TailSpecificBuildLog(jobName string, buildNumber int, maxD
 		args = append(args, "--build", strconv.Itoa(buildNumber))
 	}
 	argsStr := strings.Join(args, " ")
-	By(fmt.Sprintf("checking that there is a job built successfully by calling jx %s", argsStr), func() {
+	Step(fmt.Sprintf("checking that there is a job built successfully by calling jx %s", argsStr), func() {
 		t.ExpectJxExecution(t.WorkDir, maxDuration, 0, args...)
 	})
 }
@@ -1195,68 +1071,55 @@ func (t *TestOptions) TailBuildLog(jobName string, maxDuration time.Duration) {
 	t.TailSpecificBuildLog(jobName, 0, maxDuration)
 }
 
-// ThereShouldBeAJobThatCompletesSuccessfully asserts that the given job name completes within the given duration
+// ThereShouldBeAJobThatCompletesSuccessfully asserts that the newest build of the given job name completes successfully
+// within the given duration and returns its build number
 func (t *TestOptions) ThereShouldBeAJobThatCompletesSuccessfully(jobName string, maxDuration time.Duration) int {
-	t.TailBuildLog(jobName, maxDuration)
+	return t.ThereShouldBeAJobAfterBuildThatCompletesSuccessfully(jobName, 0, maxDuration)
+}
 
-	r := runner.New(t.WorkDir, nil, 0)
-	// TODO the current --build 1 breaks as it can be number 2 these days!
-	//out := r.RunWithOutput("get", "activities", "--filter", jobName, "--build", "1")
-	args := []string{"get", "activities", "--filter", jobName}
-	argsStr := strings.Join(args, " ")
-	out := ""
-	var activities map[string]*parsers.Activity
-	f := func() (any, error) {
-		var err error
-		By(fmt.Sprintf("calling jx %s", argsStr), func() {
-			out, err = r.RunWithOutput(args...)
-		})
-		out, err = r.RunWithOutput(args...)
-		if err != nil {
-			return nil, err
-		}
-		activities, err = parsers.ParseJxGetActivities(out)
-		// TODO fails on --ng for now...
-		//utils.ExpectNoError(err)
-		if err != nil {
-			utils.LogInfof("got error parsing activities: %s\n", err.Error())
-		}
-		if len(activities) == 0 {
-			return nil, fmt.Errorf("no activities yet")
-		}
-		return nil, err
-	}
+// TheFirstReleaseShouldCompleteSuccessfully asserts that the first release build of the given job name completes
+// successfully within the given duration, recording it as the first release build phase, and returns its build number
+func (t *TestOptions) TheFirstReleaseShouldCompleteSuccessfully(jobName string, maxDuration time.Duration) int {
+	buildNumber := 0
+	t.Phase(PhaseFirstReleaseBuild, func() {
+		buildNumber = t.ThereShouldBeAJobThatCompletesSuccessfully(jobName, maxDuration)
+	})
+	return buildNumber
+}
 
-	// Sleep 15 seconds to make sure that PipelineActivity gets updated after the run has completed
-	time.Sleep(15 * time.Second)
-	By(fmt.Sprintf("retrying jx %s with exponential backoff to ensure it completes", argsStr), func() {
-		err := RetryExponentialBackoff(TimeoutPipelineActivityComplete, f)
-		Expect(err).ShouldNot(HaveOccurred(), "get applications with a URL")
+// ThereShouldBeAJobAfterBuildThatCompletesSuccessfully asserts that the newest build of the given job name with a build
+// number greater than afterBuild completes successfully within the given duration and returns its build number. Pull
+// request builds are recorded as phases.
+func (t *TestOptions) ThereShouldBeAJobAfterBuildThatCompletesSuccessfully(jobName string, afterBuild int, maxDuration time.Duration) int {
+	job, err := activities.ParseJob(jobName)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	if !strings.HasPrefix(strings.ToUpper(job.Branch), "PR-") {
+		return t.jobCompletesSuccessfully(jobName, job, afterBuild, maxDuration)
+	}
+	buildNumber := 0
+	t.Phase(PhasePullRequestBuild, func() {
+		buildNumber = t.jobCompletesSuccessfully(jobName, job, afterBuild, maxDuration)
 	})
+	return buildNumber
+}
 
-	buildNumber := 1
-	activityKey := fmt.Sprintf("%s #%d", jobName, 1)
-	By(fmt.Sprintf("finding the activity for %s in %v", activityKey, activities), func() {
-		if activities != nil {
-			Expect(activities).Should(HaveLen(1), fmt.Sprintf("should be one activity but found %d having run jx get activities --filter %s --build 1; activities %v for output %s", len(activities), jobName, activities, out))
-			activity, ok := activities[fmt.Sprintf("%s #%d", jobName, 1)]
-			if !ok {
-				// TODO lets see if the build is number 2 instead which it is for tekton currently
-				activity, ok = activities[fmt.Sprintf("%s #%d", jobName, 2)]
-				buildNumber = 2
-			}
-			Expect(ok).Should(BeTrue(), fmt.Sprintf("could not find job with name %s #1 or #2 for output: %s", jobName, out))
-			utils.LogInfof("build status for '%s' is '%s'\n", jobName+"-"+strconv.Itoa(buildNumber), activity.Status)
-
-			// TODO we should wait for Running to turn into Succeeded...
-			if !strings.HasPrefix(activity.Status, "Succeeded") && !strings.HasPrefix(activity.Status, "Running") {
-				Fail("invalid PipelineActivity status: " + activity.Status)
-				// TODO: Fix the regex in get_activities_parser to not treat "Succeeded Version: 0.0.1" as the status. I'm too lazy right now.
-				//Expect(activity.Status).Should(HavePrefix("Succeeded"))
-			}
-		}
+func (t *TestOptions) jobCompletesSuccessfully(jobName string, job activities.Job, afterBuild int, maxDuration time.Duration) int {
+	t.TailBuildLog(jobName, maxDuration)
+
+	var activity *v1.PipelineActivity
+	Step(fmt.Sprintf("watching the PipelineActivity of %s until it completes", jobName), func() {
+		var err error
+		watcher := activities.NewWatcher(JXClient, Namespace)
+		activity, err = watcher.WaitForCompletion(context.TODO(), job, afterBuild, TimeoutPipelineActivityComplete)
+		Expect(err).ShouldNot(HaveOccurred(), "waiting for the PipelineActivity of %s to complete", jobName)
 	})
 
+	buildNumber := activities.BuildNumber(activity)
+	Step(fmt.Sprintf("checking that %s #%d succeeded", jobName, buildNumber), func() {
+		utils.LogInfof("build status for '%s #%d' is '%s'\n", jobName, buildNumber, activity.Spec.Status)
+		Expect(activity.Spec.Status).Should(Equal(v1.ActivityStatusTypeSucceeded), "invalid PipelineActivity status for %s #%d: %s", jobName, buildNumber, activity.Spec.Message)
+	})
 	return buildNumber
 }
 
@@ -1264,7 +1127,7 @@ func (t *TestOptions) ThereShouldBeAJobThatCompletesSuccessfully(jobName string,
 func (t *TestOptions) ViewPromotePRPipelineLog(maxDuration time.Duration) {
 	args := []string{"pipeline", "log", "-e", "dev", "-b", "--pending", "--wait"}
 	argsStr := strings.Join(args, " ")
-	By(fmt.Sprintf("viewing the promote PR pipeline log by calling: jx %s", argsStr), func() {
+	Step(fmt.Sprintf("viewing the promote PR pipeline log by calling: jx %s", argsStr), func() {
 		t.ExpectJxExecution(t.WorkDir, maxDuration, 0, args...)
 	})
 }
@@ -1274,23 +1137,34 @@ func (t *TestOptions) ViewBootJob(maxDuration time.Duration) {
 	utils.LogInfof("viewing the boot job log....")
 	args := []string{"admin", "log", "-w"}
 	argsStr := strings.Join(args, " ")
-	By(fmt.Sprintf("viewing the boot job by calling: jx %s", argsStr), func() {
+	Step(fmt.Sprintf("viewing the boot job by calling: jx %s", argsStr), func() {
 		t.ExpectJxExecution(t.WorkDir, maxDuration, 0, args...)
 	})
 }
 
 // ExpectCommandExecution performs the given command in the current work directory and asserts that it completes successfully
 func (t *TestOptions) ExpectCommandExecution(dir string, commandTimeout time.Duration, exitCode int, c string, args ...string) {
+	var entry *transcript.Entry
 	f := func() (interface{}, error) {
-		command := exec.Command(c, args...)
-		command.Dir = dir
-		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
-		session.Wait(commandTimeout)
-		Eventually(session).Should(gexec.Exit(exitCode))
+		var err error
+		entry, err = runCommand(dir, commandTimeout, GinkgoWriter, GinkgoWriter, c, args...)
 		return nil, err
 	}
 	err := RetryExponentialBackoff(TimeoutCmdLine, f)
 	Expect(err).ShouldNot(HaveOccurred())
+	Expect(entry.ExitCode).Should(Equal(exitCode), "exit code of %s %s", c, strings.Join(args, " "))
+}
+
+// runCommand runs the command in the given directory, killing it after the timeout. The invocation is recorded to,
+// or replayed from, the transcript if one is configured.
+func runCommand(dir string, timeout time.Duration, out io.Writer, errOut io.Writer, c string, args ...string) (*transcript.Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	command := exec.CommandContext(ctx, c, args...)
+	command.Dir = dir
+	command.Stdout = out
+	command.Stderr = errOut
+	return transcript.Run(filepath.Base(c), command)
 }
 
 func (t *TestOptions) ExpectJxExecution(dir string, commandTimeout time.Duration, exitCode int, args ...string) {
@@ -1305,63 +1179,28 @@ func (t *TestOptions) ExpectJxExecutionWithOutput(dir string, commandTimeout tim
 	return out
 }
 
-// ExpectUrlReturns expects that the given URL returns the given status code within the given time period
-func (t *TestOptions) ExpectUrlReturns(url string, expectedStatusCode int, maxDuration time.Duration) error {
-	lastLoggedStatus := -1
-	f := func() (any, error) {
-		skipVerify := false
-		if strings.ToLower(InsecureURLSkipVerify) == "true" {
-			skipVerify = true
-		}
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: skipVerify,
-			},
-		}
-		var httpClient = &http.Client{
-			Timeout:   time.Second * 30,
-			Transport: transport,
-		}
-		response, err := httpClient.Get(url)
-		if err != nil {
-			return nil, err
-		}
-		actualStatusCode := response.StatusCode
-		if actualStatusCode != lastLoggedStatus {
-			lastLoggedStatus = actualStatusCode
-			utils.LogInfof("Invoked %s and got return code: %s\n", termcolor.ColorInfo(url), termcolor.ColorInfo(strconv.Itoa(actualStatusCode)))
-		}
-		if actualStatusCode == expectedStatusCode {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("invalid HTTP status code for %s expected %d but got %d", url, expectedStatusCode, actualStatusCode)
-	}
-	return RetryExponentialBackoff(maxDuration, f)
-}
-
 // ShouldTestPipelineActivityUpdate should we make sure the build controller is updating the PipelineActivity
 func (t *TestOptions) ShouldTestPipelineActivityUpdate() bool {
-	return strings.ToLower(DisablePipelineActivityCheck) != "true"
+	return Config.Tests.PipelineActivityCheck
 }
 
 // GitProviderURL Gets the current git provider URL
 func (t *TestOptions) GitProviderURL() (string, error) {
-	gitProviderURL := os.Getenv("GIT_PROVIDER_URL")
-	if gitProviderURL != "" {
-		return gitProviderURL, nil
+	if Config.Git.ProviderURL != "" {
+		return Config.Git.ProviderURL, nil
 	}
 	var out string
-	By("running jx get gitserver", func() {
+	Step("running jx get gitserver", func() {
 
 		r := runner.New(t.WorkDir, nil, 0)
 		var err error
-		out, err = r.RunWithOutput("get", "gitserver")
+		out, err = RunJxWithStructuredOutput(r, "get", "gitserver")
 		utils.ExpectNoError(err)
 	})
 	var gitServers []parsers.GitServer
 	var err error
-	By("parsing the output of jx get gitserver", func() {
-		gitServers, err = parsers.ParseJxGetGitServer(out)
+	Step("parsing the output of jx get gitserver", func() {
+		gitServers, err = parsers.ParseGitServers(out)
 	})
 	if err != nil {
 		return "", err
@@ -1375,38 +1214,32 @@ func (t *TestOptions) GitProviderURL() (string, error) {
 
 // DeleteApplications should we delete applications after the quickstart has run
 func (t *TestOptions) DeleteApplications() bool {
-	text := os.Getenv("JX_DISABLE_DELETE_APP")
-	utils.LogInfof("checking to delete app: JX_DISABLE_DELETE_APP = %s", text)
-	return strings.ToLower(text) != "true"
+	return Config.Tests.DeleteApplications
 }
 
 // DeleteRepos should we delete the git repos after the quickstart has run
 func (t *TestOptions) DeleteRepos() bool {
-	text := os.Getenv("JX_DISABLE_DELETE_REPO")
-	return strings.ToLower(text) != "true"
+	return Config.Tests.DeleteRepos
 }
 
 // TestPullRequest should we test performing a pull request on the repo
 func (t *TestOptions) TestPullRequest() bool {
-	text := os.Getenv("JX_DISABLE_TEST_PULL_REQUEST")
-	return strings.ToLower(text) != "true"
+	return Config.Tests.PullRequest
 }
 
 // WaitForFirstRelease should we wait for first release to complete before trying a pull request
 func (t *TestOptions) WaitForFirstRelease() bool {
-	text := os.Getenv("JX_DISABLE_WAIT_FOR_FIRST_RELEASE")
-	return strings.ToLower(text) != "true"
+	return Config.Tests.WaitForFirstRelease
 }
 
 // WeShouldTestChatOpsCommands should we test prow ChatOps commands
 func (t *TestOptions) WeShouldTestChatOpsCommands() bool {
-	return strings.ToLower(EnableChatOpsTests) == "true"
+	return Config.Tests.ChatOps
 }
 
 // ViewPromotePRPipelines returns true if we should view the PR pipeline logs
 func (t *TestOptions) ViewPromotePRPipelines() bool {
-	text := os.Getenv("JX_VIEW_PROMOTE_PR_LOG")
-	return strings.ToLower(text) == "true"
+	return Config.Tests.ViewPromotePRLog
 }
 
 // GetDefaultBranch returns the default branch name
@@ -0,0 +1,281 @@
+package helpers_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/helpers"
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakejx"
+	"github.com/jenkins-x/bdd-jx3/test/utils/probe"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	ns    = "jx"
+	owner = "cb-kubecd"
+)
+
+func TestMain(m *testing.M) {
+	fakejx.RunIfFake()
+	os.Exit(m.Run())
+}
+
+// setup creates the fake jx binary and the fake clients and registers gomega with the test
+func setup(t *testing.T, objects ...runtime.Object) *fakejx.Fake {
+	gomega.RegisterTestingT(t)
+	oldOrganisation := helpers.Config.Git.Organisation
+	helpers.Config.Git.Organisation = owner
+
+	kubeClient, jxClient := fakejx.NewClients(objects...)
+	oldKubeClient, oldJXClient, oldNamespace := helpers.KubeClient, helpers.JXClient, helpers.Namespace
+	helpers.KubeClient, helpers.JXClient, helpers.Namespace = kubeClient, jxClient, ns
+	t.Cleanup(func() {
+		helpers.KubeClient, helpers.JXClient, helpers.Namespace = oldKubeClient, oldJXClient, oldNamespace
+		helpers.Config.Git.Organisation = oldOrganisation
+	})
+	return fakejx.New(t)
+}
+
+func newActivity(repo, branch, build string, status v1.ActivityStatusType) *v1.PipelineActivity {
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      owner + "-" + repo + "-" + branch + "-" + build,
+			Namespace: ns,
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:      owner + "/" + repo + "/" + branch,
+			Build:         build,
+			Status:        status,
+			GitOwner:      owner,
+			GitRepository: repo,
+			GitBranch:     branch,
+		},
+	}
+}
+
+// newDeployment creates the rolled out deployment of an application in the namespace
+func newDeployment(namespace, app, version string) *appsv1.Deployment {
+	replicas := int32(1)
+	labels := map[string]string{"app": app}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: app, Namespace: namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: app, Image: "ghcr.io/" + owner + "/" + app + ":" + version}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1, ReadyReplicas: 1},
+	}
+}
+
+func newApplicationServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintln(w, "<html><body>Hello from:  Jenkins X</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, string(out))
+}
+
+// newApplicationRepo creates a work directory with a clone of the application from a local bare repository, which
+// lets the helpers commit and push their changes
+func newApplicationRepo(t *testing.T, app string) string {
+	workDir := t.TempDir()
+	origin := filepath.Join(t.TempDir(), app+".git")
+	git(t, workDir, "init", "--bare", origin)
+	git(t, workDir, "clone", origin, app)
+	appDir := filepath.Join(workDir, app)
+	git(t, appDir, "config", "user.email", "bdd@jenkins-x.io")
+	git(t, appDir, "config", "user.name", "bdd")
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "README.md"), []byte("bdd\n"), 0600))
+	git(t, appDir, "add", "README.md")
+	git(t, appDir, "commit", "-m", "initial commit")
+	return workDir
+}
+
+func TestTheApplicationIsRunning(t *testing.T) {
+	fake := setup(t, newDeployment("jx-staging", "bdd-spring", "0.0.1"))
+	server := newApplicationServer(t)
+	fake.Expect("get", "applications", "-e", "staging", "-o", "json").
+		Returns(`[{"name": "bdd-spring", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.TheApplicationIsRunningInStaging(http.StatusOK)
+
+	assert.Equal(t, []string{"get applications -e staging -o json"}, fake.InvokedArgs())
+}
+
+func TestTheApplicationVersionIsRunning(t *testing.T) {
+	fake := setup(t, newDeployment("jx-staging", "bdd-spring", "0.0.2"))
+	server := newApplicationServer(t)
+	fake.Expect("get", "applications", "-e", "staging", "-o", "json").
+		Returns(`[{"name": "bdd-spring", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`).
+		Once()
+	fake.Expect("get", "applications", "-e", "staging", "-o", "json").
+		Returns(`[{"name": "bdd-spring", "version": "0.0.2", "pods": "1/1", "url": "` + server.URL + `"}]`)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.TheApplicationVersionIsRunning(http.StatusOK, "staging", helpers.NotVersion("0.0.1"))
+
+	assert.Len(t, fake.InvokedArgs(), 2, "jx get applications should be retried until the new version is promoted")
+}
+
+func TestVersionChecks(t *testing.T) {
+	assert.NoError(t, helpers.ExactVersion("0.0.2")("0.0.2"))
+	err := helpers.ExactVersion("0.0.2")("0.0.1")
+	require.Error(t, err)
+	assert.Equal(t, "the version is 0.0.1 rather than 0.0.2", err.Error())
+
+	assert.NoError(t, helpers.NotVersion("0.0.1")("0.0.2"))
+	assert.Error(t, helpers.NotVersion("0.0.1")("0.0.1"))
+	assert.Error(t, helpers.NotVersion("0.0.1")(""), "the application should have a version")
+}
+
+func TestTheApplicationIsRunningInTheNamespaceOfTheEnvironment(t *testing.T) {
+	fake := setup(t,
+		&v1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "production", Namespace: ns},
+			Spec:       v1.EnvironmentSpec{Namespace: "prod"},
+		},
+		newDeployment("prod", "bdd-spring", "0.0.1"),
+	)
+	server := newApplicationServer(t)
+	fake.Expect("get", "applications", "-e", "production", "-o", "json").
+		Returns(`[{"name": "bdd-spring", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`)
+
+	namespace, err := helpers.EnvironmentNamespace("production")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", namespace)
+	namespace, err = helpers.EnvironmentNamespace("staging")
+	require.NoError(t, err)
+	assert.Equal(t, "jx-staging", namespace)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.TheApplicationIsRunningInProduction(http.StatusOK)
+}
+
+func TestTheApplicationIsRunningChecksTheContent(t *testing.T) {
+	fake := setup(t, newDeployment("jx-staging", "bdd-gh", "0.0.1"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello from:  Jenkins X golang http example")
+	}))
+	t.Cleanup(server.Close)
+	fake.Expect("get", "applications", "-e", "staging", "-o", "json").
+		Returns(`[{"name": "bdd-gh", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-gh", WorkDir: t.TempDir(), Quickstart: "golang-http"}
+	o.TheApplicationIsRunningInStaging(http.StatusOK)
+
+	err := o.ExpectUrl(server.URL, 100*time.Millisecond, probe.BodyContains("Hello from:  Jenkins X node http example"))
+	require.Error(t, err)
+	var mismatch *probe.MismatchError
+	require.True(t, errors.As(err, &mismatch), "the last mismatch should be returned")
+	assert.Contains(t, err.Error(), "body: Hello from: Jenkins X golang http example")
+}
+
+func TestTheApplicationIsRunningReplayedFromTranscript(t *testing.T) {
+	fake := setup(t, newDeployment("jx-staging", "bdd-spring", "0.0.1"))
+	server := newApplicationServer(t)
+	file := filepath.Join(t.TempDir(), "transcript.jsonl")
+	r, err := transcript.NewRecorder(file, nil)
+	require.NoError(t, err)
+	args := []string{"get", "applications", "-e", "staging", "-o", "json"}
+	require.NoError(t, r.Record(&transcript.Entry{Command: "jx", Args: args, Stdout: `[{"name": "bdd-spring", "version": "0.0.1", "pods": "0/1"}]`}))
+	require.NoError(t, r.Record(&transcript.Entry{Command: "jx", Args: args, Stdout: `[{"name": "bdd-spring", "version": "0.0.1", "pods": "1/1", "url": "` + server.URL + `"}]`}))
+	require.NoError(t, r.Close())
+
+	require.NoError(t, transcript.Configure("", file))
+	t.Cleanup(func() {
+		_ = transcript.Configure("", "")
+	})
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	o.TheApplicationIsRunningInStaging(http.StatusOK)
+
+	assert.Empty(t, fake.InvokedArgs(), "jx should not be run when replaying")
+}
+
+func TestThereShouldBeAJobThatCompletesSuccessfully(t *testing.T) {
+	fake := setup(t,
+		newActivity("bdd-spring", "master", "1", v1.ActivityStatusTypeFailed),
+		newActivity("bdd-spring", "master", "2", v1.ActivityStatusTypeSucceeded),
+	)
+	jobName := owner + "/bdd-spring/master"
+	fake.Expect("get", "build", "logs", "--wait", jobName)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-spring", WorkDir: t.TempDir()}
+	buildNumber := o.ThereShouldBeAJobThatCompletesSuccessfully(jobName, helpers.TimeoutBuildCompletes)
+
+	assert.Equal(t, 2, buildNumber)
+	assert.Equal(t, []string{"get build logs --wait " + jobName}, fake.InvokedArgs())
+}
+
+func TestCreatePullRequestAndGetPreviewEnvironment(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	const app = "bdd-gh"
+	fake := setup(t,
+		newActivity(app, "PR-1", "1", v1.ActivityStatusTypeSucceeded),
+		newDeployment("jx-"+owner+"-"+app+"-pr-1", app, "0.0.0-SNAPSHOT-PR-1-1"),
+	)
+	server := newApplicationServer(t)
+
+	oldPipelineActivityCheck := helpers.Config.Tests.PipelineActivityCheck
+	helpers.Config.Tests.PipelineActivityCheck = false
+	t.Cleanup(func() {
+		helpers.Config.Tests.PipelineActivityCheck = oldPipelineActivityCheck
+	})
+
+	workDir := newApplicationRepo(t, app)
+
+	prURL := "https://github.com/" + owner + "/" + app + "/pull/1"
+	fake.Expect("create", "pullrequest", "-b", "--title", "My First PR commit", "--body", "PR comments").
+		Returns(prURL)
+	fake.Expect("get", "build", "logs", "--wait", owner+"/"+app+"/PR-1")
+	fake.Expect("get", "previews").Returns("PULL REQUEST NAMESPACE APPLICATION")
+	fake.Expect("get", "previews", "-o", "json").
+		Returns(`[{"pullRequest": "` + prURL + `", "namespace": "jx-` + owner + `-` + app + `-pr-1", "url": "` + server.URL + `"}]`)
+
+	o := &helpers.TestOptions{ApplicationName: app, WorkDir: workDir}
+	err := o.CreatePullRequestAndGetPreviewEnvironment(http.StatusOK)
+	require.NoError(t, err)
+
+	assert.Contains(t, fake.InvokedArgs(), "get previews -o json")
+}
+
+func TestNextBuildNumberAndPullTitle(t *testing.T) {
+	pr := newActivity("bdd-gh", "PR-1", "2", v1.ActivityStatusTypeSucceeded)
+	pr.Spec.PullTitle = "My First PR commit"
+	setup(t, newActivity("bdd-gh", "master", "1", v1.ActivityStatusTypeSucceeded), pr)
+
+	o := &helpers.TestOptions{ApplicationName: "bdd-gh", WorkDir: t.TempDir()}
+	assert.Equal(t, 2, o.NextBuildNumber(owner+"/bdd-gh/master"))
+	assert.Equal(t, 1, o.NextBuildNumber(owner+"/bdd-gh/PR-2"))
+	assert.Equal(t, "My First PR commit", o.GetPullTitleFromActivity(owner, "bdd-gh", "pr-1", 2))
+}
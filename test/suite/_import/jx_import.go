@@ -4,34 +4,38 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/jenkins-x/bdd-jx3/test/helpers"
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	git "gopkg.in/src-d/go-git.v4"
 )
 
-var _ = AllImportsTest()
+var _ = suites.Register(&suites.Suite{
+	Name:         "import_applications",
+	Description:  "imports each of the included quickstart repositories and promotes them to staging",
+	Tags:         []string{"import"},
+	Capabilities: []suites.Capability{suites.CapabilityCluster, suites.CapabilityGitProvider},
+	Specs:        AllImportsTest,
+})
 
 var (
 	IncludedImports = []string{"node-http", "spring-boot-rest-prometheus", "spring-boot-http-gradle", "golang-http-from-jenkins-x-yml"}
 )
 
 // AllImportsTest creates all the tests for all the quickstarts that we want to import
-func AllImportsTest() []bool {
-	tests := make([]bool, len(IncludedImports))
+func AllImportsTest() {
 	_, eksBDDRun := os.LookupEnv("EKS_BDD_RUN")
 	for _, scenarioName := range IncludedImports {
 		if eksBDDRun && scenarioName == "golang-http-from-jenkins-x-yml" {
 			fmt.Printf("Skipping %s because it's not supported by EKS\n", scenarioName)
 		} else {
-			tests = append(tests, createTest(scenarioName, fmt.Sprintf("https://github.com/jenkins-x-quickstarts/%s", scenarioName)))
+			createTest(scenarioName, fmt.Sprintf("https://github.com/jenkins-x-quickstarts/%s", scenarioName))
 		}
 	}
-	return tests
 }
 
 // createTest creates each test for every scenario we want to test
@@ -46,19 +50,25 @@ func createTest(quickstartName string, repoToImport string) bool {
 				qsAbbr = qsAbbr + qsNameParts[s][:1]
 
 			}
-			applicationName := helpers.TempDirPrefix + qsAbbr + "-import-" + strconv.FormatInt(GinkgoRandomSeed(), 10)
+			applicationName := helpers.NewApplicationName(qsAbbr + "-import")
 			T = helpers.TestOptions{
 				ApplicationName: applicationName,
 				WorkDir:         helpers.WorkDir,
+				Quickstart:      quickstartName,
 			}
 			T.GitProviderURL()
 		})
 
+		AfterEach(func() {
+			T.CollectDiagnosticsOnFailure()
+			T.CleanupResources()
+		})
+
 		Context("by running jx import", func() {
 			It("creates an application from the specified folder and promotes it to staging", func() {
 				destDir := T.WorkDir + "/" + T.ApplicationName
 
-				By(fmt.Sprintf("calling git clone %s", repoToImport), func() {
+				helpers.Step(fmt.Sprintf("calling git clone %s", repoToImport), func() {
 					_, err := git.PlainClone(destDir, false, &git.CloneOptions{
 						URL:      repoToImport,
 						Progress: GinkgoWriter,
@@ -66,13 +76,13 @@ func createTest(quickstartName string, repoToImport string) bool {
 					Expect(err).NotTo(HaveOccurred())
 				})
 
-				By("removing the .git directory", func() {
+				helpers.Step("removing the .git directory", func() {
 					err := os.RemoveAll(destDir + "/.git")
 					utils.ExpectNoError(err)
 					Expect(destDir + "/.git").ToNot(BeADirectory())
 				})
 
-				By("updating the pom.xml (if exists) to have the correct application name", func() {
+				helpers.Step("updating the pom.xml (if exists) to have the correct application name", func() {
 					err := utils.ReplaceElement(filepath.Join(destDir, "pom.xml"), "artifactId", T.ApplicationName, 1)
 					if err, ok := err.(*os.PathError); !ok {
 						Expect(err).NotTo(HaveOccurred())
@@ -82,29 +92,19 @@ func createTest(quickstartName string, repoToImport string) bool {
 				gitProviderUrl, err := T.GitProviderURL()
 				Expect(err).NotTo(HaveOccurred())
 				args := []string{"import", destDir, "-b", "--org", T.GetGitOrganisation(), "--git-provider-url", gitProviderUrl}
-				argsStr := strings.Join(args, " ")
-				By(fmt.Sprintf("running jx %s", argsStr), func() {
-					T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
-				})
-
-				T.TheApplicationShouldBeBuiltAndPromotedViaCICD(200)
+				T.RegisterRepositoryCleanup(T.GetGitOrganisation(), T.ApplicationName)
+				T.RegisterApplicationCleanup(T.ApplicationName)
 
-				if T.DeleteApplications() {
-					args = []string{"delete", "application", "-b", T.ApplicationName}
-					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("deleting the application by calling jx %s", argsStr), func() {
+				argsStr := strings.Join(args, " ")
+				T.Phase(helpers.PhaseQuickstartCreation, func() {
+					helpers.Step(fmt.Sprintf("running jx %s", argsStr), func() {
 						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
 					})
+				})
 
-				}
+				T.TheApplicationShouldBeBuiltAndPromotedViaCICD(200)
 
-				if T.DeleteRepos() {
-					args = []string{"delete", "repo", "-b", "-g", gitProviderUrl, "-o", T.GetGitOrganisation(), "-n", T.ApplicationName}
-					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("deleting the repo by calling jx %s", argsStr), func() {
-						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
-					})
-				}
+				T.DeleteApplication(T.ApplicationName)
 			})
 		})
 	})
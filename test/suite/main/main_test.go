@@ -1,29 +1,25 @@
 package main_test
 
 import (
-	"os"
 	"testing"
 
 	"github.com/jenkins-x/bdd-jx3/test/helpers"
 
 	. "github.com/onsi/ginkgo"
 
-	// lets import the tests
+	// lets register the suites
 	_ "github.com/jenkins-x/bdd-jx3/test/suite/quickstart"
-	// lets import the tests
 	_ "github.com/jenkins-x/bdd-jx3/test/suite/spring"
+	_ "github.com/jenkins-x/bdd-jx3/test/suite/step"
 )
 
-// TestSuite runs one or more tests using environment variables to define the tests to run
+// TestSuite runs the suites selected by JX_BDD_SUITE, a comma separated list of suite names and tags
 func TestSuite(t *testing.T) {
-	suiteId := os.Getenv("JX_BDD_SUITE")
-	if suiteId == "" {
-		suiteId = "create_quickstarts"
-	}
-	t.Logf("running test suite %s\n", suiteId)
-	helpers.RunWithReporters(t, suiteId)
+	selectors := helpers.Config.Suite
+	t.Logf("running test suites %s\n", selectors)
+	helpers.RunSuites(t, selectors)
 }
 
-var _ = BeforeSuite(helpers.BeforeSuiteCallback)
+var _ = SynchronizedBeforeSuite(helpers.SynchronizedBeforeSuiteNode1Callback, helpers.SynchronizedBeforeSuiteAllNodesCallback)
 
-var _ = SynchronizedAfterSuite(func() {}, helpers.SynchronizedAfterSuiteCallback)
+var _ = SynchronizedAfterSuite(helpers.SynchronizedAfterSuiteAllNodesCallback, helpers.SynchronizedAfterSuiteNode1Callback)
@@ -2,9 +2,6 @@ package quickstart
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 	"time"
 
@@ -13,29 +10,29 @@ import (
 	"github.com/jenkins-x/bdd-jx3/test/helpers"
 
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var (
 	IncludedQuickstarts = []string{"node-http", "spring-boot-rest-prometheus-java11", "spring-boot-http-gradle", "golang-http"}
-	_                   = AllQuickstartsTest()
+	_                   = suites.Register(&suites.Suite{
+		Name:         "create_quickstarts",
+		Description:  "creates each of the included quickstarts and promotes them to staging",
+		Tags:         []string{"nightly", "quickstart"},
+		Capabilities: []suites.Capability{suites.CapabilityCluster, suites.CapabilityGitProvider, suites.CapabilityQuickstarts},
+		Specs:        AllQuickstartsTest,
+	})
 )
 
-// AllQuickstartsTest is responsible for running `jx get quickstarts, and creating a test for each quickstart currnetly
-// available
+// AllQuickstartsTest creates a test for each of the included quickstarts. The suite requires the quickstarts
+// capability so it is only run if `jx get quickstarts` works.
 // Individual tests can be run with `go test test/quickstart -ginkgo.focus <quickstart name>`
-func AllQuickstartsTest() []bool {
-	cmd := exec.Command("jx", "get", "quickstarts")
-	bytes, err := cmd.CombinedOutput()
-	if err != nil {
-		panic(fmt.Errorf("running jx get quickstarts, output was %s: %w", string(bytes), err))
-	}
-	tests := make([]bool, 0)
+func AllQuickstartsTest() {
 	for _, testQuickstartName := range IncludedQuickstarts {
-		tests = append(tests, CreateQuickstartsTests(testQuickstartName))
+		CreateQuickstartsTests(testQuickstartName)
 	}
-	return tests
 }
 
 // CreateQuickstartsTests creates a batch quickstart test for the given quickstart
@@ -55,16 +52,22 @@ func createQuickstartTests(quickstartName string) bool {
 				qsAbbr = qsAbbr + qsNameParts[s][:1]
 
 			}
-			applicationName := helpers.TempDirPrefix + qsAbbr + "-" + strconv.FormatInt(GinkgoRandomSeed(), 10)
+			applicationName := helpers.NewApplicationName(qsAbbr)
 			T = helpers.TestOptions{
 				ApplicationName: applicationName,
 				WorkDir:         helpers.WorkDir,
+				Quickstart:      quickstartName,
 			}
 			T.GitProviderURL()
 
 			utils.LogInfof("Creating application %s in dir %s\n", termcolor.ColorInfo(applicationName), termcolor.ColorInfo(helpers.WorkDir))
 		})
 
+		AfterEach(func() {
+			T.CollectDiagnosticsOnFailure()
+			T.CleanupResources()
+		})
+
 		Describe("Create a quickstart", func() {
 			Context(fmt.Sprintf("by running jx create quickstart %s", quickstartName), func() {
 				It("creates a new source repository and promotes it to staging", func() {
@@ -76,14 +79,19 @@ func createQuickstartTests(quickstartName string) bool {
 						utils.LogInfof("Using Git provider URL %s\n", gitProviderUrl)
 						args = append(args, "--git-provider-url", gitProviderUrl)
 					}
-					gitKind := os.Getenv("GIT_KIND")
+					gitKind := helpers.Config.Git.Kind
 					if gitKind != "" {
 						args = append(args, "--git-kind", gitKind)
 					}
 
+					T.RegisterRepositoryCleanup(T.GetGitOrganisation(), T.ApplicationName)
+					T.RegisterApplicationCleanup(T.ApplicationName)
+
 					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("calling jx %s", argsStr), func() {
-						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+					T.Phase(helpers.PhaseQuickstartCreation, func() {
+						helpers.Step(fmt.Sprintf("calling jx %s", argsStr), func() {
+							T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+						})
 					})
 
 					applicationName := T.GetApplicationName()
@@ -94,8 +102,8 @@ func createQuickstartTests(quickstartName string) bool {
 					if T.WaitForFirstRelease() {
 						//FIXME Need to wait a little here to ensure that the build has started before asking for the log as the jx create quickstart command returns slightly before the build log is available
 						time.Sleep(30 * time.Second)
-						By(fmt.Sprintf("waiting for the first release of %s", applicationName), func() {
-							T.ThereShouldBeAJobThatCompletesSuccessfully(jobName, helpers.TimeoutBuildCompletes)
+						helpers.Step(fmt.Sprintf("waiting for the first release of %s", applicationName), func() {
+							T.TheFirstReleaseShouldCompleteSuccessfully(jobName, helpers.TimeoutBuildCompletes)
 
 							if T.ViewPromotePRPipelines() {
 								T.ViewPromotePRPipelineLog(helpers.TimeoutBuildCompletes)
@@ -105,44 +113,30 @@ func createQuickstartTests(quickstartName string) bool {
 						})
 
 					} else {
-						By(fmt.Sprintf("waiting for the first successful build of %s of %s", branch, applicationName), func() {
-							T.ThereShouldBeAJobThatCompletesSuccessfully(jobName, helpers.TimeoutBuildCompletes)
-						})
-					}
-
-					if T.DeleteApplications() {
-						utils.LogInfof("deleting the app %s", T.ApplicationName)
-
-						args = []string{"application", "delete", "--no-source", "--repo", T.ApplicationName}
-						argsStr := strings.Join(args, " ")
-						By(fmt.Sprintf("calling %s to delete the application", argsStr), func() {
-							T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+						helpers.Step(fmt.Sprintf("waiting for the first successful build of %s of %s", branch, applicationName), func() {
+							T.TheFirstReleaseShouldCompleteSuccessfully(jobName, helpers.TimeoutBuildCompletes)
 						})
-
-						if T.ViewPromotePRPipelines() {
-							T.ViewPromotePRPipelineLog(helpers.TimeoutBuildCompletes)
-
-							T.ViewBootJob(helpers.TimeoutBuildCompletes)
-						}
-					} else {
-						utils.LogInfof("not the app %s", T.ApplicationName)
 					}
 
 					if T.TestPullRequest() {
 						utils.LogInfof("now performing a PR to test a preview")
-						By("performing a pull request on the source and asserting that a preview environment is created", func() {
+						helpers.Step("performing a pull request on the source and asserting that a preview environment is created", func() {
 							T.CreatePullRequestAndGetPreviewEnvironment(200)
 						})
 					}
 
-					if T.DeleteRepos() {
-						args = []string{"delete", "repo", "-b", "--github", "-o", T.GetGitOrganisation(), "-n", T.ApplicationName}
-						argsStr = strings.Join(args, " ")
-
-						By(fmt.Sprintf("calling %s to delete the repository", os.Args), func() {
-							T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+					if T.ShouldTestMergePullRequest() {
+						helpers.Step("approving and merging a pull request and asserting that its release is promoted to staging", func() {
+							T.MergePullRequestAndExpectRelease(200)
 						})
 					}
+
+					T.DeleteApplication(T.ApplicationName)
+					if T.DeleteApplications() && T.ViewPromotePRPipelines() {
+						T.ViewPromotePRPipelineLog(helpers.TimeoutBuildCompletes)
+
+						T.ViewBootJob(helpers.TimeoutBuildCompletes)
+					}
 				})
 			})
 		})
@@ -151,7 +145,7 @@ func createQuickstartTests(quickstartName string) bool {
 				It("exits with signal 1", func() {
 					args := []string{"create", "quickstart", "-b", "--org", T.GetGitOrganisation(), "-f", quickstartName}
 					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("calling jx %s", argsStr), func() {
+					helpers.Step(fmt.Sprintf("calling jx %s", argsStr), func() {
 						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 1, args...)
 					})
 				})
@@ -160,7 +154,7 @@ func createQuickstartTests(quickstartName string) bool {
 				It("exits with signal 1", func() {
 					args := []string{"create", "quickstart", "-b", "--org", T.GetGitOrganisation(), "-p", T.ApplicationName, "-f", "the_derek_zoolander_app_for_being_really_really_good_looking"}
 					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("calling jx %s", argsStr), func() {
+					helpers.Step(fmt.Sprintf("calling jx %s", argsStr), func() {
 						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 1, args...)
 					})
 				})
@@ -9,9 +9,9 @@ import (
 )
 
 func TestSuite(t *testing.T) {
-	helpers.RunWithReporters(t, "create_quickstarts")
+	helpers.RunSuites(t, "create_quickstarts")
 }
 
-var _ = BeforeSuite(helpers.BeforeSuiteCallback)
+var _ = SynchronizedBeforeSuite(helpers.SynchronizedBeforeSuiteNode1Callback, helpers.SynchronizedBeforeSuiteAllNodesCallback)
 
-var _ = SynchronizedAfterSuite(func() {}, helpers.SynchronizedAfterSuiteCallback)
+var _ = SynchronizedAfterSuite(helpers.SynchronizedAfterSuiteAllNodesCallback, helpers.SynchronizedAfterSuiteNode1Callback)
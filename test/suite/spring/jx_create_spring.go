@@ -2,94 +2,107 @@ package spring
 
 import (
 	"fmt"
-	"os"
-	"strconv"
 	"strings"
 
 	"github.com/jenkins-x/bdd-jx3/test/helpers"
 
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
-var SkipManualPromotion = os.Getenv("JX_BDD_SKIP_MANUAL_PROMOTION")
-
-var _ = Describe("create spring\n", func() {
-	var T SpringTestOptions
-	JavaVersion, ok := os.LookupEnv("JAVA_VERSION")
-	if !ok {
-		JavaVersion = "17"
-	}
+var _ = suites.Register(&suites.Suite{
+	Name:         "create_spring_application",
+	Description:  "creates a spring application and promotes it to staging and production",
+	Tags:         []string{"nightly", "spring"},
+	Capabilities: []suites.Capability{suites.CapabilityCluster, suites.CapabilityGitProvider},
+	// maven builds of spring applications take longer than the other quickstarts
+	Timeouts: map[string]config.Duration{"timeouts.buildCompletes": config.Minutes(60)},
+	Specs:    CreateSpringTest,
+})
 
-	BeforeEach(func() {
-		T = SpringTestOptions{
-			helpers.TestOptions{
-				ApplicationName: helpers.TempDirPrefix + "spring-" + strconv.FormatInt(GinkgoRandomSeed(), 10),
-				WorkDir:         helpers.WorkDir,
-				JavaVersion:     JavaVersion,
-				ProjectType:     "maven-project",
-			},
-		}
-		T.GitProviderURL()
-	})
+// CreateSpringTest creates the tests of creating a spring application
+func CreateSpringTest() {
+	Describe("create spring\n", func() {
+		var T SpringTestOptions
+		JavaVersion := helpers.Config.Tests.JavaVersion
 
-	Describe("Given valid parameters", func() {
-		Context("when running jx create spring", func() {
-			It("creates a spring application and promotes it to staging\n", func() {
-				args := []string{"project", "spring", "-b", "--org", T.GetGitOrganisation(), "--artifact", T.ApplicationName, "--name", T.ApplicationName, "-j", T.JavaVersion, "-d", "web", "-d", "actuator", "--type", T.ProjectType}
+		BeforeEach(func() {
+			T = SpringTestOptions{
+				helpers.TestOptions{
+					ApplicationName: helpers.NewApplicationName("spring"),
+					WorkDir:         helpers.WorkDir,
+					JavaVersion:     JavaVersion,
+					ProjectType:     "maven-project",
+					Content:         helpers.SpringActuatorHealth,
+				},
+			}
+			T.GitProviderURL()
+		})
 
-				gitProviderUrl, err := T.GitProviderURL()
-				Expect(err).NotTo(HaveOccurred())
-				if gitProviderUrl != "" {
-					utils.LogInfof("Using Git provider URL %s", gitProviderUrl)
-					args = append(args, "--git-provider-url", gitProviderUrl)
-				}
-				gitKind := os.Getenv("GIT_KIND")
-				if gitKind != "" {
-					args = append(args, "--git-kind", gitKind)
-				}
+		AfterEach(func() {
+			T.CollectDiagnosticsOnFailure()
+			T.CleanupResources()
+		})
 
-				argsStr := strings.Join(args, " ")
-				By(fmt.Sprintf("calling jx %s", argsStr), func() {
-					T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
-				})
-				if T.WaitForFirstRelease() {
-					By(fmt.Sprintf("waiting for the first release"), func() {
-						T.TheApplicationShouldBeBuiltAndPromotedViaCICD(404)
-					})
-				}
+		Describe("Given valid parameters", func() {
+			Context("when running jx create spring", func() {
+				It("creates a spring application and promotes it to staging\n", func() {
+					args := []string{"project", "spring", "-b", "--org", T.GetGitOrganisation(), "--artifact", T.ApplicationName, "--name", T.ApplicationName, "-j", T.JavaVersion, "-d", "web", "-d", "actuator", "--type", T.ProjectType}
 
-				if T.TestPullRequest() {
-					By("performing a pull request on the source and asserting that a preview environment is created", func() {
-						T.CreatePullRequestAndGetPreviewEnvironment(404)
-					})
-				}
+					gitProviderUrl, err := T.GitProviderURL()
+					Expect(err).NotTo(HaveOccurred())
+					if gitProviderUrl != "" {
+						utils.LogInfof("Using Git provider URL %s", gitProviderUrl)
+						args = append(args, "--git-provider-url", gitProviderUrl)
+					}
+					gitKind := helpers.Config.Git.Kind
+					if gitKind != "" {
+						args = append(args, "--git-kind", gitKind)
+					}
 
-				if SkipManualPromotion == "" {
-					args = []string{"promote", "--env", "production", "--version", "0.0.1", T.ApplicationName}
-					By("manually promoting app to production environment", func() {
-						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
-						T.TheApplicationIsRunningInProduction(404)
-					})
-				}
+					T.RegisterRepositoryCleanup(T.GetGitOrganisation(), T.ApplicationName)
+					T.RegisterApplicationCleanup(T.ApplicationName)
 
-				if T.DeleteApplications() {
-					args = []string{"delete", "application", "-b", T.ApplicationName}
 					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("calling jx %s to delete the application", argsStr), func() {
-						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+					T.Phase(helpers.PhaseQuickstartCreation, func() {
+						helpers.Step(fmt.Sprintf("calling jx %s", argsStr), func() {
+							T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+						})
 					})
-				}
+					if T.WaitForFirstRelease() {
+						helpers.Step(fmt.Sprintf("waiting for the first release"), func() {
+							T.TheApplicationShouldBeBuiltAndPromotedViaCICD(404)
+						})
+					}
 
-				if T.DeleteRepos() {
-					args = []string{"delete", "repo", "-b", "--github", "-o", T.GetGitOrganisation(), "-n", T.ApplicationName}
-					argsStr := strings.Join(args, " ")
-					By(fmt.Sprintf("calling jx %s to delete the git repository", argsStr), func() {
-						T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
-					})
-				}
+					if T.TestPullRequest() {
+						helpers.Step("performing a pull request on the source and asserting that a preview environment is created", func() {
+							T.CreatePullRequestAndGetPreviewEnvironment(404)
+						})
+					}
+
+					if T.ShouldTestMergePullRequest() {
+						helpers.Step("approving and merging a pull request and asserting that its release is promoted to staging", func() {
+							T.MergePullRequestAndExpectRelease(404)
+						})
+					}
+
+					if !helpers.Config.Tests.SkipManualPromotion {
+						args = []string{"promote", "--env", "production", "--version", "0.0.1", T.ApplicationName}
+						T.Phase(helpers.PhaseProductionPromotion, func() {
+							helpers.Step("manually promoting app to production environment", func() {
+								T.ExpectJxExecution(T.WorkDir, helpers.TimeoutSessionWait, 0, args...)
+								T.TheApplicationIsRunningInProduction(404)
+							})
+						})
+					}
+
+					T.DeleteApplication(T.ApplicationName)
+				})
 			})
 		})
 	})
-})
+}
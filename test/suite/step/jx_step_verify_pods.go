@@ -2,44 +2,57 @@ package step
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/jenkins-x/bdd-jx3/test/helpers"
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
 	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
-var _ = Describe("verify pods", func() {
+var _ = suites.Register(&suites.Suite{
+	Name:         "verify_pods",
+	Description:  "verifies there are no failed pods in the cluster",
+	Tags:         []string{"smoke"},
+	Capabilities: []suites.Capability{suites.CapabilityCluster},
+	Timeouts:     map[string]config.Duration{"timeouts.cmdLine": config.Minutes(5)},
+	Specs:        VerifyPodsTest,
+})
 
-	var T StepTestOptions
+// VerifyPodsTest creates the tests which verify the pods of the cluster
+func VerifyPodsTest() {
+	Describe("verify pods", func() {
 
-	BeforeEach(func() {
-		T = StepTestOptions{
-			helpers.TestOptions{
-				ApplicationName: helpers.TempDirPrefix + "verify-pods-" + strconv.FormatInt(GinkgoRandomSeed(), 10),
-				WorkDir:         helpers.WorkDir,
-			},
-		}
-	})
+		var T StepTestOptions
+
+		BeforeEach(func() {
+			T = StepTestOptions{
+				helpers.TestOptions{
+					ApplicationName: helpers.NewApplicationName("verify-pods"),
+					WorkDir:         helpers.WorkDir,
+				},
+			}
+		})
+
+		Describe("Verify there are no failed pods", func() {
+			Context("by running jx step verify pod", func() {
+				It("should exit 0 or contain the word Failed", func() {
 
-	Describe("Verify there are no failed pods", func() {
-		Context("by running jx step verify pod", func() {
-			It("should exit 0 or contain the word Failed", func() {
-
-				args := []string{"step", "verify", "pod", "ready"}
-				argsStr := strings.Join(args, " ")
-				var out string
-				By(fmt.Sprintf("calling jx %s", argsStr), func() {
-					r := runner.New(T.WorkDir, &helpers.TimeoutCmdLine, 0)
-					var err error
-					out, err = r.RunWithOutput(args...)
-					utils.ExpectNoError(err)
+					args := []string{"step", "verify", "pod", "ready"}
+					argsStr := strings.Join(args, " ")
+					var out string
+					helpers.Step(fmt.Sprintf("calling jx %s", argsStr), func() {
+						r := runner.New(T.WorkDir, &helpers.TimeoutCmdLine, 0)
+						var err error
+						out, err = r.RunWithOutput(args...)
+						utils.ExpectNoError(err)
+					})
+					Expect(out).ShouldNot(ContainSubstring("Failed"), "There are failed pods")
 				})
-				Expect(out).ShouldNot(ContainSubstring("Failed"), "There are failed pods")
 			})
 		})
 	})
-})
+}
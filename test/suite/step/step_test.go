@@ -9,9 +9,9 @@ import (
 )
 
 func TestSuite(t *testing.T) {
-	helpers.RunWithReporters(t, "verify_pods")
+	helpers.RunSuites(t, "verify_pods")
 }
 
-var _ = BeforeSuite(helpers.BeforeSuiteCallback)
+var _ = SynchronizedBeforeSuite(helpers.SynchronizedBeforeSuiteNode1Callback, helpers.SynchronizedBeforeSuiteAllNodesCallback)
 
-var _ = SynchronizedAfterSuite(func() {}, helpers.SynchronizedAfterSuiteCallback)
+var _ = SynchronizedAfterSuite(helpers.SynchronizedAfterSuiteAllNodesCallback, helpers.SynchronizedAfterSuiteNode1Callback)
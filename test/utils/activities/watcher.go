@@ -0,0 +1,189 @@
+package activities
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// TerminalStatuses the PipelineActivity statuses after which a build will not change any more
+var TerminalStatuses = []v1.ActivityStatusType{
+	v1.ActivityStatusTypeSucceeded,
+	v1.ActivityStatusTypeFailed,
+	v1.ActivityStatusTypeAborted,
+	v1.ActivityStatusTypeError,
+	v1.ActivityStatusTypeTimedOut,
+	v1.ActivityStatusTypeCancelled,
+	v1.ActivityStatusTypeNotExecuted,
+}
+
+// Watcher watches PipelineActivity resources using the jx-api client rather than polling jx get activities
+type Watcher struct {
+	JXClient  versioned.Interface
+	Namespace string
+}
+
+// Job identifies the pipelines of a single branch of a repository
+type Job struct {
+	Owner      string
+	Repository string
+	Branch     string
+}
+
+// NewWatcher creates a new PipelineActivity watcher for the given namespace
+func NewWatcher(jxClient versioned.Interface, ns string) *Watcher {
+	return &Watcher{
+		JXClient:  jxClient,
+		Namespace: ns,
+	}
+}
+
+// ParseJob parses a job name of the form owner/repository/branch
+func ParseJob(jobName string) (Job, error) {
+	// the branch may contain slashes such as feature/x
+	parts := strings.SplitN(jobName, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Job{}, fmt.Errorf("job name %s should be of the form owner/repository/branch", jobName)
+	}
+	return Job{
+		Owner:      parts[0],
+		Repository: parts[1],
+		Branch:     parts[2],
+	}, nil
+}
+
+// String returns the job name
+func (j Job) String() string {
+	return fmt.Sprintf("%s/%s/%s", j.Owner, j.Repository, j.Branch)
+}
+
+// Matches returns true if the given PipelineActivity is a build of this job
+func (j Job) Matches(pa *v1.PipelineActivity) bool {
+	spec := &pa.Spec
+	if spec.GitOwner != "" && spec.GitRepository != "" && spec.GitBranch != "" {
+		return strings.EqualFold(spec.GitOwner, j.Owner) && strings.EqualFold(spec.GitRepository, j.Repository) && strings.EqualFold(spec.GitBranch, j.Branch)
+	}
+	return strings.EqualFold(spec.Pipeline, j.String())
+}
+
+// BuildNumber returns the build number of the PipelineActivity or 0 if it cannot be parsed
+func BuildNumber(pa *v1.PipelineActivity) int {
+	n, err := strconv.Atoi(pa.Spec.Build)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// IsTerminal returns true if the PipelineActivity has finished
+func IsTerminal(pa *v1.PipelineActivity) bool {
+	for _, s := range TerminalStatuses {
+		if pa.Spec.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the PipelineActivity with the highest build number of the job or nil if there are none
+func (w *Watcher) Latest(ctx context.Context, job Job) (*v1.PipelineActivity, error) {
+	list, err := w.JXClient.JenkinsV1().PipelineActivities(w.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineActivities in namespace %s: %w", w.Namespace, err)
+	}
+	var answer *v1.PipelineActivity
+	for i := range list.Items {
+		pa := &list.Items[i]
+		if job.Matches(pa) && (answer == nil || BuildNumber(pa) > BuildNumber(answer)) {
+			answer = pa
+		}
+	}
+	return answer, nil
+}
+
+// Build returns the PipelineActivity of the given build of the job or nil if there is none
+func (w *Watcher) Build(ctx context.Context, job Job, build int) (*v1.PipelineActivity, error) {
+	list, err := w.JXClient.JenkinsV1().PipelineActivities(w.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineActivities in namespace %s: %w", w.Namespace, err)
+	}
+	for i := range list.Items {
+		pa := &list.Items[i]
+		if job.Matches(pa) && BuildNumber(pa) == build {
+			return pa, nil
+		}
+	}
+	return nil, nil
+}
+
+// WaitForCompletion streams the PipelineActivity changes of the job until the newest build with a build number greater
+// than afterBuild reaches a terminal status. The completed PipelineActivity is returned whatever its status so callers
+// can report why it failed. An error is returned if no build completes within the timeout.
+func (w *Watcher) WaitForCompletion(ctx context.Context, job Job, afterBuild int, timeout time.Duration) (*v1.PipelineActivity, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	activities := w.JXClient.JenkinsV1().PipelineActivities(w.Namespace)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return activities.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return activities.Watch(ctx, options)
+		},
+	}
+
+	// the informer store is updated before each event is delivered so we always pick the newest build from the
+	// store rather than the event, otherwise an older completed build could end the wait during the initial sync
+	var store cache.Store
+	var latest *v1.PipelineActivity
+	lastLogged := ""
+	completed := func() bool {
+		latest = nil
+		for _, o := range store.List() {
+			pa, ok := o.(*v1.PipelineActivity)
+			if !ok || !job.Matches(pa) || BuildNumber(pa) <= afterBuild {
+				continue
+			}
+			if latest == nil || BuildNumber(pa) > BuildNumber(latest) {
+				latest = pa
+			}
+		}
+		if latest == nil {
+			return false
+		}
+		status := fmt.Sprintf("%s #%s %s", job.String(), latest.Spec.Build, latest.Spec.Status)
+		if status != lastLogged {
+			lastLogged = status
+			utils.LogInfof("PipelineActivity %s\n", status)
+		}
+		return IsTerminal(latest)
+	}
+	precondition := func(s cache.Store) (bool, error) {
+		store = s
+		return completed(), nil
+	}
+	condition := func(watch.Event) (bool, error) {
+		return completed(), nil
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &v1.PipelineActivity{}, precondition, condition)
+	if err != nil {
+		if latest != nil {
+			return latest, fmt.Errorf("build %s #%s did not complete within %s, last status was %s: %w", job.String(), latest.Spec.Build, timeout.String(), latest.Spec.Status, err)
+		}
+		return nil, fmt.Errorf("no build of %s after #%d completed within %s: %w", job.String(), afterBuild, timeout.String(), err)
+	}
+	return latest, nil
+}
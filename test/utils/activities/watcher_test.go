@@ -0,0 +1,141 @@
+package activities_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/activities"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const ns = "jx"
+
+func newActivity(name, build string, status v1.ActivityStatusType) *v1.PipelineActivity {
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:      "cb-kubecd/bdd-gh-1602257801/PR-1",
+			Build:         build,
+			Status:        status,
+			GitOwner:      "cb-kubecd",
+			GitRepository: "bdd-gh-1602257801",
+			GitBranch:     "PR-1",
+		},
+	}
+}
+
+func TestParseJob(t *testing.T) {
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/PR-1")
+	require.NoError(t, err)
+	assert.Equal(t, "cb-kubecd", job.Owner)
+	assert.Equal(t, "bdd-gh-1602257801", job.Repository)
+	assert.Equal(t, "PR-1", job.Branch)
+
+	job, err = activities.ParseJob("cb-kubecd/bdd-gh-1602257801/feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, "cb-kubecd", job.Owner)
+	assert.Equal(t, "bdd-gh-1602257801", job.Repository)
+	assert.Equal(t, "feature/x", job.Branch)
+	assert.Equal(t, "cb-kubecd/bdd-gh-1602257801/feature/x", job.String())
+
+	_, err = activities.ParseJob("cb-kubecd/bdd-gh-1602257801")
+	assert.Error(t, err)
+	_, err = activities.ParseJob("cb-kubecd//master")
+	assert.Error(t, err)
+}
+
+func TestLatest(t *testing.T) {
+	jxClient := fake.NewSimpleClientset(
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-1", "1", v1.ActivityStatusTypeSucceeded),
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-2", "2", v1.ActivityStatusTypeRunning),
+	)
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/PR-1")
+	require.NoError(t, err)
+
+	latest, err := activities.NewWatcher(jxClient, ns).Latest(context.TODO(), job)
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, "2", latest.Spec.Build)
+}
+
+func TestBuild(t *testing.T) {
+	jxClient := fake.NewSimpleClientset(
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-1", "1", v1.ActivityStatusTypeSucceeded),
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-2", "2", v1.ActivityStatusTypeRunning),
+	)
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/pr-1")
+	require.NoError(t, err)
+	w := activities.NewWatcher(jxClient, ns)
+
+	pa, err := w.Build(context.TODO(), job, 1)
+	require.NoError(t, err)
+	require.NotNil(t, pa, "the branch should be matched ignoring case")
+	assert.Equal(t, "cb-kubecd-bdd-gh-1602257801-pr-1-1", pa.Name)
+
+	pa, err = w.Build(context.TODO(), job, 3)
+	require.NoError(t, err)
+	assert.Nil(t, pa)
+}
+
+func TestWaitForCompletionWaitsForRunningBuild(t *testing.T) {
+	running := newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-2", "2", v1.ActivityStatusTypeRunning)
+	jxClient := fake.NewSimpleClientset(
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-1", "1", v1.ActivityStatusTypeFailed),
+		running,
+	)
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/PR-1")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		succeeded := running.DeepCopy()
+		succeeded.Spec.Status = v1.ActivityStatusTypeSucceeded
+		_, err := jxClient.JenkinsV1().PipelineActivities(ns).Update(context.TODO(), succeeded, metav1.UpdateOptions{})
+		assert.NoError(t, err)
+	}()
+
+	activity, err := activities.NewWatcher(jxClient, ns).WaitForCompletion(context.TODO(), job, 0, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "2", activity.Spec.Build)
+	assert.Equal(t, v1.ActivityStatusTypeSucceeded, activity.Spec.Status)
+}
+
+func TestWaitForCompletionIgnoresEarlierBuilds(t *testing.T) {
+	jxClient := fake.NewSimpleClientset(
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-1", "1", v1.ActivityStatusTypeSucceeded),
+	)
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/PR-1")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_, err := jxClient.JenkinsV1().PipelineActivities(ns).Create(context.TODO(), newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-2", "2", v1.ActivityStatusTypeAborted), metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}()
+
+	activity, err := activities.NewWatcher(jxClient, ns).WaitForCompletion(context.TODO(), job, 1, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "2", activity.Spec.Build)
+	assert.Equal(t, v1.ActivityStatusTypeAborted, activity.Spec.Status)
+}
+
+func TestWaitForCompletionTimesOut(t *testing.T) {
+	jxClient := fake.NewSimpleClientset(
+		newActivity("cb-kubecd-bdd-gh-1602257801-pr-1-1", "1", v1.ActivityStatusTypeRunning),
+	)
+	job, err := activities.ParseJob("cb-kubecd/bdd-gh-1602257801/PR-1")
+	require.NoError(t, err)
+
+	activity, err := activities.NewWatcher(jxClient, ns).WaitForCompletion(context.TODO(), job, 0, 500*time.Millisecond)
+	require.Error(t, err)
+	require.NotNil(t, activity)
+	assert.Equal(t, v1.ActivityStatusTypeRunning, activity.Spec.Status)
+}
@@ -0,0 +1,151 @@
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+)
+
+// StateQuarantined is the state of a spec in a run which failed but is quarantined
+const StateQuarantined = "quarantined"
+
+// Key identifies a phase of the Jenkins X workflow for a quickstart and git kind
+type Key struct {
+	Phase      string `json:"phase"`
+	Quickstart string `json:"quickstart,omitempty"`
+	GitKind    string `json:"gitKind,omitempty"`
+}
+
+// Sample is how long a phase took in a run
+type Sample struct {
+	Key
+	Duration config.Duration `json:"duration"`
+	Failed   bool            `json:"failed,omitempty"`
+}
+
+// Run is the phase durations and the spec results of a run of the suites
+type Run struct {
+	Start  time.Time `json:"start"`
+	Phases []*Sample `json:"phases,omitempty"`
+	// Specs are the states of the specs keyed by the suite and the name of the spec
+	Specs map[string]string `json:"specs,omitempty"`
+}
+
+// Baseline is the runs the timings and results of a run are compared against, oldest first
+type Baseline struct {
+	Runs []*Run `json:"runs"`
+}
+
+// NewRun creates a run from the results of the suites, which may be written by several parallel ginkgo nodes. When
+// a phase ran more than once with the same key the latest duration wins.
+func NewRun(results ...*reports.Result) *Run {
+	run := &Run{Specs: map[string]string{}}
+	samples := map[Key]*Sample{}
+	var phases []*reports.Phase
+	for _, result := range results {
+		if run.Start.IsZero() || result.Start.Before(run.Start) {
+			run.Start = result.Start
+		}
+		for _, s := range result.Specs {
+			state := s.State
+			if s.Quarantined {
+				// quarantined failures do not fail the suite so they are not regressions
+				state = StateQuarantined
+			}
+			run.Specs[SpecKey(result.Suite, s.Name)] = state
+		}
+		phases = append(phases, result.Phases...)
+	}
+	sort.SliceStable(phases, func(i, j int) bool {
+		return phases[i].Start.Before(phases[j].Start)
+	})
+	for _, p := range phases {
+		key := Key{Phase: p.Name, Quickstart: p.Labels["quickstart"], GitKind: p.Labels["git_kind"]}
+		sample := samples[key]
+		if sample == nil {
+			sample = &Sample{Key: key}
+			samples[key] = sample
+			run.Phases = append(run.Phases, sample)
+		}
+		sample.Duration = p.Duration
+		sample.Failed = p.Failed
+	}
+	return run
+}
+
+// SpecKey returns the key of a spec in a run
+func SpecKey(suite string, spec string) string {
+	return suite + ": " + spec
+}
+
+// LoadRun loads a run from the JSON reports of the suites
+func LoadRun(paths ...string) (*Run, error) {
+	var results []*reports.Result
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the report %s: %w", path, err)
+		}
+		result := &reports.Result{}
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the report %s: %w", path, err)
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no reports to compare")
+	}
+	return NewRun(results...), nil
+}
+
+// Load loads the baseline from the given file, returning an empty baseline if it does not exist yet
+func Load(path string) (*Baseline, error) {
+	b := &Baseline{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("failed to read the baseline %s: %w", path, err)
+	}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the baseline %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Save writes the baseline to the given file
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create the directory of the baseline %s: %w", path, err)
+	}
+	err = os.WriteFile(path, append(data, '\n'), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the baseline %s: %w", path, err)
+	}
+	return nil
+}
+
+// Add adds the run to the baseline keeping only the latest maxRuns runs, or all of them if maxRuns is not positive
+func (b *Baseline) Add(run *Run, maxRuns int) {
+	b.Runs = append(b.Runs, run)
+	sort.SliceStable(b.Runs, func(i, j int) bool {
+		return b.Runs[i].Start.Before(b.Runs[j].Start)
+	})
+	if maxRuns > 0 && len(b.Runs) > maxRuns {
+		b.Runs = b.Runs[len(b.Runs)-maxRuns:]
+	}
+}
@@ -0,0 +1,103 @@
+package baseline_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/baseline"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+
+const spec = "quickstart node-http creates a new source repository and promotes it to staging"
+
+// newResult creates the result of a nightly run of the quickstarts with the given durations of the preview phase
+func newResult(day int, preview time.Duration, state string) *reports.Result {
+	at := start.AddDate(0, 0, day)
+	labels := map[string]string{"quickstart": "node-http", "git_kind": "github"}
+	return &reports.Result{
+		Suite: "create_quickstarts",
+		Start: at,
+		Specs: []*reports.Spec{{Name: spec, State: state}},
+		Phases: []*reports.Phase{
+			{Name: "first_release_build", Labels: labels, Start: at, Duration: config.Duration(3 * time.Minute)},
+			{Name: "preview_url_available", Labels: labels, Start: at.Add(time.Hour), Duration: config.Duration(preview)},
+		},
+	}
+}
+
+func newBaseline() *baseline.Baseline {
+	b := &baseline.Baseline{}
+	for i, d := range []time.Duration{110 * time.Second, 2 * time.Minute, 130 * time.Second} {
+		b.Add(baseline.NewRun(newResult(i, d, reports.StatePassed)), 10)
+	}
+	return b
+}
+
+func diff(t *testing.T, c *baseline.Comparison) string {
+	buf := &strings.Builder{}
+	require.NoError(t, c.WriteDiff(buf))
+	return buf.String()
+}
+
+func TestCompareFlagsSlowerPhase(t *testing.T) {
+	b := newBaseline()
+	c := baseline.Compare(b, baseline.NewRun(newResult(3, 4*time.Minute, reports.StatePassed)), baseline.DefaultOptions())
+
+	assert.Equal(t, 1, c.Regressions())
+	assert.Equal(t, `PHASE                  QUICKSTART  GIT KIND  RUNS  BASELINE  CURRENT  CHANGE  RESULT
+first_release_build    node-http   github    3     3m0s ±0s  3m0s     +0%     ok
+preview_url_available  node-http   github    3     2m0s ±8s  4m0s     +100%   SLOWER
+
+1 regressions compared to the baseline
+`, diff(t, c))
+}
+
+func TestCompareIgnoresNoise(t *testing.T) {
+	b := newBaseline()
+	c := baseline.Compare(b, baseline.NewRun(newResult(3, 150*time.Second, reports.StatePassed)), baseline.DefaultOptions())
+	assert.Equal(t, 0, c.Regressions(), diff(t, c))
+
+	o := baseline.DefaultOptions()
+	o.MinRuns = 4
+	c = baseline.Compare(b, baseline.NewRun(newResult(3, time.Hour, reports.StatePassed)), o)
+	assert.Equal(t, 0, c.Regressions(), "phases without enough baseline runs should not be compared")
+	assert.Equal(t, baseline.ResultTooFewRuns, c.Phases[1].Result)
+}
+
+func TestCompareFlagsNewlyFailingSpec(t *testing.T) {
+	b := newBaseline()
+	current := baseline.NewRun(newResult(3, 2*time.Minute, reports.StateFailed))
+	c := baseline.Compare(b, current, baseline.DefaultOptions())
+	assert.Equal(t, 1, c.Regressions())
+	assert.Contains(t, diff(t, c), "create_quickstarts: "+spec+"  passed 3/3  failed   NEWLY FAILING\n")
+
+	b.Add(current, 10)
+	c = baseline.Compare(b, baseline.NewRun(newResult(4, 2*time.Minute, reports.StateFailed)), baseline.DefaultOptions())
+	assert.Equal(t, 0, c.Regressions(), "a spec which was already failing should not be a regression")
+	assert.Equal(t, baseline.ResultStillFailing, c.Specs[0].Result)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "baseline", "nightly.json")
+	b, err := baseline.Load(file)
+	require.NoError(t, err)
+	assert.Empty(t, b.Runs, "a missing baseline should be empty")
+
+	b = newBaseline()
+	b.Add(baseline.NewRun(newResult(3, 2*time.Minute, reports.StatePassed)), 2)
+	require.NoError(t, b.Save(file))
+
+	loaded, err := baseline.Load(file)
+	require.NoError(t, err)
+	require.Len(t, loaded.Runs, 2, "only the latest runs should be kept")
+	assert.Equal(t, start.AddDate(0, 0, 3), loaded.Runs[1].Start)
+	assert.Equal(t, 2*time.Minute, loaded.Runs[1].Phases[1].Duration.Duration())
+	assert.Equal(t, reports.StatePassed, loaded.Runs[1].Specs[baseline.SpecKey("create_quickstarts", spec)])
+}
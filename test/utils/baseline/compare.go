@@ -0,0 +1,256 @@
+package baseline
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+)
+
+// Options are the thresholds a phase has to exceed to be a significant slowdown
+type Options struct {
+	// MinRuns is the number of successful baseline runs of a phase needed to compare it
+	MinRuns int
+	// Ratio is how many times longer than the mean of the baseline a phase has to take, such as 2 for twice as long
+	Ratio float64
+	// Sigmas is how many standard deviations above the mean of the baseline a phase has to take
+	Sigmas float64
+}
+
+// DefaultOptions returns the default thresholds
+func DefaultOptions() Options {
+	return Options{
+		MinRuns: 3,
+		Ratio:   1.5,
+		Sigmas:  3,
+	}
+}
+
+const (
+	ResultOK           = "ok"
+	ResultSlower       = "SLOWER"
+	ResultFaster       = "faster"
+	ResultFailed       = "failed"
+	ResultNew          = "new"
+	ResultTooFewRuns   = "too few runs"
+	ResultNewlyFailing = "NEWLY FAILING"
+	ResultFixed        = "fixed"
+	ResultStillFailing = "still failing"
+)
+
+// PhaseComparison compares how long a phase took with the baseline
+type PhaseComparison struct {
+	Key
+	// Runs is the number of successful baseline runs of the phase
+	Runs    int
+	Mean    time.Duration
+	StdDev  time.Duration
+	Current time.Duration
+	Result  string
+}
+
+// Regressed returns true if the phase is significantly slower than the baseline
+func (c *PhaseComparison) Regressed() bool {
+	return c.Result == ResultSlower
+}
+
+// SpecComparison compares the state of a spec with the baseline
+type SpecComparison struct {
+	Spec string
+	// Passed and Runs are how many of the baseline runs of the spec passed
+	Passed  int
+	Runs    int
+	Latest  string
+	Current string
+	Result  string
+}
+
+// Regressed returns true if the spec failed but passed in the latest baseline run
+func (c *SpecComparison) Regressed() bool {
+	return c.Result == ResultNewlyFailing
+}
+
+// Comparison is the comparison of a run with the baseline
+type Comparison struct {
+	Phases []*PhaseComparison
+	// Specs are the specs whose state differs from the latest baseline run or which failed
+	Specs []*SpecComparison
+}
+
+// Regressions returns the number of phases which are significantly slower and specs which are newly failing
+func (c *Comparison) Regressions() int {
+	answer := 0
+	for _, p := range c.Phases {
+		if p.Regressed() {
+			answer++
+		}
+	}
+	for _, s := range c.Specs {
+		if s.Regressed() {
+			answer++
+		}
+	}
+	return answer
+}
+
+// Compare compares the run with the baseline. A phase is significantly slower if there are enough baseline runs and
+// it took both Ratio times the mean and more than Sigmas standard deviations above the mean of the baseline.
+func Compare(b *Baseline, run *Run, o Options) *Comparison {
+	c := &Comparison{}
+	history := map[Key][]float64{}
+	for _, r := range b.Runs {
+		for _, s := range r.Phases {
+			if !s.Failed {
+				history[s.Key] = append(history[s.Key], s.Duration.Duration().Seconds())
+			}
+		}
+	}
+	for _, s := range run.Phases {
+		samples := history[s.Key]
+		mean, stdDev := meanAndStdDev(samples)
+		pc := &PhaseComparison{
+			Key:     s.Key,
+			Runs:    len(samples),
+			Mean:    seconds(mean),
+			StdDev:  seconds(stdDev),
+			Current: s.Duration.Duration(),
+		}
+		current := s.Duration.Duration().Seconds()
+		switch {
+		case s.Failed:
+			pc.Result = ResultFailed
+		case len(samples) == 0:
+			pc.Result = ResultNew
+		case len(samples) < o.MinRuns:
+			pc.Result = ResultTooFewRuns
+		case current >= mean*o.Ratio && current > mean+o.Sigmas*stdDev:
+			pc.Result = ResultSlower
+		case current <= mean/o.Ratio && current < mean-o.Sigmas*stdDev:
+			pc.Result = ResultFaster
+		default:
+			pc.Result = ResultOK
+		}
+		c.Phases = append(c.Phases, pc)
+	}
+	sort.SliceStable(c.Phases, func(i, j int) bool {
+		a, b := c.Phases[i], c.Phases[j]
+		if a.Quickstart != b.Quickstart {
+			return a.Quickstart < b.Quickstart
+		}
+		return a.GitKind < b.GitKind
+	})
+
+	var latest *Run
+	if len(b.Runs) > 0 {
+		latest = b.Runs[len(b.Runs)-1]
+	}
+	for spec, state := range run.Specs {
+		sc := &SpecComparison{Spec: spec, Current: state}
+		for _, r := range b.Runs {
+			if s, ok := r.Specs[spec]; ok {
+				sc.Runs++
+				if s == reports.StatePassed {
+					sc.Passed++
+				}
+			}
+		}
+		if latest != nil {
+			sc.Latest = latest.Specs[spec]
+		}
+		failed := isFailed(state)
+		switch {
+		case failed && sc.Latest == reports.StatePassed:
+			sc.Result = ResultNewlyFailing
+		case failed:
+			sc.Result = ResultStillFailing
+		case state == reports.StatePassed && isFailed(sc.Latest):
+			sc.Result = ResultFixed
+		default:
+			continue
+		}
+		c.Specs = append(c.Specs, sc)
+	}
+	sort.Slice(c.Specs, func(i, j int) bool {
+		return c.Specs[i].Spec < c.Specs[j].Spec
+	})
+	return c
+}
+
+// WriteDiff writes the comparison as tables of the phases and the specs which changed, followed by a summary
+func (c *Comparison) WriteDiff(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tQUICKSTART\tGIT KIND\tRUNS\tBASELINE\tCURRENT\tCHANGE\tRESULT")
+	for _, p := range c.Phases {
+		baseline, change := "-", "-"
+		if p.Runs > 0 {
+			baseline = fmt.Sprintf("%s ±%s", roundDuration(p.Mean), roundDuration(p.StdDev))
+			if p.Mean > 0 {
+				change = fmt.Sprintf("%+.0f%%", (float64(p.Current)/float64(p.Mean)-1)*100)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", p.Phase, orDash(p.Quickstart), orDash(p.GitKind), p.Runs, baseline, roundDuration(p.Current), change, p.Result)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	if len(c.Specs) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SPEC\tBASELINE\tCURRENT\tRESULT")
+		for _, s := range c.Specs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", strings.Join(strings.Fields(s.Spec), " "), fmt.Sprintf("passed %d/%d", s.Passed, s.Runs), s.Current, s.Result)
+		}
+		err = tw.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	n := c.Regressions()
+	if n == 0 {
+		_, err = fmt.Fprintln(w, "\nno regressions compared to the baseline")
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\n%d regressions compared to the baseline\n", n)
+	return err
+}
+
+func isFailed(state string) bool {
+	return state == reports.StateFailed || state == reports.StatePanicked || state == reports.StateTimedOut
+}
+
+func meanAndStdDev(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += s
+	}
+	mean := sum / float64(len(samples))
+	variance := 0.0
+	for _, s := range samples {
+		variance += (s - mean) * (s - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(samples)))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func roundDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+func orDash(text string) string {
+	if text == "" {
+		return "-"
+	}
+	return text
+}
@@ -0,0 +1,382 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"sigs.k8s.io/yaml"
+)
+
+// ReportFormats are the formats of the reports which can be written
+var ReportFormats = []string{"junit", "json", "html", "tap", "openmetrics"}
+
+const (
+	// EnvConfigFile is the environment variable used to specify the config file to load
+	EnvConfigFile = "BDD_CONFIG"
+	// DefaultFileName is the name of the config file which is looked up in the current directory and its parents
+	DefaultFileName = "bdd.yaml"
+)
+
+// Config is the configuration of the BDD tests. It is loaded from an optional bdd.yaml file and the environment
+// variables in the env tag of each setting override the values from the file. Settings tagged with invert are the
+// opposite of their environment variable, for example JX_DISABLE_DELETE_APP=true sets tests.deleteApplications to false.
+type Config struct {
+	// JX is the jx binary to use, defaults to jx on the $PATH
+	JX string `json:"jx,omitempty" env:"BDD_JX"`
+	// JxOutputFormat is the preferred output format of jx get commands, one of json, yaml or table
+	JxOutputFormat string `json:"jxOutputFormat,omitempty" env:"BDD_JX_OUTPUT_FORMAT"`
+	// JXUIURL is the URL of the Jenkins X UI
+	JXUIURL string `json:"jxuiURL,omitempty" env:"JXUI_URL"`
+	// Suite is the test suite run by the main suite
+	Suite string `json:"suite,omitempty" env:"JX_BDD_SUITE"`
+	// ReportsDir is the directory the test reports are written to
+	ReportsDir string `json:"reportsDir,omitempty" env:"REPORTS_DIR"`
+	// ReportFormats are the formats of the reports written to the reports directory, see ReportFormats
+	ReportFormats []string `json:"reportFormats,omitempty" env:"BDD_REPORT_FORMATS"`
+	// SlowSpecThreshold is the number of seconds after which Ginkgo marks a spec as slow
+	SlowSpecThreshold float64 `json:"slowSpecThreshold,omitempty" env:"SLOW_SPEC_THRESHOLD"`
+	// CleanWorkDir removes the work directory at the end of the suite
+	CleanWorkDir bool `json:"cleanWorkDir" env:"JX_DISABLE_CLEAN_DIR" config:"invert"`
+	// URLInsecureSkipVerify skips the TLS verify when checking URLs of deployed applications
+	URLInsecureSkipVerify bool `json:"urlInsecureSkipVerify,omitempty" env:"BDD_URL_INSECURE_SKIP_VERIFY"`
+	// LighthouseBaseReportURL is the base URL used by Lighthouse for status reporting, if set
+	LighthouseBaseReportURL string `json:"lighthouseBaseReportURL,omitempty" env:"BDD_LIGHTHOUSE_BASE_REPORT_URL"`
+
+	Git        Git        `json:"git,omitempty"`
+	Tests      Tests      `json:"tests,omitempty"`
+	Timeouts   Timeouts   `json:"timeouts,omitempty"`
+	Transcript Transcript `json:"transcript,omitempty"`
+	Coverage   Coverage   `json:"coverage,omitempty"`
+	Metrics    Metrics    `json:"metrics,omitempty"`
+	Flakes     Flakes     `json:"flakes,omitempty"`
+	Probe      Probe      `json:"probe,omitempty"`
+
+	file    string
+	sources map[string]string
+}
+
+// Git the git provider settings
+type Git struct {
+	// Kind is the kind of git provider, see gits.Kinds
+	Kind string `json:"kind,omitempty" env:"GIT_KIND"`
+	// ProviderURL is the URL of the git provider
+	ProviderURL string `json:"providerURL,omitempty" env:"GIT_PROVIDER_URL"`
+	// Organisation is the owner of the repositories created by the tests, defaults to the dev environment organisation
+	Organisation string `json:"organisation,omitempty" env:"GIT_ORGANISATION"`
+	// Username is the pipeline git user, defaults to the jx-boot secret
+	Username string `json:"username,omitempty" env:"GIT_USERNAME,GH_USERNAME"`
+	// Token is the API token of the pipeline git user, defaults to the jx-boot secret
+	Token string `json:"token,omitempty" env:"GIT_TOKEN,GITHUB_TOKEN,GH_ACCESS_TOKEN" config:"secret"`
+	// ApproverUsername is the user which approves pull requests as the pipeline user may not be allowed to
+	ApproverUsername string `json:"approverUsername,omitempty" env:"BDD_APPROVER_USERNAME"`
+	// ApproverToken is the API token of the approver user
+	ApproverToken string `json:"approverToken,omitempty" env:"BDD_APPROVER_ACCESS_TOKEN" config:"secret"`
+	// ForceLocalAuthConfig only uses the local credentials rather than the jx-boot secret
+	ForceLocalAuthConfig bool `json:"forceLocalAuthConfig,omitempty" env:"BDD_FORCE_LOCAL_AUTH_CONFIG"`
+}
+
+// Tests the settings which enable or disable parts of the tests
+type Tests struct {
+	// DeleteApplications deletes the applications created by the tests once they have been promoted
+	DeleteApplications bool `json:"deleteApplications" env:"JX_DISABLE_DELETE_APP" config:"invert"`
+	// DeleteRepos deletes the git repositories created by the tests
+	DeleteRepos bool `json:"deleteRepos" env:"JX_DISABLE_DELETE_REPO" config:"invert"`
+	// PullRequest tests creating a pull request and its preview environment
+	PullRequest bool `json:"pullRequest" env:"JX_DISABLE_TEST_PULL_REQUEST" config:"invert"`
+	// WaitForFirstRelease waits for the first release to be promoted to staging
+	WaitForFirstRelease bool `json:"waitForFirstRelease" env:"JX_DISABLE_WAIT_FOR_FIRST_RELEASE" config:"invert"`
+	// PipelineActivityCheck checks that PipelineActivities are updated with the pull request title
+	PipelineActivityCheck bool `json:"pipelineActivityCheck" env:"BDD_DISABLE_PIPELINEACTIVITY_CHECK" config:"invert"`
+	// ClusterRepoCheck checks that promotions and deleting applications change the helmfiles of the cluster repository
+	ClusterRepoCheck bool `json:"clusterRepoCheck" env:"BDD_DISABLE_CLUSTER_REPO_CHECK" config:"invert"`
+	// PreviewTeardownCheck closes the pull request once its preview works and checks the preview is garbage collected
+	PreviewTeardownCheck bool `json:"previewTeardownCheck" env:"BDD_DISABLE_PREVIEW_TEARDOWN_CHECK" config:"invert"`
+	// ViewPromotePRLog views the logs of the promotion pull request pipelines
+	ViewPromotePRLog bool `json:"viewPromotePRLog,omitempty" env:"JX_VIEW_PROMOTE_PR_LOG"`
+	// ChatOps runs the ChatOps tests as part of the quickstart tests
+	ChatOps bool `json:"chatOps,omitempty" env:"BDD_ENABLE_TEST_CHATOPS_COMMANDS"`
+	// MergePullRequest approves the pull request of the quickstart tests as the approver user, waits for it to be merged
+	// and for the release built from the merged commit to be promoted to staging
+	MergePullRequest bool `json:"mergePullRequest,omitempty" env:"BDD_ENABLE_TEST_MERGE_PULL_REQUEST"`
+	// SkipManualPromotion skips promoting the spring application to production
+	SkipManualPromotion bool `json:"skipManualPromotion,omitempty" env:"JX_BDD_SKIP_MANUAL_PROMOTION"`
+	// IncludeApps are the apps to test the life cycle of
+	IncludeApps []string `json:"includeApps,omitempty" env:"JX_BDD_INCLUDE_APPS"`
+	// JavaVersion is the java version of the spring application
+	JavaVersion string `json:"javaVersion,omitempty" env:"JAVA_VERSION"`
+	// MaxPodRestarts is how many times the containers of a deployed application may have restarted
+	MaxPodRestarts int `json:"maxPodRestarts,omitempty" env:"BDD_MAX_POD_RESTARTS"`
+}
+
+// Timeouts the timeouts of the tests which can be Go durations such as 45m or whole numbers of minutes
+type Timeouts struct {
+	// BuildCompletes is the timeout for a build to complete successfully
+	BuildCompletes Duration `json:"buildCompletes,omitempty" env:"BDD_TIMEOUT_BUILD_COMPLETES"`
+	// BuildRunningInStaging is the timeout for an application to be running in staging
+	BuildRunningInStaging Duration `json:"buildRunningInStaging,omitempty" env:"BDD_TIMEOUT_BUILD_RUNNING_IN_STAGING"`
+	// PipelineActivityComplete is the timeout for a PipelineActivity to complete
+	PipelineActivityComplete Duration `json:"pipelineActivityComplete,omitempty" env:"BDD_TIMEOUT_PIPELINE_ACTIVITY_COMPLETE"`
+	// URLReturns is the timeout for a URL to return the expected status code
+	URLReturns Duration `json:"urlReturns,omitempty" env:"BDD_TIMEOUT_URL_RETURNS"`
+	// PreviewURLReturns is the timeout for a preview URL to be available
+	PreviewURLReturns Duration `json:"previewURLReturns,omitempty" env:"BDD_TIMEOUT_PREVIEW_URL_RETURNS"`
+	// PreviewRemoved is the timeout for the preview environment of a closed or merged pull request to be removed
+	PreviewRemoved Duration `json:"previewRemoved,omitempty" env:"BDD_TIMEOUT_PREVIEW_REMOVED"`
+	// CmdLine is the timeout for a command line execution to complete
+	CmdLine Duration `json:"cmdLine,omitempty" env:"BDD_TIMEOUT_CMD_LINE"`
+	// SessionWait is the timeout for jx commands run by the tests to complete
+	SessionWait Duration `json:"sessionWait,omitempty" env:"BDD_TIMEOUT_SESSION_WAIT"`
+	// DeploymentRollout is the timeout for a deployment rollout
+	DeploymentRollout Duration `json:"deploymentRollout,omitempty" env:"BDD_TIMEOUT_DEPLOYMENT_ROLLOUT"`
+	// ProwActionWait is the timeout for a ChatOps action to complete
+	ProwActionWait Duration `json:"prowActionWait,omitempty" env:"BDD_TIMEOUT_PROW_ACTION_WAIT"`
+	// JxRunner is the default timeout of the jx runner
+	JxRunner Duration `json:"jxRunner,omitempty" env:"BDD_TIMEOUT_JX_RUNNER"`
+}
+
+// Transcript the settings for recording the jx and kubectl commands run by the tests and replaying them later
+type Transcript struct {
+	// Record is the file every jx and kubectl invocation is appended to
+	Record string `json:"record,omitempty" env:"BDD_TRANSCRIPT_RECORD"`
+	// Replay is a recorded transcript whose outputs are returned rather than running jx and kubectl
+	Replay string `json:"replay,omitempty" env:"BDD_TRANSCRIPT_REPLAY"`
+}
+
+// Coverage the settings for collecting the coverage of jx binaries built with -cover
+type Coverage struct {
+	// Enabled gives every jx invocation its own GOCOVERDIR which are merged into a profile in the reports directory
+	// when the suite finishes
+	Enabled bool `json:"enabled,omitempty" env:"BDD_COVERAGE"`
+	// SourceDir is a checkout of the jx source which the HTML report is rendered from, defaults to the current directory
+	SourceDir string `json:"sourceDir,omitempty" env:"BDD_COVERAGE_SOURCE_DIR"`
+}
+
+// Metrics the settings for pushing the durations of the phases of the Jenkins X workflow to a Prometheus pushgateway
+type Metrics struct {
+	// PushURL is the URL of a Prometheus pushgateway compatible endpoint the phase durations are pushed to
+	PushURL string `json:"pushURL,omitempty" env:"BDD_METRICS_PUSH_URL"`
+	// Job is the job the phase durations are pushed as
+	Job string `json:"job,omitempty" env:"BDD_METRICS_JOB"`
+}
+
+// Flakes the settings for retrying specs which fail intermittently and quarantining specs which are known to be flaky
+type Flakes struct {
+	// Retries is how many times a failed spec is retried, a spec which passes on a retry is reported as flaky
+	Retries int `json:"retries,omitempty" env:"BDD_SPEC_RETRIES"`
+	// QuarantineFile lists the names of the specs whose failures are reported but do not fail the suite
+	QuarantineFile string `json:"quarantineFile,omitempty" env:"BDD_QUARANTINE_FILE"`
+}
+
+// Probe the settings of the requests made to the URLs of the applications deployed by the tests
+type Probe struct {
+	// BasicAuth sends the username and password as basic auth, such as for a UI behind basic auth
+	BasicAuth bool `json:"basicAuth,omitempty" env:"JX_APP_UI_TEST_BASIC_AUTH"`
+	// Username is the basic auth user
+	Username string `json:"username,omitempty" env:"BDD_URL_USERNAME"`
+	// Password is the basic auth password
+	Password string `json:"password,omitempty" env:"BDD_URL_PASSWORD,JENKINS_PASSWORD" config:"secret"`
+	// BearerToken is sent as an Authorization bearer token, instead of basic auth
+	BearerToken string `json:"bearerToken,omitempty" env:"BDD_URL_BEARER_TOKEN" config:"secret"`
+	// RequestTimeout is the timeout of each request, which is retried until the URL returns the expected response
+	RequestTimeout Duration `json:"requestTimeout,omitempty" env:"BDD_URL_REQUEST_TIMEOUT"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		JxOutputFormat:    string(parsers.OutputFormatJSON),
+		Suite:             "create_quickstarts",
+		ReportsDir:        filepath.Join("..", "build", "reports"),
+		ReportFormats:     []string{"junit", "json", "html", "openmetrics"},
+		SlowSpecThreshold: 50000,
+		CleanWorkDir:      true,
+		Tests: Tests{
+			DeleteApplications:    true,
+			DeleteRepos:           true,
+			PullRequest:           true,
+			WaitForFirstRelease:   true,
+			PipelineActivityCheck: true,
+			ClusterRepoCheck:      true,
+			PreviewTeardownCheck:  true,
+			JavaVersion:           "17",
+		},
+		Timeouts: Timeouts{
+			BuildCompletes:           Minutes(40),
+			BuildRunningInStaging:    Minutes(20),
+			PipelineActivityComplete: Minutes(15),
+			URLReturns:               Minutes(15),
+			PreviewURLReturns:        Minutes(15),
+			PreviewRemoved:           Minutes(30),
+			CmdLine:                  Minutes(1),
+			SessionWait:              Minutes(60),
+			DeploymentRollout:        Minutes(3),
+			ProwActionWait:           Minutes(5),
+			JxRunner:                 Minutes(5),
+		},
+		Metrics: Metrics{
+			Job: "bdd-jx3",
+		},
+		Probe: Probe{
+			Username:       "admin",
+			RequestTimeout: Duration(30 * time.Second),
+		},
+	}
+}
+
+var (
+	current     *Config
+	currentErr  error
+	currentOnce sync.Once
+)
+
+// Current returns the configuration loaded by Load the first time it is called. The configuration is always
+// returned, using the defaults for anything that could not be loaded, so that callers can report the error later.
+func Current() (*Config, error) {
+	currentOnce.Do(func() {
+		current, currentErr = Load()
+	})
+	return current, currentErr
+}
+
+// Get returns the current configuration ignoring any error, which is reported when the suite starts
+func Get() *Config {
+	c, _ := Current()
+	return c
+}
+
+// Load loads the configuration from the file in $BDD_CONFIG or the bdd.yaml file found in the current directory or
+// one of its parents, if any, then applies the environment variables and validates the result
+func Load() (*Config, error) {
+	path := os.Getenv(EnvConfigFile)
+	if path == "" {
+		var err error
+		path, err = findFile(DefaultFileName)
+		if err != nil {
+			return Default(), err
+		}
+	}
+	return LoadFile(path, os.LookupEnv)
+}
+
+// LoadFile loads the configuration from the given file, which is optional if empty, then applies the environment
+// variables found with lookupEnv and validates the result
+func LoadFile(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		err = yaml.UnmarshalStrict(data, c)
+		if err != nil {
+			return Default(), fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		c.file = path
+	}
+	err := c.applyEnv(lookupEnv)
+	if err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+// Validate returns an error if any settings are invalid
+func (c *Config) Validate() error {
+	if !utils.Contains(parsers.OutputFormats, strings.ToLower(c.JxOutputFormat)) {
+		return utils.InvalidOption(c.optionName("JxOutputFormat"), c.JxOutputFormat, parsers.OutputFormats)
+	}
+	if c.Git.ProviderURL != "" {
+		u, err := url.Parse(c.Git.ProviderURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return utils.InvalidOptionf(c.optionName("Git.ProviderURL"), c.Git.ProviderURL, "should be an absolute URL such as https://github.com")
+		}
+	}
+	// without a provider URL the kind is guessed once the URL is found with jx get gitserver
+	if c.Git.Kind != "" || c.Git.ProviderURL != "" {
+		kind, err := gits.ResolveKind(c.Git.Kind, c.Git.ProviderURL)
+		if err != nil {
+			return utils.InvalidOption(c.optionName("Git.Kind"), c.Git.Kind, gits.Kinds)
+		}
+		c.Git.Kind = kind
+	}
+	for _, f := range c.ReportFormats {
+		if !utils.Contains(ReportFormats, f) {
+			return utils.InvalidOption(c.optionName("ReportFormats"), f, ReportFormats)
+		}
+	}
+	if c.Metrics.PushURL != "" {
+		u, err := url.Parse(c.Metrics.PushURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return utils.InvalidOptionf(c.optionName("Metrics.PushURL"), c.Metrics.PushURL, "should be an absolute URL such as http://pushgateway:9091")
+		}
+		if c.Metrics.Job == "" {
+			return utils.InvalidOptionf(c.optionName("Metrics.Job"), c.Metrics.Job, "should be set when pushing metrics")
+		}
+	}
+	if c.Probe.BasicAuth && c.Probe.Password == "" {
+		return utils.InvalidOptionf(c.optionName("Probe.Password"), c.Probe.Password, "should be set when using basic auth")
+	}
+	if c.Tests.MergePullRequest && (c.Git.ApproverUsername == "" || c.Git.ApproverToken == "") {
+		return utils.InvalidOptionf(c.optionName("Git.ApproverUsername"), c.Git.ApproverUsername, "should be set along with the approver token to approve pull requests")
+	}
+	if c.Tests.MaxPodRestarts < 0 {
+		return utils.InvalidOptionf(c.optionName("Tests.MaxPodRestarts"), c.Tests.MaxPodRestarts, "should not be negative")
+	}
+	if c.Flakes.Retries < 0 {
+		return utils.InvalidOptionf(c.optionName("Flakes.Retries"), c.Flakes.Retries, "should not be negative")
+	}
+	if c.SlowSpecThreshold <= 0 {
+		return utils.InvalidOptionf(c.optionName("SlowSpecThreshold"), c.SlowSpecThreshold, "should be a positive number of seconds")
+	}
+	if c.Transcript.Record != "" && c.Transcript.Record == c.Transcript.Replay {
+		return utils.InvalidOptionf(c.optionName("Transcript.Record"), c.Transcript.Record, "should not be the transcript which is replayed")
+	}
+	for _, s := range c.Settings() {
+		if d, ok := s.value.Interface().(Duration); ok && d <= 0 {
+			return utils.InvalidOptionf(s.option(), d, "should be a positive duration such as 45m")
+		}
+	}
+	return nil
+}
+
+// File returns the config file that was loaded, if any
+func (c *Config) File() string {
+	return c.file
+}
+
+// optionName returns the name of the setting with the given field path to use in errors
+func (c *Config) optionName(fieldPath string) string {
+	for _, s := range c.Settings() {
+		if s.fieldPath == fieldPath {
+			return s.option()
+		}
+	}
+	return fieldPath
+}
+
+// findFile looks for the file in the current directory and its parents returning an empty string if it is not found
+func findFile(name string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the current directory: %w", err)
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,147 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "bdd.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	c, err := config.LoadFile("", lookupEnv(nil))
+	require.NoError(t, err)
+
+	assert.Equal(t, "json", c.JxOutputFormat)
+	assert.Empty(t, c.Git.Kind, "the kind is guessed from the git provider URL")
+	assert.Empty(t, c.Git.ProviderURL, "the git provider URL defaults to jx get gitserver")
+	assert.True(t, c.Tests.DeleteApplications)
+	assert.True(t, c.Tests.DeleteRepos)
+	assert.True(t, c.CleanWorkDir)
+	assert.Equal(t, 40*time.Minute, c.Timeouts.BuildCompletes.Duration())
+	for _, s := range c.Settings() {
+		assert.Equal(t, config.SourceDefault, s.Source, "setting %s", s.Name)
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	path := writeFile(t, `jxOutputFormat: yaml
+git:
+  organisation: cb-kubecd
+  kind: gitlab
+tests:
+  deleteRepos: false
+timeouts:
+  buildCompletes: 20
+  urlReturns: 10
+`)
+	env := map[string]string{
+		"BDD_TIMEOUT_BUILD_COMPLETES": "30",
+		"JX_DISABLE_DELETE_APP":       "true",
+		"GITHUB_TOKEN":                "secret-token",
+		"JX_BDD_INCLUDE_APPS":         "jx-app-jacoco:0.0.100, jx-app-sonar",
+		"BDD_SPEC_RETRIES":            "2",
+		"JX_APP_UI_TEST_BASIC_AUTH":   "true",
+		"JENKINS_PASSWORD":            "admin-password",
+		"BDD_URL_REQUEST_TIMEOUT":     "10s",
+	}
+	c, err := config.LoadFile(path, lookupEnv(env))
+	require.NoError(t, err)
+
+	assert.Equal(t, path, c.File())
+	assert.Equal(t, "yaml", c.JxOutputFormat)
+	assert.Equal(t, "cb-kubecd", c.Git.Organisation)
+	assert.Equal(t, "gitlab", c.Git.Kind)
+	assert.Equal(t, "secret-token", c.Git.Token)
+	assert.False(t, c.Tests.DeleteRepos)
+	assert.False(t, c.Tests.DeleteApplications, "JX_DISABLE_DELETE_APP=true should disable deleting applications")
+	assert.Equal(t, []string{"jx-app-jacoco:0.0.100", "jx-app-sonar"}, c.Tests.IncludeApps)
+	assert.Equal(t, 30*time.Minute, c.Timeouts.BuildCompletes.Duration())
+	assert.Equal(t, 10*time.Minute, c.Timeouts.URLReturns.Duration())
+	assert.Equal(t, 2, c.Flakes.Retries)
+	assert.True(t, c.Probe.BasicAuth)
+	assert.Equal(t, "admin", c.Probe.Username)
+	assert.Equal(t, "admin-password", c.Probe.Password)
+	assert.Equal(t, 10*time.Second, c.Probe.RequestTimeout.Duration())
+
+	sources := map[string]string{}
+	for _, s := range c.Settings() {
+		sources[s.Name] = s.Source
+	}
+	assert.Equal(t, "bdd.yaml", sources["git.organisation"])
+	assert.Equal(t, "$BDD_TIMEOUT_BUILD_COMPLETES=30", sources["timeouts.buildCompletes"])
+	assert.Equal(t, "$GITHUB_TOKEN", sources["git.token"], "secrets should not be shown")
+	assert.Equal(t, config.SourceDefault, sources["timeouts.cmdLine"])
+}
+
+func TestGitKindGuessedFromProviderURL(t *testing.T) {
+	c, err := config.LoadFile("", lookupEnv(map[string]string{"GIT_PROVIDER_URL": "https://gitlab.example.com"}))
+	require.NoError(t, err)
+	assert.Equal(t, "gitlab", c.Git.Kind)
+
+	c, err = config.LoadFile("", lookupEnv(map[string]string{"GIT_PROVIDER_URL": "https://bitbucket.example.com", "GIT_KIND": "GitHub"}))
+	require.NoError(t, err)
+	assert.Equal(t, "github", c.Git.Kind, "an explicit kind wins over the guess")
+}
+
+func TestWriteTableMasksSecrets(t *testing.T) {
+	c, err := config.LoadFile("", lookupEnv(map[string]string{
+		"GIT_TOKEN":              "secret-token",
+		"JX_DISABLE_DELETE_REPO": "true",
+	}))
+	require.NoError(t, err)
+
+	table := &strings.Builder{}
+	require.NoError(t, c.WriteTable(table))
+	assert.NotContains(t, table.String(), "secret-token")
+	assert.Regexp(t, `tests.deleteRepos\s+false\s+\$JX_DISABLE_DELETE_REPO=true`, table.String())
+	assert.Regexp(t, `tests.deleteApplications\s+true\s+default`, table.String())
+}
+
+func TestInvalidValues(t *testing.T) {
+	testCases := []struct {
+		env      map[string]string
+		file     string
+		expected string
+	}{
+		{env: map[string]string{"BDD_JX_OUTPUT_FORMAT": "jsn"}, expected: "BDD_JX_OUTPUT_FORMAT"},
+		{env: map[string]string{"GIT_KIND": "githbu"}, expected: "GIT_KIND"},
+		{env: map[string]string{"JX_DISABLE_DELETE_APP": "maybe"}, expected: "JX_DISABLE_DELETE_APP"},
+		{env: map[string]string{"BDD_TIMEOUT_URL_RETURNS": "ten"}, expected: "BDD_TIMEOUT_URL_RETURNS"},
+		{env: map[string]string{"BDD_TIMEOUT_URL_RETURNS": "0"}, expected: "BDD_TIMEOUT_URL_RETURNS"},
+		{env: map[string]string{"GIT_PROVIDER_URL": "github.com"}, expected: "GIT_PROVIDER_URL"},
+		{env: map[string]string{"BDD_REPORT_FORMATS": "json,xml"}, expected: "BDD_REPORT_FORMATS"},
+		{env: map[string]string{"BDD_SPEC_RETRIES": "two"}, expected: "BDD_SPEC_RETRIES"},
+		{env: map[string]string{"BDD_SPEC_RETRIES": "-1"}, expected: "BDD_SPEC_RETRIES"},
+		{env: map[string]string{"JX_APP_UI_TEST_BASIC_AUTH": "true"}, expected: "BDD_URL_PASSWORD"},
+		{env: map[string]string{"BDD_MAX_POD_RESTARTS": "-1"}, expected: "BDD_MAX_POD_RESTARTS"},
+		{env: map[string]string{"BDD_ENABLE_TEST_MERGE_PULL_REQUEST": "true", "BDD_APPROVER_USERNAME": "bdd-approver"}, expected: "BDD_APPROVER_USERNAME"},
+		{file: "timeouts:\n  buildComplete: 10\n", expected: "buildComplete"},
+	}
+	for _, tc := range testCases {
+		path := ""
+		if tc.file != "" {
+			path = writeFile(t, tc.file)
+		}
+		_, err := config.LoadFile(path, lookupEnv(tc.env))
+		require.Error(t, err, "env %v file %s", tc.env, tc.file)
+		assert.Contains(t, err.Error(), tc.expected)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+)
+
+// durationUnits the units supported by time.ParseDuration in the order they are suggested, as timeouts are rarely
+// less than a second
+var durationUnits = []string{"h", "m", "s", "ms", "us", "ns"}
+
+// durationUnitAliases maps commonly used unit names to the Go duration unit
+var durationUnitAliases = map[string]string{
+	"sec":     "s",
+	"secs":    "s",
+	"second":  "s",
+	"seconds": "s",
+	"min":     "m",
+	"mins":    "m",
+	"minute":  "m",
+	"minutes": "m",
+	"hr":      "h",
+	"hrs":     "h",
+	"hour":    "h",
+	"hours":   "h",
+}
+
+var durationPartRegex = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([a-zA-Zµ]+)\s*$`)
+
+// Duration is a timeout which can be written either as a Go duration such as 45m or 1h30m, or as a whole number of
+// minutes
+type Duration time.Duration
+
+// Minutes returns a Duration of the given number of minutes
+func Minutes(n int) Duration {
+	return Duration(time.Duration(n) * time.Minute)
+}
+
+// Duration returns the timeout as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the timeout as a Go duration string
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON writes the timeout as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads the timeout from either a Go duration string or a number of minutes
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		text = s
+	}
+	value, err := ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// ParseDuration parses either a Go duration string such as 45m or 1h30m, or a whole number of minutes. The returned
+// error suggests the Go duration unit if a common unit name such as mins or hours was used.
+func ParseDuration(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, fmt.Errorf("no duration specified")
+	}
+	if minutes, err := strconv.Atoi(text); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err == nil {
+		return d, nil
+	}
+	if suggestion := suggestDuration(text); suggestion != "" {
+		return 0, fmt.Errorf("invalid duration %s. Did you mean: %s", text, utils.ColorInfo(suggestion))
+	}
+	return 0, fmt.Errorf("invalid duration %s. Use a whole number of minutes or a duration such as 45m or 1h30m", text)
+}
+
+// suggestDuration returns a valid duration for values like 45 mins or returns an empty string if it cannot guess one
+func suggestDuration(text string) string {
+	parts := durationPartRegex.FindStringSubmatch(text)
+	if len(parts) != 3 {
+		return ""
+	}
+	unit := strings.ToLower(parts[2])
+	if alias, ok := durationUnitAliases[unit]; ok {
+		return parts[1] + alias
+	}
+	suggestions := utils.SuggestionsFor(unit, durationUnits, 1)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return parts[1] + suggestions[0]
+}
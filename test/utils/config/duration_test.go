@@ -0,0 +1,109 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected time.Duration
+	}{
+		{"60", 60 * time.Minute},
+		{" 5 ", 5 * time.Minute},
+		{"45m", 45 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"90s", 90 * time.Second},
+	}
+	for _, tc := range testCases {
+		d, err := config.ParseDuration(tc.text)
+		require.NoError(t, err, "parsing %q", tc.text)
+		assert.Equal(t, tc.expected, d, "parsing %q", tc.text)
+	}
+}
+
+func TestParseDurationSuggestions(t *testing.T) {
+	testCases := []struct {
+		text       string
+		suggestion string
+	}{
+		{"45mins", "45m"},
+		{"2 hours", "2h"},
+		{"30 sec", "30s"},
+		{"10mn", "10m"},
+	}
+	for _, tc := range testCases {
+		_, err := config.ParseDuration(tc.text)
+		require.Error(t, err, "parsing %q", tc.text)
+		assert.Contains(t, err.Error(), "Did you mean", "parsing %q", tc.text)
+		assert.Contains(t, err.Error(), tc.suggestion, "parsing %q", tc.text)
+	}
+
+	_, err := config.ParseDuration("10mn")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "10ms")
+
+	_, err = config.ParseDuration("forever")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "Did you mean")
+}
+
+func TestDurationSettings(t *testing.T) {
+	path := writeFile(t, `timeouts:
+  buildCompletes: 20
+  urlReturns: 1h30m
+`)
+	c, err := config.LoadFile(path, lookupEnv(map[string]string{
+		"BDD_TIMEOUT_CMD_LINE": "90s",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Minute, c.Timeouts.BuildCompletes.Duration())
+	assert.Equal(t, 90*time.Minute, c.Timeouts.URLReturns.Duration())
+	assert.Equal(t, 90*time.Second, c.Timeouts.CmdLine.Duration())
+
+	// the old behaviour treated a plain number in an environment variable as nanoseconds
+	c, err = config.LoadFile("", lookupEnv(map[string]string{
+		"BDD_TIMEOUT_BUILD_COMPLETES": "60",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, c.Timeouts.BuildCompletes.Duration())
+
+	_, err = config.LoadFile("", lookupEnv(map[string]string{
+		"BDD_TIMEOUT_BUILD_COMPLETES": "45mins",
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BDD_TIMEOUT_BUILD_COMPLETES")
+	assert.Contains(t, err.Error(), "45m")
+}
+
+func TestSetDefaultKeepsConfiguredSettings(t *testing.T) {
+	c, err := config.LoadFile("", lookupEnv(map[string]string{
+		"BDD_TIMEOUT_URL_RETURNS": "5m",
+	}))
+	require.NoError(t, err)
+
+	changed, err := c.SetDefault("timeouts.buildCompletes", config.Minutes(90), "suite create_spring")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 90*time.Minute, c.Timeouts.BuildCompletes.Duration())
+
+	changed, err = c.SetDefault("timeouts.urlReturns", config.Minutes(30), "suite create_spring")
+	require.NoError(t, err)
+	assert.False(t, changed, "settings from the environment should not be changed")
+	assert.Equal(t, 5*time.Minute, c.Timeouts.URLReturns.Duration())
+
+	table := &strings.Builder{}
+	require.NoError(t, c.WriteTable(table))
+	assert.Regexp(t, `timeouts.buildCompletes\s+1h30m0s\s+suite create_spring`, table.String())
+
+	_, err = c.SetDefault("timeouts.buildCompletes", "90m", "suite create_spring")
+	assert.Error(t, err)
+	_, err = c.SetDefault("timeouts.unknown", config.Minutes(1), "suite create_spring")
+	assert.Error(t, err)
+}
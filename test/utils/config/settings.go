@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+)
+
+const (
+	// SourceDefault is the source of settings which have their default value
+	SourceDefault = "default"
+
+	secretMask = "********"
+)
+
+// Setting is a single setting of the configuration
+type Setting struct {
+	// Name is the path of the setting in the config file, such as timeouts.buildCompletes
+	Name string
+	// Env are the environment variables which override the setting in order of precedence
+	Env []string
+	// Invert is true if the setting is the opposite of the environment variable
+	Invert bool
+	// Secret is true if the value should not be logged
+	Secret bool
+	// Source is where the value came from, the default, the config file or an environment variable
+	Source string
+
+	fieldPath string
+	value     reflect.Value
+}
+
+// Value returns the value of the setting formatted for display with any secrets masked
+func (s *Setting) Value() string {
+	if s.Secret {
+		if s.value.IsZero() {
+			return ""
+		}
+		return secretMask
+	}
+	switch v := s.value.Interface().(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case Duration:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// SecretValues returns the values of the secret settings which are set, so they can be masked in any output
+func (c *Config) SecretValues() []string {
+	var answer []string
+	for _, s := range c.Settings() {
+		if s.Secret && !s.value.IsZero() {
+			answer = append(answer, fmt.Sprintf("%v", s.value.Interface()))
+		}
+	}
+	return answer
+}
+
+// option returns the name of the setting to use in errors, which is the environment variable users are most likely
+// to have set
+func (s *Setting) option() string {
+	if len(s.Env) > 0 {
+		return s.Env[0]
+	}
+	return s.Name
+}
+
+// Settings returns all the settings of the configuration in the order they are declared
+func (c *Config) Settings() []*Setting {
+	var answer []*Setting
+	collectSettings(reflect.ValueOf(c).Elem(), "", "", &answer)
+	for _, s := range answer {
+		s.Source = SourceDefault
+		if source, ok := c.sources[s.Name]; ok {
+			s.Source = source
+		}
+	}
+	return answer
+}
+
+func collectSettings(v reflect.Value, prefix string, fieldPrefix string, answer *[]*Setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fieldPath := field.Name
+		if fieldPrefix != "" {
+			fieldPath = fieldPrefix + "." + field.Name
+		}
+		env := field.Tag.Get("env")
+		if env == "" && field.Type.Kind() == reflect.Struct {
+			collectSettings(v.Field(i), name, fieldPath, answer)
+			continue
+		}
+		options := strings.Split(field.Tag.Get("config"), ",")
+		*answer = append(*answer, &Setting{
+			Name:      name,
+			Env:       strings.Split(env, ","),
+			Invert:    utils.Contains(options, "invert"),
+			Secret:    utils.Contains(options, "secret"),
+			fieldPath: fieldPath,
+			value:     v.Field(i),
+		})
+	}
+}
+
+// applyEnv records which settings came from the config file and overrides the settings with any environment
+// variables which are set
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	c.sources = map[string]string{}
+	defaults := map[string]reflect.Value{}
+	for _, s := range Default().Settings() {
+		defaults[s.Name] = s.value
+	}
+	for _, s := range c.Settings() {
+		if c.file != "" && !reflect.DeepEqual(s.value.Interface(), defaults[s.Name].Interface()) {
+			c.sources[s.Name] = filepath.Base(c.file)
+		}
+		for _, env := range s.Env {
+			text, ok := lookupEnv(env)
+			if !ok || text == "" {
+				continue
+			}
+			err := s.set(env, text)
+			if err != nil {
+				return err
+			}
+			c.sources[s.Name] = fmt.Sprintf("$%s=%s", env, text)
+			if s.Secret {
+				c.sources[s.Name] = "$" + env
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// set sets the setting from the text of the environment variable
+func (s *Setting) set(env string, text string) error {
+	text = strings.TrimSpace(text)
+	if s.value.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := ParseDuration(text)
+		if err != nil {
+			return utils.InvalidOptionError(env, text, err)
+		}
+		s.value.SetInt(int64(d))
+		return nil
+	}
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(text)
+	case reflect.Bool:
+		b, err := parseBool(text)
+		if err != nil {
+			return utils.InvalidOption(env, text, []string{"true", "false"})
+		}
+		s.value.SetBool(b != s.Invert)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return utils.InvalidOptionf(env, text, "should be a whole number")
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return utils.InvalidOptionf(env, text, "should be a number")
+		}
+		s.value.SetFloat(f)
+	case reflect.Slice:
+		var values []string
+		for _, v := range strings.Split(text, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		s.value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s of setting %s", s.value.Type().String(), s.Name)
+	}
+	return nil
+}
+
+func parseBool(text string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "true", "1", "on", "yes":
+		return true, nil
+	case "false", "0", "off", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %s", text)
+}
+
+// SetSource records where a setting which was discovered when the suite started came from
+func (c *Config) SetSource(name string, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[name] = source
+}
+
+// WriteTable writes the effective configuration as a table showing where each setting came from
+func (c *Config) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range c.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Value(), s.Source)
+	}
+	return tw.Flush()
+}
+
+// SetDefault changes the value of a setting which still has its default value and records where the new value came
+// from. Settings which were configured in the config file or by an environment variable are left alone. True is
+// returned if the setting was changed.
+func (c *Config) SetDefault(name string, value interface{}, source string) (bool, error) {
+	for _, s := range c.Settings() {
+		if s.Name != name {
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if v.Type() != s.value.Type() {
+			return false, fmt.Errorf("cannot set setting %s of type %s to a %s", name, s.value.Type().String(), v.Type().String())
+		}
+		if s.Source != SourceDefault {
+			return false, nil
+		}
+		s.value.Set(v)
+		c.SetSource(name, source)
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown setting %s", name)
+}
@@ -0,0 +1,284 @@
+package coverage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+const (
+	// EnvCoverDir is the environment variable binaries built with -cover write their coverage data into
+	EnvCoverDir = "GOCOVERDIR"
+	// ProfileFile is the name of the merged coverage profile
+	ProfileFile = "coverage.out"
+	// HTMLFile is the name of the HTML coverage report
+	HTMLFile = "coverage.html"
+)
+
+// Collector gives each invocation of an instrumented binary its own coverage directory and merges them into a single
+// coverage profile and HTML report
+type Collector struct {
+	// Dir is the directory the coverage data and reports are written to
+	Dir string
+	// SourceDir is the directory of the module of the instrumented binary which is needed to render the HTML report
+	SourceDir string
+	// Go runs the go command in the given directory returning its combined output
+	Go func(dir string, args ...string) (string, error)
+	// Run is the directory in RawDir of the invocations of the current run, which are the only ones merged, see Reset
+	Run string
+}
+
+// Report the files written when merging the coverage data
+type Report struct {
+	// Invocations is the number of invocations which wrote coverage data
+	Invocations int
+	Profile     string
+	HTML        string
+}
+
+// NewCollector creates a collector writing into the given directory
+func NewCollector(dir string, sourceDir string) (*Collector, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the absolute path of %s: %w", dir, err)
+	}
+	return &Collector{
+		Dir:       dir,
+		SourceDir: sourceDir,
+		Go:        runGo,
+	}, nil
+}
+
+func runGo(dir string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// RawDir returns the directory containing the coverage directories of the invocations
+func (c *Collector) RawDir() string {
+	return filepath.Join(c.Dir, "raw")
+}
+
+// RunDir returns the directory containing the coverage directories of the invocations of the current run
+func (c *Collector) RunDir() string {
+	return filepath.Join(c.RawDir(), c.Run)
+}
+
+// Reset removes the coverage data of previous runs which used the same directory and starts a new run, returning its
+// name so that the collectors of the other ginkgo nodes can use the same run
+func (c *Collector) Reset() (string, error) {
+	entries, err := os.ReadDir(c.RawDir())
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read coverage dir %s: %w", c.RawDir(), err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(c.RawDir(), e.Name())
+		err = os.RemoveAll(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to remove the coverage data of a previous run %s: %w", path, err)
+		}
+	}
+	err = os.MkdirAll(c.RawDir(), 0750)
+	if err != nil {
+		return "", fmt.Errorf("failed to create coverage dir %s: %w", c.RawDir(), err)
+	}
+	dir, err := os.MkdirTemp(c.RawDir(), "run-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a coverage dir in %s: %w", c.RawDir(), err)
+	}
+	c.Run = filepath.Base(dir)
+	return c.Run, nil
+}
+
+// NewInvocationDir creates a coverage directory for a single invocation in the directory of the current run. The
+// directories are unique across processes so that parallel ginkgo nodes can share the same collector directory.
+func (c *Collector) NewInvocationDir() (string, error) {
+	err := os.MkdirAll(c.RunDir(), 0750)
+	if err != nil {
+		return "", fmt.Errorf("failed to create coverage dir %s: %w", c.RunDir(), err)
+	}
+	dir, err := os.MkdirTemp(c.RunDir(), "jx-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a coverage dir in %s: %w", c.RunDir(), err)
+	}
+	return dir, nil
+}
+
+// Merge merges the coverage data of all the invocations of the current run into a coverage profile and renders it as HTML. Invocations
+// of binaries which were not built with -cover leave their directories empty and are ignored. Nil is returned if
+// there is no coverage data.
+func (c *Collector) Merge() (*Report, error) {
+	dirs, err := c.invocationDirs()
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	merged := filepath.Join(c.Dir, "merged")
+	err = os.RemoveAll(merged)
+	if err == nil {
+		err = os.MkdirAll(merged, 0750)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coverage dir %s: %w", merged, err)
+	}
+	err = c.goTool(c.Dir, "covdata", "merge", "-i="+strings.Join(dirs, ","), "-o="+merged)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Invocations: len(dirs),
+		Profile:     filepath.Join(c.Dir, ProfileFile),
+		HTML:        filepath.Join(c.Dir, HTMLFile),
+	}
+	err = c.goTool(c.Dir, "covdata", "textfmt", "-i="+merged, "-o="+report.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sources of the packages are looked up from the module in the source dir
+	sourceDir := c.SourceDir
+	if sourceDir == "" {
+		sourceDir, err = os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = c.goTool(sourceDir, "cover", "-html="+report.Profile, "-o="+report.HTML)
+	if err != nil {
+		return report, fmt.Errorf("failed to render the HTML report from the sources in %s, set BDD_COVERAGE_SOURCE_DIR to a checkout of jx: %w", sourceDir, err)
+	}
+	return report, nil
+}
+
+func (c *Collector) goTool(dir string, args ...string) error {
+	args = append([]string{"tool"}, args...)
+	out, err := c.Go(dir, args...)
+	if err != nil {
+		return fmt.Errorf("failed to run go %s: %s: %w", strings.Join(args[:3], " "), strings.TrimSpace(out), err)
+	}
+	return nil
+}
+
+// invocationDirs returns the coverage directories of the invocations of the current run which wrote coverage data
+func (c *Collector) invocationDirs() ([]string, error) {
+	entries, err := os.ReadDir(c.RunDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage dir %s: %w", c.RunDir(), err)
+	}
+	var answer []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "jx-") {
+			continue
+		}
+		dir := filepath.Join(c.RunDir(), e.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read coverage dir %s: %w", dir, err)
+		}
+		if len(files) > 0 {
+			answer = append(answer, dir)
+		}
+	}
+	return answer, nil
+}
+
+var (
+	lock       sync.Mutex
+	configured bool
+	collector  *Collector
+)
+
+// Configure collects coverage with the given collector, or disables it if nil. It replaces the coverage
+// configuration which is otherwise used.
+func Configure(c *Collector) {
+	lock.Lock()
+	defer lock.Unlock()
+	configured = true
+	collector = c
+}
+
+// Current returns the collector, creating it from the configuration the first time. Nil is returned if coverage is
+// not being collected.
+func Current() (*Collector, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if !configured {
+		cfg := config.Get()
+		if cfg.Coverage.Enabled {
+			c, err := NewCollector(filepath.Join(cfg.ReportsDir, "coverage"), cfg.Coverage.SourceDir)
+			if err != nil {
+				return nil, err
+			}
+			collector = c
+		}
+		configured = true
+	}
+	return collector, nil
+}
+
+// Env returns the environment for an invocation of an instrumented binary, adding its own GOCOVERDIR to the given
+// environment or to the current environment if it is nil. The environment is returned unchanged if coverage is not
+// being collected.
+func Env(env []string) ([]string, error) {
+	c, err := Current()
+	if err != nil || c == nil {
+		return env, err
+	}
+	lock.Lock()
+	dir, err := c.NewInvocationDir()
+	lock.Unlock()
+	if err != nil {
+		return env, err
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env, EnvCoverDir+"="+dir), nil
+}
+
+// Reset removes the coverage data of previous runs and starts a new run with the current collector, if any, returning
+// the name of the run for SetRun
+func Reset() (string, error) {
+	c, err := Current()
+	if err != nil || c == nil {
+		return "", err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return c.Reset()
+}
+
+// SetRun makes the current collector, if any, use the run started by Reset in another process
+func SetRun(run string) error {
+	c, err := Current()
+	if err != nil || c == nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	c.Run = run
+	return nil
+}
+
+// Merge merges the coverage collected by the current collector, if any
+func Merge() (*Report, error) {
+	c, err := Current()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return c.Merge()
+}
@@ -0,0 +1,131 @@
+package coverage_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mainGo = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Println("hello", os.Args[1])
+		return
+	}
+	fmt.Println("hello")
+}
+`
+
+// buildInstrumented builds a small binary with -cover returning the module dir and the binary
+func buildInstrumented(t *testing.T) (string, string) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/hello\n\ngo 1.20\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(mainGo), 0600))
+	bin := filepath.Join(dir, "hello")
+	cmd := exec.Command("go", "build", "-cover", "-o", bin, ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "go build: %s", string(out))
+	return dir, bin
+}
+
+func TestMergeInvocations(t *testing.T) {
+	sourceDir, bin := buildInstrumented(t)
+	c, err := coverage.NewCollector(filepath.Join(t.TempDir(), "coverage"), sourceDir)
+	require.NoError(t, err)
+	coverage.Configure(c)
+	t.Cleanup(func() {
+		coverage.Configure(nil)
+	})
+
+	for _, args := range [][]string{{}, {"world"}, {}} {
+		env, err := coverage.Env(nil)
+		require.NoError(t, err)
+		cmd := exec.Command(bin, args...)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	// binaries without coverage leave their directory empty
+	_, err = c.NewInvocationDir()
+	require.NoError(t, err)
+
+	report, err := coverage.Merge()
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 3, report.Invocations)
+
+	data, err := os.ReadFile(report.Profile)
+	require.NoError(t, err)
+	profile := string(data)
+	assert.True(t, strings.HasPrefix(profile, "mode: "), profile)
+	assert.Contains(t, profile, "example.com/hello/main.go")
+	assert.NotContains(t, profile, " 0\n", "both branches of main should have been covered")
+	assert.FileExists(t, report.HTML)
+}
+
+func TestResetOnlyMergesTheCurrentRun(t *testing.T) {
+	sourceDir, bin := buildInstrumented(t)
+	dir := filepath.Join(t.TempDir(), "coverage")
+	run := func(c *coverage.Collector) {
+		invocationDir, err := c.NewInvocationDir()
+		require.NoError(t, err)
+		cmd := exec.Command(bin)
+		cmd.Env = append(os.Environ(), coverage.EnvCoverDir+"="+invocationDir)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	previous, err := coverage.NewCollector(dir, sourceDir)
+	require.NoError(t, err)
+	_, err = previous.Reset()
+	require.NoError(t, err)
+	run(previous)
+	run(previous)
+
+	c, err := coverage.NewCollector(dir, sourceDir)
+	require.NoError(t, err)
+	name, err := c.Reset()
+	require.NoError(t, err)
+	assert.NoDirExists(t, previous.RunDir(), "the coverage of the previous run should be removed")
+	other, err := coverage.NewCollector(dir, sourceDir)
+	require.NoError(t, err)
+	other.Run = name
+	run(c)
+	run(other)
+
+	report, err := c.Merge()
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 2, report.Invocations, "only the invocations of the current run should be merged")
+}
+
+func TestMergeWithoutCoverage(t *testing.T) {
+	c, err := coverage.NewCollector(t.TempDir(), "")
+	require.NoError(t, err)
+	report, err := c.Merge()
+	require.NoError(t, err)
+	assert.Nil(t, report)
+}
+
+func TestEnvWhenDisabled(t *testing.T) {
+	coverage.Configure(nil)
+	env, err := coverage.Env([]string{"A=B"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A=B"}, env)
+}
@@ -0,0 +1,210 @@
+package deployments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// appLabels are the labels the charts of the quickstarts put on the deployment of an application
+var appLabels = []string{"app", "app.kubernetes.io/name"}
+
+// Expectation is what the deployment of a released application should look like
+type Expectation struct {
+	// Version is the released version of the application which should be the tag of one of its images
+	Version string
+	// DesiredPods and RunningPods are the pods of the application reported by jx get applications, which are not
+	// checked if zero
+	DesiredPods int
+	RunningPods int
+	// MaxRestarts is how many times each container of the application may have restarted
+	MaxRestarts int32
+}
+
+// Find returns the deployment of the application in the namespace. It is looked up by the name of the application,
+// with and without the jx- prefix of older charts, then by the app labels.
+func Find(ctx context.Context, kubeClient kubernetes.Interface, ns string, app string) (*appsv1.Deployment, error) {
+	deployments := kubeClient.AppsV1().Deployments(ns)
+	for _, name := range []string{app, "jx-" + app} {
+		d, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return d, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get the deployment %s in namespace %s: %w", name, ns, err)
+		}
+	}
+	for _, label := range appLabels {
+		list, err := deployments.List(ctx, metav1.ListOptions{LabelSelector: label + "=" + app})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the deployments in namespace %s: %w", ns, err)
+		}
+		if len(list.Items) > 0 {
+			return &list.Items[0], nil
+		}
+	}
+	return nil, fmt.Errorf("no deployment of %s found in namespace %s", app, ns)
+}
+
+// RolloutStatus returns whether the deployment has rolled out its latest revision, like kubectl rollout status, and
+// a description of what it is waiting for if not. An error is returned if the rollout is stuck.
+func RolloutStatus(d *appsv1.Deployment) (bool, string, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, fmt.Sprintf("waiting for the deployment %s spec update to be observed", d.Name), nil
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return false, "", fmt.Errorf("deployment %s exceeded its progress deadline: %s", d.Name, c.Message)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return false, fmt.Sprintf("waiting for deployment %s rollout to finish: %d out of %d new replicas have been updated", d.Name, d.Status.UpdatedReplicas, replicas), nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("waiting for deployment %s rollout to finish: %d old replicas are pending termination", d.Name, d.Status.Replicas-d.Status.UpdatedReplicas), nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("waiting for deployment %s rollout to finish: %d of %d updated replicas are available", d.Name, d.Status.AvailableReplicas, d.Status.UpdatedReplicas), nil
+	}
+	return true, "", nil
+}
+
+// WaitForRollout streams the changes of the deployment until it has rolled out its latest revision, returning the
+// rolled out deployment. An error is returned if the rollout is stuck or does not finish within the timeout.
+func WaitForRollout(ctx context.Context, kubeClient kubernetes.Interface, ns string, name string, timeout time.Duration) (*appsv1.Deployment, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	deployments := kubeClient.AppsV1().Deployments(ns)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return deployments.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return deployments.Watch(ctx, options)
+		},
+	}
+
+	var store cache.Store
+	var latest *appsv1.Deployment
+	lastLogged := ""
+	rolledOut := func() (bool, error) {
+		o, exists, err := store.GetByKey(ns + "/" + name)
+		if err != nil || !exists {
+			return false, err
+		}
+		latest = o.(*appsv1.Deployment)
+		done, status, err := RolloutStatus(latest)
+		if status != "" && status != lastLogged {
+			lastLogged = status
+			utils.LogInfof("%s\n", status)
+		}
+		return done, err
+	}
+	precondition := func(s cache.Store) (bool, error) {
+		store = s
+		return rolledOut()
+	}
+	condition := func(watch.Event) (bool, error) {
+		return rolledOut()
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &appsv1.Deployment{}, precondition, condition)
+	if err != nil {
+		if latest == nil {
+			return nil, fmt.Errorf("deployment %s in namespace %s was not found within %s: %w", name, ns, timeout.String(), err)
+		}
+		if ctx.Err() != nil {
+			return latest, fmt.Errorf("deployment %s in namespace %s did not roll out within %s, %s: %w", name, ns, timeout.String(), lastLogged, err)
+		}
+		// the rollout is stuck
+		return latest, err
+	}
+	return latest, nil
+}
+
+// Verify checks the rolled out deployment and its pods against the expectation, returning all the mismatches
+func Verify(ctx context.Context, kubeClient kubernetes.Interface, d *appsv1.Deployment, e Expectation) error {
+	var errs []error
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	if e.DesiredPods > 0 && int(replicas) != e.DesiredPods {
+		errs = append(errs, fmt.Errorf("deployment %s has %d replicas but jx reported %d desired pods", d.Name, replicas, e.DesiredPods))
+	}
+	if int(d.Status.ReadyReplicas) < e.RunningPods {
+		errs = append(errs, fmt.Errorf("deployment %s has %d ready replicas but jx reported %d running pods", d.Name, d.Status.ReadyReplicas, e.RunningPods))
+	}
+	if e.Version != "" {
+		var images []string
+		found := false
+		for _, c := range d.Spec.Template.Spec.Containers {
+			images = append(images, c.Image)
+			if ImageTag(c.Image) == e.Version || ImageTag(c.Image) == "v"+e.Version {
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("no image of deployment %s has the tag %s of the release: %s", d.Name, e.Version, strings.Join(images, ", ")))
+		}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("invalid selector of deployment %s: %w", d.Name, err))...)
+	}
+	pods, err := kubeClient.CoreV1().Pods(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("failed to list the pods of deployment %s: %w", d.Name, err))...)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		errs = append(errs, verifyRestarts(pod, e.MaxRestarts)...)
+	}
+	return errors.Join(errs...)
+}
+
+func verifyRestarts(pod *corev1.Pod, maxRestarts int32) []error {
+	var errs []error
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.RestartCount <= maxRestarts {
+			continue
+		}
+		reason := ""
+		if t := s.LastTerminationState.Terminated; t != nil {
+			reason = fmt.Sprintf(", last terminated with %s exit code %d", t.Reason, t.ExitCode)
+		}
+		errs = append(errs, fmt.Errorf("container %s of pod %s restarted %d times%s", s.Name, pod.Name, s.RestartCount, reason))
+	}
+	return errs
+}
+
+// ImageTag returns the tag of the image or an empty string if it has none, such as when it is referenced by digest
+func ImageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
@@ -0,0 +1,184 @@
+package deployments_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/deployments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const ns = "jx-staging"
+
+func newDeployment(name string, image string, replicas int32) *appsv1.Deployment {
+	labels := map[string]string{"app": "bdd-spring"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: labels, Generation: 2},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "istio-proxy", Image: "docker.io/istio/proxyv2:1.20.1"},
+						{Name: "bdd-spring", Image: image},
+					},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			AvailableReplicas:  replicas,
+			ReadyReplicas:      replicas,
+		},
+	}
+}
+
+func newPod(name string, restarts int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{"app": "bdd-spring"}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:         "bdd-spring",
+					RestartCount: restarts,
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := context.TODO()
+	kubeClient := fake.NewSimpleClientset(newDeployment("jx-bdd-spring", "ghcr.io/cb-kubecd/bdd-spring:0.0.1", 1))
+
+	d, err := deployments.Find(ctx, kubeClient, ns, "bdd-spring")
+	require.NoError(t, err)
+	assert.Equal(t, "jx-bdd-spring", d.Name)
+
+	kubeClient = fake.NewSimpleClientset(newDeployment("bdd-spring-chart", "ghcr.io/cb-kubecd/bdd-spring:0.0.1", 1))
+	d, err = deployments.Find(ctx, kubeClient, ns, "bdd-spring")
+	require.NoError(t, err)
+	assert.Equal(t, "bdd-spring-chart", d.Name, "the deployment should be found by its app label")
+
+	_, err = deployments.Find(ctx, kubeClient, "jx-production", "bdd-spring")
+	require.Error(t, err)
+	assert.Equal(t, "no deployment of bdd-spring found in namespace jx-production", err.Error())
+}
+
+func TestRolloutStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		update   func(d *appsv1.Deployment)
+		done     bool
+		status   string
+		hasError bool
+	}{
+		{name: "rolled out", update: func(d *appsv1.Deployment) {}, done: true},
+		{
+			name:   "not observed",
+			update: func(d *appsv1.Deployment) { d.Generation = 3 },
+			status: "waiting for the deployment bdd-spring spec update to be observed",
+		},
+		{
+			name:   "updating",
+			update: func(d *appsv1.Deployment) { d.Status.UpdatedReplicas = 1 },
+			status: "waiting for deployment bdd-spring rollout to finish: 1 out of 2 new replicas have been updated",
+		},
+		{
+			name:   "terminating",
+			update: func(d *appsv1.Deployment) { d.Status.Replicas = 3 },
+			status: "waiting for deployment bdd-spring rollout to finish: 1 old replicas are pending termination",
+		},
+		{
+			name:   "unavailable",
+			update: func(d *appsv1.Deployment) { d.Status.AvailableReplicas = 0 },
+			status: "waiting for deployment bdd-spring rollout to finish: 0 of 2 updated replicas are available",
+		},
+		{
+			name: "stuck",
+			update: func(d *appsv1.Deployment) {
+				d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded", Message: "ReplicaSet bdd-spring-7d9 has timed out progressing."}}
+			},
+			hasError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newDeployment("bdd-spring", "ghcr.io/cb-kubecd/bdd-spring:0.0.1", 2)
+			tc.update(d)
+			done, status, err := deployments.RolloutStatus(d)
+			assert.Equal(t, tc.done, done)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.hasError, err != nil)
+		})
+	}
+}
+
+func TestWaitForRollout(t *testing.T) {
+	ctx := context.TODO()
+	d := newDeployment("bdd-spring", "ghcr.io/cb-kubecd/bdd-spring:0.0.2", 1)
+	d.Status.AvailableReplicas = 0
+	kubeClient := fake.NewSimpleClientset(d)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		available := d.DeepCopy()
+		available.Status.AvailableReplicas = 1
+		_, _ = kubeClient.AppsV1().Deployments(ns).UpdateStatus(ctx, available, metav1.UpdateOptions{})
+	}()
+
+	rolledOut, err := deployments.WaitForRollout(ctx, kubeClient, ns, "bdd-spring", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), rolledOut.Status.AvailableReplicas)
+
+	_, err = deployments.WaitForRollout(ctx, kubeClient, "jx-production", "bdd-spring", 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deployment bdd-spring in namespace jx-production was not found within 200ms")
+}
+
+func TestWaitForRolloutTimesOut(t *testing.T) {
+	d := newDeployment("bdd-spring", "ghcr.io/cb-kubecd/bdd-spring:0.0.2", 1)
+	d.Status.AvailableReplicas = 0
+	kubeClient := fake.NewSimpleClientset(d)
+
+	_, err := deployments.WaitForRollout(context.TODO(), kubeClient, ns, "bdd-spring", 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did not roll out within 200ms, waiting for deployment bdd-spring rollout to finish: 0 of 1 updated replicas are available")
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.TODO()
+	d := newDeployment("bdd-spring", "ghcr.io/cb-kubecd/bdd-spring:0.0.1", 1)
+	kubeClient := fake.NewSimpleClientset(d, newPod("bdd-spring-7d9-abcde", 0))
+
+	err := deployments.Verify(ctx, kubeClient, d, deployments.Expectation{Version: "0.0.1", DesiredPods: 1, RunningPods: 1})
+	require.NoError(t, err)
+
+	kubeClient = fake.NewSimpleClientset(d, newPod("bdd-spring-7d9-abcde", 3))
+	err = deployments.Verify(ctx, kubeClient, d, deployments.Expectation{Version: "0.0.2", DesiredPods: 2, RunningPods: 2, MaxRestarts: 1})
+	require.Error(t, err)
+	assert.Equal(t, `deployment bdd-spring has 1 replicas but jx reported 2 desired pods
+deployment bdd-spring has 1 ready replicas but jx reported 2 running pods
+no image of deployment bdd-spring has the tag 0.0.2 of the release: docker.io/istio/proxyv2:1.20.1, ghcr.io/cb-kubecd/bdd-spring:0.0.1
+container bdd-spring of pod bdd-spring-7d9-abcde restarted 3 times, last terminated with OOMKilled exit code 137`, err.Error())
+}
+
+func TestImageTag(t *testing.T) {
+	assert.Equal(t, "0.0.1", deployments.ImageTag("ghcr.io/cb-kubecd/bdd-spring:0.0.1"))
+	assert.Equal(t, "0.0.1", deployments.ImageTag("localhost:5000/bdd-spring:0.0.1@sha256:abc"))
+	assert.Equal(t, "", deployments.ImageTag("localhost:5000/bdd-spring"))
+	assert.Equal(t, "", deployments.ImageTag("bdd-spring@sha256:abc"))
+}
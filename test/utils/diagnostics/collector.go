@@ -0,0 +1,370 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// RepositoryLabel is the label lighthouse adds to the PipelineRuns of a repository
+	RepositoryLabel = "lighthouse.jenkins-x.io/refs.repo"
+	// PipelineRunLabel is the label tekton adds to the TaskRuns and pods of a PipelineRun
+	PipelineRunLabel = "tekton.dev/pipelineRun"
+)
+
+// TektonVersions the tekton API versions to look for PipelineRuns and TaskRuns in order of preference
+var TektonVersions = []string{"v1", "v1beta1"}
+
+// Collector writes the state of the cluster relevant to an application into a directory so that failed specs can be
+// diagnosed after the cluster has gone
+type Collector struct {
+	// Dir is the directory the files are written to
+	Dir string
+	// Application is the name of the application, which is also the name of its git repository
+	Application string
+	// Namespace is the dev namespace
+	Namespace string
+
+	KubeClient kubernetes.Interface
+	JXClient   versioned.Interface
+	// DynamicClient is used to find the tekton resources and the previews of the application. They are skipped if it is
+	// nil.
+	DynamicClient dynamic.Interface
+	// Jx runs a jx command returning its output. The output of jx commands is skipped if it is nil.
+	Jx func(args ...string) (string, error)
+}
+
+// SpecDir returns the directory of the bundle of a spec in the reports directory
+func SpecDir(reportsDir string, specText string) string {
+	return filepath.Join(reportsDir, specDirName(specText))
+}
+
+var nonAlphaNumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+func specDirName(specText string) string {
+	name := strings.Trim(nonAlphaNumeric.ReplaceAllString(strings.ToLower(specText), "-"), "-")
+	if len(name) > 100 {
+		name = strings.TrimRight(name[:100], "-")
+	}
+	if name == "" {
+		name = "spec"
+	}
+	return name
+}
+
+// Collect writes all the diagnostics it can find. A failure to collect one part of the bundle does not stop the
+// others from being collected and any failures are written to errors.txt as well as being returned.
+func (c *Collector) Collect(ctx context.Context) error {
+	err := os.MkdirAll(c.Dir, 0750)
+	if err != nil {
+		return fmt.Errorf("failed to create diagnostics dir %s: %w", c.Dir, err)
+	}
+	var errs []error
+	collectors := []func(context.Context) error{
+		c.collectPipelineActivities,
+		c.collectSourceRepositories,
+		c.collectTekton,
+		c.collectApplicationPods,
+		c.collectEvents,
+		c.collectApplications,
+	}
+	for _, collect := range collectors {
+		err := collect(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		_ = os.WriteFile(filepath.Join(c.Dir, "errors.txt"), []byte(err.Error()+"\n"), 0600)
+		return err
+	}
+	return nil
+}
+
+func (c *Collector) writeFile(name string, data []byte) error {
+	path := filepath.Join(c.Dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Collector) writeYAML(name string, value interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	return c.writeFile(name, data)
+}
+
+func (c *Collector) collectPipelineActivities(ctx context.Context) error {
+	list, err := c.JXClient.JenkinsV1().PipelineActivities(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list PipelineActivities in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []v1.PipelineActivity
+	for _, pa := range list.Items {
+		if pa.Spec.GitRepository == c.Application {
+			answer = append(answer, pa)
+		}
+	}
+	return c.writeYAML("pipelineactivities.yaml", answer)
+}
+
+func (c *Collector) collectSourceRepositories(ctx context.Context) error {
+	list, err := c.JXClient.JenkinsV1().SourceRepositories(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list SourceRepositories in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []v1.SourceRepository
+	for _, sr := range list.Items {
+		if sr.Spec.Repo == c.Application {
+			answer = append(answer, sr)
+		}
+	}
+	return c.writeYAML("sourcerepositories.yaml", answer)
+}
+
+// collectTekton writes the PipelineRuns and TaskRuns of the application along with the logs of their pods
+func (c *Collector) collectTekton(ctx context.Context) error {
+	if c.DynamicClient == nil {
+		return nil
+	}
+	pipelineRuns, err := c.listTekton(ctx, "pipelineruns", RepositoryLabel+"="+c.Application)
+	if err != nil {
+		return err
+	}
+	err = c.writeYAML("pipelineruns.yaml", pipelineRuns)
+	if err != nil {
+		return err
+	}
+	var taskRuns []unstructured.Unstructured
+	var errs []error
+	for _, pr := range pipelineRuns {
+		selector := PipelineRunLabel + "=" + pr.GetName()
+		list, err := c.listTekton(ctx, "taskruns", selector)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		taskRuns = append(taskRuns, list...)
+
+		err = c.collectPodLogs(ctx, c.Namespace, selector, nil)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = c.writeYAML("taskruns.yaml", taskRuns)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Collector) listTekton(ctx context.Context, resource string, selector string) ([]unstructured.Unstructured, error) {
+	var err error
+	for _, version := range TektonVersions {
+		gvr := schema.GroupVersionResource{Group: "tekton.dev", Version: version, Resource: resource}
+		var list *unstructured.UnstructuredList
+		list, err = c.DynamicClient.Resource(gvr).Namespace(c.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err == nil {
+			return list.Items, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to list tekton %s in namespace %s: %w", resource, c.Namespace, err)
+}
+
+// environmentNamespaces returns the namespaces of all the environments
+func (c *Collector) environmentNamespaces(ctx context.Context) ([]string, error) {
+	envs, err := c.JXClient.JenkinsV1().Environments(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Environments in namespace %s: %w", c.Namespace, err)
+	}
+	answer := []string{c.Namespace}
+	for _, env := range envs.Items {
+		ns := env.Spec.Namespace
+		if ns != "" && !utils.Contains(answer, ns) {
+			answer = append(answer, ns)
+		}
+	}
+	return answer, nil
+}
+
+// previewNamespaces returns the namespaces of the previews of the application, such as jx-<owner>-<application>-pr-1,
+// which only contain resources of the application
+func (c *Collector) previewNamespaces(ctx context.Context) ([]string, error) {
+	if c.DynamicClient == nil {
+		return nil, nil
+	}
+	list, err := c.DynamicClient.Resource(previews.GroupVersionResource).Namespace(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list Previews in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []string
+	for i := range list.Items {
+		p, err := previews.FromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(p.Repository, c.Application) && p.PreviewNamespace != "" && !utils.Contains(answer, p.PreviewNamespace) {
+			answer = append(answer, p.PreviewNamespace)
+		}
+	}
+	return answer, nil
+}
+
+// namespace is a namespace the application is deployed in
+type namespace struct {
+	Name string
+	// Preview is true for the namespace of a preview, all the resources of which belong to the application
+	Preview bool
+}
+
+// isApplicationResource returns true if the named resource in the namespace belongs to the application
+func (n namespace) isApplicationResource(c *Collector, name string) bool {
+	return n.Preview || c.isApplicationResource(name)
+}
+
+// applicationNamespaces returns the namespaces of all the environments and the previews of the application
+func (c *Collector) applicationNamespaces(ctx context.Context) ([]namespace, error) {
+	namespaces, err := c.environmentNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previewNamespaces, err := c.previewNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var answer []namespace
+	for _, ns := range namespaces {
+		answer = append(answer, namespace{Name: ns})
+	}
+	for _, ns := range previewNamespaces {
+		answer = append(answer, namespace{Name: ns, Preview: true})
+	}
+	return answer, nil
+}
+
+// collectApplicationPods writes the logs of the pods of the application in all the environments and its previews
+func (c *Collector) collectApplicationPods(ctx context.Context) error {
+	namespaces, err := c.applicationNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, ns := range namespaces {
+		err = c.collectPodLogs(ctx, ns.Name, "", func(pod *corev1.Pod) bool {
+			return ns.isApplicationResource(c, pod.Name)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Collector) isApplicationResource(name string) bool {
+	return strings.HasPrefix(name, c.Application) || strings.HasPrefix(name, "jx-"+c.Application)
+}
+
+func (c *Collector) collectPodLogs(ctx context.Context, ns string, selector string, filter func(pod *corev1.Pod) bool) error {
+	pods, err := c.KubeClient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in namespace %s: %w", ns, err)
+	}
+	var errs []error
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if filter != nil && !filter(pod) {
+			continue
+		}
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			data, err := c.KubeClient.CoreV1().Pods(ns).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container.Name}).DoRaw(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get the logs of container %s of pod %s in namespace %s: %w", container.Name, pod.Name, ns, err))
+				continue
+			}
+			err = c.writeFile(filepath.Join("pods", ns, pod.Name, container.Name+".log"), data)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		err = c.writeYAML(filepath.Join("pods", ns, pod.Name, "status.yaml"), pod.Status)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collectEvents writes the events of the resources of the application in all the environments and its previews in
+// time order
+func (c *Collector) collectEvents(ctx context.Context) error {
+	namespaces, err := c.applicationNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	var events []corev1.Event
+	for _, ns := range namespaces {
+		list, err := c.KubeClient.CoreV1().Events(ns.Name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list events in namespace %s: %w", ns.Name, err)
+		}
+		for _, e := range list.Items {
+			if ns.isApplicationResource(c, e.InvolvedObject.Name) {
+				events = append(events, e)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	buf := &strings.Builder{}
+	for _, e := range events {
+		fmt.Fprintf(buf, "%s\t%s\t%s\t%s/%s\t%s\t%s\n", e.LastTimestamp.UTC().Format("2006-01-02T15:04:05Z"), e.Namespace, e.Type, e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Reason, e.Message)
+	}
+	return c.writeFile("events.txt", []byte(buf.String()))
+}
+
+func (c *Collector) collectApplications(ctx context.Context) error {
+	if c.Jx == nil {
+		return nil
+	}
+	out, err := c.Jx("get", "applications")
+	if err != nil {
+		return fmt.Errorf("failed to run jx get applications: %w", err)
+	}
+	return c.writeFile("applications.txt", []byte(out))
+}
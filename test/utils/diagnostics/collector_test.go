@@ -0,0 +1,195 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/diagnostics"
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakejx"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const (
+	ns  = "jx"
+	app = "bdd-spring-1234"
+)
+
+func newDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, version := range diagnostics.TektonVersions {
+		listKinds[schema.GroupVersionResource{Group: "tekton.dev", Version: version, Resource: "pipelineruns"}] = "PipelineRunList"
+		listKinds[schema.GroupVersionResource{Group: "tekton.dev", Version: version, Resource: "taskruns"}] = "TaskRunList"
+	}
+	listKinds[previews.GroupVersionResource] = "PreviewList"
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+func newTektonResource(kind, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("tekton.dev/v1")
+	u.SetKind(kind)
+	u.SetNamespace(ns)
+	u.SetName(name)
+	u.SetLabels(labels)
+	u.Object["status"] = map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Succeeded", "status": "False", "reason": "Failed"}}}
+	return u
+}
+
+func newPreview(name, repository, previewNamespace string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"pullRequest": map[string]interface{}{"number": int64(1), "owner": "cb-kubecd", "repository": repository},
+			"resources":   map[string]interface{}{"namespace": previewNamespace},
+		},
+	}}
+	u.SetAPIVersion("preview.jenkins.io/v1alpha1")
+	u.SetKind("Preview")
+	u.SetNamespace(ns)
+	u.SetName(name)
+	return u
+}
+
+func TestCollect(t *testing.T) {
+	kubeClient, jxClient := fakejx.NewClients(
+		&v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{Name: "cb-kubecd-" + app + "-master-1", Namespace: ns},
+			Spec:       v1.PipelineActivitySpec{GitRepository: app, Status: v1.ActivityStatusTypeFailed},
+		},
+		&v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{Name: "cb-kubecd-other-master-1", Namespace: ns},
+			Spec:       v1.PipelineActivitySpec{GitRepository: "other"},
+		},
+		&v1.SourceRepository{
+			ObjectMeta: metav1.ObjectMeta{Name: "cb-kubecd-" + app, Namespace: ns},
+			Spec:       v1.SourceRepositorySpec{Org: "cb-kubecd", Repo: app},
+		},
+		&v1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "staging", Namespace: ns},
+			Spec:       v1.EnvironmentSpec{Namespace: "jx-staging", Kind: v1.EnvironmentKindTypePermanent},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: app + "-abc", Namespace: "jx-staging"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-abc", Namespace: "jx-staging"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "build-pod", Namespace: ns, Labels: map[string]string{diagnostics.PipelineRunLabel: "pr-1"}},
+			Spec:       corev1.PodSpec{InitContainers: []corev1.Container{{Name: "prepare"}}, Containers: []corev1.Container{{Name: "step-build"}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "preview-abc", Namespace: "jx-cb-kubecd-" + app + "-pr-1"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "preview-abc", Namespace: "jx-cb-kubecd-other-pr-1"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "e2", Namespace: "jx-cb-kubecd-" + app + "-pr-1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "preview-abc"},
+			Reason:         "Unhealthy",
+			Message:        "Readiness probe failed",
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "e1", Namespace: "jx-staging"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: app + "-abc"},
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+		},
+	)
+	dynamicClient := newDynamicClient(
+		newTektonResource("PipelineRun", "pr-1", map[string]string{diagnostics.RepositoryLabel: app}),
+		newTektonResource("PipelineRun", "pr-2", map[string]string{diagnostics.RepositoryLabel: "other"}),
+		newTektonResource("TaskRun", "pr-1-build", map[string]string{diagnostics.PipelineRunLabel: "pr-1"}),
+		newPreview(app+"-pr-1", app, "jx-cb-kubecd-"+app+"-pr-1"),
+		newPreview("other-pr-1", "other", "jx-cb-kubecd-other-pr-1"),
+	)
+
+	dir := filepath.Join(t.TempDir(), "spec")
+	c := &diagnostics.Collector{
+		Dir:           dir,
+		Application:   app,
+		Namespace:     ns,
+		KubeClient:    kubeClient,
+		JXClient:      jxClient,
+		DynamicClient: dynamicClient,
+		Jx: func(args ...string) (string, error) {
+			return "APPLICATION STAGING\n" + app + " 0.0.1\n", nil
+		},
+	}
+	err := c.Collect(context.TODO())
+	require.NoError(t, err)
+
+	assertFileContains := func(name string, expected ...string) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, "reading %s", name)
+		for _, e := range expected {
+			assert.Contains(t, string(data), e, "file %s", name)
+		}
+	}
+	assertFileContains("pipelineactivities.yaml", "cb-kubecd-"+app+"-master-1", "Failed")
+	assertFileContains("sourcerepositories.yaml", "cb-kubecd-"+app)
+	assertFileContains("pipelineruns.yaml", "pr-1", "reason: Failed")
+	assertFileContains("taskruns.yaml", "pr-1-build")
+	assertFileContains(filepath.Join("pods", "jx-staging", app+"-abc", "app.log"), "fake logs")
+	assertFileContains(filepath.Join("pods", ns, "build-pod", "prepare.log"), "fake logs")
+	assertFileContains(filepath.Join("pods", ns, "build-pod", "step-build.log"), "fake logs")
+	assertFileContains(filepath.Join("pods", "jx-cb-kubecd-"+app+"-pr-1", "preview-abc", "app.log"), "fake logs")
+	assertFileContains("events.txt", "BackOff", "Back-off restarting failed container", "Unhealthy", "Readiness probe failed")
+	assertFileContains("applications.txt", app)
+
+	data, err := os.ReadFile(filepath.Join(dir, "pipelineactivities.yaml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "cb-kubecd-other-master-1")
+	data, err = os.ReadFile(filepath.Join(dir, "pipelineruns.yaml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "pr-2")
+	assert.NoDirExists(t, filepath.Join(dir, "pods", "jx-staging", "other-abc"))
+	assert.NoDirExists(t, filepath.Join(dir, "pods", "jx-cb-kubecd-other-pr-1"))
+	assert.NoFileExists(t, filepath.Join(dir, "errors.txt"))
+}
+
+func TestCollectContinuesAfterFailures(t *testing.T) {
+	kubeClient, jxClient := fakejx.NewClients()
+	dir := t.TempDir()
+	c := &diagnostics.Collector{
+		Dir:         dir,
+		Application: app,
+		Namespace:   ns,
+		KubeClient:  kubeClient,
+		JXClient:    jxClient,
+		Jx: func(args ...string) (string, error) {
+			return "", errors.New("jx not found")
+		},
+	}
+	err := c.Collect(context.TODO())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jx not found")
+
+	assert.FileExists(t, filepath.Join(dir, "pipelineactivities.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "events.txt"))
+	data, err := os.ReadFile(filepath.Join(dir, "errors.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "jx not found")
+}
+
+func TestSpecDir(t *testing.T) {
+	assert.Equal(t, filepath.Join("reports", "create-spring-given-valid-parameters-creates-a-spring-application-and-promotes-it-to-staging"),
+		diagnostics.SpecDir("reports", "create spring\n Given valid parameters?? creates a spring application and promotes it to staging\n"))
+	assert.Equal(t, filepath.Join("reports", "spec"), diagnostics.SpecDir("reports", "!!"))
+}
@@ -0,0 +1,22 @@
+package fakejx
+
+import (
+	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	jxscheme "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/scheme"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+// NewClients creates fake kubernetes and jx clients populated with the given objects. Jenkins X resources such as
+// PipelineActivities are added to the jx client and everything else to the kubernetes client.
+func NewClients(objects ...runtime.Object) (*kubefake.Clientset, *jxfake.Clientset) {
+	var kubeObjects, jxObjects []runtime.Object
+	for _, o := range objects {
+		if _, _, err := jxscheme.Scheme.ObjectKinds(o); err == nil {
+			jxObjects = append(jxObjects, o)
+		} else {
+			kubeObjects = append(kubeObjects, o)
+		}
+	}
+	return kubefake.NewSimpleClientset(kubeObjects...), jxfake.NewSimpleClientset(jxObjects...)
+}
@@ -0,0 +1,252 @@
+package fakejx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// EnvScript is the environment variable containing the path of the script of expected commands. When it is set
+	// the test binary behaves as the fake jx binary, see RunIfFake
+	EnvScript = "BDD_FAKE_JX_SCRIPT"
+
+	// AnyArg matches any single argument of an expected command
+	AnyArg = "*"
+
+	invocationsFile = "invocations.jsonl"
+)
+
+// Command is an expected jx command along with the canned output and exit code to return
+type Command struct {
+	Args     []string `json:"args"`
+	Output   string   `json:"output,omitempty"`
+	ExitCode int      `json:"exitCode,omitempty"`
+	// Times is the number of times the command may be invoked, 0 means any number of times
+	Times int `json:"times,omitempty"`
+
+	fake *Fake
+}
+
+// Invocation is a recorded invocation of the fake jx binary
+type Invocation struct {
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	Command int      `json:"command"`
+}
+
+// Fake is a scripted fake jx binary. The test binary itself is used as the fake so tests must call RunIfFake from
+// TestMain. New selects the fake via BDD_JX for the duration of the test.
+type Fake struct {
+	Dir      string
+	Commands []*Command
+
+	lock sync.Mutex
+}
+
+// New creates a new fake jx binary and points BDD_JX at it for the duration of the test
+func New(t testing.TB) *Fake {
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find the test binary: %s", err)
+	}
+	f := &Fake{
+		Dir: t.TempDir(),
+	}
+	err = f.save()
+	if err != nil {
+		t.Fatalf("failed to save the fake jx script: %s", err)
+	}
+	t.Setenv("BDD_JX", bin)
+	t.Setenv(EnvScript, f.scriptFile())
+	return f
+}
+
+// Expect expects the jx command with the given arguments to be run. Use AnyArg to match any value of an argument.
+// By default the command succeeds without any output.
+func (f *Fake) Expect(args ...string) *Command {
+	f.lock.Lock()
+	c := &Command{
+		Args: args,
+		fake: f,
+	}
+	f.Commands = append(f.Commands, c)
+	f.lock.Unlock()
+	f.mustSave()
+	return c
+}
+
+// Returns sets the output of the command
+func (c *Command) Returns(output string) *Command {
+	c.Output = output
+	c.fake.mustSave()
+	return c
+}
+
+// Fails makes the command exit with the given exit code and output
+func (c *Command) Fails(exitCode int, output string) *Command {
+	c.ExitCode = exitCode
+	c.Output = output
+	c.fake.mustSave()
+	return c
+}
+
+// Once limits the command to be invoked a single time so that later expectations with the same arguments are used
+// for subsequent invocations
+func (c *Command) Once() *Command {
+	c.Times = 1
+	c.fake.mustSave()
+	return c
+}
+
+// Invocations returns the recorded invocations of the fake jx binary
+func (f *Fake) Invocations() ([]Invocation, error) {
+	return readInvocations(filepath.Join(f.Dir, invocationsFile))
+}
+
+// InvokedArgs returns the arguments of all the recorded invocations joined with spaces, which is handy for assertions
+func (f *Fake) InvokedArgs() []string {
+	invocations, err := f.Invocations()
+	if err != nil {
+		return nil
+	}
+	answer := make([]string, 0, len(invocations))
+	for _, i := range invocations {
+		answer = append(answer, strings.Join(i.Args, " "))
+	}
+	return answer
+}
+
+func (f *Fake) scriptFile() string {
+	return filepath.Join(f.Dir, "script.json")
+}
+
+func (f *Fake) mustSave() {
+	err := f.save()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (f *Fake) save() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	data, err := json.MarshalIndent(f.Commands, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the fake jx commands: %w", err)
+	}
+	return os.WriteFile(f.scriptFile(), data, 0600)
+}
+
+// RunIfFake runs the fake jx binary and exits if the process was started as the fake, otherwise it does nothing.
+// It should be the first thing called in TestMain.
+func RunIfFake() {
+	script := os.Getenv(EnvScript)
+	if script == "" {
+		return
+	}
+	os.Exit(run(script, os.Args[1:]))
+}
+
+func run(script string, args []string) int {
+	data, err := os.ReadFile(script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake jx: failed to read script %s: %s\n", script, err)
+		return 1
+	}
+	var commands []*Command
+	err = json.Unmarshal(data, &commands)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake jx: failed to parse script %s: %s\n", script, err)
+		return 1
+	}
+	invocationsPath := filepath.Join(filepath.Dir(script), invocationsFile)
+	invocations, err := readInvocations(invocationsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake jx: %s\n", err)
+		return 1
+	}
+	counts := map[int]int{}
+	for _, i := range invocations {
+		counts[i.Command]++
+	}
+
+	index := -1
+	for i, c := range commands {
+		if matches(c.Args, args) && (c.Times == 0 || counts[i] < c.Times) {
+			index = i
+			break
+		}
+	}
+	dir, _ := os.Getwd()
+	err = recordInvocation(invocationsPath, Invocation{Args: args, Dir: dir, Command: index})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake jx: %s\n", err)
+		return 1
+	}
+	if index < 0 {
+		fmt.Fprintf(os.Stderr, "fake jx: unexpected command: jx %s\n", strings.Join(args, " "))
+		return 1
+	}
+	c := commands[index]
+	fmt.Fprint(os.Stdout, c.Output)
+	return c.ExitCode
+}
+
+func matches(expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != AnyArg && expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func readInvocations(path string) ([]Invocation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var answer []Invocation
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var i Invocation
+		err = json.Unmarshal(scanner.Bytes(), &i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse invocation in %s: %w", path, err)
+		}
+		answer = append(answer, i)
+	}
+	return answer, scanner.Err()
+}
+
+func recordInvocation(path string, invocation Invocation) error {
+	data, err := json.Marshal(invocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invocation: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to record invocation in %s: %w", path, err)
+	}
+	return nil
+}
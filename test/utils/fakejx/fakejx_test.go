@@ -0,0 +1,72 @@
+package fakejx_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakejx"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMain(m *testing.M) {
+	fakejx.RunIfFake()
+	os.Exit(m.Run())
+}
+
+func runJx(args ...string) (string, int) {
+	out, err := exec.Command(os.Getenv("BDD_JX"), args...).CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	}
+	return string(out), 0
+}
+
+func TestFakeReturnsCannedOutput(t *testing.T) {
+	f := fakejx.New(t)
+	f.Expect("get", "applications", "-e", fakejx.AnyArg).Returns(`[{"name": "bdd-spring"}]`)
+	f.Expect("get", "previews").Fails(2, "boom")
+
+	out, exitCode := runJx("get", "applications", "-e", "staging")
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, `[{"name": "bdd-spring"}]`, out)
+
+	out, exitCode = runJx("get", "previews")
+	assert.Equal(t, 2, exitCode)
+	assert.Equal(t, "boom", out)
+
+	_, exitCode = runJx("get", "activities")
+	assert.Equal(t, 1, exitCode, "unexpected commands should fail")
+
+	assert.Equal(t, []string{"get applications -e staging", "get previews", "get activities"}, f.InvokedArgs())
+}
+
+func TestFakeOnce(t *testing.T) {
+	f := fakejx.New(t)
+	f.Expect("get", "previews").Returns("first").Once()
+	f.Expect("get", "previews").Returns("second")
+
+	out, _ := runJx("get", "previews")
+	assert.Equal(t, "first", out)
+	out, _ = runJx("get", "previews")
+	assert.Equal(t, "second", out)
+	out, _ = runJx("get", "previews")
+	assert.Equal(t, "second", out)
+}
+
+func TestNewClients(t *testing.T) {
+	kubeClient, jxClient := fakejx.NewClients(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "jx-boot", Namespace: "jx-git-operator"}},
+		&v1.PipelineActivity{ObjectMeta: metav1.ObjectMeta{Name: "cb-kubecd-bdd-pr-1-1", Namespace: "jx"}},
+	)
+
+	_, err := kubeClient.CoreV1().Secrets("jx-git-operator").Get(context.TODO(), "jx-boot", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = jxClient.JenkinsV1().PipelineActivities("jx").Get(context.TODO(), "cb-kubecd-bdd-pr-1-1", metav1.GetOptions{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,518 @@
+package fakescm
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// StateOpen is the state of an open issue or pull request
+	StateOpen = "open"
+	// StateClosed is the state of a closed or merged issue or pull request
+	StateClosed = "closed"
+
+	// APIPath is the path the GitHub REST API is served on, which go-scm appends to GitHub Enterprise server URLs
+	APIPath = "/api/v3"
+)
+
+// EventKind is the kind of change made through the API which the hooks of the server react to
+type EventKind string
+
+const (
+	// EventComment is a comment on an issue or pull request
+	EventComment EventKind = "comment"
+	// EventPullRequestOpened is a pull request being created
+	EventPullRequestOpened EventKind = "pull_request_opened"
+	// EventPullRequestEdited is a change of the title or body of a pull request
+	EventPullRequestEdited EventKind = "pull_request_edited"
+	// EventPullRequestClosed is a pull request being closed without merging
+	EventPullRequestClosed EventKind = "pull_request_closed"
+	// EventPullRequestMerged is a pull request being merged
+	EventPullRequestMerged EventKind = "pull_request_merged"
+)
+
+// Repository is a repository of the fake server
+type Repository struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+	// Collaborators are the users, other than the owner, who accepted an invitation to the repository
+	Collaborators []string
+}
+
+// FullName returns the owner/name of the repository
+func (r *Repository) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// Issue is an issue of the fake server. Pull requests are issues too so they share the numbers, comments and
+// labels of the issues of their repository.
+type Issue struct {
+	Number    int
+	Title     string
+	Body      string
+	Author    string
+	State     string
+	Labels    []string
+	Assignees []string
+	Created   time.Time
+	Updated   time.Time
+}
+
+// PullRequest is a pull request of the fake server
+type PullRequest struct {
+	Issue
+	// Head and Base are the source and target branches
+	Head string
+	Base string
+	// Sha is the commit at the head of the pull request
+	Sha       string
+	Merged    bool
+	MergeSha  string
+	Reviewers []string
+}
+
+// Comment is a comment on an issue or pull request
+type Comment struct {
+	ID      int
+	Author  string
+	Body    string
+	Created time.Time
+}
+
+// Status is a commit status
+type Status struct {
+	// Context is the name of the check such as pr-build
+	Context     string
+	State       string
+	TargetURL   string
+	Description string
+	Created     time.Time
+}
+
+// Invitation is a pending invitation of a user to become a collaborator of a repository
+type Invitation struct {
+	ID      int64
+	Owner   string
+	Repo    string
+	Invitee string
+	Inviter string
+}
+
+// Event is a change made through the API. It is passed to the hooks of the server after the change is made and
+// before the API call returns, so the hooks can react to it as a webhook handler such as lighthouse would.
+type Event struct {
+	Kind   EventKind
+	Owner  string
+	Repo   string
+	Number int
+	// Sender is the user who made the change
+	Sender string
+	// Comment is the comment of an EventComment
+	Comment *Comment
+}
+
+// Hook reacts to the changes made through the API of the server
+type Hook func(s *Server, e Event)
+
+// Server is an in-process fake GitHub server implementing the subset of the REST API the go-scm client of the BDD
+// tests uses: users, repositories, collaborators and invitations, pull requests, issues, comments, labels and
+// commit statuses. The state is kept in memory and can be set up and inspected by the tests.
+type Server struct {
+	// URL is the URL of the server which can be used as the git provider URL of a go-scm github client
+	URL string
+
+	server      *httptest.Server
+	lock        sync.Mutex
+	users       map[string]string
+	tokens      map[string]string
+	repos       map[string]*repository
+	invitations []*Invitation
+	hooks       []Hook
+	requests    []string
+	nextID      int
+	now         func() time.Time
+}
+
+type repository struct {
+	Repository
+	pulls    map[int]*PullRequest
+	issues   map[int]*Issue
+	comments map[int][]*Comment
+	statuses map[string][]*Status
+	next     int
+}
+
+// New starts a new fake server which is closed at the end of the test
+func New(t testing.TB) *Server {
+	s := &Server{
+		users:  map[string]string{},
+		tokens: map[string]string{},
+		repos:  map[string]*repository{},
+		now:    time.Now,
+	}
+	s.server = httptest.NewServer(s.handler())
+	s.URL = s.server.URL
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// AddUser adds a user who authenticates with the API token
+func (s *Server) AddUser(login string, token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.users[login] = token
+	s.tokens[token] = login
+}
+
+// AddRepository adds a repository with a master default branch if it does not exist yet
+func (s *Server) AddRepository(owner string, name string) *Repository {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.repos[owner+"/"+name]
+	if r == nil {
+		r = &repository{
+			Repository: Repository{Owner: owner, Name: name, DefaultBranch: "master"},
+			pulls:      map[int]*PullRequest{},
+			issues:     map[int]*Issue{},
+			comments:   map[int][]*Comment{},
+			statuses:   map[string][]*Status{},
+		}
+		s.repos[r.FullName()] = r
+	}
+	return copyRepository(&r.Repository)
+}
+
+// Repository returns a copy of the repository or nil if it does not exist
+func (s *Server) Repository(owner string, name string) *Repository {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.repos[owner+"/"+name]
+	if r == nil {
+		return nil
+	}
+	return copyRepository(&r.Repository)
+}
+
+// CreatePullRequest creates an open pull request in the repository, which is created if need be, from the given
+// one. The number is assigned by the server and the head sha and base branch are defaulted if they are not set.
+// The hooks are not called.
+func (s *Server) CreatePullRequest(owner string, repo string, pr PullRequest) *PullRequest {
+	s.AddRepository(owner, repo)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return copyPullRequest(s.createPullRequest(s.repos[owner+"/"+repo], pr))
+}
+
+// PullRequest returns a copy of the pull request or nil if it does not exist
+func (s *Server) PullRequest(owner string, repo string, number int) *PullRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pr := s.pullRequest(owner, repo, number)
+	if pr == nil {
+		return nil
+	}
+	return copyPullRequest(pr)
+}
+
+// UpdatePullRequest changes the pull request, such as to simulate lighthouse, and returns an error if it does not
+// exist. The hooks are not called.
+func (s *Server) UpdatePullRequest(owner string, repo string, number int, f func(pr *PullRequest)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pr := s.pullRequest(owner, repo, number)
+	if pr == nil {
+		return fmt.Errorf("no pull request %s/%s/%d", owner, repo, number)
+	}
+	f(pr)
+	pr.Updated = s.now()
+	return nil
+}
+
+// MergePullRequest merges the open pull request, giving it a merge sha, and returns an error if it does not exist or
+// is not open. The hooks are not called.
+func (s *Server) MergePullRequest(owner string, repo string, number int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.mergePullRequest(owner, repo, number)
+}
+
+// Issue returns a copy of the issue or the issue of the pull request with the number, or nil if it does not exist
+func (s *Server) Issue(owner string, repo string, number int) *Issue {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	issue := s.issue(owner, repo, number)
+	if issue == nil {
+		return nil
+	}
+	answer := *issue
+	answer.Labels = slices.Clone(issue.Labels)
+	answer.Assignees = slices.Clone(issue.Assignees)
+	return &answer
+}
+
+// UpdateIssue changes the issue or the issue of the pull request with the number and returns an error if it does
+// not exist. The hooks are not called.
+func (s *Server) UpdateIssue(owner string, repo string, number int, f func(issue *Issue)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	issue := s.issue(owner, repo, number)
+	if issue == nil {
+		return fmt.Errorf("no issue %s/%s/%d", owner, repo, number)
+	}
+	f(issue)
+	issue.Updated = s.now()
+	return nil
+}
+
+// AddLabel adds the label to the issue or pull request if it does not have it yet
+func (s *Server) AddLabel(owner string, repo string, number int, label string) error {
+	return s.UpdateIssue(owner, repo, number, func(issue *Issue) {
+		issue.Labels = addName(issue.Labels, label)
+	})
+}
+
+// RemoveLabel removes the label from the issue or pull request
+func (s *Server) RemoveLabel(owner string, repo string, number int, label string) error {
+	return s.UpdateIssue(owner, repo, number, func(issue *Issue) {
+		issue.Labels = removeName(issue.Labels, label)
+	})
+}
+
+// Labels returns the labels of the issue or pull request
+func (s *Server) Labels(owner string, repo string, number int) []string {
+	issue := s.Issue(owner, repo, number)
+	if issue == nil {
+		return nil
+	}
+	return issue.Labels
+}
+
+// AddComment comments on the issue or pull request as the user and returns the comment. The hooks are not called,
+// so this is how hooks reply to comments.
+func (s *Server) AddComment(owner string, repo string, number int, author string, body string) (*Comment, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, err := s.addComment(owner, repo, number, author, body)
+	if err != nil {
+		return nil, err
+	}
+	answer := *c
+	return &answer, nil
+}
+
+// Comments returns the comments on the issue or pull request, oldest first
+func (s *Server) Comments(owner string, repo string, number int) []Comment {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.repos[owner+"/"+repo]
+	if r == nil {
+		return nil
+	}
+	var answer []Comment
+	for _, c := range r.comments[number] {
+		answer = append(answer, *c)
+	}
+	return answer
+}
+
+// SetStatus sets the status of the context on the commit of the repository, which is created if need be
+func (s *Server) SetStatus(owner string, repo string, sha string, status Status) {
+	s.AddRepository(owner, repo)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.setStatus(s.repos[owner+"/"+repo], sha, status)
+}
+
+// Statuses returns the statuses of the commit of the repository, newest first as GitHub lists them
+func (s *Server) Statuses(owner string, repo string, sha string) []Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.repos[owner+"/"+repo]
+	if r == nil {
+		return nil
+	}
+	var answer []Status
+	for _, st := range r.statuses[sha] {
+		answer = append(answer, *st)
+	}
+	return answer
+}
+
+// Invitations returns the pending invitations to become a collaborator
+func (s *Server) Invitations() []Invitation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var answer []Invitation
+	for _, i := range s.invitations {
+		answer = append(answer, *i)
+	}
+	return answer
+}
+
+// AddHook adds a hook which is called after every change made through the API
+func (s *Server) AddHook(hook Hook) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Requests returns the method and path, without the API path, of every API request made to the server in order,
+// such as "PATCH repos/cb-kubecd/bdd-nh/pulls/1"
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// PullRequestURL returns the web URL of the pull request, as jx create pullrequest prints it
+func (s *Server) PullRequestURL(owner string, repo string, number int) string {
+	return fmt.Sprintf("%s/%s/%s/pull/%d", s.URL, owner, repo, number)
+}
+
+// IssueURL returns the web URL of the issue
+func (s *Server) IssueURL(owner string, repo string, number int) string {
+	return fmt.Sprintf("%s/%s/%s/issues/%d", s.URL, owner, repo, number)
+}
+
+func (s *Server) pullRequest(owner string, repo string, number int) *PullRequest {
+	r := s.repos[owner+"/"+repo]
+	if r == nil {
+		return nil
+	}
+	return r.pulls[number]
+}
+
+func (s *Server) issue(owner string, repo string, number int) *Issue {
+	r := s.repos[owner+"/"+repo]
+	if r == nil {
+		return nil
+	}
+	if pr := r.pulls[number]; pr != nil {
+		return &pr.Issue
+	}
+	return r.issues[number]
+}
+
+func (s *Server) createPullRequest(r *repository, pr PullRequest) *PullRequest {
+	r.next++
+	now := s.now()
+	pr.Number = r.next
+	pr.State = StateOpen
+	pr.Created, pr.Updated = now, now
+	pr.Labels = slices.Clone(pr.Labels)
+	pr.Assignees = slices.Clone(pr.Assignees)
+	pr.Reviewers = slices.Clone(pr.Reviewers)
+	if pr.Base == "" {
+		pr.Base = r.DefaultBranch
+	}
+	if pr.Head == "" {
+		pr.Head = fmt.Sprintf("pr-%d", pr.Number)
+	}
+	if pr.Sha == "" {
+		pr.Sha = fakeSha(r.FullName(), "pull", pr.Number)
+	}
+	r.pulls[pr.Number] = &pr
+	return &pr
+}
+
+func (s *Server) createIssue(r *repository, issue Issue) *Issue {
+	r.next++
+	now := s.now()
+	issue.Number = r.next
+	issue.State = StateOpen
+	issue.Created, issue.Updated = now, now
+	r.issues[issue.Number] = &issue
+	return &issue
+}
+
+func (s *Server) mergePullRequest(owner string, repo string, number int) error {
+	pr := s.pullRequest(owner, repo, number)
+	if pr == nil {
+		return fmt.Errorf("no pull request %s/%s/%d", owner, repo, number)
+	}
+	if pr.State != StateOpen {
+		return fmt.Errorf("pull request %s/%s/%d is %s", owner, repo, number, pr.State)
+	}
+	pr.State = StateClosed
+	pr.Merged = true
+	pr.MergeSha = fakeSha(owner+"/"+repo, "merge", number)
+	pr.Updated = s.now()
+	return nil
+}
+
+func (s *Server) addComment(owner string, repo string, number int, author string, body string) (*Comment, error) {
+	if s.issue(owner, repo, number) == nil {
+		return nil, fmt.Errorf("no issue or pull request %s/%s/%d", owner, repo, number)
+	}
+	r := s.repos[owner+"/"+repo]
+	s.nextID++
+	c := &Comment{ID: s.nextID, Author: author, Body: body, Created: s.now()}
+	r.comments[number] = append(r.comments[number], c)
+	return c, nil
+}
+
+func (s *Server) setStatus(r *repository, sha string, status Status) {
+	status.Created = s.now()
+	r.statuses[sha] = append([]*Status{&status}, r.statuses[sha]...)
+}
+
+// isCollaborator returns true if the user owns or is a collaborator of the repository
+func (r *repository) isCollaborator(user string) bool {
+	return strings.EqualFold(r.Owner, user) || slices.Contains(r.Collaborators, user)
+}
+
+// reposOf returns the repositories matching the filter sorted by name
+func (s *Server) reposOf(filter func(r *repository) bool) []*repository {
+	var answer []*repository
+	for _, r := range s.repos {
+		if filter(r) {
+			answer = append(answer, r)
+		}
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Name < answer[j].Name
+	})
+	return answer
+}
+
+func copyRepository(r *Repository) *Repository {
+	answer := *r
+	answer.Collaborators = slices.Clone(r.Collaborators)
+	return &answer
+}
+
+func copyPullRequest(pr *PullRequest) *PullRequest {
+	answer := *pr
+	answer.Labels = slices.Clone(pr.Labels)
+	answer.Assignees = slices.Clone(pr.Assignees)
+	answer.Reviewers = slices.Clone(pr.Reviewers)
+	return &answer
+}
+
+// fakeSha returns a stable commit sha for the pull request of the repository
+func fakeSha(fullName string, kind string, number int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s/%s/%d", fullName, kind, number))) // #nosec
+	return hex.EncodeToString(sum[:])
+}
+
+func addName(names []string, name string) []string {
+	if slices.Contains(names, name) {
+		return names
+	}
+	return append(names, name)
+}
+
+func removeName(names []string, name string) []string {
+	return slices.DeleteFunc(names, func(n string) bool {
+		return n == name
+	})
+}
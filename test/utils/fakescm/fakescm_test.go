@@ -0,0 +1,222 @@
+package fakescm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakescm"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	owner    = "cb-kubecd"
+	repo     = "bdd-nh"
+	bot      = "bdd-bot"
+	approver = "bdd-approver"
+)
+
+// newServer starts a fake server with the bot and approver users and returns it along with a provider for each
+func newServer(t *testing.T) (*fakescm.Server, gits.Provider, gits.Provider) {
+	s := fakescm.New(t)
+	s.AddUser(bot, "bot-token")
+	s.AddUser(approver, "approver-token")
+	s.AddUser(owner, "owner-token")
+	s.AddRepository(owner, repo)
+
+	provider, err := gits.NewProvider("", s.URL, "", "bot-token")
+	require.NoError(t, err)
+	approverProvider, err := gits.NewProvider("", s.URL, approver, "approver-token")
+	require.NoError(t, err)
+	return s, provider, approverProvider
+}
+
+func TestProviderPullRequests(t *testing.T) {
+	s, provider, _ := newServer(t)
+	assert.Equal(t, gits.KindGitHub, provider.Kind())
+	assert.Equal(t, bot, provider.CurrentUsername(), "the user should be found from the token")
+
+	created := s.CreatePullRequest(owner, repo, fakescm.PullRequest{Issue: fakescm.Issue{Title: "my change", Author: bot}})
+	s.CreatePullRequest(owner, repo, fakescm.PullRequest{Issue: fakescm.Issue{Title: "another change", Author: bot}})
+
+	pr, err := provider.GetPullRequest(owner, repo, created.Number)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pr.Number)
+	assert.Equal(t, "my change", pr.Title)
+	assert.Equal(t, created.Sha, pr.Sha)
+	assert.Equal(t, "master", pr.Target)
+	assert.Equal(t, s.PullRequestURL(owner, repo, 1), pr.Link)
+	assert.Equal(t, bot, pr.Author.Login)
+	assert.False(t, pr.Closed)
+
+	prs, err := provider.ListOpenPullRequests(owner, repo)
+	require.NoError(t, err)
+	require.Len(t, prs, 2)
+	assert.Equal(t, 2, prs[0].Number, "the newest pull request should be first")
+
+	err = provider.UpdatePullRequestTitle(pr, "WIP my change")
+	require.NoError(t, err)
+	assert.Equal(t, "WIP my change", s.PullRequest(owner, repo, 1).Title)
+
+	err = provider.ClosePullRequest(pr)
+	require.NoError(t, err)
+	pr, err = provider.GetPullRequest(owner, repo, 1)
+	require.NoError(t, err)
+	assert.True(t, pr.Closed)
+	assert.False(t, pr.Merged)
+
+	_, err = provider.GetPullRequest(owner, repo, 3)
+	assert.ErrorIs(t, err, scm.ErrNotFound)
+
+	assert.Equal(t, []string{
+		"GET user",
+		"GET repos/cb-kubecd/bdd-nh/pulls/1",
+		"GET repos/cb-kubecd/bdd-nh/pulls",
+		"PATCH repos/cb-kubecd/bdd-nh/pulls/1",
+		"PATCH repos/cb-kubecd/bdd-nh/pulls/1",
+		"GET repos/cb-kubecd/bdd-nh/pulls/1",
+		"GET repos/cb-kubecd/bdd-nh/pulls/3",
+	}, s.Requests())
+}
+
+func TestProviderCommentsLabelsAndStatuses(t *testing.T) {
+	s, provider, _ := newServer(t)
+	created := s.CreatePullRequest(owner, repo, fakescm.PullRequest{Issue: fakescm.Issue{Title: "my change", Author: bot}})
+	pr := &gits.PullRequest{PullRequest: &scm.PullRequest{Number: created.Number}, Owner: owner, Repo: repo}
+
+	err := provider.AddPRComment(pr, "looks good")
+	require.NoError(t, err)
+	comments, err := provider.ListPullRequestComments(pr)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "looks good", comments[0].Body)
+	assert.Equal(t, bot, comments[0].Author.Login)
+
+	ctx := context.TODO()
+	client := provider.Client()
+	_, err = client.PullRequests.AddLabel(ctx, owner+"/"+repo, created.Number, fakescm.LabelHold)
+	require.NoError(t, err)
+	_, err = client.PullRequests.AddLabel(ctx, owner+"/"+repo, created.Number, "kind/bug")
+	require.NoError(t, err)
+	assert.Equal(t, []string{fakescm.LabelHold, "kind/bug"}, s.Labels(owner, repo, created.Number))
+	_, err = client.PullRequests.DeleteLabel(ctx, owner+"/"+repo, created.Number, fakescm.LabelHold)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kind/bug"}, s.Labels(owner, repo, created.Number))
+
+	s.SetStatus(owner, repo, created.Sha, fakescm.Status{Context: "pr-build", State: "pending"})
+	_, _, err = client.Repositories.CreateStatus(ctx, owner+"/"+repo, created.Sha, &scm.StatusInput{Label: "pr-build", State: scm.StateSuccess, Target: "https://dashboard/1"})
+	require.NoError(t, err)
+	statuses, err := provider.ListCommitStatus(owner, repo, created.Sha)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, scm.StateSuccess, statuses[0].State, "the newest status should be first")
+	assert.Equal(t, "https://dashboard/1", statuses[0].Target)
+	assert.Equal(t, scm.StatePending, statuses[1].State)
+}
+
+func TestProviderCollaboratorsAndIssues(t *testing.T) {
+	s, provider, approverProvider := newServer(t)
+
+	err := provider.AddCollaborator(approver, owner, repo)
+	require.NoError(t, err)
+	invites, err := approverProvider.ListInvitations()
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+	assert.Equal(t, owner+"/"+repo, invites[0].Repo.FullName)
+	invites, err = provider.ListInvitations()
+	require.NoError(t, err)
+	assert.Empty(t, invites, "the invitation is for the approver")
+
+	err = approverProvider.AcceptInvitation(s.Invitations()[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, s.Invitations())
+	assert.Equal(t, []string{approver}, s.Repository(owner, repo).Collaborators)
+	err = provider.AddCollaborator(approver, owner, repo)
+	require.NoError(t, err)
+	assert.Empty(t, s.Invitations(), "the approver is already a collaborator")
+
+	issue, err := provider.CreateIssue(owner, repo, &scm.IssueInput{Title: "broken", Body: "it does not work"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, issue.Number)
+	err = provider.CreateIssueComment(owner, repo, issue.Number, "me too")
+	require.NoError(t, err)
+	assert.Equal(t, "me too", s.Comments(owner, repo, issue.Number)[0].Body)
+	err = s.UpdateIssue(owner, repo, issue.Number, func(issue *fakescm.Issue) {
+		issue.Assignees = append(issue.Assignees, bot)
+	})
+	require.NoError(t, err)
+	issue, err = provider.GetIssue(owner, repo, issue.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "broken", issue.Title)
+	require.Len(t, issue.Assignees, 1)
+	assert.Equal(t, bot, issue.Assignees[0].Login)
+
+	repos, err := provider.ListRepositories(owner)
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, repo, repos[0].Name)
+	err = provider.DeleteRepository(owner, repo)
+	require.NoError(t, err)
+	assert.Nil(t, s.Repository(owner, repo))
+}
+
+func TestProviderListRepositoriesOfUser(t *testing.T) {
+	s, provider, _ := newServer(t)
+	s.AddRepository(bot, "bdd-mine")
+	s.AddRepository("another-org", "bdd-theirs")
+	require.NoError(t, provider.AddCollaborator(bot, "another-org", "bdd-theirs"))
+	require.NoError(t, provider.AcceptInvitation(s.Invitations()[0].ID))
+
+	repos, err := provider.ListRepositories(bot)
+	require.NoError(t, err)
+	require.Len(t, repos, 1, "repositories the user only collaborates on should not be listed")
+	assert.Equal(t, "bdd-mine", repos[0].Name)
+	assert.Contains(t, s.Requests(), "GET user/repos")
+}
+
+func TestBadCredentials(t *testing.T) {
+	s := fakescm.New(t)
+	_, err := gits.NewProvider("", s.URL, "", "wrong-token")
+	assert.Error(t, err)
+}
+
+func TestLighthouse(t *testing.T) {
+	s, provider, approverProvider := newServer(t)
+	lighthouse := &fakescm.Lighthouse{Bot: owner, Merge: true}
+	s.AddHook(lighthouse.Hook())
+	created := s.CreatePullRequest(owner, repo, fakescm.PullRequest{Issue: fakescm.Issue{Title: "my change", Author: bot}})
+	pr := &gits.PullRequest{PullRequest: &scm.PullRequest{Number: created.Number, Title: created.Title}, Owner: owner, Repo: repo}
+
+	require.NoError(t, provider.AddPRComment(pr, "/lgtm"))
+	comments := s.Comments(owner, repo, pr.Number)
+	require.Len(t, comments, 2)
+	assert.Equal(t, owner, comments[1].Author)
+	assert.Contains(t, comments[1].Body, fakescm.CannotLGTMOwnPullRequest)
+
+	require.NoError(t, provider.AddPRComment(pr, "/hold"))
+	assert.Equal(t, []string{fakescm.LabelHold}, s.Labels(owner, repo, pr.Number))
+	require.NoError(t, provider.UpdatePullRequestTitle(pr, "WIP my change"))
+	assert.Equal(t, []string{fakescm.LabelHold, fakescm.LabelWorkInProgress}, s.Labels(owner, repo, pr.Number))
+	require.NoError(t, provider.UpdatePullRequestTitle(pr, "my change"))
+	require.NoError(t, provider.AddPRComment(pr, "/hold cancel"))
+	assert.Empty(t, s.Labels(owner, repo, pr.Number))
+
+	require.NoError(t, provider.AddPRComment(pr, "/cc @"+approver))
+	assert.Equal(t, []string{approver}, s.PullRequest(owner, repo, pr.Number).Reviewers)
+	require.NoError(t, provider.AddPRComment(pr, "/uncc "+approver))
+	assert.Empty(t, s.PullRequest(owner, repo, pr.Number).Reviewers)
+
+	require.NoError(t, approverProvider.AddPRComment(pr, "/approve"))
+	assert.Empty(t, s.Labels(owner, repo, pr.Number), "the approver is not a collaborator yet")
+	require.NoError(t, provider.AddCollaborator(approver, owner, repo))
+	require.NoError(t, approverProvider.AcceptInvitation(s.Invitations()[0].ID))
+	require.NoError(t, approverProvider.AddPRComment(pr, "/lh-approve"))
+
+	merged := s.PullRequest(owner, repo, pr.Number)
+	assert.Equal(t, []string{fakescm.LabelApproved}, merged.Labels)
+	assert.True(t, merged.Merged, "the approved pull request should be merged")
+	assert.Equal(t, fakescm.StateClosed, merged.State)
+	assert.NotEmpty(t, merged.MergeSha)
+}
@@ -0,0 +1,716 @@
+package fakescm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// call is an authenticated API request along with the events of the changes it made
+type call struct {
+	request *http.Request
+	user    string
+	events  []Event
+}
+
+// apiHandler handles an API request with the lock of the server held and returns the status code and the value to
+// return as JSON, if any
+type apiHandler func(c *call) (int, any)
+
+type errorJSON struct {
+	Message string `json:"message"`
+}
+
+type userJSON struct {
+	Login string `json:"login"`
+}
+
+type labelJSON struct {
+	Name string `json:"name"`
+}
+
+type permissionsJSON struct {
+	Admin bool `json:"admin"`
+	Push  bool `json:"push"`
+	Pull  bool `json:"pull"`
+}
+
+type repositoryJSON struct {
+	Owner         userJSON        `json:"owner"`
+	Name          string          `json:"name"`
+	FullName      string          `json:"full_name"`
+	HTMLURL       string          `json:"html_url"`
+	CloneURL      string          `json:"clone_url"`
+	DefaultBranch string          `json:"default_branch"`
+	Permissions   permissionsJSON `json:"permissions"`
+}
+
+type branchJSON struct {
+	Ref  string         `json:"ref"`
+	Sha  string         `json:"sha"`
+	Repo repositoryJSON `json:"repo"`
+}
+
+type pullRequestJSON struct {
+	Number             int         `json:"number"`
+	State              string      `json:"state"`
+	Title              string      `json:"title"`
+	Body               string      `json:"body"`
+	Labels             []labelJSON `json:"labels"`
+	HTMLURL            string      `json:"html_url"`
+	User               userJSON    `json:"user"`
+	RequestedReviewers []userJSON  `json:"requested_reviewers"`
+	Assignees          []userJSON  `json:"assignees"`
+	Head               branchJSON  `json:"head"`
+	Base               branchJSON  `json:"base"`
+	Merged             bool        `json:"merged"`
+	Mergeable          bool        `json:"mergeable"`
+	MergeSha           string      `json:"merge_commit_sha,omitempty"`
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+type issueLinkJSON struct {
+	HTMLURL string `json:"html_url"`
+}
+
+type issueJSON struct {
+	Number      int            `json:"number"`
+	HTMLURL     string         `json:"html_url"`
+	State       string         `json:"state"`
+	Title       string         `json:"title"`
+	Body        string         `json:"body"`
+	User        userJSON       `json:"user"`
+	Labels      []labelJSON    `json:"labels"`
+	Assignees   []userJSON     `json:"assignees"`
+	PullRequest *issueLinkJSON `json:"pull_request,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type commentJSON struct {
+	ID        int       `json:"id"`
+	HTMLURL   string    `json:"html_url"`
+	User      userJSON  `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type statusJSON struct {
+	State       string    `json:"state"`
+	TargetURL   string    `json:"target_url"`
+	Description string    `json:"description"`
+	Context     string    `json:"context"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type invitationJSON struct {
+	ID          int64          `json:"id"`
+	Repo        repositoryJSON `json:"repository"`
+	Invitee     userJSON       `json:"invitee"`
+	Inviter     userJSON       `json:"inviter"`
+	Permissions string         `json:"permissions"`
+}
+
+type pullRequestInput struct {
+	Title *string `json:"title"`
+	Body  *string `json:"body"`
+	Head  string  `json:"head"`
+	Base  string  `json:"base"`
+	State string  `json:"state"`
+}
+
+type issueInput struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type commentInput struct {
+	Body string `json:"body"`
+}
+
+type reviewersInput struct {
+	Reviewers []string `json:"reviewers"`
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	routes := map[string]apiHandler{
+		"GET user":                               s.getUser,
+		"GET user/repos":                         s.listUserRepositories,
+		"GET orgs/{owner}/repos":                 s.listOrganisationRepositories,
+		"GET user/repository_invitations":        s.listInvitations,
+		"PATCH user/repository_invitations/{id}": s.acceptInvitation,
+
+		"GET repos/{owner}/{repo}":                      s.getRepository,
+		"DELETE repos/{owner}/{repo}":                   s.deleteRepository,
+		"GET repos/{owner}/{repo}/collaborators/{user}": s.isCollaborator,
+		"PUT repos/{owner}/{repo}/collaborators/{user}": s.addCollaborator,
+		"GET repos/{owner}/{repo}/statuses/{sha}":       s.listStatuses,
+		"POST repos/{owner}/{repo}/statuses/{sha}":      s.createStatus,
+
+		"GET repos/{owner}/{repo}/pulls":                                 s.listPullRequests,
+		"POST repos/{owner}/{repo}/pulls":                                s.createPullRequestCall,
+		"GET repos/{owner}/{repo}/pulls/{number}":                        s.getPullRequest,
+		"PATCH repos/{owner}/{repo}/pulls/{number}":                      s.updatePullRequest,
+		"PUT repos/{owner}/{repo}/pulls/{number}/merge":                  s.mergePullRequestCall,
+		"POST repos/{owner}/{repo}/pulls/{number}/requested_reviewers":   s.requestReviewers,
+		"DELETE repos/{owner}/{repo}/pulls/{number}/requested_reviewers": s.unrequestReviewers,
+
+		"POST repos/{owner}/{repo}/issues":                             s.createIssueCall,
+		"GET repos/{owner}/{repo}/issues/{number}":                     s.getIssue,
+		"GET repos/{owner}/{repo}/issues/{number}/comments":            s.listComments,
+		"POST repos/{owner}/{repo}/issues/{number}/comments":           s.createComment,
+		"GET repos/{owner}/{repo}/issues/{number}/labels":              s.listLabels,
+		"POST repos/{owner}/{repo}/issues/{number}/labels":             s.addLabels,
+		"DELETE repos/{owner}/{repo}/issues/{number}/labels/{name...}": s.deleteLabel,
+	}
+	for route, h := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		mux.Handle(method+" "+APIPath+"/"+path, s.serve(h))
+	}
+	return mux
+}
+
+// serve authenticates the request, handles it with the lock held, calls the hooks with the events of the changes it
+// made and then writes the response
+func (s *Server) serve(h apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests = append(s.requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, APIPath+"/"))
+		_, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		user, ok := s.tokens[token]
+		if !ok {
+			s.lock.Unlock()
+			writeJSON(w, http.StatusUnauthorized, errorJSON{Message: "Bad credentials"})
+			return
+		}
+		c := &call{request: r, user: user}
+		status, body := h(c)
+		hooks := slices.Clone(s.hooks)
+		s.lock.Unlock()
+
+		for _, e := range c.events {
+			for _, hook := range hooks {
+				hook(s, e)
+			}
+		}
+		writeJSON(w, status, body)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func notFound(format string, args ...any) (int, any) {
+	return http.StatusNotFound, errorJSON{Message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(err error) (int, any) {
+	return http.StatusBadRequest, errorJSON{Message: err.Error()}
+}
+
+// decode decodes the JSON body of the request
+func (c *call) decode(v any) error {
+	err := json.NewDecoder(c.request.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse the body of %s %s: %w", c.request.Method, c.request.URL.Path, err)
+	}
+	return nil
+}
+
+func (c *call) event(kind EventKind, number int, comment *Comment) {
+	c.events = append(c.events, Event{
+		Kind:    kind,
+		Owner:   c.request.PathValue("owner"),
+		Repo:    c.request.PathValue("repo"),
+		Number:  number,
+		Sender:  c.user,
+		Comment: comment,
+	})
+}
+
+// repository returns the repository of the request or nil if it does not exist
+func (s *Server) repository(c *call) *repository {
+	return s.repos[c.request.PathValue("owner")+"/"+c.request.PathValue("repo")]
+}
+
+// number returns the issue or pull request number of the request
+func (c *call) number() int {
+	n, _ := strconv.Atoi(c.request.PathValue("number"))
+	return n
+}
+
+func (s *Server) getUser(c *call) (int, any) {
+	return http.StatusOK, userJSON{Login: c.user}
+}
+
+// listUserRepositories lists the repositories the user owns or collaborates on, whoever owns them, as GitHub does
+func (s *Server) listUserRepositories(c *call) (int, any) {
+	return s.listRepositories(c, func(r *repository) bool {
+		return r.isCollaborator(c.user)
+	})
+}
+
+func (s *Server) listOrganisationRepositories(c *call) (int, any) {
+	owner := c.request.PathValue("owner")
+	return s.listRepositories(c, func(r *repository) bool {
+		return strings.EqualFold(r.Owner, owner)
+	})
+}
+
+func (s *Server) listRepositories(c *call, filter func(r *repository) bool) (int, any) {
+	answer := []repositoryJSON{}
+	for _, r := range s.reposOf(filter) {
+		answer = append(answer, s.toRepositoryJSON(r, c.user))
+	}
+	return http.StatusOK, answer
+}
+
+func (s *Server) getRepository(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil {
+		return notFound("no repository %s/%s", c.request.PathValue("owner"), c.request.PathValue("repo"))
+	}
+	return http.StatusOK, s.toRepositoryJSON(r, c.user)
+}
+
+func (s *Server) deleteRepository(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil {
+		return notFound("no repository %s/%s", c.request.PathValue("owner"), c.request.PathValue("repo"))
+	}
+	delete(s.repos, r.FullName())
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) isCollaborator(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil || !r.isCollaborator(c.request.PathValue("user")) {
+		return http.StatusNotFound, nil
+	}
+	return http.StatusNoContent, nil
+}
+
+// addCollaborator invites the user to become a collaborator, unless they already are one, as GitHub does
+func (s *Server) addCollaborator(c *call) (int, any) {
+	r := s.repository(c)
+	user := c.request.PathValue("user")
+	if _, ok := s.users[user]; r == nil || !ok {
+		return notFound("no repository %s/%s or user %s", c.request.PathValue("owner"), c.request.PathValue("repo"), user)
+	}
+	if r.isCollaborator(user) {
+		return http.StatusNoContent, nil
+	}
+	for _, i := range s.invitations {
+		if i.Invitee == user && i.Owner == r.Owner && i.Repo == r.Name {
+			return http.StatusCreated, s.toInvitationJSON(i)
+		}
+	}
+	s.nextID++
+	i := &Invitation{ID: int64(s.nextID), Owner: r.Owner, Repo: r.Name, Invitee: user, Inviter: c.user}
+	s.invitations = append(s.invitations, i)
+	return http.StatusCreated, s.toInvitationJSON(i)
+}
+
+func (s *Server) listInvitations(c *call) (int, any) {
+	answer := []invitationJSON{}
+	for _, i := range s.invitations {
+		if i.Invitee == c.user {
+			answer = append(answer, s.toInvitationJSON(i))
+		}
+	}
+	return http.StatusOK, answer
+}
+
+func (s *Server) acceptInvitation(c *call) (int, any) {
+	id, _ := strconv.ParseInt(c.request.PathValue("id"), 10, 64)
+	for idx, i := range s.invitations {
+		if i.ID != id || i.Invitee != c.user {
+			continue
+		}
+		s.invitations = slices.Delete(s.invitations, idx, idx+1)
+		if r := s.repos[i.Owner+"/"+i.Repo]; r != nil {
+			r.Collaborators = addName(r.Collaborators, i.Invitee)
+		}
+		return http.StatusNoContent, nil
+	}
+	return notFound("no invitation %d for %s", id, c.user)
+}
+
+func (s *Server) listStatuses(c *call) (int, any) {
+	answer := []statusJSON{}
+	if r := s.repository(c); r != nil {
+		for _, st := range r.statuses[c.request.PathValue("sha")] {
+			answer = append(answer, toStatusJSON(st))
+		}
+	}
+	return http.StatusOK, answer
+}
+
+func (s *Server) createStatus(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil {
+		return notFound("no repository %s/%s", c.request.PathValue("owner"), c.request.PathValue("repo"))
+	}
+	in := statusJSON{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	status := Status{Context: in.Context, State: in.State, TargetURL: in.TargetURL, Description: in.Description}
+	s.setStatus(r, c.request.PathValue("sha"), status)
+	return http.StatusCreated, toStatusJSON(r.statuses[c.request.PathValue("sha")][0])
+}
+
+func (s *Server) listPullRequests(c *call) (int, any) {
+	answer := []pullRequestJSON{}
+	r := s.repository(c)
+	if r == nil {
+		return http.StatusOK, answer
+	}
+	state := c.request.URL.Query().Get("state")
+	if state == "" {
+		state = StateOpen
+	}
+	var numbers []int
+	for n, pr := range r.pulls {
+		if state == "all" || pr.State == state {
+			numbers = append(numbers, n)
+		}
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	for _, n := range numbers {
+		answer = append(answer, s.toPullRequestJSON(r, r.pulls[n]))
+	}
+	return http.StatusOK, answer
+}
+
+func (s *Server) createPullRequestCall(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil {
+		return notFound("no repository %s/%s", c.request.PathValue("owner"), c.request.PathValue("repo"))
+	}
+	in := pullRequestInput{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	pr := PullRequest{Head: in.Head, Base: in.Base}
+	pr.Author = c.user
+	if in.Title != nil {
+		pr.Title = *in.Title
+	}
+	if in.Body != nil {
+		pr.Body = *in.Body
+	}
+	created := s.createPullRequest(r, pr)
+	c.event(EventPullRequestOpened, created.Number, nil)
+	return http.StatusCreated, s.toPullRequestJSON(r, created)
+}
+
+func (s *Server) getPullRequest(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil || r.pulls[c.number()] == nil {
+		return notFound("no pull request %s", c.request.URL.Path)
+	}
+	return http.StatusOK, s.toPullRequestJSON(r, r.pulls[c.number()])
+}
+
+func (s *Server) updatePullRequest(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil || r.pulls[c.number()] == nil {
+		return notFound("no pull request %s", c.request.URL.Path)
+	}
+	pr := r.pulls[c.number()]
+	in := pullRequestInput{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	edited := false
+	if in.Title != nil && *in.Title != pr.Title {
+		pr.Title = *in.Title
+		edited = true
+	}
+	if in.Body != nil && *in.Body != pr.Body {
+		pr.Body = *in.Body
+		edited = true
+	}
+	if in.Base != "" {
+		pr.Base = in.Base
+	}
+	if edited {
+		c.event(EventPullRequestEdited, pr.Number, nil)
+	}
+	switch {
+	case in.State == StateClosed && pr.State == StateOpen:
+		pr.State = StateClosed
+		c.event(EventPullRequestClosed, pr.Number, nil)
+	case in.State == StateOpen && pr.State == StateClosed && !pr.Merged:
+		pr.State = StateOpen
+		c.event(EventPullRequestOpened, pr.Number, nil)
+	}
+	pr.Updated = s.now()
+	return http.StatusOK, s.toPullRequestJSON(r, pr)
+}
+
+func (s *Server) mergePullRequestCall(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil || r.pulls[c.number()] == nil {
+		return notFound("no pull request %s", c.request.URL.Path)
+	}
+	err := s.mergePullRequest(r.Owner, r.Name, c.number())
+	if err != nil {
+		return http.StatusMethodNotAllowed, errorJSON{Message: err.Error()}
+	}
+	c.event(EventPullRequestMerged, c.number(), nil)
+	return http.StatusOK, map[string]any{"merged": true, "sha": r.pulls[c.number()].MergeSha}
+}
+
+func (s *Server) requestReviewers(c *call) (int, any) {
+	return s.changeReviewers(c, addName)
+}
+
+func (s *Server) unrequestReviewers(c *call) (int, any) {
+	return s.changeReviewers(c, removeName)
+}
+
+func (s *Server) changeReviewers(c *call, change func([]string, string) []string) (int, any) {
+	r := s.repository(c)
+	if r == nil || r.pulls[c.number()] == nil {
+		return notFound("no pull request %s", c.request.URL.Path)
+	}
+	pr := r.pulls[c.number()]
+	in := reviewersInput{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	for _, reviewer := range in.Reviewers {
+		pr.Reviewers = change(pr.Reviewers, reviewer)
+	}
+	pr.Updated = s.now()
+	return http.StatusOK, s.toPullRequestJSON(r, pr)
+}
+
+func (s *Server) createIssueCall(c *call) (int, any) {
+	r := s.repository(c)
+	if r == nil {
+		return notFound("no repository %s/%s", c.request.PathValue("owner"), c.request.PathValue("repo"))
+	}
+	in := issueInput{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	issue := s.createIssue(r, Issue{Title: in.Title, Body: in.Body, Author: c.user})
+	return http.StatusCreated, s.toIssueJSON(r, issue)
+}
+
+func (s *Server) getIssue(c *call) (int, any) {
+	r := s.repository(c)
+	issue := s.issue(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number())
+	if issue == nil {
+		return notFound("no issue %s", c.request.URL.Path)
+	}
+	return http.StatusOK, s.toIssueJSON(r, issue)
+}
+
+func (s *Server) listComments(c *call) (int, any) {
+	r := s.repository(c)
+	if s.issue(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number()) == nil {
+		return notFound("no issue %s", c.request.URL.Path)
+	}
+	answer := []commentJSON{}
+	for _, comment := range r.comments[c.number()] {
+		answer = append(answer, s.toCommentJSON(r, c.number(), comment))
+	}
+	return http.StatusOK, answer
+}
+
+func (s *Server) createComment(c *call) (int, any) {
+	in := commentInput{}
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	comment, err := s.addComment(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number(), c.user, in.Body)
+	if err != nil {
+		return notFound("%s", err.Error())
+	}
+	event := *comment
+	c.event(EventComment, c.number(), &event)
+	return http.StatusCreated, s.toCommentJSON(s.repository(c), c.number(), comment)
+}
+
+func (s *Server) listLabels(c *call) (int, any) {
+	issue := s.issue(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number())
+	if issue == nil {
+		return notFound("no issue %s", c.request.URL.Path)
+	}
+	return http.StatusOK, toLabelsJSON(issue.Labels)
+}
+
+// addLabels adds the labels which are either a list of names or an object with a list of names, as GitHub accepts
+// both
+func (s *Server) addLabels(c *call) (int, any) {
+	issue := s.issue(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number())
+	if issue == nil {
+		return notFound("no issue %s", c.request.URL.Path)
+	}
+	var in json.RawMessage
+	err := c.decode(&in)
+	if err != nil {
+		return badRequest(err)
+	}
+	var labels []string
+	if json.Unmarshal(in, &labels) != nil {
+		wrapped := struct {
+			Labels []string `json:"labels"`
+		}{}
+		err = json.Unmarshal(in, &wrapped)
+		if err != nil {
+			return badRequest(fmt.Errorf("failed to parse the labels %s: %w", string(in), err))
+		}
+		labels = wrapped.Labels
+	}
+	for _, l := range labels {
+		issue.Labels = addName(issue.Labels, l)
+	}
+	issue.Updated = s.now()
+	return http.StatusOK, toLabelsJSON(issue.Labels)
+}
+
+func (s *Server) deleteLabel(c *call) (int, any) {
+	issue := s.issue(c.request.PathValue("owner"), c.request.PathValue("repo"), c.number())
+	name := c.request.PathValue("name")
+	if issue == nil || !slices.Contains(issue.Labels, name) {
+		return notFound("no label %s on %s", name, c.request.URL.Path)
+	}
+	issue.Labels = removeName(issue.Labels, name)
+	issue.Updated = s.now()
+	return http.StatusOK, toLabelsJSON(issue.Labels)
+}
+
+func (s *Server) toRepositoryJSON(r *repository, user string) repositoryJSON {
+	collaborator := r.isCollaborator(user)
+	return repositoryJSON{
+		Owner:         userJSON{Login: r.Owner},
+		Name:          r.Name,
+		FullName:      r.FullName(),
+		HTMLURL:       s.URL + "/" + r.FullName(),
+		CloneURL:      s.URL + "/" + r.FullName() + ".git",
+		DefaultBranch: r.DefaultBranch,
+		Permissions:   permissionsJSON{Admin: collaborator, Push: collaborator, Pull: true},
+	}
+}
+
+func (s *Server) toPullRequestJSON(r *repository, pr *PullRequest) pullRequestJSON {
+	repo := s.toRepositoryJSON(r, "")
+	return pullRequestJSON{
+		Number:             pr.Number,
+		State:              pr.State,
+		Title:              pr.Title,
+		Body:               pr.Body,
+		Labels:             toLabelsJSON(pr.Labels),
+		HTMLURL:            s.PullRequestURL(r.Owner, r.Name, pr.Number),
+		User:               userJSON{Login: pr.Author},
+		RequestedReviewers: toUsersJSON(pr.Reviewers),
+		Assignees:          toUsersJSON(pr.Assignees),
+		Head:               branchJSON{Ref: pr.Head, Sha: pr.Sha, Repo: repo},
+		Base:               branchJSON{Ref: pr.Base, Repo: repo},
+		Merged:             pr.Merged,
+		Mergeable:          pr.State == StateOpen,
+		MergeSha:           pr.MergeSha,
+		CreatedAt:          pr.Created,
+		UpdatedAt:          pr.Updated,
+	}
+}
+
+func (s *Server) toIssueJSON(r *repository, issue *Issue) issueJSON {
+	answer := issueJSON{
+		Number:    issue.Number,
+		HTMLURL:   s.IssueURL(r.Owner, r.Name, issue.Number),
+		State:     issue.State,
+		Title:     issue.Title,
+		Body:      issue.Body,
+		User:      userJSON{Login: issue.Author},
+		Labels:    toLabelsJSON(issue.Labels),
+		Assignees: toUsersJSON(issue.Assignees),
+		CreatedAt: issue.Created,
+		UpdatedAt: issue.Updated,
+	}
+	if r.pulls[issue.Number] != nil {
+		answer.HTMLURL = s.PullRequestURL(r.Owner, r.Name, issue.Number)
+		answer.PullRequest = &issueLinkJSON{HTMLURL: answer.HTMLURL}
+	}
+	return answer
+}
+
+func (s *Server) toCommentJSON(r *repository, number int, comment *Comment) commentJSON {
+	return commentJSON{
+		ID:        comment.ID,
+		HTMLURL:   fmt.Sprintf("%s#issuecomment-%d", s.IssueURL(r.Owner, r.Name, number), comment.ID),
+		User:      userJSON{Login: comment.Author},
+		Body:      comment.Body,
+		CreatedAt: comment.Created,
+		UpdatedAt: comment.Created,
+	}
+}
+
+func (s *Server) toInvitationJSON(i *Invitation) invitationJSON {
+	answer := invitationJSON{
+		ID:          i.ID,
+		Repo:        repositoryJSON{Owner: userJSON{Login: i.Owner}, Name: i.Repo, FullName: i.Owner + "/" + i.Repo},
+		Invitee:     userJSON{Login: i.Invitee},
+		Inviter:     userJSON{Login: i.Inviter},
+		Permissions: "admin",
+	}
+	if r := s.repos[i.Owner+"/"+i.Repo]; r != nil {
+		answer.Repo = s.toRepositoryJSON(r, i.Invitee)
+	}
+	return answer
+}
+
+func toStatusJSON(st *Status) statusJSON {
+	return statusJSON{
+		State:       st.State,
+		TargetURL:   st.TargetURL,
+		Description: st.Description,
+		Context:     st.Context,
+		CreatedAt:   st.Created,
+		UpdatedAt:   st.Created,
+	}
+}
+
+func toLabelsJSON(labels []string) []labelJSON {
+	answer := []labelJSON{}
+	for _, l := range labels {
+		answer = append(answer, labelJSON{Name: l})
+	}
+	return answer
+}
+
+func toUsersJSON(logins []string) []userJSON {
+	answer := []userJSON{}
+	for _, l := range logins {
+		answer = append(answer, userJSON{Login: l})
+	}
+	return answer
+}
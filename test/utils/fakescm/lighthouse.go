@@ -0,0 +1,153 @@
+package fakescm
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// LabelApproved is the label lighthouse adds on /approve
+	LabelApproved = "approved"
+	// LabelLGTM is the label lighthouse adds on /lgtm
+	LabelLGTM = "lgtm"
+	// LabelHold is the label lighthouse adds on /hold
+	LabelHold = "do-not-merge/hold"
+	// LabelWorkInProgress is the label lighthouse adds to pull requests whose title starts with WIP
+	LabelWorkInProgress = "do-not-merge/work-in-progress"
+
+	// CannotLGTMOwnPullRequest is the reply of lighthouse to the author of a pull request commenting /lgtm
+	CannotLGTMOwnPullRequest = "you cannot LGTM your own PR."
+)
+
+var (
+	commandRegex = regexp.MustCompile(`(?m)^/(?:lh-)?([a-z]+)\s*(.*?)\s*$`)
+	wipRegex     = regexp.MustCompile(`(?i)^\W?WIP\W`)
+)
+
+// Lighthouse emulates the ChatOps commands of the lighthouse plugins and the merging of lighthouse keeper that the
+// BDD tests exercise, so that the pull request helpers can be tested against the fake server
+type Lighthouse struct {
+	// Bot is the user lighthouse comments as
+	Bot string
+	// Merge merges pull requests once they are approved and have no do-not-merge labels, as keeper does
+	Merge bool
+}
+
+// Hook returns the hook which reacts to comments and pull request changes. GitLab style /lh- prefixed commands are
+// supported too.
+func (l *Lighthouse) Hook() Hook {
+	return func(s *Server, e Event) {
+		switch e.Kind {
+		case EventComment:
+			if e.Comment == nil || e.Sender == l.Bot {
+				return
+			}
+			for _, m := range commandRegex.FindAllStringSubmatch(e.Comment.Body, -1) {
+				l.command(s, e, m[1], strings.Fields(m[2]))
+			}
+		case EventPullRequestOpened, EventPullRequestEdited:
+			pr := s.PullRequest(e.Owner, e.Repo, e.Number)
+			if pr == nil {
+				return
+			}
+			if wipRegex.MatchString(pr.Title) {
+				_ = s.AddLabel(e.Owner, e.Repo, e.Number, LabelWorkInProgress)
+			} else {
+				_ = s.RemoveLabel(e.Owner, e.Repo, e.Number, LabelWorkInProgress)
+			}
+		}
+		l.mergeIfReady(s, e)
+	}
+}
+
+func (l *Lighthouse) command(s *Server, e Event, name string, args []string) {
+	issue := s.Issue(e.Owner, e.Repo, e.Number)
+	if issue == nil {
+		return
+	}
+	repo := s.Repository(e.Owner, e.Repo)
+	collaborator := repo != nil && (strings.EqualFold(repo.Owner, e.Sender) || slices.Contains(repo.Collaborators, e.Sender))
+	cancel := len(args) > 0 && args[0] == "cancel"
+
+	switch name {
+	case "approve":
+		if !collaborator {
+			l.reply(s, e, fmt.Sprintf("@%s you cannot approve as you are not a collaborator of %s/%s.", e.Sender, e.Owner, e.Repo))
+			return
+		}
+		l.label(s, e, LabelApproved, !cancel)
+	case "lgtm":
+		if issue.Author == e.Sender {
+			l.reply(s, e, fmt.Sprintf("@%s %s", e.Sender, CannotLGTMOwnPullRequest))
+			return
+		}
+		l.label(s, e, LabelLGTM, !cancel)
+	case "hold":
+		l.label(s, e, LabelHold, !cancel)
+	case "assign", "unassign":
+		users := usersOrSender(args, e.Sender)
+		_ = s.UpdateIssue(e.Owner, e.Repo, e.Number, func(issue *Issue) {
+			for _, u := range users {
+				if name == "assign" {
+					issue.Assignees = addName(issue.Assignees, u)
+				} else {
+					issue.Assignees = removeName(issue.Assignees, u)
+				}
+			}
+		})
+	case "cc", "uncc":
+		users := usersOrSender(args, e.Sender)
+		_ = s.UpdatePullRequest(e.Owner, e.Repo, e.Number, func(pr *PullRequest) {
+			for _, u := range users {
+				if name == "cc" {
+					pr.Reviewers = addName(pr.Reviewers, u)
+				} else {
+					pr.Reviewers = removeName(pr.Reviewers, u)
+				}
+			}
+		})
+	}
+}
+
+func (l *Lighthouse) label(s *Server, e Event, label string, add bool) {
+	if add {
+		_ = s.AddLabel(e.Owner, e.Repo, e.Number, label)
+	} else {
+		_ = s.RemoveLabel(e.Owner, e.Repo, e.Number, label)
+	}
+}
+
+func (l *Lighthouse) reply(s *Server, e Event, body string) {
+	_, _ = s.AddComment(e.Owner, e.Repo, e.Number, l.Bot, body)
+}
+
+// mergeIfReady merges the pull request of the event if it is open, approved and has no do-not-merge labels
+func (l *Lighthouse) mergeIfReady(s *Server, e Event) {
+	if !l.Merge {
+		return
+	}
+	pr := s.PullRequest(e.Owner, e.Repo, e.Number)
+	if pr == nil || pr.State != StateOpen || !slices.Contains(pr.Labels, LabelApproved) {
+		return
+	}
+	for _, label := range pr.Labels {
+		if strings.HasPrefix(label, "do-not-merge/") {
+			return
+		}
+	}
+	_ = s.MergePullRequest(e.Owner, e.Repo, e.Number)
+}
+
+// usersOrSender returns the users of a command without their @ prefix, or the sender if there are none
+func usersOrSender(args []string, sender string) []string {
+	if len(args) == 0 {
+		return []string{sender}
+	}
+	var answer []string
+	for _, a := range args {
+		answer = append(answer, strings.TrimPrefix(a, "@"))
+	}
+	return answer
+}
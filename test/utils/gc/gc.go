@@ -0,0 +1,330 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kind is the kind of a stale resource
+type Kind string
+
+const (
+	// KindRepository is a git repository in the git organisation of the tests
+	KindRepository Kind = "repository"
+	// KindSourceRepository is a SourceRepository in the dev namespace
+	KindSourceRepository Kind = "sourcerepository"
+	// KindPipelineActivity is a PipelineActivity in the dev namespace
+	KindPipelineActivity Kind = "pipelineactivity"
+	// KindPreview is the namespace of a preview environment
+	KindPreview Kind = "preview"
+	// KindPreviewResource is the jx-preview Preview resource of a preview environment in the dev namespace
+	KindPreviewResource Kind = "previewresource"
+	// KindApplication is an application deployed to a permanent environment such as staging or production
+	KindApplication Kind = "application"
+)
+
+// Resource is a resource left behind by the BDD tests
+type Resource struct {
+	Kind      Kind
+	Namespace string
+	Name      string
+	Created   time.Time
+}
+
+// String returns the kind and name of the resource
+func (r *Resource) String() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// Repositories lists and deletes git repositories. It is implemented by gits.Provider.
+type Repositories interface {
+	ListRepositories(owner string) ([]*scm.Repository, error)
+	DeleteRepository(owner, repo string) error
+}
+
+// Collector finds and removes the resources created by the BDD tests which are older than a given age. Resources
+// are matched by the prefix of their repository name, which is helpers.TempDirPrefix for all the suites.
+type Collector struct {
+	// Prefix is the prefix of the repository names created by the tests
+	Prefix string
+	// OlderThan is the minimum age of a resource before it is considered stale
+	OlderThan time.Duration
+	// Namespace is the dev namespace
+	Namespace string
+	// Owner is the git organisation or user the test repositories are created in. If it is empty the previews of every
+	// owner are matched.
+	Owner string
+
+	KubeClient kubernetes.Interface
+	JXClient   versioned.Interface
+	// DynamicClient is used to find the jx-preview Preview resources. They are skipped if it is nil.
+	DynamicClient dynamic.Interface
+	// Repositories is used to find the git repositories. Git repositories are skipped if it is nil.
+	Repositories Repositories
+	// DeleteApplication removes an application from all the environments. Applications are only listed if it is nil.
+	DeleteApplication func(ctx context.Context, name string) error
+	// Now returns the current time, defaulting to time.Now
+	Now func() time.Time
+}
+
+func (c *Collector) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Collector) isStale(name string, created time.Time) bool {
+	if !strings.HasPrefix(name, c.Prefix) || created.IsZero() {
+		return false
+	}
+	return c.now().Sub(created) >= c.OlderThan
+}
+
+// Find returns the stale resources sorted by kind and name
+func (c *Collector) Find(ctx context.Context) ([]*Resource, error) {
+	if c.Prefix == "" {
+		return nil, errors.New("no prefix specified so every resource would match")
+	}
+	finders := []func(context.Context) ([]*Resource, error){
+		c.findRepositories,
+		c.findSourceRepositories,
+		c.findPipelineActivities,
+		c.findPreviews,
+		c.findPreviewResources,
+		c.findApplications,
+	}
+	var answer []*Resource
+	for _, find := range finders {
+		resources, err := find(ctx)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, resources...)
+	}
+	sort.SliceStable(answer, func(i, j int) bool {
+		if answer[i].Kind != answer[j].Kind {
+			return answer[i].Kind < answer[j].Kind
+		}
+		return answer[i].String() < answer[j].String()
+	})
+	return answer, nil
+}
+
+func (c *Collector) findRepositories(ctx context.Context) ([]*Resource, error) {
+	if c.Repositories == nil {
+		return nil, nil
+	}
+	repos, err := c.Repositories.ListRepositories(c.Owner)
+	if err != nil {
+		return nil, err
+	}
+	var answer []*Resource
+	for _, repo := range repos {
+		// never delete a repository of another owner with the same name
+		if !strings.EqualFold(repo.Namespace, c.Owner) {
+			continue
+		}
+		if c.isStale(repo.Name, repo.Created) {
+			answer = append(answer, &Resource{Kind: KindRepository, Namespace: c.Owner, Name: repo.Name, Created: repo.Created})
+		}
+	}
+	return answer, nil
+}
+
+func (c *Collector) findSourceRepositories(ctx context.Context) ([]*Resource, error) {
+	list, err := c.JXClient.JenkinsV1().SourceRepositories(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SourceRepositories in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []*Resource
+	for _, sr := range list.Items {
+		if c.isStale(sr.Spec.Repo, sr.CreationTimestamp.Time) {
+			answer = append(answer, &Resource{Kind: KindSourceRepository, Namespace: sr.Namespace, Name: sr.Name, Created: sr.CreationTimestamp.Time})
+		}
+	}
+	return answer, nil
+}
+
+func (c *Collector) findPipelineActivities(ctx context.Context) ([]*Resource, error) {
+	list, err := c.JXClient.JenkinsV1().PipelineActivities(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineActivities in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []*Resource
+	for _, pa := range list.Items {
+		if c.isStale(pa.Spec.GitRepository, pa.CreationTimestamp.Time) {
+			answer = append(answer, &Resource{Kind: KindPipelineActivity, Namespace: pa.Namespace, Name: pa.Name, Created: pa.CreationTimestamp.Time})
+		}
+	}
+	return answer, nil
+}
+
+// findPreviews finds the preview namespaces, which are named jx-<owner>-<repository>-pr-<number>
+func (c *Collector) findPreviews(ctx context.Context) ([]*Resource, error) {
+	list, err := c.KubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	var answer []*Resource
+	for _, ns := range list.Items {
+		repository := c.previewRepository(ns.Name)
+		if repository != "" && c.isStale(repository, ns.CreationTimestamp.Time) {
+			answer = append(answer, &Resource{Kind: KindPreview, Name: ns.Name, Created: ns.CreationTimestamp.Time})
+		}
+	}
+	return answer, nil
+}
+
+// previewRepository returns the repository of a preview namespace of the owner, or "" if the namespace is not a
+// preview of the owner. Namespaces are lower case whatever the case of the owner. Without an owner the previews of
+// every owner match, finding the repository by its prefix as the owner may contain dashes.
+func (c *Collector) previewRepository(namespace string) string {
+	if !strings.HasPrefix(namespace, "jx-") || !strings.Contains(namespace, "-pr-") {
+		return ""
+	}
+	name := strings.TrimPrefix(namespace, "jx-")
+	if c.Owner == "" {
+		idx := strings.Index(name, "-"+strings.ToLower(c.Prefix))
+		if idx < 0 {
+			return ""
+		}
+		return name[idx+1:]
+	}
+	ownerPrefix := strings.ToLower(c.Owner) + "-"
+	if !strings.HasPrefix(name, ownerPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(name, ownerPrefix)
+}
+
+// findPreviewResources finds the jx-preview Preview resources of the previews of the owner in the dev namespace
+func (c *Collector) findPreviewResources(ctx context.Context) ([]*Resource, error) {
+	if c.DynamicClient == nil {
+		return nil, nil
+	}
+	list, err := c.DynamicClient.Resource(previews.GroupVersionResource).Namespace(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Previews in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []*Resource
+	for i := range list.Items {
+		u := &list.Items[i]
+		p, err := previews.FromUnstructured(u)
+		if err != nil {
+			return nil, err
+		}
+		if c.Owner != "" && !strings.EqualFold(p.Owner, c.Owner) {
+			continue
+		}
+		created := u.GetCreationTimestamp().Time
+		if c.isStale(p.Repository, created) {
+			answer = append(answer, &Resource{Kind: KindPreviewResource, Namespace: p.Namespace, Name: p.Name, Created: created})
+		}
+	}
+	return answer, nil
+}
+
+// findApplications finds the deployments of the applications in the permanent environments
+func (c *Collector) findApplications(ctx context.Context) ([]*Resource, error) {
+	envs, err := c.JXClient.JenkinsV1().Environments(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Environments in namespace %s: %w", c.Namespace, err)
+	}
+	var answer []*Resource
+	for _, env := range envs.Items {
+		if env.Spec.Kind != v1.EnvironmentKindTypePermanent || env.Spec.Namespace == "" {
+			continue
+		}
+		deployments, err := c.KubeClient.AppsV1().Deployments(env.Spec.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Deployments in namespace %s: %w", env.Spec.Namespace, err)
+		}
+		for _, d := range deployments.Items {
+			name := strings.TrimPrefix(d.Name, "jx-")
+			if c.isStale(name, d.CreationTimestamp.Time) {
+				answer = append(answer, &Resource{Kind: KindApplication, Namespace: d.Namespace, Name: name, Created: d.CreationTimestamp.Time})
+			}
+		}
+	}
+	return answer, nil
+}
+
+// Delete removes the given resources returning the resources which were removed. Every resource is attempted even
+// if removing an earlier one fails. Applications are removed from all environments at once.
+func (c *Collector) Delete(ctx context.Context, resources []*Resource) ([]*Resource, error) {
+	var removed []*Resource
+	var errs []error
+	deletedApps := map[string]bool{}
+	for _, r := range resources {
+		var err error
+		switch r.Kind {
+		case KindRepository:
+			if c.Repositories == nil {
+				err = errors.New("no git provider configured")
+				break
+			}
+			err = c.Repositories.DeleteRepository(r.Namespace, r.Name)
+		case KindSourceRepository:
+			err = c.JXClient.JenkinsV1().SourceRepositories(r.Namespace).Delete(ctx, r.Name, metav1.DeleteOptions{})
+		case KindPipelineActivity:
+			err = c.JXClient.JenkinsV1().PipelineActivities(r.Namespace).Delete(ctx, r.Name, metav1.DeleteOptions{})
+		case KindPreview:
+			err = c.KubeClient.CoreV1().Namespaces().Delete(ctx, r.Name, metav1.DeleteOptions{})
+		case KindPreviewResource:
+			if c.DynamicClient == nil {
+				err = errors.New("no dynamic client configured")
+				break
+			}
+			err = c.DynamicClient.Resource(previews.GroupVersionResource).Namespace(r.Namespace).Delete(ctx, r.Name, metav1.DeleteOptions{})
+		case KindApplication:
+			if c.DeleteApplication == nil {
+				err = errors.New("no way to delete applications configured")
+				break
+			}
+			if !deletedApps[r.Name] {
+				err = c.DeleteApplication(ctx, r.Name)
+				deletedApps[r.Name] = err == nil
+			}
+		default:
+			err = fmt.Errorf("unknown kind %s", r.Kind)
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			utils.LogInfof("WARNING: failed to remove %s: %s\n", r.String(), err.Error())
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", r.String(), err))
+			continue
+		}
+		utils.LogInfof("removed %s\n", r.String())
+		removed = append(removed, r)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// WriteTable writes the resources as a table along with their age at the given time
+func WriteTable(w io.Writer, resources []*Resource, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tAGE")
+	for _, r := range resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Kind, r.Namespace, r.Name, now.Sub(r.Created).Truncate(time.Minute).String())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,263 @@
+package gc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakejx"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gc"
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const (
+	ns    = "jx"
+	owner = "cb-kubecd"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeRepositories struct {
+	repos   []*scm.Repository
+	deleted []string
+}
+
+func (f *fakeRepositories) ListRepositories(owner string) ([]*scm.Repository, error) {
+	return f.repos, nil
+}
+
+func (f *fakeRepositories) DeleteRepository(owner, repo string) error {
+	f.deleted = append(f.deleted, owner+"/"+repo)
+	for i, r := range f.repos {
+		if r.Name == repo && strings.EqualFold(r.Namespace, owner) {
+			f.repos = append(f.repos[:i], f.repos[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func meta(namespace, name string, age time.Duration) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace:         namespace,
+		Name:              name,
+		CreationTimestamp: metav1.NewTime(now.Add(-age)),
+	}
+}
+
+func newPreview(name, previewOwner, repository string, age time.Duration) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "preview.jenkins.io/v1alpha1",
+		"kind":       "Preview",
+		"spec": map[string]interface{}{
+			"pullRequest": map[string]interface{}{
+				"number":     int64(1),
+				"owner":      previewOwner,
+				"repository": repository,
+			},
+		},
+	}}
+	u.SetNamespace(ns)
+	u.SetName(name)
+	u.SetCreationTimestamp(metav1.NewTime(now.Add(-age)))
+	return u
+}
+
+// newCollector creates a collector with fake clients, passing the Preview resources to the dynamic client
+func newCollector(t *testing.T, repos *fakeRepositories, objects ...runtime.Object) *gc.Collector {
+	var kubeObjects, dynamicObjects []runtime.Object
+	for _, o := range objects {
+		if _, ok := o.(*unstructured.Unstructured); ok {
+			dynamicObjects = append(dynamicObjects, o)
+		} else {
+			kubeObjects = append(kubeObjects, o)
+		}
+	}
+	kubeClient, jxClient := fakejx.NewClients(kubeObjects...)
+	listKinds := map[schema.GroupVersionResource]string{previews.GroupVersionResource: "PreviewList"}
+	c := &gc.Collector{
+		Prefix:        "bdd-",
+		OlderThan:     24 * time.Hour,
+		Namespace:     ns,
+		Owner:         owner,
+		KubeClient:    kubeClient,
+		JXClient:      jxClient,
+		DynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, dynamicObjects...),
+		Now:           func() time.Time { return now },
+	}
+	if repos != nil {
+		c.Repositories = repos
+	}
+	return c
+}
+
+func testObjects() []runtime.Object {
+	return []runtime.Object{
+		&v1.SourceRepository{ObjectMeta: meta(ns, "cb-kubecd-bdd-old", 48*time.Hour), Spec: v1.SourceRepositorySpec{Org: owner, Repo: "bdd-old"}},
+		&v1.SourceRepository{ObjectMeta: meta(ns, "cb-kubecd-bdd-new", time.Hour), Spec: v1.SourceRepositorySpec{Org: owner, Repo: "bdd-new"}},
+		&v1.SourceRepository{ObjectMeta: meta(ns, "cb-kubecd-other", 48*time.Hour), Spec: v1.SourceRepositorySpec{Org: owner, Repo: "other"}},
+		&v1.PipelineActivity{ObjectMeta: meta(ns, "cb-kubecd-bdd-old-master-1", 48*time.Hour), Spec: v1.PipelineActivitySpec{GitRepository: "bdd-old"}},
+		&v1.PipelineActivity{ObjectMeta: meta(ns, "cb-kubecd-other-master-1", 48*time.Hour), Spec: v1.PipelineActivitySpec{GitRepository: "other"}},
+		&corev1.Namespace{ObjectMeta: meta("", "jx-cb-kubecd-bdd-old-pr-1", 48*time.Hour)},
+		&corev1.Namespace{ObjectMeta: meta("", "jx-cb-kubecd-other-pr-1", 48*time.Hour)},
+		&corev1.Namespace{ObjectMeta: meta("", "jx-another-org-bdd-collaborator-pr-2", 48*time.Hour)},
+		newPreview("bdd-old-pr-1", "CB-KubeCD", "bdd-old", 48*time.Hour),
+		newPreview("bdd-new-pr-1", owner, "bdd-new", time.Hour),
+		newPreview("bdd-collaborator-pr-2", "another-org", "bdd-collaborator", 48*time.Hour),
+		&corev1.Namespace{ObjectMeta: meta("", "jx-staging", 48*time.Hour)},
+		&v1.Environment{ObjectMeta: meta(ns, "staging", 48*time.Hour), Spec: v1.EnvironmentSpec{Namespace: "jx-staging", Kind: v1.EnvironmentKindTypePermanent}},
+		&v1.Environment{ObjectMeta: meta(ns, "production", 48*time.Hour), Spec: v1.EnvironmentSpec{Namespace: "jx-production", Kind: v1.EnvironmentKindTypePermanent}},
+		&v1.Environment{ObjectMeta: meta(ns, "dev", 48*time.Hour), Spec: v1.EnvironmentSpec{Namespace: ns, Kind: v1.EnvironmentKindTypeDevelopment}},
+		&appsv1.Deployment{ObjectMeta: meta("jx-staging", "jx-bdd-old", 48*time.Hour)},
+		&appsv1.Deployment{ObjectMeta: meta("jx-production", "jx-bdd-old", 47*time.Hour)},
+		&appsv1.Deployment{ObjectMeta: meta("jx-staging", "bdd-new", time.Hour)},
+		&appsv1.Deployment{ObjectMeta: meta(ns, "bdd-in-dev", 48*time.Hour)},
+	}
+}
+
+func TestFindStaleResources(t *testing.T) {
+	repos := &fakeRepositories{
+		repos: []*scm.Repository{
+			{Namespace: owner, Name: "bdd-old", Created: now.Add(-48 * time.Hour)},
+			{Namespace: owner, Name: "bdd-new", Created: now.Add(-time.Hour)},
+			{Namespace: owner, Name: "other", Created: now.Add(-48 * time.Hour)},
+			{Namespace: "another-org", Name: "bdd-collaborator", Created: now.Add(-48 * time.Hour)},
+		},
+	}
+	c := newCollector(t, repos, testObjects()...)
+
+	resources, err := c.Find(context.TODO())
+	require.NoError(t, err)
+
+	var names []string
+	for _, r := range resources {
+		names = append(names, r.String())
+	}
+	assert.Equal(t, []string{
+		"application jx-production/bdd-old",
+		"application jx-staging/bdd-old",
+		"pipelineactivity jx/cb-kubecd-bdd-old-master-1",
+		"preview jx-cb-kubecd-bdd-old-pr-1",
+		"previewresource jx/bdd-old-pr-1",
+		"repository cb-kubecd/bdd-old",
+		"sourcerepository jx/cb-kubecd-bdd-old",
+	}, names)
+}
+
+func TestFindPreviewsIgnoresOwnerCase(t *testing.T) {
+	c := newCollector(t, nil, testObjects()...)
+	c.Owner = "CB-KubeCD"
+
+	resources, err := c.Find(context.TODO())
+	require.NoError(t, err)
+
+	var names []string
+	for _, r := range resources {
+		if r.Kind == gc.KindPreview || r.Kind == gc.KindPreviewResource {
+			names = append(names, r.String())
+		}
+	}
+	assert.Equal(t, []string{"preview jx-cb-kubecd-bdd-old-pr-1", "previewresource jx/bdd-old-pr-1"}, names)
+}
+
+func TestFindPreviewsOfEveryOwnerWithoutOwner(t *testing.T) {
+	c := newCollector(t, nil, testObjects()...)
+	c.Owner = ""
+
+	resources, err := c.Find(context.TODO())
+	require.NoError(t, err)
+
+	var names []string
+	for _, r := range resources {
+		if r.Kind == gc.KindPreview || r.Kind == gc.KindPreviewResource {
+			names = append(names, r.String())
+		}
+	}
+	assert.Equal(t, []string{
+		"preview jx-another-org-bdd-collaborator-pr-2",
+		"preview jx-cb-kubecd-bdd-old-pr-1",
+		"previewresource jx/bdd-collaborator-pr-2",
+		"previewresource jx/bdd-old-pr-1",
+	}, names)
+}
+
+func TestFindRequiresPrefix(t *testing.T) {
+	c := newCollector(t, nil)
+	c.Prefix = ""
+	_, err := c.Find(context.TODO())
+	assert.Error(t, err)
+}
+
+func TestDeleteStaleResources(t *testing.T) {
+	repos := &fakeRepositories{
+		repos: []*scm.Repository{
+			{Namespace: "another-org", Name: "bdd-old", Created: now.Add(-48 * time.Hour)},
+			{Namespace: "CB-KubeCD", Name: "bdd-old", Created: now.Add(-48 * time.Hour)},
+		},
+	}
+	c := newCollector(t, repos, testObjects()...)
+	var deletedApps []string
+	c.DeleteApplication = func(ctx context.Context, name string) error {
+		deletedApps = append(deletedApps, name)
+		return nil
+	}
+
+	resources, err := c.Find(context.TODO())
+	require.NoError(t, err)
+	removed, err := c.Delete(context.TODO(), resources)
+	require.NoError(t, err)
+	assert.Len(t, removed, len(resources))
+
+	assert.Equal(t, []string{"bdd-old"}, deletedApps, "the application should only be deleted once")
+	assert.Equal(t, []string{"cb-kubecd/bdd-old"}, repos.deleted, "the repository of another owner with the same name should be kept")
+
+	remaining, err := c.Find(context.TODO())
+	require.NoError(t, err)
+	for _, r := range remaining {
+		assert.Equal(t, gc.KindApplication, r.Kind, "only the fake application deployments should remain")
+	}
+
+	_, err = c.JXClient.JenkinsV1().SourceRepositories(ns).Get(context.TODO(), "cb-kubecd-other", metav1.GetOptions{})
+	assert.NoError(t, err, "resources without the prefix should be kept")
+
+	_, err = c.DynamicClient.Resource(previews.GroupVersionResource).Namespace(ns).Get(context.TODO(), "bdd-old-pr-1", metav1.GetOptions{})
+	assert.Error(t, err, "the Preview of the stale preview should be removed")
+	_, err = c.DynamicClient.Resource(previews.GroupVersionResource).Namespace(ns).Get(context.TODO(), "bdd-collaborator-pr-2", metav1.GetOptions{})
+	assert.NoError(t, err, "the Preview of another owner should be kept")
+}
+
+func TestDeleteContinuesAfterFailures(t *testing.T) {
+	c := newCollector(t, nil, testObjects()...)
+	c.DeleteApplication = func(ctx context.Context, name string) error {
+		return errors.New("boom")
+	}
+
+	resources, err := c.Find(context.TODO())
+	require.NoError(t, err)
+	removed, err := c.Delete(context.TODO(), resources)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to remove application jx-staging/bdd-old: boom")
+	assert.Len(t, removed, 4)
+}
+
+func TestWriteTable(t *testing.T) {
+	out := &strings.Builder{}
+	err := gc.WriteTable(out, []*gc.Resource{
+		{Kind: gc.KindRepository, Namespace: owner, Name: "bdd-old", Created: now.Add(-30*time.Hour - 30*time.Second)},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "KIND        NAMESPACE  NAME     AGE\nrepository  cb-kubecd  bdd-old  30h0m0s\n", out.String())
+}
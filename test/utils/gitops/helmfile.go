@@ -0,0 +1,100 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Release is a helm release of a helmfile
+type Release struct {
+	Name      string `json:"name"`
+	Chart     string `json:"chart,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Helmfile is the part of a helmfile.yaml of a cluster repository the tests look at
+type Helmfile struct {
+	Releases []Release `json:"releases,omitempty"`
+}
+
+// HelmfilePath returns the path of the helmfile of the namespace in the cluster repository checked out in dir
+func HelmfilePath(dir string, namespace string) string {
+	return filepath.Join(dir, "helmfiles", namespace, "helmfile.yaml")
+}
+
+// LoadHelmfile loads the helmfile at the given path, returning an empty helmfile if it does not exist as jx removes
+// the helmfile of a namespace once it has no releases
+func LoadHelmfile(path string) (*Helmfile, error) {
+	h := &Helmfile{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, fmt.Errorf("failed to read the helmfile %s: %w", path, err)
+	}
+	err = yaml.Unmarshal(data, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the helmfile %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Find returns the release of the application or nil if there is none. The release is matched by its name or by
+// the name of its chart, such as dev/bdd-spring, with or without the jx- prefix of older charts.
+func (h *Helmfile) Find(app string) *Release {
+	for i := range h.Releases {
+		r := &h.Releases[i]
+		for _, name := range []string{app, "jx-" + app} {
+			if r.Name == name || r.Chart == name || strings.HasSuffix(r.Chart, "/"+name) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// ExpectRelease returns an error unless the helmfile of the namespace in the cluster repository checked out in dir
+// has the release of the application with the version
+func ExpectRelease(dir string, namespace string, app string, version string) error {
+	path := HelmfilePath(dir, namespace)
+	h, err := LoadHelmfile(path)
+	if err != nil {
+		return err
+	}
+	r := h.Find(app)
+	if r == nil {
+		return fmt.Errorf("no release of %s in %s", app, relative(dir, path))
+	}
+	if version != "" && r.Version != version {
+		return fmt.Errorf("the release of %s in %s has the version %s rather than %s", app, relative(dir, path), r.Version, version)
+	}
+	return nil
+}
+
+// ExpectNoRelease returns an error if the helmfile of the namespace in the cluster repository checked out in dir has
+// a release of the application
+func ExpectNoRelease(dir string, namespace string, app string) error {
+	path := HelmfilePath(dir, namespace)
+	h, err := LoadHelmfile(path)
+	if err != nil {
+		return err
+	}
+	if r := h.Find(app); r != nil {
+		return fmt.Errorf("the release %s of %s is still in %s", r.Name, app, relative(dir, path))
+	}
+	return nil
+}
+
+func relative(dir string, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,71 @@
+package gitops_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/gitops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stagingHelmfile = `filepath: ""
+environments:
+  default:
+    values:
+    - jx-values.yaml
+namespace: jx-staging
+repositories:
+- name: dev
+  url: http://bucketrepo.jx.svc.cluster.local/bucketrepo/charts/
+releases:
+- chart: dev/bdd-spring-1612345678
+  version: 0.0.1
+  name: bdd-spring-1612345678
+  values:
+  - jx-values.yaml
+- chart: dev/jx-bdd-nh-1612345679
+  version: 0.0.2
+  name: jx-bdd-nh-1612345679
+templates: {}
+renderedvalues: {}
+`
+
+func writeHelmfile(t *testing.T, namespace string, content string) string {
+	dir := t.TempDir()
+	path := gitops.HelmfilePath(dir, namespace)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return dir
+}
+
+func TestExpectRelease(t *testing.T) {
+	dir := writeHelmfile(t, "jx-staging", stagingHelmfile)
+
+	assert.NoError(t, gitops.ExpectRelease(dir, "jx-staging", "bdd-spring-1612345678", "0.0.1"))
+	assert.NoError(t, gitops.ExpectRelease(dir, "jx-staging", "bdd-nh-1612345679", "0.0.2"), "the jx- prefix should be ignored")
+	assert.NoError(t, gitops.ExpectRelease(dir, "jx-staging", "bdd-nh-1612345679", ""))
+
+	err := gitops.ExpectRelease(dir, "jx-staging", "bdd-spring-1612345678", "0.0.2")
+	require.Error(t, err)
+	assert.Equal(t, "the release of bdd-spring-1612345678 in helmfiles/jx-staging/helmfile.yaml has the version 0.0.1 rather than 0.0.2", err.Error())
+
+	err = gitops.ExpectRelease(dir, "jx-production", "bdd-spring-1612345678", "0.0.1")
+	require.Error(t, err, "a missing helmfile has no releases")
+	assert.Equal(t, "no release of bdd-spring-1612345678 in helmfiles/jx-production/helmfile.yaml", err.Error())
+}
+
+func TestExpectNoRelease(t *testing.T) {
+	dir := writeHelmfile(t, "jx-staging", stagingHelmfile)
+
+	assert.NoError(t, gitops.ExpectNoRelease(dir, "jx-staging", "bdd-gh-1612345680"))
+	assert.NoError(t, gitops.ExpectNoRelease(dir, "jx-production", "bdd-spring-1612345678"))
+
+	err := gitops.ExpectNoRelease(dir, "jx-staging", "bdd-spring-1612345678")
+	require.Error(t, err)
+	assert.Equal(t, "the release bdd-spring-1612345678 of bdd-spring-1612345678 is still in helmfiles/jx-staging/helmfile.yaml", err.Error())
+
+	dir = writeHelmfile(t, "jx-staging", "releases: [")
+	assert.Error(t, gitops.ExpectNoRelease(dir, "jx-staging", "bdd-spring-1612345678"))
+}
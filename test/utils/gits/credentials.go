@@ -0,0 +1,45 @@
+package gits
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// BootSecretNamespace is the namespace of the secret containing the pipeline user git credentials
+	BootSecretNamespace = "jx-git-operator"
+	// BootSecretName is the name of the secret containing the pipeline user git credentials
+	BootSecretName = "jx-boot"
+)
+
+// FindCredentials returns the username and API token of the pipeline user. If no token is given it is loaded from the
+// jx-boot secret in the cluster unless forceLocal is true.
+func FindCredentials(kubeClient kubernetes.Interface, username string, token string, forceLocal bool) (string, string, error) {
+	if token != "" {
+		return username, strings.TrimSpace(token), nil
+	}
+	if forceLocal {
+		return "", "", utils.MissingEnv("GIT_TOKEN")
+	}
+	if kubeClient == nil {
+		return "", "", fmt.Errorf("no GIT_TOKEN defined and no kubernetes client to load the %s secret", BootSecretName)
+	}
+	utils.LogInfof("using git credentials from secret %s in namespace %s\n", BootSecretName, BootSecretNamespace)
+	secret, err := kubeClient.CoreV1().Secrets(BootSecretNamespace).Get(context.TODO(), BootSecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load secret %s in namespace %s: %w", BootSecretName, BootSecretNamespace, err)
+	}
+	if username == "" {
+		username = string(secret.Data["username"])
+	}
+	token = strings.TrimSpace(string(secret.Data["password"]))
+	if token == "" {
+		return "", "", fmt.Errorf("no password in secret %s in namespace %s", BootSecretName, BootSecretNamespace)
+	}
+	return username, token, nil
+}
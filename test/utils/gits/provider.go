@@ -0,0 +1,326 @@
+package gits
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/factory"
+)
+
+const (
+	// KindGitHub is the kind of GitHub and GitHub Enterprise servers
+	KindGitHub = "github"
+	// KindGitLab is the kind of GitLab servers
+	KindGitLab = "gitlab"
+	// KindBitbucketServer is the kind of Bitbucket Server servers
+	KindBitbucketServer = "bitbucketserver"
+	// KindBitbucketCloud is the kind of bitbucket.org
+	KindBitbucketCloud = "bitbucketcloud"
+	// KindGitea is the kind of Gitea servers
+	KindGitea = "gitea"
+)
+
+// Kinds the git provider kinds supported by the BDD tests
+var Kinds = []string{KindGitHub, KindGitLab, KindBitbucketServer, KindBitbucketCloud, KindGitea}
+
+// Provider is the subset of git provider operations used by the BDD tests. It is implemented on top of go-scm so
+// that the same tests can run against any supported git server.
+type Provider interface {
+	// Kind returns the kind of git provider, one of Kinds
+	Kind() string
+	// ServerURL returns the URL of the git server
+	ServerURL() string
+	// CurrentUsername returns the username the provider is authenticated as
+	CurrentUsername() string
+	// Client returns the underlying go-scm client for anything not covered by the provider
+	Client() *scm.Client
+	// IsBitbucketServer returns true if the provider is a Bitbucket Server
+	IsBitbucketServer() bool
+
+	GetPullRequest(owner, repo string, number int) (*PullRequest, error)
+	ListOpenPullRequests(owner, repo string) ([]*PullRequest, error)
+	UpdatePullRequestTitle(pr *PullRequest, title string) error
+	ClosePullRequest(pr *PullRequest) error
+	AddPRComment(pr *PullRequest, comment string) error
+	ListPullRequestComments(pr *PullRequest) ([]*scm.Comment, error)
+	ListCommitStatus(owner, repo, sha string) ([]*scm.Status, error)
+
+	ListRepositories(owner string) ([]*scm.Repository, error)
+	DeleteRepository(owner, repo string) error
+
+	AddCollaborator(user, owner, repo string) error
+	ListInvitations() ([]*scm.Invitation, error)
+	AcceptInvitation(id int64) error
+
+	CreateIssue(owner, repo string, issue *scm.IssueInput) (*Issue, error)
+	CreateIssueComment(owner, repo string, number int, comment string) error
+	GetIssue(owner, repo string, number int) (*Issue, error)
+}
+
+// PullRequest is a pull request along with the repository it was created in, as not all go-scm drivers populate the
+// repository of a pull request
+type PullRequest struct {
+	*scm.PullRequest
+	Owner string
+	Repo  string
+}
+
+// Issue is an issue along with the repository it was created in
+type Issue struct {
+	*scm.Issue
+	Owner string
+	Repo  string
+}
+
+// FullName returns the owner/repo name of the repository of the pull request
+func (pr *PullRequest) FullName() string {
+	return scm.Join(pr.Owner, pr.Repo)
+}
+
+type scmProvider struct {
+	kind      string
+	serverURL string
+	username  string
+	client    *scm.Client
+}
+
+// NewProvider creates a new git provider of the given kind for the server using the username and API token
+func NewProvider(kind, serverURL, username, token string) (Provider, error) {
+	kind, err := ResolveKind(kind, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := factory.NewClient(kind, serverURL, token, factory.SetUsername(username))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s git client for %s: %w", kind, serverURL, err)
+	}
+	if username == "" {
+		user, _, err := client.Users.Find(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the current user of %s: %w", serverURL, err)
+		}
+		username = user.Login
+	}
+	return NewProviderForClient(kind, serverURL, username, client), nil
+}
+
+// NewProviderForClient creates a git provider for an existing go-scm client
+func NewProviderForClient(kind, serverURL, username string, client *scm.Client) Provider {
+	return &scmProvider{
+		kind:      kind,
+		serverURL: serverURL,
+		username:  username,
+		client:    client,
+	}
+}
+
+// ResolveKind returns the git provider kind from the given GIT_KIND value, or guesses it from the host of the git
+// provider URL if it is not specified
+func ResolveKind(kind, serverURL string) (string, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	switch kind {
+	case "":
+		break
+	case "stash", "bitbucket-server":
+		return KindBitbucketServer, nil
+	case "bitbucket", "bitbucket-cloud":
+		return KindBitbucketCloud, nil
+	default:
+		if !utils.Contains(Kinds, kind) {
+			return "", utils.InvalidOption("git-kind", kind, Kinds)
+		}
+		return kind, nil
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git provider URL %s: %w", serverURL, err)
+	}
+	host := strings.ToLower(u.Host)
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return KindGitLab, nil
+	case strings.Contains(host, "gitea"):
+		return KindGitea, nil
+	case host == "bitbucket.org" || strings.HasSuffix(host, ".bitbucket.org"):
+		// bitbucket.org needs the bitbucket cloud driver rather than the bitbucket server one
+		return KindBitbucketCloud, nil
+	case strings.Contains(host, "bitbucket"):
+		return KindBitbucketServer, nil
+	}
+	return KindGitHub, nil
+}
+
+func (p *scmProvider) Kind() string {
+	return p.kind
+}
+
+func (p *scmProvider) ServerURL() string {
+	return p.serverURL
+}
+
+func (p *scmProvider) CurrentUsername() string {
+	return p.username
+}
+
+func (p *scmProvider) Client() *scm.Client {
+	return p.client
+}
+
+func (p *scmProvider) IsBitbucketServer() bool {
+	return p.kind == KindBitbucketServer
+}
+
+func (p *scmProvider) GetPullRequest(owner, repo string, number int) (*PullRequest, error) {
+	pr, _, err := p.client.PullRequests.Find(context.TODO(), scm.Join(owner, repo), number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pull request %s/%s/%d: %w", owner, repo, number, err)
+	}
+	return &PullRequest{PullRequest: pr, Owner: owner, Repo: repo}, nil
+}
+
+func (p *scmProvider) ListOpenPullRequests(owner, repo string) ([]*PullRequest, error) {
+	opts := &scm.PullRequestListOptions{
+		Open: true,
+		Size: 100,
+	}
+	prs, _, err := p.client.PullRequests.List(context.TODO(), scm.Join(owner, repo), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open pull requests of %s/%s: %w", owner, repo, err)
+	}
+	answer := make([]*PullRequest, 0, len(prs))
+	for _, pr := range prs {
+		answer = append(answer, &PullRequest{PullRequest: pr, Owner: owner, Repo: repo})
+	}
+	return answer, nil
+}
+
+func (p *scmProvider) UpdatePullRequestTitle(pr *PullRequest, title string) error {
+	input := &scm.PullRequestInput{
+		Title: title,
+	}
+	_, _, err := p.client.PullRequests.Update(context.TODO(), pr.FullName(), pr.Number, input)
+	if err != nil {
+		return fmt.Errorf("failed to update the title of pull request %s/%d: %w", pr.FullName(), pr.Number, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) ClosePullRequest(pr *PullRequest) error {
+	_, err := p.client.PullRequests.Close(context.TODO(), pr.FullName(), pr.Number)
+	if err != nil {
+		return fmt.Errorf("failed to close pull request %s/%d: %w", pr.FullName(), pr.Number, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) AddPRComment(pr *PullRequest, comment string) error {
+	_, _, err := p.client.PullRequests.CreateComment(context.TODO(), pr.FullName(), pr.Number, &scm.CommentInput{Body: comment})
+	if err != nil {
+		return fmt.Errorf("failed to comment on pull request %s/%d: %w", pr.FullName(), pr.Number, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) ListPullRequestComments(pr *PullRequest) ([]*scm.Comment, error) {
+	comments, _, err := p.client.PullRequests.ListComments(context.TODO(), pr.FullName(), pr.Number, &scm.ListOptions{Size: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments of pull request %s/%d: %w", pr.FullName(), pr.Number, err)
+	}
+	return comments, nil
+}
+
+func (p *scmProvider) ListCommitStatus(owner, repo, sha string) ([]*scm.Status, error) {
+	statuses, _, err := p.client.Repositories.ListStatus(context.TODO(), scm.Join(owner, repo), sha, &scm.ListOptions{Size: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commit statuses of %s/%s at %s: %w", owner, repo, sha, err)
+	}
+	return statuses, nil
+}
+
+func (p *scmProvider) ListRepositories(owner string) ([]*scm.Repository, error) {
+	var answer []*scm.Repository
+	opts := &scm.ListOptions{Page: 1, Size: 100}
+	for {
+		var repos []*scm.Repository
+		var res *scm.Response
+		var err error
+		if owner == p.username {
+			repos, res, err = p.client.Repositories.List(context.TODO(), opts)
+		} else {
+			repos, res, err = p.client.Repositories.ListOrganisation(context.TODO(), owner, opts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories of %s: %w", owner, err)
+		}
+		for _, repo := range repos {
+			// the repositories of the user include those of other owners the user collaborates on
+			if strings.EqualFold(repo.Namespace, owner) {
+				answer = append(answer, repo)
+			}
+		}
+		if res == nil || res.Page.Next <= opts.Page || len(repos) == 0 {
+			return answer, nil
+		}
+		opts.Page = res.Page.Next
+	}
+}
+
+func (p *scmProvider) DeleteRepository(owner, repo string) error {
+	_, err := p.client.Repositories.Delete(context.TODO(), scm.Join(owner, repo))
+	if err != nil {
+		return fmt.Errorf("failed to delete repository %s/%s: %w", owner, repo, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) AddCollaborator(user, owner, repo string) error {
+	_, _, _, err := p.client.Repositories.AddCollaborator(context.TODO(), scm.Join(owner, repo), user, "admin")
+	if err != nil {
+		return fmt.Errorf("failed to add %s as a collaborator of %s/%s: %w", user, owner, repo, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) ListInvitations() ([]*scm.Invitation, error) {
+	invites, _, err := p.client.Users.ListInvitations(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations of %s: %w", p.username, err)
+	}
+	return invites, nil
+}
+
+func (p *scmProvider) AcceptInvitation(id int64) error {
+	_, err := p.client.Users.AcceptInvitation(context.TODO(), id)
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation %d for %s: %w", id, p.username, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) CreateIssue(owner, repo string, issue *scm.IssueInput) (*Issue, error) {
+	created, _, err := p.client.Issues.Create(context.TODO(), scm.Join(owner, repo), issue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue in %s/%s: %w", owner, repo, err)
+	}
+	return &Issue{Issue: created, Owner: owner, Repo: repo}, nil
+}
+
+func (p *scmProvider) CreateIssueComment(owner, repo string, number int, comment string) error {
+	_, _, err := p.client.Issues.CreateComment(context.TODO(), scm.Join(owner, repo), number, &scm.CommentInput{Body: comment})
+	if err != nil {
+		return fmt.Errorf("failed to comment on issue %s/%s/%d: %w", owner, repo, number, err)
+	}
+	return nil
+}
+
+func (p *scmProvider) GetIssue(owner, repo string, number int) (*Issue, error) {
+	issue, _, err := p.client.Issues.Find(context.TODO(), scm.Join(owner, repo), number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find issue %s/%s/%d: %w", owner, repo, number, err)
+	}
+	return &Issue{Issue: issue, Owner: owner, Repo: repo}, nil
+}
@@ -0,0 +1,36 @@
+package gits_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveKind(t *testing.T) {
+	testCases := []struct {
+		kind      string
+		serverURL string
+		expected  string
+	}{
+		{"", "https://github.com", gits.KindGitHub},
+		{"", "https://gitlab.com", gits.KindGitLab},
+		{"", "https://gitea.example.com", gits.KindGitea},
+		{"", "https://bitbucket.example.com", gits.KindBitbucketServer},
+		{"", "https://bitbucket.org", gits.KindBitbucketCloud},
+		{"", "https://api.bitbucket.org", gits.KindBitbucketCloud},
+		{"bitbucket", "https://git.example.com", gits.KindBitbucketCloud},
+		{"GitLab", "https://git.example.com", gits.KindGitLab},
+		{"stash", "https://git.example.com", gits.KindBitbucketServer},
+		{"bitbucket-server", "https://git.example.com", gits.KindBitbucketServer},
+	}
+	for _, tc := range testCases {
+		kind, err := gits.ResolveKind(tc.kind, tc.serverURL)
+		require.NoError(t, err, "kind %s url %s", tc.kind, tc.serverURL)
+		assert.Equal(t, tc.expected, kind, "kind %s url %s", tc.kind, tc.serverURL)
+	}
+
+	_, err := gits.ResolveKind("svn", "https://git.example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package parsers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/fakescm"
+	"github.com/jenkins-x/bdd-jx3/test/utils/gits"
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJxCreatePullRequest(t *testing.T) {
+	testCases := []struct {
+		output   string
+		expected parsers.CreatePullRequest
+	}{
+		{
+			output:   "https://github.com/cb-kubecd/bdd-nh/pull/12",
+			expected: parsers.CreatePullRequest{Provider: "github.com", Owner: "cb-kubecd", Repository: "bdd-nh", PullRequestNumber: 12},
+		},
+		{
+			output:   "Created Pull Request: https://gitlab.com/jx3-bdd/bdd-nh/-/merge_requests/3",
+			expected: parsers.CreatePullRequest{Provider: "gitlab.com", Owner: "jx3-bdd", Repository: "bdd-nh", PullRequestNumber: 3},
+		},
+		{
+			output:   "https://bitbucket.example.com/projects/JX/repos/bdd-nh/pull-requests/7",
+			expected: parsers.CreatePullRequest{Provider: "bitbucket.example.com", Owner: "jx", Repository: "bdd-nh", PullRequestNumber: 7},
+		},
+	}
+	for _, tc := range testCases {
+		pr, err := parsers.ParseJxCreatePullRequest(tc.output)
+		require.NoError(t, err, "output %s", tc.output)
+		tc.expected.Url = pr.Url
+		assert.Equal(t, &tc.expected, pr, "output %s", tc.output)
+	}
+
+	_, err := parsers.ParseJxCreatePullRequest("https://github.com/cb-kubecd/bdd-nh")
+	assert.Error(t, err)
+}
+
+func TestParseJxCreatePullRequestFromFullLogOfGitServer(t *testing.T) {
+	s := fakescm.New(t)
+	s.AddUser("bdd-bot", "bot-token")
+	s.AddRepository("cb-kubecd", "bdd-nh")
+	provider, err := gits.NewProvider("", s.URL, "bdd-bot", "bot-token")
+	require.NoError(t, err)
+
+	input := &scm.PullRequestInput{Title: "my change", Head: "my-branch", Base: "master"}
+	created, _, err := provider.Client().PullRequests.Create(context.TODO(), "cb-kubecd/bdd-nh", input)
+	require.NoError(t, err)
+
+	log := "pushed the changes\n" + parsers.CreatedPRLogLinePrefix + created.Link + "\r\n"
+	pr, err := parsers.ParseJxCreatePullRequestFromFullLog(log)
+	require.NoError(t, err)
+	assert.Equal(t, "cb-kubecd", pr.Owner)
+	assert.Equal(t, "bdd-nh", pr.Repository)
+	assert.Equal(t, created.Number, pr.PullRequestNumber)
+
+	found, err := provider.GetPullRequest(pr.Owner, pr.Repository, pr.PullRequestNumber)
+	require.NoError(t, err)
+	assert.Equal(t, "my change", found.Title)
+	assert.Equal(t, "my-branch", found.Source)
+
+	_, err = parsers.ParseJxCreatePullRequestFromFullLog("pushed the changes")
+	assert.Error(t, err)
+}
@@ -0,0 +1,352 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// OutputFormat is the format of the output of a jx command
+type OutputFormat string
+
+const (
+	// OutputFormatTable is the default whitespace aligned table output of jx
+	OutputFormatTable OutputFormat = "table"
+	// OutputFormatJSON is the output of jx when invoked with -o json
+	OutputFormatJSON OutputFormat = "json"
+	// OutputFormatYAML is the output of jx when invoked with -o yaml
+	OutputFormatYAML OutputFormat = "yaml"
+)
+
+// OutputFormats the output formats that jx commands may return
+var OutputFormats = []string{string(OutputFormatTable), string(OutputFormatJSON), string(OutputFormatYAML)}
+
+// DetectOutputFormat detects whether the given jx output is JSON, YAML or a table
+func DetectOutputFormat(s string) OutputFormat {
+	body := stripWarnings(s)
+	if body == "" {
+		return OutputFormatTable
+	}
+	switch body[0] {
+	case '{', '[':
+		if json.Valid([]byte(body)) {
+			return OutputFormatJSON
+		}
+		return OutputFormatTable
+	}
+	firstLine := strings.SplitN(body, "\n", 2)[0]
+	if firstLine == "---" || strings.HasPrefix(firstLine, "- ") {
+		return OutputFormatYAML
+	}
+	// a table header never contains a colon but a YAML mapping key always does
+	if idx := strings.Index(firstLine, ":"); idx > 0 && !strings.Contains(firstLine[:idx], " ") {
+		return OutputFormatYAML
+	}
+	return OutputFormatTable
+}
+
+// ParseApplications parses the output of jx get applications in any of the supported output formats
+func ParseApplications(s string) (map[string]Application, error) {
+	if DetectOutputFormat(s) == OutputFormatTable {
+		return ParseJxGetApplications(s)
+	}
+	items, err := structuredItems(s)
+	if err != nil {
+		return nil, err
+	}
+	answer := make(map[string]Application, 0)
+	for _, item := range items {
+		a := applicationItem{}
+		err = json.Unmarshal(item, &a)
+		if err != nil {
+			return nil, fmt.Errorf("parsing application %s: %w", string(item), err)
+		}
+		app, err := a.toApplication()
+		if err != nil {
+			return nil, err
+		}
+		if app.Name == "" {
+			continue
+		}
+		answer[app.Name] = app
+	}
+	return answer, nil
+}
+
+// ParsePreviews parses the output of jx get previews in any of the supported output formats
+func ParsePreviews(s string) (map[string]Preview, error) {
+	if DetectOutputFormat(s) == OutputFormatTable {
+		return ParseJxGetPreviews(s)
+	}
+	items, err := structuredItems(s)
+	if err != nil {
+		return nil, err
+	}
+	answer := make(map[string]Preview, 0)
+	for _, item := range items {
+		p := previewItem{}
+		err = json.Unmarshal(item, &p)
+		if err != nil {
+			return nil, fmt.Errorf("parsing preview %s: %w", string(item), err)
+		}
+		preview := p.toPreview()
+		if preview.PullRequest == "" {
+			continue
+		}
+		answer[preview.PullRequest] = preview
+	}
+	return answer, nil
+}
+
+// ParseActivities parses the output of jx get activities in any of the supported output formats
+func ParseActivities(s string) (map[string]*Activity, error) {
+	if DetectOutputFormat(s) == OutputFormatTable {
+		return ParseJxGetActivities(s)
+	}
+	items, err := structuredItems(s)
+	if err != nil {
+		return nil, err
+	}
+	answer := make(map[string]*Activity, 0)
+	for _, item := range items {
+		pa := v1.PipelineActivity{}
+		err = json.Unmarshal(item, &pa)
+		if err != nil {
+			return nil, fmt.Errorf("parsing PipelineActivity %s: %w", string(item), err)
+		}
+		activity := ActivityFromPipelineActivity(&pa)
+		answer[fmt.Sprintf("%s #%d", activity.JobName, activity.BuildNumber)] = activity
+	}
+	return answer, nil
+}
+
+// ParseGitServers parses the output of jx get gitserver in any of the supported output formats
+func ParseGitServers(s string) ([]GitServer, error) {
+	if DetectOutputFormat(s) == OutputFormatTable {
+		return ParseJxGetGitServer(s)
+	}
+	items, err := structuredItems(s)
+	if err != nil {
+		return nil, err
+	}
+	answer := make([]GitServer, 0)
+	for _, item := range items {
+		g := GitServer{}
+		err = json.Unmarshal(item, &g)
+		if err != nil {
+			return nil, fmt.Errorf("parsing git server %s: %w", string(item), err)
+		}
+		answer = append(answer, g)
+	}
+	return answer, nil
+}
+
+// ParseQuickstarts parses the output of jx get quickstarts in any of the supported output formats
+func ParseQuickstarts(s string) (map[string]string, error) {
+	if DetectOutputFormat(s) == OutputFormatTable {
+		return ParseJxGetQuickstarts(s)
+	}
+	items, err := structuredItems(s)
+	if err != nil {
+		return nil, err
+	}
+	answer := make(map[string]string)
+	for _, item := range items {
+		q := struct {
+			Name string `json:"name"`
+		}{}
+		err = json.Unmarshal(item, &q)
+		if err != nil {
+			return nil, fmt.Errorf("parsing quickstart %s: %w", string(item), err)
+		}
+		if q.Name != "" {
+			answer[q.Name] = string(item)
+		}
+	}
+	return answer, nil
+}
+
+// ActivityFromPipelineActivity converts a PipelineActivity resource into the Activity returned by the parsers
+func ActivityFromPipelineActivity(pa *v1.PipelineActivity) *Activity {
+	buildNumber, _ := strconv.Atoi(pa.Spec.Build)
+	activity := &Activity{
+		JobName:     pa.Spec.Pipeline,
+		BuildNumber: buildNumber,
+		Status:      string(pa.Spec.Status),
+		Stages:      make([]*Stage, 0),
+	}
+	if activity.JobName == "" {
+		activity.JobName = pa.Name
+	}
+	for _, step := range pa.Spec.Steps {
+		switch {
+		case step.Stage != nil:
+			stage := &Stage{
+				Name:   step.Stage.Name,
+				Status: string(step.Stage.Status),
+			}
+			for _, s := range step.Stage.Steps {
+				stage.Steps = append(stage.Steps, &Step{
+					Name:   s.Name,
+					Status: string(s.Status),
+				})
+			}
+			activity.Stages = append(activity.Stages, stage)
+		case step.Preview != nil:
+			activity.Stages = append(activity.Stages, &Stage{
+				Name:   "Preview",
+				Status: step.Preview.PullRequestURL,
+				Steps: []*Step{
+					{
+						Name:   "Preview Application",
+						Status: step.Preview.ApplicationURL,
+					},
+				},
+			})
+		case step.Promote != nil:
+			activity.Stages = append(activity.Stages, &Stage{
+				Name:   step.Promote.Name,
+				Status: string(step.Promote.Status),
+			})
+		}
+	}
+	return activity
+}
+
+// applicationItem is the structured form of a single application returned by jx get applications -o json
+type applicationItem struct {
+	Name        string `json:"name"`
+	Application string `json:"application"`
+	Version     string `json:"version"`
+	URL         string `json:"url"`
+	Pods        string `json:"pods"`
+	DesiredPods *int   `json:"desiredPods"`
+	RunningPods *int   `json:"runningPods"`
+}
+
+func (a *applicationItem) toApplication() (Application, error) {
+	app := Application{
+		Name:    a.Name,
+		Version: a.Version,
+	}
+	if app.Name == "" {
+		app.Name = a.Application
+	}
+	if a.DesiredPods != nil {
+		app.DesiredPods = *a.DesiredPods
+	}
+	if a.RunningPods != nil {
+		app.RunningPods = *a.RunningPods
+	}
+	if a.Pods != "" {
+		pods := strings.Split(a.Pods, "/")
+		if len(pods) != 2 {
+			return app, fmt.Errorf("cannot parse pods %s of application %s as 1/1", a.Pods, app.Name)
+		}
+		var err error
+		app.RunningPods, err = strconv.Atoi(pods[0])
+		if err != nil {
+			return app, fmt.Errorf("cannot convert running pods %s of application %s to integer: %w", pods[0], app.Name, err)
+		}
+		app.DesiredPods, err = strconv.Atoi(pods[1])
+		if err != nil {
+			return app, fmt.Errorf("cannot convert desired pods %s of application %s to integer: %w", pods[1], app.Name, err)
+		}
+	}
+	if a.URL != "" {
+		// only use URLs with a scheme so that we retry until the ingress is created
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			return app, fmt.Errorf("parsing URL %s of application %s: %w", a.URL, app.Name, err)
+		}
+		if u.Scheme != "" {
+			app.Url = a.URL
+		}
+	}
+	return app, nil
+}
+
+// previewItem is either the flat form of a preview or a jx-preview Preview resource
+type previewItem struct {
+	PullRequest string `json:"pullRequest"`
+	Namespace   string `json:"namespace"`
+	URL         string `json:"url"`
+	Spec        struct {
+		PullRequest struct {
+			URL string `json:"url"`
+		} `json:"pullRequest"`
+		Resources struct {
+			Namespace string `json:"namespace"`
+			URL       string `json:"url"`
+		} `json:"resources"`
+	} `json:"spec"`
+}
+
+func (p *previewItem) toPreview() Preview {
+	preview := Preview{
+		PullRequest: p.PullRequest,
+		Namespace:   p.Namespace,
+		Url:         p.URL,
+	}
+	if preview.PullRequest == "" {
+		preview.PullRequest = p.Spec.PullRequest.URL
+	}
+	if preview.Namespace == "" {
+		preview.Namespace = p.Spec.Resources.Namespace
+	}
+	if preview.Url == "" {
+		preview.Url = p.Spec.Resources.URL
+	}
+	return preview
+}
+
+// structuredItems converts JSON or YAML output into the list of raw JSON items it contains. The output can be a
+// list, a kubernetes style object with items or a single object.
+func structuredItems(s string) ([]json.RawMessage, error) {
+	body := stripWarnings(s)
+	data := []byte(body)
+	if DetectOutputFormat(body) == OutputFormatYAML {
+		var err error
+		data, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("converting YAML to JSON, entire output was %s: %w", s, err)
+		}
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		items := make([]json.RawMessage, 0)
+		err := json.Unmarshal(data, &items)
+		if err != nil {
+			return nil, fmt.Errorf("parsing list, entire output was %s: %w", s, err)
+		}
+		return items, nil
+	}
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, fmt.Errorf("parsing object, entire output was %s: %w", s, err)
+	}
+	if list.Items != nil {
+		return list.Items, nil
+	}
+	return []json.RawMessage{data}, nil
+}
+
+// stripWarnings removes any warning lines that jx prints before the real output
+func stripWarnings(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	answer := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "WARNING") {
+			continue
+		}
+		answer = append(answer, line)
+	}
+	return strings.TrimSpace(strings.Join(answer, "\n"))
+}
@@ -0,0 +1,111 @@
+package parsers_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/parsers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectOutputFormat(t *testing.T) {
+	assert.Equal(t, parsers.OutputFormatJSON, parsers.DetectOutputFormat(`WARNING: no user
+[{"name": "bdd-spring"}]`))
+	assert.Equal(t, parsers.OutputFormatYAML, parsers.DetectOutputFormat(`- name: bdd-spring
+  version: 0.0.1`))
+	assert.Equal(t, parsers.OutputFormatYAML, parsers.DetectOutputFormat(`items:
+- name: bdd-spring`))
+	assert.Equal(t, parsers.OutputFormatTable, parsers.DetectOutputFormat(`APPLICATION           STAGING PODS URL
+bdd-spring-1561456570 0.0.1   1/1  http://bdd-spring-1561456570.jx-staging.35.205.242.160.nip.io`))
+}
+
+func TestParseApplicationsJSON(t *testing.T) {
+	out := `WARNING: could not find the current user name user: Current not implemented on linux/amd64
+[
+  {"name": "bdd-spring-1561456570", "version": "0.0.1", "pods": "1/2", "url": "http://bdd-spring-1561456570.jx-staging.35.205.242.160.nip.io"},
+  {"name": "bdd-gh-1561456570", "version": "0.0.2", "url": "1/1"}
+]`
+	applications, err := parsers.ParseApplications(out)
+	require.NoError(t, err)
+	require.Len(t, applications, 2)
+
+	app := applications["bdd-spring-1561456570"]
+	assert.Equal(t, "0.0.1", app.Version)
+	assert.Equal(t, "http://bdd-spring-1561456570.jx-staging.35.205.242.160.nip.io", app.Url)
+	assert.Equal(t, 1, app.RunningPods)
+	assert.Equal(t, 2, app.DesiredPods)
+
+	assert.Empty(t, applications["bdd-gh-1561456570"].Url, "should ignore URLs without a scheme")
+}
+
+func TestParseApplicationsFallsBackToTable(t *testing.T) {
+	out := `APPLICATION           PRODUCTION PODS URL
+bdd-spring-1617112975 0.0.1           http://bdd-spring-1617112975-myapps.34.123.71.97.nip.io`
+	applications, err := parsers.ParseApplications(out)
+	require.NoError(t, err)
+	assert.Equal(t, "http://bdd-spring-1617112975-myapps.34.123.71.97.nip.io", applications["bdd-spring-1617112975"].Url)
+}
+
+func TestParsePreviewsYAML(t *testing.T) {
+	out := `apiVersion: v1
+items:
+- apiVersion: preview.jenkins.io/v1alpha1
+  kind: Preview
+  metadata:
+    name: cb-kubecd-bdd-gh-1601660823-pr-1
+  spec:
+    pullRequest:
+      url: https://github.com/cb-kubecd/bdd-gh-1601660823/pull/1
+    resources:
+      namespace: jx-cb-kubecd-bdd-gh-1601660823-pr-1
+      url: http://bdd-gh-1601660823-jx.35.184.30.41.nip.io
+kind: List`
+	previews, err := parsers.ParsePreviews(out)
+	require.NoError(t, err)
+	require.Len(t, previews, 1)
+
+	preview := previews["https://github.com/cb-kubecd/bdd-gh-1601660823/pull/1"]
+	assert.Equal(t, "jx-cb-kubecd-bdd-gh-1601660823-pr-1", preview.Namespace)
+	assert.Equal(t, "http://bdd-gh-1601660823-jx.35.184.30.41.nip.io", preview.Url)
+}
+
+func TestParseActivitiesJSON(t *testing.T) {
+	out := `{
+  "kind": "PipelineActivityList",
+  "items": [
+    {
+      "metadata": {"name": "cb-kubecd-bdd-gh-1602257801-pr-1-2"},
+      "spec": {
+        "pipeline": "cb-kubecd/bdd-gh-1602257801/PR-1",
+        "build": "2",
+        "status": "Succeeded",
+        "steps": [
+          {"kind": "Stage", "stage": {"name": "from build pack", "status": "Succeeded", "steps": [{"name": "Git Clone", "status": "Succeeded"}]}},
+          {"kind": "Preview", "preview": {"pullRequestURL": "https://github.com/cb-kubecd/bdd-gh-1602257801/pull/1", "applicationURL": "http://bdd-gh-1602257801-jx.35.223.52.156.nip.io"}}
+        ]
+      }
+    }
+  ]
+}`
+	activities, err := parsers.ParseActivities(out)
+	require.NoError(t, err)
+	require.Len(t, activities, 1)
+
+	key := "cb-kubecd/bdd-gh-1602257801/PR-1 #2"
+	activity := activities[key]
+	require.NotNil(t, activity, "no activity found for key %s", key)
+	assert.Equal(t, 2, activity.BuildNumber)
+	assert.Equal(t, "Succeeded", activity.Status)
+	require.Len(t, activity.Stages, 2)
+	assert.Equal(t, "Git Clone", activity.Stages[0].Steps[0].Name)
+	assert.Equal(t, "http://bdd-gh-1602257801-jx.35.223.52.156.nip.io", activity.Stages[1].Steps[0].Status)
+}
+
+func TestParseGitServersJSON(t *testing.T) {
+	out := `[{"name": "GitHub", "kind": "github", "url": "https://github.com"}]`
+	gitServers, err := parsers.ParseGitServers(out)
+	require.NoError(t, err)
+	require.Len(t, gitServers, 1)
+	assert.Equal(t, "https://github.com", gitServers[0].Url)
+	assert.Equal(t, "github", gitServers[0].Kind)
+}
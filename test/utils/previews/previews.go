@@ -0,0 +1,166 @@
+package previews
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// HelmOwnerLabel is the label helm puts on the secrets it stores its releases in
+	HelmOwnerLabel = "owner"
+	// HelmNameLabel is the label of the name of the release on the secrets helm stores its releases in
+	HelmNameLabel = "name"
+)
+
+var (
+	// GroupVersionResource is the jx-preview Preview resource
+	GroupVersionResource = schema.GroupVersionResource{Group: "preview.jenkins.io", Version: "v1alpha1", Resource: "previews"}
+
+	// PollInterval is how often WaitForRemoval checks what is left of a preview
+	PollInterval = 10 * time.Second
+)
+
+// Preview is the part of a jx-preview Preview resource the tests look at
+type Preview struct {
+	// Name and Namespace are of the Preview resource itself
+	Name      string
+	Namespace string
+	// PullRequestURL, PullRequestNumber, Owner and Repository are of the pull request the preview was created for
+	PullRequestURL    string
+	PullRequestNumber int
+	Owner             string
+	Repository        string
+	// PreviewNamespace is the namespace the preview is deployed into
+	PreviewNamespace string
+	// URL is the URL of the preview application
+	URL string
+}
+
+// previewResource is the jx-preview Preview resource as JSON
+type previewResource struct {
+	Spec struct {
+		PullRequest struct {
+			Number     int    `json:"number"`
+			Owner      string `json:"owner"`
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+		} `json:"pullRequest"`
+		Resources struct {
+			Namespace string `json:"namespace"`
+			URL       string `json:"url"`
+		} `json:"resources"`
+	} `json:"spec"`
+}
+
+// FromUnstructured converts a Preview resource
+func FromUnstructured(u *unstructured.Unstructured) (*Preview, error) {
+	r := &previewResource{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert preview %s: %w", u.GetName(), err)
+	}
+	return &Preview{
+		Name:              u.GetName(),
+		Namespace:         u.GetNamespace(),
+		PullRequestURL:    r.Spec.PullRequest.URL,
+		PullRequestNumber: r.Spec.PullRequest.Number,
+		Owner:             r.Spec.PullRequest.Owner,
+		Repository:        r.Spec.PullRequest.Repository,
+		PreviewNamespace:  r.Spec.Resources.Namespace,
+		URL:               r.Spec.Resources.URL,
+	}, nil
+}
+
+// Find returns the preview of the pull request of the repository in the namespace or nil if there is none yet. The
+// owner and repository are compared ignoring case as bitbucket server uses upper case project keys.
+func Find(ctx context.Context, dynamicClient dynamic.Interface, ns string, owner string, repository string, number int) (*Preview, error) {
+	list, err := dynamicClient.Resource(GroupVersionResource).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list previews in namespace %s: %w", ns, err)
+	}
+	for i := range list.Items {
+		p, err := FromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if p.PullRequestNumber == number && strings.EqualFold(p.Owner, owner) && strings.EqualFold(p.Repository, repository) {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Remaining returns what is left of the preview: the Preview resource, its namespace and the helm releases in it
+func Remaining(ctx context.Context, dynamicClient dynamic.Interface, kubeClient kubernetes.Interface, p *Preview) ([]string, error) {
+	var answer []string
+	_, err := dynamicClient.Resource(GroupVersionResource).Namespace(p.Namespace).Get(ctx, p.Name, metav1.GetOptions{})
+	if err == nil {
+		answer = append(answer, fmt.Sprintf("Preview %s in namespace %s", p.Name, p.Namespace))
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get preview %s in namespace %s: %w", p.Name, p.Namespace, err)
+	}
+	if p.PreviewNamespace == "" {
+		return answer, nil
+	}
+
+	ns, err := kubeClient.CoreV1().Namespaces().Get(ctx, p.PreviewNamespace, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return answer, nil
+		}
+		return nil, fmt.Errorf("failed to get namespace %s: %w", p.PreviewNamespace, err)
+	}
+	if ns.Status.Phase != "" {
+		answer = append(answer, fmt.Sprintf("namespace %s in phase %s", ns.Name, ns.Status.Phase))
+	} else {
+		answer = append(answer, "namespace "+ns.Name)
+	}
+
+	secrets, err := kubeClient.CoreV1().Secrets(p.PreviewNamespace).List(ctx, metav1.ListOptions{LabelSelector: HelmOwnerLabel + "=helm"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the helm releases in namespace %s: %w", p.PreviewNamespace, err)
+	}
+	var releases []string
+	for _, s := range secrets.Items {
+		name := s.Labels[HelmNameLabel]
+		if name != "" && !utils.Contains(releases, name) {
+			releases = append(releases, name)
+		}
+	}
+	for _, name := range releases {
+		answer = append(answer, fmt.Sprintf("helm release %s in namespace %s", name, p.PreviewNamespace))
+	}
+	return answer, nil
+}
+
+// WaitForRemoval waits for the Preview resource, its namespace and the helm releases in it to be garbage collected,
+// such as once its pull request is merged or closed. An error listing what is left is returned if they are not all
+// removed within the timeout.
+func WaitForRemoval(ctx context.Context, dynamicClient dynamic.Interface, kubeClient kubernetes.Interface, p *Preview, timeout time.Duration) error {
+	var remaining []string
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, PollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		remaining, lastErr = Remaining(ctx, dynamicClient, kubeClient, p)
+		return lastErr == nil && len(remaining) == 0, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if lastErr != nil {
+		return errors.Join(fmt.Errorf("preview of %s was not removed within %s", p.PullRequestURL, timeout.String()), lastErr)
+	}
+	return fmt.Errorf("preview of %s was not removed within %s, still left: %s", p.PullRequestURL, timeout.String(), strings.Join(remaining, ", "))
+}
@@ -0,0 +1,140 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	ns               = "jx"
+	previewNamespace = "jx-cb-kubecd-bdd-gh-pr-1"
+)
+
+func newPreview(name string, owner string, repository string, number int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "preview.jenkins.io/v1alpha1",
+		"kind":       "Preview",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": ns,
+		},
+		"spec": map[string]interface{}{
+			"pullRequest": map[string]interface{}{
+				"number":     number,
+				"owner":      owner,
+				"repository": repository,
+				"url":        "https://github.com/" + owner + "/" + repository + "/pull/1",
+			},
+			"resources": map[string]interface{}{
+				"namespace": previewNamespace,
+				"url":       "http://bdd-gh-jx-cb-kubecd-bdd-gh-pr-1.1.2.3.4.nip.io",
+			},
+		},
+	}}
+}
+
+func newDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{previews.GroupVersionResource: "PreviewList"}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+func newHelmRelease(name string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1." + name + ".v1",
+			Namespace: previewNamespace,
+			Labels:    map[string]string{previews.HelmOwnerLabel: "helm", previews.HelmNameLabel: name},
+		},
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := context.TODO()
+	dynamicClient := newDynamicClient(
+		newPreview("bdd-nh-pr-1", "cb-kubecd", "bdd-nh", 1),
+		newPreview("bdd-gh-pr-1", "cb-kubecd", "bdd-gh", 1),
+	)
+
+	p, err := previews.Find(ctx, dynamicClient, ns, "CB-KUBECD", "bdd-gh", 1)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, &previews.Preview{
+		Name:              "bdd-gh-pr-1",
+		Namespace:         ns,
+		PullRequestURL:    "https://github.com/cb-kubecd/bdd-gh/pull/1",
+		PullRequestNumber: 1,
+		Owner:             "cb-kubecd",
+		Repository:        "bdd-gh",
+		PreviewNamespace:  previewNamespace,
+		URL:               "http://bdd-gh-jx-cb-kubecd-bdd-gh-pr-1.1.2.3.4.nip.io",
+	}, p)
+
+	p, err = previews.Find(ctx, dynamicClient, ns, "cb-kubecd", "bdd-gh", 2)
+	require.NoError(t, err)
+	assert.Nil(t, p, "there is no preview of the pull request yet")
+}
+
+func TestRemaining(t *testing.T) {
+	ctx := context.TODO()
+	preview := newPreview("bdd-gh-pr-1", "cb-kubecd", "bdd-gh", 1)
+	p, err := previews.FromUnstructured(preview)
+	require.NoError(t, err)
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: previewNamespace},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+	}
+	kubeClient := fake.NewSimpleClientset(namespace, newHelmRelease("bdd-gh"), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bdd-gh-token", Namespace: previewNamespace},
+	})
+	remaining, err := previews.Remaining(ctx, newDynamicClient(preview), kubeClient, p)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Preview bdd-gh-pr-1 in namespace jx",
+		"namespace jx-cb-kubecd-bdd-gh-pr-1 in phase Terminating",
+		"helm release bdd-gh in namespace jx-cb-kubecd-bdd-gh-pr-1",
+	}, remaining)
+
+	remaining, err = previews.Remaining(ctx, newDynamicClient(), fake.NewSimpleClientset(), p)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestWaitForRemoval(t *testing.T) {
+	oldPollInterval := previews.PollInterval
+	previews.PollInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		previews.PollInterval = oldPollInterval
+	})
+
+	ctx := context.TODO()
+	preview := newPreview("bdd-gh-pr-1", "cb-kubecd", "bdd-gh", 1)
+	p, err := previews.FromUnstructured(preview)
+	require.NoError(t, err)
+	dynamicClient := newDynamicClient(preview)
+	kubeClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: previewNamespace}}, newHelmRelease("bdd-gh"))
+
+	err = previews.WaitForRemoval(ctx, dynamicClient, kubeClient, p, 100*time.Millisecond)
+	require.Error(t, err)
+	assert.Equal(t, "preview of https://github.com/cb-kubecd/bdd-gh/pull/1 was not removed within 100ms, still left: Preview bdd-gh-pr-1 in namespace jx, namespace jx-cb-kubecd-bdd-gh-pr-1, helm release bdd-gh in namespace jx-cb-kubecd-bdd-gh-pr-1", err.Error())
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = dynamicClient.Resource(previews.GroupVersionResource).Namespace(ns).Delete(ctx, "bdd-gh-pr-1", metav1.DeleteOptions{})
+		_ = kubeClient.CoreV1().Namespaces().Delete(ctx, previewNamespace, metav1.DeleteOptions{})
+	}()
+	err = previews.WaitForRemoval(ctx, dynamicClient, kubeClient, p, 10*time.Second)
+	assert.NoError(t, err)
+}
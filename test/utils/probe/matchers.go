@@ -0,0 +1,212 @@
+package probe
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Matcher checks a response returning an error describing the mismatch
+type Matcher func(r *Response) error
+
+// Status matches the status code of the response
+func Status(code int) Matcher {
+	return func(r *Response) error {
+		if r.StatusCode != code {
+			return fmt.Errorf("expected status %d but got %d", code, r.StatusCode)
+		}
+		return nil
+	}
+}
+
+// BodyContains matches a response whose body contains the text
+func BodyContains(text string) Matcher {
+	return func(r *Response) error {
+		if !strings.Contains(string(r.Body), text) {
+			return fmt.Errorf("expected the body to contain %q", text)
+		}
+		return nil
+	}
+}
+
+// BodyNotContains matches a response whose body does not contain the text, such as the error page of a framework
+func BodyNotContains(text string) Matcher {
+	return func(r *Response) error {
+		if strings.Contains(string(r.Body), text) {
+			return fmt.Errorf("expected the body not to contain %q", text)
+		}
+		return nil
+	}
+}
+
+// BodyMatches matches a response whose body matches the regular expression
+func BodyMatches(pattern string) Matcher {
+	re, err := regexp.Compile(pattern)
+	return func(r *Response) error {
+		if err != nil {
+			return fmt.Errorf("invalid body pattern %q: %w", pattern, err)
+		}
+		if !re.Match(r.Body) {
+			return fmt.Errorf("expected the body to match %q", pattern)
+		}
+		return nil
+	}
+}
+
+// Header matches a response which has the header with a value matching the regular expression, or any value if the
+// pattern is empty
+func Header(name string, pattern string) Matcher {
+	re, err := regexp.Compile(pattern)
+	return func(r *Response) error {
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q of header %s: %w", pattern, name, err)
+		}
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return fmt.Errorf("expected the header %s", name)
+		}
+		for _, v := range values {
+			if re.MatchString(v) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected the header %s to match %q but got %q", name, pattern, strings.Join(values, ", "))
+	}
+}
+
+// JSONPath matches a JSON response whose value at the path equals the expected value. The path is a dot separated
+// list of object keys and array indexes such as status or items[0].metadata.name. Numbers are compared by value so
+// an int can be expected for a JSON number.
+func JSONPath(path string, expected any) Matcher {
+	return func(r *Response) error {
+		var doc any
+		err := json.Unmarshal(r.Body, &doc)
+		if err != nil {
+			return fmt.Errorf("expected a JSON body: %w", err)
+		}
+		actual, err := lookup(doc, path)
+		if err != nil {
+			return err
+		}
+		if !jsonEqual(actual, expected) {
+			return fmt.Errorf("expected %s to be %v but got %v", path, expected, actual)
+		}
+		return nil
+	}
+}
+
+// RedirectsTo matches a response which was redirected to a URL starting with the prefix
+func RedirectsTo(prefix string) Matcher {
+	return func(r *Response) error {
+		if len(r.Redirects) == 0 {
+			return fmt.Errorf("expected a redirect to %s", prefix)
+		}
+		if !strings.HasPrefix(r.FinalURL(), prefix) {
+			return fmt.Errorf("expected a redirect to %s but got %s", prefix, r.FinalURL())
+		}
+		return nil
+	}
+}
+
+// NoRedirect matches a response which was not redirected
+func NoRedirect() Matcher {
+	return func(r *Response) error {
+		if len(r.Redirects) > 0 {
+			return fmt.Errorf("expected no redirect but got %s", strings.Join(r.Redirects, " -> "))
+		}
+		return nil
+	}
+}
+
+// ValidCertificate matches a response served over TLS with a certificate which is trusted by the system roots, is
+// valid for the host and does not expire for at least minValidity. It verifies the certificate even if the probe
+// skips verifying TLS.
+func ValidCertificate(minValidity time.Duration) Matcher {
+	return ValidCertificateWithRoots(minValidity, nil)
+}
+
+// ValidCertificateWithRoots is like ValidCertificate but trusts the given roots instead of the system ones, such as
+// the CA of a cluster issuing its own certificates
+func ValidCertificateWithRoots(minValidity time.Duration, roots *x509.CertPool) Matcher {
+	return func(r *Response) error {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return fmt.Errorf("expected %s to be served over TLS", r.FinalURL())
+		}
+		u, err := url.Parse(r.FinalURL())
+		if err != nil {
+			return err
+		}
+		leaf := r.TLS.PeerCertificates[0]
+		intermediates := x509.NewCertPool()
+		for _, c := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:       u.Hostname(),
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid certificate for %s: %w", u.Hostname(), err)
+		}
+		if remaining := time.Until(leaf.NotAfter); remaining < minValidity {
+			return fmt.Errorf("the certificate for %s expires on %s, in less than %s", u.Hostname(), leaf.NotAfter.Format(time.RFC3339), minValidity)
+		}
+		return nil
+	}
+}
+
+var indexPattern = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// lookup returns the value at the path in the JSON document
+func lookup(doc any, path string) (any, error) {
+	value := doc
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".") {
+		m := indexPattern.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("invalid JSON path %s", path)
+		}
+		if m[1] != "" {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an object at %s in %s", m[1], path)
+			}
+			value, ok = object[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("expected %s to have %s", path, m[1])
+			}
+		}
+		for _, index := range strings.FieldsFunc(m[2], func(r rune) bool { return r == '[' || r == ']' }) {
+			i, _ := strconv.Atoi(index)
+			array, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an array at %s in %s", part, path)
+			}
+			if i >= len(array) {
+				return nil, fmt.Errorf("expected %s to have at least %d items", part, i+1)
+			}
+			value = array[i]
+		}
+	}
+	return value, nil
+}
+
+// jsonEqual compares a value decoded from JSON with a Go value by encoding and decoding the latter
+func jsonEqual(actual any, expected any) bool {
+	data, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var normalized any
+	err = json.Unmarshal(data, &normalized)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(actual, normalized)
+}
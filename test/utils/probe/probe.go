@@ -0,0 +1,167 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBodySize is how much of a response body is read, which is plenty for the pages of the quickstarts
+	maxBodySize = 1 << 20
+	// snippetSize is how much of a response body is included in errors and logs
+	snippetSize = 512
+	// maxRedirects is how many redirects are followed before giving up, like the default of net/http
+	maxRedirects = 10
+)
+
+// Options are the settings of the requests made by a Probe
+type Options struct {
+	// Timeout is the timeout of each request
+	Timeout time.Duration
+	// InsecureSkipVerify skips verifying the TLS certificates of the URLs, ValidCertificate still checks them
+	InsecureSkipVerify bool
+	// Username and Password are sent as basic auth if the password is set
+	Username string
+	Password string
+	// BearerToken is sent as an Authorization bearer token if set, instead of basic auth
+	BearerToken string
+}
+
+// Probe requests URLs and checks the responses with matchers. It reuses one client so the connections are kept
+// alive between the retries of a check.
+type Probe struct {
+	options Options
+	client  *http.Client
+}
+
+// Response is a response of a URL with the redirects that were followed to get it
+type Response struct {
+	// URL is the URL which was requested
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Redirects are the URLs which were redirected to, in order, the last one being the URL of the response
+	Redirects []string
+	// TLS is the state of the TLS connection of the response, if the URL is https
+	TLS *tls.ConnectionState
+}
+
+// New creates a Probe with the given options
+func New(o Options) *Probe {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify, // #nosec G402 -- test clusters often use self signed certificates
+	}
+	p := &Probe{options: o}
+	p.client = &http.Client{
+		Timeout:   o.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			// the credentials are only for the host of the original URL
+			if req.URL.Host == via[0].URL.Host {
+				p.authorize(req)
+			}
+			return nil
+		},
+	}
+	return p
+}
+
+// Get requests the URL following any redirects
+func (p *Probe) Get(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of %s: %w", url, err)
+	}
+	answer := &Response{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		TLS:        resp.TLS,
+	}
+	var redirects []string
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		redirects = append([]string{r.URL.String()}, redirects...)
+	}
+	answer.Redirects = redirects
+	return answer, nil
+}
+
+// Check requests the URL and returns the response and a *MismatchError if it does not satisfy all the matchers
+func (p *Probe) Check(ctx context.Context, url string, matchers ...Matcher) (*Response, error) {
+	resp, err := p.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, m := range matchers {
+		if err := m(resp); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return resp, &MismatchError{Response: resp, Err: errors.Join(errs...)}
+	}
+	return resp, nil
+}
+
+func (p *Probe) authorize(req *http.Request) {
+	switch {
+	case p.options.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.options.BearerToken)
+	case p.options.Password != "":
+		req.SetBasicAuth(p.options.Username, p.options.Password)
+	}
+}
+
+// FinalURL returns the URL of the response after following any redirects
+func (r *Response) FinalURL() string {
+	if len(r.Redirects) > 0 {
+		return r.Redirects[len(r.Redirects)-1]
+	}
+	return r.URL
+}
+
+// Snippet returns the start of the body of the response on a single line, for logs and errors
+func (r *Response) Snippet() string {
+	text := strings.Join(strings.Fields(string(r.Body)), " ")
+	if len(text) > snippetSize {
+		text = text[:snippetSize] + "..."
+	}
+	return text
+}
+
+// MismatchError is returned by Check when a response does not satisfy the matchers
+type MismatchError struct {
+	Response *Response
+	Err      error
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("unexpected response from %s: %s\nstatus %d, body: %s", e.Response.URL, strings.ReplaceAll(e.Err.Error(), "\n", ", "), e.Response.StatusCode, e.Response.Snippet())
+}
+
+func (e *MismatchError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,120 @@
+package probe_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/probe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, tls bool) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello from:  Jenkins X golang http example")
+	})
+	mux.HandleFunc("/actuator/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.spring-boot.actuator.v3+json")
+		fmt.Fprint(w, `{"status":"UP","groups":["liveness","readiness"],"components":{"diskSpace":{"details":{"threshold":10485760}}}}`)
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if r.Header.Get("Authorization") == "Bearer s3cret" || (ok && user == "admin" && password == "s3cret") {
+			fmt.Fprint(w, "welcome")
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "<html><body><h1>Whitelabel Error Page</h1>"+strings.Repeat("x", 1000)+"</body></html>")
+	})
+	var server *httptest.Server
+	if tls {
+		server = httptest.NewTLSServer(mux)
+	} else {
+		server = httptest.NewServer(mux)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheck(t *testing.T) {
+	server := newServer(t, false)
+	p := probe.New(probe.Options{Timeout: 5 * time.Second})
+	ctx := context.TODO()
+
+	resp, err := p.Check(ctx, server.URL, probe.Status(200), probe.BodyContains("Hello from:"), probe.BodyMatches(`golang\s+http`), probe.NoRedirect())
+	require.NoError(t, err)
+	assert.Equal(t, "Hello from: Jenkins X golang http example", resp.Snippet())
+
+	_, err = p.Check(ctx, server.URL+"/actuator/health",
+		probe.Status(200),
+		probe.Header("Content-Type", `json`),
+		probe.JSONPath("status", "UP"),
+		probe.JSONPath("groups[1]", "readiness"),
+		probe.JSONPath("$.components.diskSpace.details.threshold", 10485760),
+	)
+	require.NoError(t, err)
+
+	_, err = p.Check(ctx, server.URL+"/actuator/health", probe.JSONPath("status", "DOWN"), probe.JSONPath("groups[2]", "startup"), probe.Header("X-Frame-Options", ""))
+	require.Error(t, err)
+	var mismatch *probe.MismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, 200, mismatch.Response.StatusCode)
+	assert.Contains(t, err.Error(), "expected status to be DOWN but got UP, expected groups[2] to have at least 3 items, expected the header X-Frame-Options")
+	assert.Contains(t, err.Error(), `status 200, body: {"status":"UP"`)
+
+	_, err = p.Check(ctx, server.URL+"/old", probe.Status(200), probe.RedirectsTo(server.URL+"/login"), probe.BodyNotContains("Whitelabel Error Page"))
+	require.Error(t, err, "no credentials should be sent by default")
+	assert.Contains(t, err.Error(), "expected status 200 but got 401")
+	assert.Contains(t, err.Error(), "expected the body not to contain \"Whitelabel Error Page\"")
+	assert.Contains(t, err.Error(), "...", "the body should be truncated")
+	assert.NotContains(t, err.Error(), "expected a redirect")
+}
+
+func TestCheckSendsCredentials(t *testing.T) {
+	server := newServer(t, false)
+	ctx := context.TODO()
+
+	basic := probe.New(probe.Options{Username: "admin", Password: "s3cret"})
+	resp, err := basic.Check(ctx, server.URL+"/old", probe.Status(200), probe.RedirectsTo(server.URL+"/login"), probe.BodyContains("welcome"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{server.URL + "/login"}, resp.Redirects)
+	assert.Equal(t, server.URL+"/login", resp.FinalURL())
+
+	bearer := probe.New(probe.Options{BearerToken: "s3cret"})
+	_, err = bearer.Check(ctx, server.URL+"/login", probe.Status(200))
+	require.NoError(t, err)
+}
+
+func TestValidCertificate(t *testing.T) {
+	server := newServer(t, true)
+	ctx := context.TODO()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	p := probe.New(probe.Options{InsecureSkipVerify: true})
+	_, err := p.Check(ctx, server.URL, probe.ValidCertificate(0))
+	require.Error(t, err, "the certificate of the test server should not be trusted by the system roots")
+	assert.Contains(t, err.Error(), "invalid certificate for 127.0.0.1")
+
+	_, err = p.Check(ctx, server.URL, probe.ValidCertificateWithRoots(24*time.Hour, roots))
+	require.NoError(t, err)
+
+	_, err = p.Check(ctx, server.URL, probe.ValidCertificateWithRoots(200*365*24*time.Hour, roots))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the certificate for 127.0.0.1 expires on ")
+
+	_, err = p.Check(ctx, newServer(t, false).URL, probe.ValidCertificate(0))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "to be served over TLS")
+}
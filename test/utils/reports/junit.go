@@ -0,0 +1,152 @@
+package reports
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// junitTestSuite is a JUnit testsuite like the one ginkgo writes, with the properties of the environment
+type junitTestSuite struct {
+	XMLName    xml.Name         `xml:"testsuite"`
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       float64          `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	// FlakyFailures and RerunFailures are the failures of the attempts before the last one, in the format surefire
+	// writes for reruns which Jenkins reports as flaky tests
+	FlakyFailures []junitFailure `xml:"flakyFailure,omitempty"`
+	RerunFailures []junitFailure `xml:"rerunFailure,omitempty"`
+	SystemOut     string         `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// WriteJUnit writes the result as a JUnit testsuite with the properties of the suite and the application and
+// commands of each spec in the system-out of its testcase
+func WriteJUnit(w io.Writer, result *Result) error {
+	name := result.Description
+	if name == "" {
+		name = result.Suite
+	}
+	suite := &junitTestSuite{
+		Name:     name,
+		Tests:    len(result.Specs),
+		Failures: result.Failed,
+		Skipped:  result.Skipped + result.Pending + result.Quarantined,
+		Time:     result.Duration.Duration().Seconds(),
+	}
+	if len(result.Properties) > 0 {
+		suite.Properties = &junitProperties{}
+		for _, p := range result.Properties {
+			suite.Properties.Properties = append(suite.Properties.Properties, junitProperty{Name: p.Name, Value: p.Value})
+		}
+	}
+	for _, s := range result.Specs {
+		testCase := junitTestCase{
+			Name:      s.Name,
+			ClassName: name,
+			Time:      s.Duration.Duration().Seconds(),
+			SystemOut: junitSystemOut(s),
+		}
+		for _, f := range s.Retries {
+			retry := junitFailure{Type: StateFailed, Message: junitFailureMessage(f)}
+			if s.Failed() {
+				testCase.RerunFailures = append(testCase.RerunFailures, retry)
+			} else {
+				testCase.FlakyFailures = append(testCase.FlakyFailures, retry)
+			}
+		}
+		switch {
+		case s.Quarantined:
+			// quarantined failures are reported without failing the build
+			testCase.Skipped = &junitSkipped{Message: "quarantined: " + firstLine(s.Failure)}
+			testCase.SystemOut = strings.TrimSpace(testCase.SystemOut + "\n\nquarantined failure:\n" + junitFailureMessage(s.Failure))
+		case s.Failed():
+			testCase.Failure = &junitFailure{Type: s.State, Message: junitFailureMessage(s.Failure)}
+		case s.State == StateSkipped || s.State == StatePending:
+			testCase.Skipped = &junitSkipped{}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", "    ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitFailureMessage(f *Failure) string {
+	if f == nil {
+		return ""
+	}
+	message := f.Message
+	if f.Location != "" {
+		message += "\n" + f.Location
+	}
+	return message
+}
+
+func firstLine(f *Failure) string {
+	if f == nil {
+		return ""
+	}
+	return strings.SplitN(strings.TrimSpace(f.Message), "\n", 2)[0]
+}
+
+// junitSystemOut describes the application and the commands run by the spec along with any output ginkgo captured
+func junitSystemOut(s *Spec) string {
+	buf := &strings.Builder{}
+	if s.Application != "" {
+		fmt.Fprintf(buf, "application: %s\n", s.Application)
+	}
+	commands := s.AllCommands()
+	if len(commands) > 0 {
+		buf.WriteString("commands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(buf, "  %s (exit %d in %s)\n", strings.TrimSpace(c.Command+" "+strings.Join(c.Args, " ")), c.ExitCode, formatDuration(c.Duration))
+		}
+	}
+	if s.Output != "" {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(s.Output)
+	}
+	return buf.String()
+}
@@ -0,0 +1,150 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+// PhaseMetric is the name of the OpenMetrics gauge of the phase durations
+const PhaseMetric = "bdd_phase_duration_seconds"
+
+// Phase is how long a phase of the Jenkins X workflow took, such as the first release build or the promotion to
+// staging
+type Phase struct {
+	Name string `json:"name"`
+	// Spec is the spec the phase was part of
+	Spec     string            `json:"spec,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Start    time.Time         `json:"start"`
+	Duration config.Duration   `json:"duration"`
+	Failed   bool              `json:"failed,omitempty"`
+}
+
+// BeginPhase starts a phase of the running spec which is ended by calling the returned function. Phases are not
+// nested so beginning a phase which is already running records nothing.
+func (r *Recorder) BeginPhase(name string, labels map[string]string) func(failed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	noop := func(bool) {}
+	if r.spec == nil || r.phases[name] {
+		return noop
+	}
+	if r.phases == nil {
+		r.phases = map[string]bool{}
+	}
+	r.phases[name] = true
+	spec := r.spec
+	phase := &Phase{Name: name, Spec: spec.Name, Labels: labels, Start: r.now()}
+	return func(failed bool) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.spec != spec || !r.phases[name] {
+			return
+		}
+		delete(r.phases, name)
+		phase.Duration = config.Duration(r.now().Sub(phase.Start))
+		phase.Failed = failed
+		r.result.Phases = append(r.result.Phases, phase)
+	}
+}
+
+// BeginPhase starts a phase of the spec which is running, if a suite is being recorded
+func BeginPhase(name string, labels map[string]string) func(failed bool) {
+	r := Current()
+	if r == nil {
+		return func(bool) {}
+	}
+	return r.BeginPhase(name, labels)
+}
+
+// WriteOpenMetrics writes the durations of the phases as an OpenMetrics gauge labelled by the phase, the labels of
+// the phase and whether it succeeded. The latest duration wins when a phase with the same labels ran more than once.
+func WriteOpenMetrics(w io.Writer, result *Result) error {
+	samples := map[string]float64{}
+	for _, p := range result.Phases {
+		labels := map[string]string{"phase": p.Name, "result": "succeeded"}
+		if p.Failed {
+			labels["result"] = "failed"
+		}
+		for k, v := range p.Labels {
+			labels[k] = v
+		}
+		samples[formatLabels(labels)] = p.Duration.Duration().Seconds()
+	}
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", PhaseMetric)
+	fmt.Fprintf(buf, "# UNIT %s seconds\n", PhaseMetric)
+	fmt.Fprintf(buf, "# HELP %s How long each phase of the Jenkins X workflow took.\n", PhaseMetric)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s%s %s\n", PhaseMetric, k, strconv.FormatFloat(samples[k], 'f', -1, 64))
+	}
+	buf.WriteString("# EOF\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// formatLabels formats the labels sorted by name with their values escaped
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[name])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// PushOpenMetrics pushes the durations of the phases to a Prometheus pushgateway compatible endpoint, replacing the
+// metrics of the given job and grouping labels
+func PushOpenMetrics(ctx context.Context, client *http.Client, pushURL string, job string, grouping map[string]string, result *Result) error {
+	buf := &strings.Builder{}
+	err := WriteOpenMetrics(buf, result)
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(pushURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u += "/" + url.PathEscape(name) + "/" + url.PathEscape(grouping[name])
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, strings.NewReader(buf.String()))
+	if err != nil {
+		return fmt.Errorf("failed to create the request to push the metrics to %s: %w", u, err)
+	}
+	// the text format is what pushgateways accept, which can parse OpenMetrics text as well
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push the metrics to %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to push the metrics to %s: %s %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package reports_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recordPhases(r *reports.Recorder) {
+	labels := map[string]string{"quickstart": "node-http", "git_kind": "github"}
+	r.StartSpec("quickstart node-http creates a new source repository", "")
+	endCreate := r.BeginPhase("quickstart_creation", labels)
+	endCreate(false)
+	endRelease := r.BeginPhase("first_release_build", labels)
+	endNested := r.BeginPhase("first_release_build", labels)
+	endNested(false)
+	endRelease(false)
+	endPreview := r.BeginPhase("preview_url_available", map[string]string{"quickstart": `say "hi"`, "git_kind": "github"})
+	endPreview(true)
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "preview environment visible at a URL"})
+}
+
+func TestBeginPhase(t *testing.T) {
+	r := newRecorder()
+	recordPhases(r)
+
+	phases := r.Result().Phases
+	require.Len(t, phases, 3, "a phase which is already running should only be recorded once")
+	assert.Equal(t, "first_release_build", phases[1].Name)
+	assert.Equal(t, "quickstart node-http creates a new source repository", phases[1].Spec)
+	assert.Equal(t, 1.0, phases[1].Duration.Duration().Seconds())
+	assert.True(t, phases[2].Failed)
+
+	end := r.BeginPhase("quickstart_creation", nil)
+	end(false)
+	assert.Len(t, r.Result().Phases, 3, "phases should not be recorded outside of a spec")
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := newRecorder()
+	recordPhases(r)
+	buf := &strings.Builder{}
+	require.NoError(t, reports.WriteOpenMetrics(buf, r.Result()))
+	assert.Equal(t, `# TYPE bdd_phase_duration_seconds gauge
+# UNIT bdd_phase_duration_seconds seconds
+# HELP bdd_phase_duration_seconds How long each phase of the Jenkins X workflow took.
+bdd_phase_duration_seconds{git_kind="github",phase="first_release_build",quickstart="node-http",result="succeeded"} 1
+bdd_phase_duration_seconds{git_kind="github",phase="preview_url_available",quickstart="say \"hi\"",result="failed"} 1
+bdd_phase_duration_seconds{git_kind="github",phase="quickstart_creation",quickstart="node-http",result="succeeded"} 1
+# EOF
+`, buf.String())
+}
+
+func TestPushOpenMetrics(t *testing.T) {
+	var method, path, contentType, body string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		method, path, contentType = req.Method, req.URL.Path, req.Header.Get("Content-Type")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	r := newRecorder()
+	recordPhases(r)
+
+	err := reports.PushOpenMetrics(context.TODO(), server.Client(), server.URL+"/", "bdd-jx3", map[string]string{"suite": "create_quickstarts"}, r.Result())
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/bdd-jx3/suite/create_quickstarts", path)
+	assert.Equal(t, "text/plain; version=0.0.4", contentType)
+	assert.Contains(t, body, `phase="first_release_build"`)
+
+	status = http.StatusBadRequest
+	err = reports.PushOpenMetrics(context.TODO(), server.Client(), server.URL, "bdd-jx3", nil, r.Result())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400 Bad Request")
+}
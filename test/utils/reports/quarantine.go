@@ -0,0 +1,49 @@
+package reports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Quarantine is the names of the specs whose failures are reported but do not fail the suite
+type Quarantine map[string]bool
+
+// LoadQuarantine loads the quarantine file which has the name of a spec on each line, as it appears in the reports.
+// Blank lines and lines starting with # are ignored.
+func LoadQuarantine(path string) (Quarantine, error) {
+	q := Quarantine{}
+	if path == "" {
+		return q, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the quarantine file %s: %w", path, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		q[NormalizeSpecName(line)] = true
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the quarantine file %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// Contains returns true if the spec with the given name is quarantined
+func (q Quarantine) Contains(name string) bool {
+	return q[NormalizeSpecName(name)]
+}
+
+// NormalizeSpecName collapses the white space in the name of a spec, as the texts of the containers of the suites
+// often end with new lines
+func NormalizeSpecName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,33 @@
+package reports_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadQuarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`# the preview ingress is slow to get a DNS entry
+create spring Given valid parameters when running jx create spring creates a spring application and promotes it to staging
+
+quarantined spec
+`), 0600))
+
+	q, err := reports.LoadQuarantine(path)
+	require.NoError(t, err)
+	assert.Len(t, q, 2)
+	assert.True(t, q.Contains("create spring\n Given valid parameters when running jx create spring creates a spring application and promotes it to staging\n"), "white space should be ignored")
+	assert.False(t, q.Contains("the preview ingress is slow to get a DNS entry"))
+
+	q, err = reports.LoadQuarantine("")
+	require.NoError(t, err)
+	assert.Empty(t, q)
+
+	_, err = reports.LoadQuarantine(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
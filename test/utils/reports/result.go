@@ -0,0 +1,458 @@
+package reports
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+const (
+	StatePassed   = "passed"
+	StateFailed   = "failed"
+	StateSkipped  = "skipped"
+	StatePending  = "pending"
+	StatePanicked = "panicked"
+	StateTimedOut = "timedout"
+)
+
+// Result is the result of running a suite
+type Result struct {
+	Suite       string `json:"suite"`
+	Description string `json:"description,omitempty"`
+	// Node is the ginkgo node which ran the specs when running in parallel
+	Node     int             `json:"node,omitempty"`
+	Start    time.Time       `json:"start"`
+	Duration config.Duration `json:"duration"`
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	Skipped  int             `json:"skipped"`
+	Pending  int             `json:"pending"`
+	// Flaky is how many of the specs which passed only passed on a retry
+	Flaky int `json:"flaky"`
+	// Quarantined is how many specs failed which are quarantined, these are not counted as failed
+	Quarantined int `json:"quarantined"`
+	// Properties describe the environment the suite ran in, such as the jx version
+	Properties []*Property `json:"properties,omitempty"`
+	Specs      []*Spec     `json:"specs"`
+	// Phases are the phases of the Jenkins X workflow which the specs went through
+	Phases []*Phase `json:"phases,omitempty"`
+}
+
+// Property is a named value describing the environment of a suite
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Spec is the result of a single spec
+type Spec struct {
+	Name     string `json:"name"`
+	Location string `json:"location,omitempty"`
+	// Application is the name of the application created by the spec, if any
+	Application string          `json:"application,omitempty"`
+	State       string          `json:"state"`
+	Start       time.Time       `json:"start"`
+	Duration    config.Duration `json:"duration"`
+	Failure     *Failure        `json:"failure,omitempty"`
+	Steps       []*Step         `json:"steps,omitempty"`
+	// Commands are the commands which were not run in a step
+	Commands []*Command `json:"commands,omitempty"`
+	// Output is the output ginkgo captured from the spec, which it only does when running in parallel
+	Output string `json:"-"`
+	// Attempts is how many times the spec ran, which is more than once if it was retried
+	Attempts int `json:"attempts"`
+	// Retries are the failures of the attempts before the last one
+	Retries []*Failure `json:"retries,omitempty"`
+	// Flaky is true if the spec passed on a retry
+	Flaky bool `json:"flaky,omitempty"`
+	// Quarantined is true if the spec failed but is quarantined so does not fail the suite
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// Failure is why a spec failed
+type Failure struct {
+	Message  string `json:"message"`
+	Location string `json:"location,omitempty"`
+}
+
+// Step is a step of a spec, which may contain nested steps
+type Step struct {
+	Text     string          `json:"text"`
+	Start    time.Time       `json:"start"`
+	Duration config.Duration `json:"duration"`
+	Failed   bool            `json:"failed,omitempty"`
+	Steps    []*Step         `json:"steps,omitempty"`
+	Commands []*Command      `json:"commands,omitempty"`
+
+	// marker is true for steps without a body which last until the next step
+	marker bool
+	ended  bool
+}
+
+// Command is a jx or kubectl command run by a spec
+type Command struct {
+	Command  string          `json:"command"`
+	Args     []string        `json:"args,omitempty"`
+	ExitCode int             `json:"exitCode"`
+	Start    time.Time       `json:"start"`
+	Duration config.Duration `json:"duration"`
+}
+
+// AllCommands returns the commands run by the spec, including those run in its steps, in the order they were run
+func (s *Spec) AllCommands() []*Command {
+	answer := append([]*Command{}, s.Commands...)
+	var collect func(steps []*Step)
+	collect = func(steps []*Step) {
+		for _, step := range steps {
+			answer = append(answer, step.Commands...)
+			collect(step.Steps)
+		}
+	}
+	collect(s.Steps)
+	sort.SliceStable(answer, func(i, j int) bool {
+		return answer[i].Start.Before(answer[j].Start)
+	})
+	return answer
+}
+
+// Failed returns true if the spec did not pass and was not skipped
+func (s *Spec) Failed() bool {
+	return s.State == StateFailed || s.State == StatePanicked || s.State == StateTimedOut
+}
+
+// Recorder records the specs of a suite along with the steps and commands of the spec which is running
+type Recorder struct {
+	lock   sync.Mutex
+	result *Result
+	spec   *Spec
+	// stack are the steps with a body which are running, innermost last
+	stack []*Step
+	// phases are the names of the phases which are running
+	phases map[string]bool
+	now    func() time.Time
+}
+
+// NewRecorder creates a recorder of the given suite
+func NewRecorder(suite string, node int) *Recorder {
+	r := &Recorder{now: time.Now}
+	r.result = &Result{Suite: suite, Node: node, Start: r.now()}
+	return r
+}
+
+// SetClock sets the clock used for the start times and durations
+func (r *Recorder) SetClock(now func() time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.now = now
+	r.result.Start = now()
+}
+
+// Result returns the result recorded so far
+func (r *Recorder) Result() *Result {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.result
+}
+
+// StartSpec starts recording a spec
+func (r *Recorder) StartSpec(name string, location string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spec = &Spec{Name: name, Location: location, Start: r.now(), Attempts: 1}
+	r.stack = nil
+	r.phases = nil
+}
+
+// RetrySpec starts recording another attempt of the spec with the given name and location if it was the last spec
+// to complete and it failed, replacing the failed attempt. False is returned if it is not a retry.
+func (r *Recorder) RetrySpec(name string, location string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := len(r.result.Specs)
+	if n == 0 {
+		return false
+	}
+	last := r.result.Specs[n-1]
+	if last.Name != name || last.Location != location || !last.Failed() || last.Quarantined {
+		return false
+	}
+	r.result.Specs = r.result.Specs[:n-1]
+	r.result.Failed--
+	r.spec = &Spec{
+		Name:     name,
+		Location: location,
+		Start:    last.Start,
+		Attempts: last.Attempts + 1,
+		Retries:  append(last.Retries, last.Failure),
+	}
+	r.stack = nil
+	r.phases = nil
+	return true
+}
+
+// Attempt returns which attempt of the running spec this is, starting at 1, or 0 if no spec is running
+func (r *Recorder) Attempt() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spec == nil {
+		return 0
+	}
+	return r.spec.Attempts
+}
+
+// QuarantineSpec records that the running spec failed but is quarantined so the failure does not fail the suite
+func (r *Recorder) QuarantineSpec(failure *Failure) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spec != nil && !r.spec.Quarantined {
+		r.spec.Quarantined = true
+		r.spec.Failure = failure
+	}
+}
+
+// SetProperty sets a property of the suite, replacing any existing value
+func (r *Recorder) SetProperty(name string, value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, p := range r.result.Properties {
+		if p.Name == name {
+			p.Value = value
+			return
+		}
+	}
+	r.result.Properties = append(r.result.Properties, &Property{Name: name, Value: value})
+}
+
+// SetDescription sets the description of the suite
+func (r *Recorder) SetDescription(description string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.result.Description = description
+}
+
+// SetApplication sets the application created by the spec which is running
+func (r *Recorder) SetApplication(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spec != nil {
+		r.spec.Application = name
+	}
+}
+
+// SetOutput sets the output captured from the spec which is running
+func (r *Recorder) SetOutput(output string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spec != nil {
+		r.spec.Output = output
+	}
+}
+
+// EndSpec finishes recording the spec which is running with the given state
+func (r *Recorder) EndSpec(state string, failure *Failure) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.spec
+	if s == nil {
+		return
+	}
+	now := r.now()
+	if s.Quarantined {
+		// the failure was turned into a skip so the suite does not fail
+		state = StateFailed
+		if failure == nil || failure.Message == "" {
+			failure = s.Failure
+		}
+	}
+	s.State = state
+	s.Failure = failure
+	s.Flaky = state == StatePassed && s.Attempts > 1
+	s.Duration = config.Duration(now.Sub(s.Start))
+	// any steps which are still running are where the spec failed
+	if marker := r.runningMarker(); marker != nil {
+		marker.Failed = s.Failed()
+	}
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		r.endStep(r.stack[i], now, s.Failed())
+	}
+	r.endMarker(s.Steps, now)
+
+	switch {
+	case s.Quarantined:
+		r.result.Quarantined++
+	case state == StatePassed:
+		r.result.Passed++
+		if s.Flaky {
+			r.result.Flaky++
+		}
+	case state == StateSkipped:
+		r.result.Skipped++
+	case state == StatePending:
+		r.result.Pending++
+	default:
+		r.result.Failed++
+	}
+	r.result.Specs = append(r.result.Specs, s)
+	r.spec = nil
+	r.stack = nil
+}
+
+// End finishes recording the suite
+func (r *Recorder) End() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.result.Duration = config.Duration(r.now().Sub(r.result.Start))
+}
+
+// BeginStep starts a step of the running spec. Steps with a body are ended by calling the returned function once
+// the body returns. Steps without a body last until the next step starts or the enclosing step ends.
+func (r *Recorder) BeginStep(text string, hasBody bool) func(failed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	noop := func(bool) {}
+	if r.spec == nil {
+		return noop
+	}
+	now := r.now()
+	step := &Step{Text: text, Start: now, marker: !hasBody}
+	siblings := &r.spec.Steps
+	if len(r.stack) > 0 {
+		siblings = &r.stack[len(r.stack)-1].Steps
+	}
+	r.endMarker(*siblings, now)
+	*siblings = append(*siblings, step)
+	if !hasBody {
+		return noop
+	}
+	r.stack = append(r.stack, step)
+	spec := r.spec
+	return func(failed bool) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.spec != spec || step.ended {
+			return
+		}
+		r.endStep(step, r.now(), failed)
+		for i := len(r.stack) - 1; i >= 0; i-- {
+			if r.stack[i] == step {
+				r.stack = r.stack[:i]
+				break
+			}
+		}
+	}
+}
+
+// AddCommand adds a command to the innermost step which is running
+func (r *Recorder) AddCommand(c *Command) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spec == nil {
+		return
+	}
+	commands := &r.spec.Commands
+	if len(r.stack) > 0 {
+		commands = &r.stack[len(r.stack)-1].Commands
+	}
+	if marker := r.runningMarker(); marker != nil {
+		commands = &marker.Commands
+	}
+	*commands = append(*commands, c)
+}
+
+// runningMarker returns the innermost step without a body if it is still running
+func (r *Recorder) runningMarker() *Step {
+	steps := r.spec.Steps
+	if len(r.stack) > 0 {
+		steps = r.stack[len(r.stack)-1].Steps
+	}
+	if n := len(steps); n > 0 && steps[n-1].marker && !steps[n-1].ended {
+		return steps[n-1]
+	}
+	return nil
+}
+
+func (r *Recorder) endStep(step *Step, now time.Time, failed bool) {
+	r.endMarker(step.Steps, now)
+	step.Duration = config.Duration(now.Sub(step.Start))
+	step.Failed = step.Failed || failed
+	step.ended = true
+}
+
+// endMarker ends the last of the steps if it is a step without a body which is still running
+func (r *Recorder) endMarker(steps []*Step, now time.Time) {
+	if n := len(steps); n > 0 && steps[n-1].marker && !steps[n-1].ended {
+		steps[n-1].Duration = config.Duration(now.Sub(steps[n-1].Start))
+		steps[n-1].ended = true
+	}
+}
+
+var (
+	currentLock sync.Mutex
+	current     *Recorder
+)
+
+// SetCurrent sets the recorder of the suite which is running
+func SetCurrent(r *Recorder) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	current = r
+}
+
+// Current returns the recorder of the suite which is running, if any
+func Current() *Recorder {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	return current
+}
+
+// BeginStep starts a step of the spec which is running, if a suite is being recorded
+func BeginStep(text string, hasBody bool) func(failed bool) {
+	r := Current()
+	if r == nil {
+		return func(bool) {}
+	}
+	return r.BeginStep(text, hasBody)
+}
+
+// AddCommand adds a command to the spec which is running, if a suite is being recorded
+func AddCommand(c *Command) {
+	r := Current()
+	if r != nil {
+		r.AddCommand(c)
+	}
+}
+
+// SetProperty sets a property of the suite, if a suite is being recorded
+func SetProperty(name string, value string) {
+	r := Current()
+	if r != nil {
+		r.SetProperty(name, value)
+	}
+}
+
+// SetApplication sets the application created by the spec which is running, if a suite is being recorded
+func SetApplication(name string) {
+	r := Current()
+	if r != nil {
+		r.SetApplication(name)
+	}
+}
+
+// Attempt returns which attempt of the running spec this is, starting at 1, or 0 if no suite is being recorded
+func Attempt() int {
+	r := Current()
+	if r == nil {
+		return 0
+	}
+	return r.Attempt()
+}
+
+// QuarantineSpec records that the running spec failed but is quarantined, if a suite is being recorded
+func QuarantineSpec(failure *Failure) {
+	r := Current()
+	if r != nil {
+		r.QuarantineSpec(failure)
+	}
+}
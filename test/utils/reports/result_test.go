@@ -0,0 +1,240 @@
+package reports_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/reports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newRecorder creates a recorder whose clock moves on a second every time it is read
+func newRecorder() *reports.Recorder {
+	r := reports.NewRecorder("create_spring_application", 0)
+	now := start
+	r.SetClock(func() time.Time {
+		t := now
+		now = now.Add(time.Second)
+		return t
+	})
+	return r
+}
+
+func recordSpecs(r *reports.Recorder) {
+	r.StartSpec("create spring creates a spring application", "jx_create_spring.go:38")
+	endCreate := r.BeginStep("calling jx project spring", true)
+	r.AddCommand(&reports.Command{Command: "jx", Args: []string{"project", "spring"}})
+	endCreate(false)
+	r.BeginStep("approving the PR", false)
+	r.AddCommand(&reports.Command{Command: "jx", Args: []string{"get", "activities"}})
+	endRelease := r.BeginStep("waiting for the first release", true)
+	r.BeginStep("waiting for the build", false)
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "timed out waiting for the build", Location: "test.go:10"})
+	endRelease(false)
+
+	r.StartSpec("create spring with invalid parameters", "")
+	r.EndSpec(reports.StateSkipped, nil)
+	r.End()
+}
+
+func TestRecordStepsAndCommands(t *testing.T) {
+	r := newRecorder()
+	recordSpecs(r)
+	result := r.Result()
+
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 1, result.Skipped)
+	require.Len(t, result.Specs, 2)
+	s := result.Specs[0]
+	assert.True(t, s.Failed())
+	assert.Equal(t, 6*time.Second, s.Duration.Duration())
+	require.Len(t, s.Steps, 3)
+
+	create := s.Steps[0]
+	assert.Equal(t, "calling jx project spring", create.Text)
+	assert.Equal(t, 1*time.Second, create.Duration.Duration())
+	assert.False(t, create.Failed)
+	require.Len(t, create.Commands, 1)
+	assert.Equal(t, []string{"project", "spring"}, create.Commands[0].Args)
+
+	approve := s.Steps[1]
+	assert.Equal(t, 1*time.Second, approve.Duration.Duration(), "a step without a body should last until the next step")
+	require.Len(t, approve.Commands, 1, "commands should be added to the step without a body which is running")
+
+	release := s.Steps[2]
+	assert.True(t, release.Failed, "the step which was running when the spec failed should have failed")
+	require.Len(t, release.Steps, 1)
+	assert.Equal(t, "waiting for the build", release.Steps[0].Text)
+	assert.Equal(t, 2*time.Second, release.Duration.Duration())
+}
+
+func TestWriteJSON(t *testing.T) {
+	r := newRecorder()
+	recordSpecs(r)
+	buf := &bytes.Buffer{}
+	require.NoError(t, reports.WriteJSON(buf, r.Result()))
+
+	result := &reports.Result{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), result))
+	assert.Equal(t, "create_spring_application", result.Suite)
+	require.Len(t, result.Specs, 2)
+	assert.Equal(t, "timed out waiting for the build", result.Specs[0].Failure.Message)
+	assert.Equal(t, "waiting for the build", result.Specs[0].Steps[2].Steps[0].Text)
+	assert.Contains(t, buf.String(), `"duration": "1s"`)
+}
+
+func TestWriteTAP(t *testing.T) {
+	r := newRecorder()
+	recordSpecs(r)
+	buf := &strings.Builder{}
+	require.NoError(t, reports.WriteTAP(buf, r.Result()))
+	assert.Equal(t, `TAP version 13
+1..2
+not ok 1 - create spring creates a spring application
+  ---
+  duration_ms: 6000
+  message: |
+    timed out waiting for the build
+  at: "test.go:10"
+  steps:
+    - text: "calling jx project spring"
+      duration_ms: 1000
+    - text: "approving the PR"
+      duration_ms: 1000
+    - text: "waiting for the first release"
+      duration_ms: 2000
+      failed: true
+      steps:
+        - text: "waiting for the build"
+          duration_ms: 1000
+          failed: true
+  ...
+ok 2 - create spring with invalid parameters # SKIP
+  ---
+  duration_ms: 1000
+  ...
+`, buf.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	r := newRecorder()
+	recordSpecs(r)
+	r.Result().Specs[0].Failure.Message = "expected <b>200</b>"
+	buf := &strings.Builder{}
+	require.NoError(t, reports.WriteHTML(buf, r.Result()))
+	html := buf.String()
+	assert.Contains(t, html, "<title>create_spring_application</title>")
+	assert.Contains(t, html, "calling jx project spring")
+	assert.Contains(t, html, "<code>jx project spring</code>")
+	assert.Contains(t, html, "expected &lt;b&gt;200&lt;/b&gt;", "the output should be escaped")
+	assert.NotContains(t, html, "<link", "the report should be self contained")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	r := newRecorder()
+	r.SetDescription("Jenkins X E2E tests: create_spring_application")
+	r.SetProperty("jx.version", "3.10.0")
+	r.SetProperty("timeouts.buildCompletes", "40m0s")
+	r.SetProperty("jx.version", "3.10.1")
+	r.StartSpec("create spring creates a spring application", "")
+	r.SetApplication("bdd-spring-1234")
+	endCreate := r.BeginStep("calling jx project spring", true)
+	r.AddCommand(&reports.Command{Command: "jx", Args: []string{"project", "spring"}, ExitCode: 1, Start: start.Add(2 * time.Second), Duration: config.Duration(1500 * time.Millisecond)})
+	endCreate(true)
+	r.AddCommand(&reports.Command{Command: "kubectl", Args: []string{"get", "pods"}, Start: start.Add(4 * time.Second)})
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "expected <b>200</b>", Location: "test.go:10"})
+	r.StartSpec("create spring with invalid parameters", "")
+	r.EndSpec(reports.StateSkipped, nil)
+	r.End()
+
+	buf := &strings.Builder{}
+	require.NoError(t, reports.WriteJUnit(buf, r.Result()))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+  <testsuite name="Jenkins X E2E tests: create_spring_application" tests="2" failures="1" errors="0" skipped="1" time="7">
+      <properties>
+          <property name="jx.version" value="3.10.1"></property>
+          <property name="timeouts.buildCompletes" value="40m0s"></property>
+      </properties>
+      <testcase name="create spring creates a spring application" classname="Jenkins X E2E tests: create_spring_application" time="3">
+          <failure type="failed">expected &lt;b&gt;200&lt;/b&gt;&#xA;test.go:10</failure>
+          <system-out>application: bdd-spring-1234&#xA;commands:&#xA;  jx project spring (exit 1 in 1.5s)&#xA;  kubectl get pods (exit 0 in 0s)&#xA;</system-out>
+      </testcase>
+      <testcase name="create spring with invalid parameters" classname="Jenkins X E2E tests: create_spring_application" time="1">
+          <skipped></skipped>
+      </testcase>
+  </testsuite>
+`, buf.String())
+}
+
+func TestRetrySpec(t *testing.T) {
+	r := newRecorder()
+	assert.False(t, r.RetrySpec("preview", "preview.go:10"), "the first attempt should not be a retry")
+	r.StartSpec("preview", "preview.go:10")
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "dial tcp: lookup preview.example.com: no such host"})
+	require.True(t, r.RetrySpec("preview", "preview.go:10"))
+	assert.Equal(t, 2, r.Attempt())
+	r.EndSpec(reports.StatePassed, nil)
+
+	r.StartSpec("promote", "promote.go:10")
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "timed out"})
+	require.True(t, r.RetrySpec("promote", "promote.go:10"))
+	r.EndSpec(reports.StateFailed, &reports.Failure{Message: "timed out again"})
+	r.End()
+
+	result := r.Result()
+	assert.Equal(t, 1, result.Passed)
+	assert.Equal(t, 1, result.Failed, "only the last attempt should be counted")
+	assert.Equal(t, 1, result.Flaky)
+	require.Len(t, result.Specs, 2)
+	preview := result.Specs[0]
+	assert.True(t, preview.Flaky)
+	assert.Equal(t, 2, preview.Attempts)
+	require.Len(t, preview.Retries, 1)
+	assert.Contains(t, preview.Retries[0].Message, "no such host")
+	assert.False(t, result.Specs[1].Flaky)
+
+	junit := &strings.Builder{}
+	require.NoError(t, reports.WriteJUnit(junit, result))
+	assert.Contains(t, junit.String(), `<flakyFailure type="failed">dial tcp: lookup preview.example.com: no such host</flakyFailure>`)
+	assert.Contains(t, junit.String(), `<failure type="failed">timed out again</failure>`)
+	assert.Contains(t, junit.String(), `<rerunFailure type="failed">timed out</rerunFailure>`)
+
+	tap := &strings.Builder{}
+	require.NoError(t, reports.WriteTAP(tap, result))
+	assert.Contains(t, tap.String(), "ok 1 - preview\n  ---\n  duration_ms: 2000\n  attempts: 2\n  flaky: true\n")
+}
+
+func TestQuarantineSpec(t *testing.T) {
+	r := newRecorder()
+	r.StartSpec("preview", "")
+	r.QuarantineSpec(&reports.Failure{Message: "preview environment visible at a URL\nExpected 503 to equal 200", Location: "test.go:10"})
+	r.EndSpec(reports.StateSkipped, nil)
+	assert.False(t, r.RetrySpec("preview", ""), "quarantined specs should not be retried")
+	r.End()
+
+	result := r.Result()
+	assert.Equal(t, 0, result.Failed)
+	assert.Equal(t, 0, result.Skipped)
+	assert.Equal(t, 1, result.Quarantined)
+	s := result.Specs[0]
+	assert.Equal(t, reports.StateFailed, s.State, "the failure should still be reported")
+	assert.True(t, s.Quarantined)
+	assert.Equal(t, "test.go:10", s.Failure.Location)
+
+	junit := &strings.Builder{}
+	require.NoError(t, reports.WriteJUnit(junit, result))
+	assert.Contains(t, junit.String(), `failures="0" errors="0" skipped="1"`)
+	assert.Contains(t, junit.String(), `<skipped message="quarantined: preview environment visible at a URL"></skipped>`)
+	assert.Contains(t, junit.String(), `<system-out>quarantined failure:&#xA;preview environment visible at a URL&#xA;Expected 503 to equal 200&#xA;test.go:10</system-out>`)
+
+	tap := &strings.Builder{}
+	require.NoError(t, reports.WriteTAP(tap, result))
+	assert.Contains(t, tap.String(), "not ok 1 - preview # TODO quarantined\n")
+}
@@ -0,0 +1,165 @@
+package reports
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+// WriteJSON writes the result as indented JSON
+func WriteJSON(w io.Writer, result *Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// WriteTAP writes the result in the Test Anything Protocol version 13 with the failures and steps of each spec as
+// YAML diagnostics
+func WriteTAP(w io.Writer, result *Result) error {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "TAP version 13\n1..%d\n", len(result.Specs))
+	for i, s := range result.Specs {
+		status := "ok"
+		if s.Failed() {
+			status = "not ok"
+		}
+		directive := ""
+		switch {
+		case s.Quarantined:
+			directive = " # TODO quarantined"
+		case s.State == StateSkipped:
+			directive = " # SKIP"
+		case s.State == StatePending:
+			directive = " # TODO pending"
+		}
+		fmt.Fprintf(buf, "%s %d - %s%s\n", status, i+1, tapLine(s.Name), directive)
+		fmt.Fprintf(buf, "  ---\n  duration_ms: %d\n", s.Duration.Duration().Milliseconds())
+		if s.Attempts > 1 {
+			fmt.Fprintf(buf, "  attempts: %d\n", s.Attempts)
+		}
+		if s.Flaky {
+			buf.WriteString("  flaky: true\n")
+		}
+		if s.Failure != nil {
+			fmt.Fprintf(buf, "  message: |\n%s", tapIndent(s.Failure.Message, "    "))
+			if s.Failure.Location != "" {
+				fmt.Fprintf(buf, "  at: %q\n", s.Failure.Location)
+			}
+		}
+		if len(s.Steps) > 0 {
+			buf.WriteString("  steps:\n")
+			writeTAPSteps(buf, s.Steps, "    ")
+		}
+		buf.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func writeTAPSteps(buf *strings.Builder, steps []*Step, indent string) {
+	for _, step := range steps {
+		fmt.Fprintf(buf, "%s- text: %q\n%s  duration_ms: %d\n", indent, step.Text, indent, step.Duration.Duration().Milliseconds())
+		if step.Failed {
+			fmt.Fprintf(buf, "%s  failed: true\n", indent)
+		}
+		if len(step.Steps) > 0 {
+			fmt.Fprintf(buf, "%s  steps:\n", indent)
+			writeTAPSteps(buf, step.Steps, indent+"    ")
+		}
+	}
+}
+
+// tapLine removes the new lines which cannot be part of a test line
+func tapLine(text string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(text, "#", "\\#")), " ")
+}
+
+func tapIndent(text string, indent string) string {
+	buf := &strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		buf.WriteString(indent + line + "\n")
+	}
+	return buf.String()
+}
+
+var htmlTemplate = template.Must(template.New("result").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"time": func(t time.Time) string {
+		return t.UTC().Format("15:04:05")
+	},
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Suite}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.summary td { padding: 0 1em 0 0; }
+details { margin: 0.5em 0; }
+summary { cursor: pointer; }
+.passed { color: #1a7f37; }
+.failed, .panicked, .timedout { color: #cf222e; }
+.skipped, .pending { color: #6e7781; }
+.flaky, .quarantined { color: #9a6700; }
+.duration { color: #6e7781; font-size: 0.9em; }
+ul { list-style: none; padding-left: 1.5em; }
+pre { background: #f6f8fa; padding: 1em; white-space: pre-wrap; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{.Suite}}</h1>
+<table class="summary">
+<tr><td>Started</td><td>{{.Start.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><td>Duration</td><td>{{duration .Duration}}</td></tr>
+<tr><td class="passed">Passed</td><td>{{.Passed}}</td></tr>
+<tr><td class="failed">Failed</td><td>{{.Failed}}</td></tr>
+<tr><td class="skipped">Skipped</td><td>{{.Skipped}}</td></tr>
+<tr><td class="pending">Pending</td><td>{{.Pending}}</td></tr>
+<tr><td class="flaky">Flaky</td><td>{{.Flaky}}</td></tr>
+<tr><td class="quarantined">Quarantined</td><td>{{.Quarantined}}</td></tr>
+</table>
+{{range .Specs}}
+<details{{if .Failed}} open{{end}}>
+<summary><span class="{{.State}}">{{.State}}</span>{{if .Quarantined}} <span class="quarantined">quarantined</span>{{end}}{{if .Flaky}} <span class="flaky">flaky</span>{{end}} {{.Name}} <span class="duration">{{duration .Duration}}{{if gt .Attempts 1}} in {{.Attempts}} attempts{{end}}</span></summary>
+{{if .Failure}}<pre>{{.Failure.Message}}{{if .Failure.Location}}
+
+{{.Failure.Location}}{{end}}</pre>{{end}}
+{{template "commands" .Commands}}
+{{template "steps" .Steps}}
+</details>
+{{end}}
+</body>
+</html>
+{{define "steps"}}{{if .}}<ul>{{range .}}
+<li><span class="{{if .Failed}}failed{{else}}passed{{end}}">{{if .Failed}}&#10007;{{else}}&#10003;{{end}}</span> {{time .Start}} {{.Text}} <span class="duration">{{duration .Duration}}</span>
+{{template "commands" .Commands}}{{template "steps" .Steps}}</li>{{end}}
+</ul>{{end}}{{end}}
+{{define "commands"}}{{if .}}<ul>{{range .}}
+<li><code>{{.Command}} {{join .Args " "}}</code> <span class="duration">exit {{.ExitCode}} in {{duration .Duration}}</span></li>{{end}}
+</ul>{{end}}{{end}}
+`))
+
+// WriteHTML writes the result as a self contained HTML page
+func WriteHTML(w io.Writer, result *Result) error {
+	return htmlTemplate.Execute(w, result)
+}
+
+// formatDuration formats a duration rounded for humans
+func formatDuration(d config.Duration) string {
+	v := d.Duration()
+	switch {
+	case v >= time.Minute:
+		return v.Round(time.Second).String()
+	case v >= time.Second:
+		return v.Round(100 * time.Millisecond).String()
+	default:
+		return v.Round(time.Millisecond).String()
+	}
+}
@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/coverage"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+)
+
+// RunOptions configures a single jx invocation made with RunContext
+type RunOptions struct {
+	// Dir overrides the working directory of the runner
+	Dir string
+	// Env contains extra environment variables of the form KEY=VALUE which are added to the current environment
+	Env []string
+	// Kubeconfig sets KUBECONFIG for the invocation so the command can run against a different cluster
+	Kubeconfig string
+	// Stdin is used as the standard input of the command if not nil
+	Stdin io.Reader
+	// OnStdout is called with each line written to stdout as soon as it is available
+	OnStdout func(line string)
+	// OnStderr is called with each line written to stderr as soon as it is available
+	OnStderr func(line string)
+}
+
+// Result is the result of a jx invocation made with RunContext
+type Result struct {
+	Args     []string
+	ExitCode int
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+}
+
+// RunContext runs a jx command until it exits or the context is done. If the context has no deadline the timeout of
+// the runner is used. Stdout and stderr are kept separate in the result and streamed line by line to the callbacks of
+// the options, which are never called concurrently. The result is returned along with an error if the command exits
+// with an unexpected exit code or is stopped because the context is done.
+func (r *JxRunner) RunContext(ctx context.Context, opts RunOptions, args ...string) (*Result, error) {
+	if _, ok := ctx.Deadline(); !ok && r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = r.cwd
+	}
+	argsStr := strings.Join(args, " ")
+	if testing.Verbose() {
+		utils.LogInfof("\033[1mRUNNER:\033[0mAbout to execute jx %s in %s expecting exit code %d\n", argsStr, dir, r.exitCode)
+	}
+
+	var lock sync.Mutex
+	stdout := newLineWriter(&lock, opts.OnStdout)
+	stderr := newLineWriter(&lock, opts.OnStderr)
+
+	command := exec.CommandContext(ctx, JxBin(), args...)
+	command.Dir = dir
+	command.Env = append(os.Environ(), opts.Env...)
+	if opts.Kubeconfig != "" {
+		command.Env = append(command.Env, "KUBECONFIG="+opts.Kubeconfig)
+	}
+	env, err := coverage.Env(command.Env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run jx %s: %w", argsStr, err)
+	}
+	command.Env = env
+	command.Stdin = opts.Stdin
+	command.Stdout = stdout
+	command.Stderr = stderr
+	// don't wait forever for any child processes still holding on to stdout or stderr once jx is killed
+	command.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	entry, err := transcript.Run(Jx, command)
+	stdout.flush()
+	stderr.flush()
+	result := &Result{
+		Args:     args,
+		ExitCode: -1,
+		Duration: time.Since(start),
+		Stdout:   strings.TrimSpace(RemoveCoverageText(stdout.String(), args...)),
+		Stderr:   strings.TrimSpace(stderr.String()),
+	}
+	if entry != nil {
+		result.ExitCode = entry.ExitCode
+	}
+	if testing.Verbose() {
+		utils.LogInfof("\033[1mRUNNER:\033[0mExecution completed with exit code %d in %s\n", result.ExitCode, result.Duration.String())
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, fmt.Errorf("jx %s was stopped after %s: %w", argsStr, result.Duration.String(), ctxErr)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to run jx %s: %w", argsStr, err)
+	}
+	if result.ExitCode != r.exitCode {
+		return result, fmt.Errorf("expected exit code %d but got %d whilst running command %s %s: %s", r.exitCode, result.ExitCode, Jx, argsStr, result.Stderr)
+	}
+	return result, nil
+}
+
+// lineWriter keeps everything written to it and calls the callback with each complete line
+type lineWriter struct {
+	lock     *sync.Mutex
+	callback func(string)
+	buffer   bytes.Buffer
+	partial  []byte
+}
+
+func newLineWriter(lock *sync.Mutex, callback func(string)) *lineWriter {
+	return &lineWriter{
+		lock:     lock,
+		callback: callback,
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.buffer.Write(p)
+	if w.callback == nil {
+		return len(p), nil
+	}
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.callback(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush calls the callback with any remaining output which did not end with a new line
+func (w *lineWriter) flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.callback != nil && len(w.partial) > 0 {
+		w.callback(string(w.partial))
+	}
+	w.partial = nil
+}
+
+func (w *lineWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buffer.String()
+}
@@ -0,0 +1,69 @@
+package runner_test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useShell uses sh as the jx binary so the tests can script their output
+func useShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not installed")
+	}
+	t.Setenv("BDD_JX", sh)
+}
+
+func TestRunContext(t *testing.T) {
+	useShell(t)
+	r := runner.New(t.TempDir(), nil, 0)
+
+	var lines []string
+	opts := runner.RunOptions{
+		Env:        []string{"BDD_GREETING=hello"},
+		Kubeconfig: "/tmp/bdd-kubeconfig",
+		Stdin:      strings.NewReader("from stdin\n"),
+		OnStdout: func(line string) {
+			lines = append(lines, "out: "+line)
+		},
+		OnStderr: func(line string) {
+			lines = append(lines, "err: "+line)
+		},
+	}
+	result, err := r.RunContext(context.TODO(), opts, "-c", `echo $BDD_GREETING; echo $KUBECONFIG; echo "WARNING: deprecated" >&2; cat`)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "hello\n/tmp/bdd-kubeconfig\nfrom stdin", result.Stdout)
+	assert.Equal(t, "WARNING: deprecated", result.Stderr)
+	assert.ElementsMatch(t, []string{"out: hello", "out: /tmp/bdd-kubeconfig", "err: WARNING: deprecated", "out: from stdin"}, lines)
+}
+
+func TestRunContextUnexpectedExitCode(t *testing.T) {
+	useShell(t)
+	r := runner.New(t.TempDir(), nil, 0)
+
+	result, err := r.RunContext(context.TODO(), runner.RunOptions{}, "-c", "echo failed >&2; exit 3")
+	require.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "failed", result.Stderr)
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	useShell(t)
+	r := runner.New(t.TempDir(), nil, 0)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+	defer cancel()
+	result, err := r.RunContext(ctx, runner.RunOptions{}, "-c", "exec sleep 30")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, result.Duration, 5*time.Second)
+}
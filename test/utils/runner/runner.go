@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,9 +14,10 @@ import (
 	"time"
 
 	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/coverage"
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
 	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
-	"github.com/onsi/gomega/gexec"
 )
 
 const (
@@ -23,7 +26,7 @@ const (
 
 var (
 	// jxRunner session timeout
-	TimeoutJxRunner     = utils.GetTimeoutFromEnv("BDD_TIMEOUT_JX_RUNNER", 5)
+	TimeoutJxRunner     = config.Get().Timeouts.JxRunner.Duration()
 	coverageOutputRegex = regexp.MustCompile(`(?m:(PASS|FAIL)\n\s*coverage: ([\d\.]*%) of statements in [\w\.\/]*\n)`)
 )
 
@@ -57,19 +60,29 @@ func (r *JxRunner) run(out io.Writer, errOut io.Writer, args ...string) error {
 		utils.LogInfof("\033[1mRUNNER:\033[0mAbout to execute jx %s in %s with timeout %v expecting exit code %d\n", strings.Join(args, " "), r.cwd, r.timeout, r.exitCode)
 	}
 
-	command := exec.Command(JxBin(), args...)
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	command := exec.CommandContext(ctx, JxBin(), args...)
 	command.Dir = r.cwd
-	session, err := gexec.Start(command, out, errOut)
+	command.Stdout = out
+	command.Stderr = errOut
+	env, err := coverage.Env(nil)
+	if err != nil {
+		return err
+	}
+	command.Env = env
+	entry, err := transcript.Run(Jx, command)
 	if err != nil {
 		return err
 	}
-	session.Wait(r.timeout)
-	Eventually(session).Should(gexec.Exit())
 	if testing.Verbose() {
-		utils.LogInfof("\033[1mRUNNER:\033[0mExecution completed with exit code %d\n", session.ExitCode())
+		utils.LogInfof("\033[1mRUNNER:\033[0mExecution completed with exit code %d\n", entry.ExitCode)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("jx %s did not complete within %s: %w", strings.Join(args, " "), r.timeout.String(), ctx.Err())
 	}
-	if session.ExitCode() != r.exitCode {
-		return fmt.Errorf("expected exit code %d but got %d whilst running command %s %s", r.exitCode, session.ExitCode(), Jx, strings.Join(args, " "))
+	if entry.ExitCode != r.exitCode {
+		return fmt.Errorf("expected exit code %d but got %d whilst running command %s %s", r.exitCode, entry.ExitCode, Jx, strings.Join(args, " "))
 	}
 	return nil
 }
@@ -97,7 +110,7 @@ func (r *JxRunner) RunWithOutput(args ...string) (string, error) {
 	}
 	answer := string(outBytes)
 	if rErr != nil {
-		return "", fmt.Errorf("running jx %s output %s: %w", strings.Join(args, " "), answer, err)
+		return "", fmt.Errorf("running jx %s output %s: %w", strings.Join(args, " "), answer, rErr)
 	}
 	return strings.TrimSpace(RemoveCoverageText(answer, args...)), nil
 }
@@ -110,9 +123,17 @@ func (r *JxRunner) RunWithOutputNoTimeout(args ...string) (string, error) {
 	}
 	command := exec.Command(JxBin(), args...)
 	command.Dir = r.cwd
+	outBytes := &bytes.Buffer{}
+	command.Stdout = outBytes
+	command.Stderr = outBytes
+	env, err := coverage.Env(nil)
+	if err != nil {
+		return "", err
+	}
+	command.Env = env
 
-	outBytes, err := command.CombinedOutput()
-	answer := strings.TrimSpace(string(outBytes))
+	err = runCombined(command)
+	answer := strings.TrimSpace(outBytes.String())
 
 	if err != nil {
 		utils.LogInfof("ERROR: running jx %s and got result: %s and error: %s\n", argsStr, answer, err.Error())
@@ -127,20 +148,32 @@ func (r *JxRunner) RunWithOutputNoTimeout(args ...string) (string, error) {
 	return answer, nil
 }
 
+// runCombined runs the command returning an error if it fails, like exec.Cmd.CombinedOutput
+func runCombined(command *exec.Cmd) error {
+	entry, err := transcript.Run(Jx, command)
+	if err != nil {
+		return err
+	}
+	if entry.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", entry.ExitCode)
+	}
+	return nil
+}
+
+// JxBin returns the jx binary to use. $BDD_JX is checked on every call, rather than only when the configuration is
+// loaded, so that tests can point it at a fake jx binary.
 func JxBin() string {
-	jxBin, set := os.LookupEnv("BDD_JX")
-	if !set {
-		jxBin = Jx
+	if jxBin := os.Getenv("BDD_JX"); jxBin != "" {
+		return jxBin
 	}
-	return jxBin
+	if jxBin := config.Get().JX; jxBin != "" {
+		return jxBin
+	}
+	return Jx
 }
 
 func JxUiUrl() string {
-	jxUiUrl, set := os.LookupEnv("JXUI_URL")
-	if !set {
-		jxUiUrl = ""
-	}
-	return jxUiUrl
+	return config.Get().JXUIURL
 }
 
 func RemoveCoverageText(s string, args ...string) string {
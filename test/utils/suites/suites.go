@@ -0,0 +1,228 @@
+package suites
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils"
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+// Capability is something the cluster or git provider has to support for a suite to run
+type Capability string
+
+const (
+	// CapabilityCluster a connection to a cluster with Jenkins X installed
+	CapabilityCluster Capability = "cluster"
+	// CapabilityGitProvider credentials of the pipeline user to create repositories in the git organisation
+	CapabilityGitProvider Capability = "git-provider"
+	// CapabilityQuickstarts quickstarts which can be listed with jx get quickstarts
+	CapabilityQuickstarts Capability = "quickstarts"
+)
+
+// SelectAll is the selector which selects every registered suite
+const SelectAll = "all"
+
+// Suite is a named set of specs which can be selected to run
+type Suite struct {
+	// Name is the name the suite is selected with
+	Name string
+	// Description describes what the suite tests
+	Description string
+	// Tags select the suite along with any other suites with the same tag
+	Tags []string
+	// Capabilities are what the suite needs to run. The suite is skipped if any of them are missing.
+	Capabilities []Capability
+	// Timeouts are the default timeouts of the suite keyed by the name of the setting, such as
+	// timeouts.buildCompletes. They are used unless the timeout is configured in the config file or environment.
+	Timeouts map[string]config.Duration
+	// Specs declares the ginkgo specs of the suite. It is only called if the suite is selected.
+	Specs func()
+}
+
+// Registry the suites which can be selected
+type Registry struct {
+	lock   sync.Mutex
+	suites []*Suite
+}
+
+// Register registers a suite returning an error if there is already a suite with the same name
+func (r *Registry) Register(s *Suite) error {
+	if s.Name == "" || s.Name == SelectAll {
+		return utils.InvalidOptionf("name", s.Name, "should be a name other than %s", SelectAll)
+	}
+	if s.Specs == nil {
+		return fmt.Errorf("suite %s has no specs", s.Name)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, existing := range r.suites {
+		if existing.Name == s.Name {
+			return fmt.Errorf("suite %s is already registered", s.Name)
+		}
+	}
+	r.suites = append(r.suites, s)
+	return nil
+}
+
+// Suites returns the registered suites sorted by name
+func (r *Registry) Suites() []*Suite {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	answer := append([]*Suite{}, r.suites...)
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Name < answer[j].Name
+	})
+	return answer
+}
+
+// Decision is whether a suite was selected to run and why
+type Decision struct {
+	Suite    *Suite
+	Selected bool
+	// Named is true if the suite was selected by its name rather than a tag or all, in which case it has to run
+	Named  bool
+	Reason string
+}
+
+// CapabilityCheck returns an error if the capability is missing
+type CapabilityCheck func(c Capability) error
+
+// Select decides which suites run. A suite is selected if one of the selectors is its name or one of its tags, or if
+// the selectors contain all, and it has all the capabilities it needs. A decision is returned for every registered
+// suite. Capabilities are only checked for suites which match a selector and each capability is checked once.
+func (r *Registry) Select(selectors []string, check CapabilityCheck) ([]*Decision, error) {
+	all := r.Suites()
+	err := validateSelectors(all, selectors)
+	if err != nil {
+		return nil, err
+	}
+	checked := map[Capability]error{}
+	var answer []*Decision
+	for _, s := range all {
+		d := &Decision{Suite: s}
+		answer = append(answer, d)
+		selector := s.matches(selectors)
+		if selector == "" {
+			d.Reason = "not selected"
+			continue
+		}
+		d.Named = utils.Contains(selectors, s.Name)
+		var missing []string
+		for _, c := range s.Capabilities {
+			err, ok := checked[c]
+			if !ok && check != nil {
+				err = check(c)
+				checked[c] = err
+			}
+			if err != nil {
+				missing = append(missing, fmt.Sprintf("missing capability %s: %s", c, err.Error()))
+			}
+		}
+		if len(missing) > 0 {
+			d.Reason = strings.Join(missing, "; ")
+			continue
+		}
+		d.Selected = true
+		d.Reason = "selected by " + selector
+	}
+	return answer, nil
+}
+
+// matches returns the selector which matches the suite, if any
+func (s *Suite) matches(selectors []string) string {
+	for _, selector := range selectors {
+		if selector == SelectAll || selector == s.Name || utils.Contains(s.Tags, selector) {
+			return selector
+		}
+	}
+	return ""
+}
+
+func validateSelectors(all []*Suite, selectors []string) error {
+	if len(selectors) == 0 {
+		return fmt.Errorf("no suites selected")
+	}
+	valid := []string{SelectAll}
+	for _, s := range all {
+		valid = append(valid, s.Name)
+		for _, tag := range s.Tags {
+			if !utils.Contains(valid, tag) {
+				valid = append(valid, tag)
+			}
+		}
+	}
+	for _, selector := range selectors {
+		if !utils.Contains(valid, selector) {
+			return utils.InvalidOption("JX_BDD_SUITE", selector, valid)
+		}
+	}
+	return nil
+}
+
+// ParseSelectors parses a comma or space separated list of suite names and tags
+func ParseSelectors(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// MissingCapabilities returns an error if a suite selected by its name cannot run as it is missing a capability.
+// Suites selected by a tag or all are skipped instead, as they were not asked for explicitly.
+func MissingCapabilities(decisions []*Decision) error {
+	var missing []string
+	for _, d := range decisions {
+		if d.Named && !d.Selected {
+			missing = append(missing, fmt.Sprintf("suite %s cannot run: %s", d.Suite.Name, d.Reason))
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, "\n"))
+	}
+	return nil
+}
+
+// DefaultTimeouts returns the default timeouts of the selected suites. If more than one suite has a default for the
+// same timeout the longest is used.
+func DefaultTimeouts(decisions []*Decision) map[string]config.Duration {
+	answer := map[string]config.Duration{}
+	for _, d := range decisions {
+		if !d.Selected {
+			continue
+		}
+		for name, timeout := range d.Suite.Timeouts {
+			if timeout > answer[name] {
+				answer[name] = timeout
+			}
+		}
+	}
+	return answer
+}
+
+// WriteTable writes the decisions as a table
+func WriteTable(w io.Writer, decisions []*Decision) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUITE\tSELECTED\tTAGS\tREASON")
+	for _, d := range decisions {
+		fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", d.Suite.Name, d.Selected, strings.Join(d.Suite.Tags, ","), d.Reason)
+	}
+	return tw.Flush()
+}
+
+// Default is the registry the suite packages register themselves with
+var Default = &Registry{}
+
+// Register registers a suite with the default registry. It panics if the suite cannot be registered so that it can
+// be called when declaring a package variable, like ginkgo's Describe.
+func Register(s *Suite) bool {
+	err := Default.Register(s)
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
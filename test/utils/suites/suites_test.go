@@ -0,0 +1,142 @@
+package suites_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+	"github.com/jenkins-x/bdd-jx3/test/utils/suites"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegistry(t *testing.T) *suites.Registry {
+	r := &suites.Registry{}
+	noSpecs := func() {}
+	for _, s := range []*suites.Suite{
+		{
+			Name:         "create_quickstarts",
+			Tags:         []string{"nightly"},
+			Capabilities: []suites.Capability{suites.CapabilityCluster, suites.CapabilityQuickstarts},
+			Timeouts:     map[string]config.Duration{"timeouts.buildCompletes": config.Minutes(40)},
+			Specs:        noSpecs,
+		},
+		{
+			Name:         "create_spring_application",
+			Tags:         []string{"nightly"},
+			Capabilities: []suites.Capability{suites.CapabilityCluster},
+			Timeouts:     map[string]config.Duration{"timeouts.buildCompletes": config.Minutes(60)},
+			Specs:        noSpecs,
+		},
+		{
+			Name:         "verify_pods",
+			Tags:         []string{"smoke"},
+			Capabilities: []suites.Capability{suites.CapabilityCluster},
+			Timeouts:     map[string]config.Duration{"timeouts.cmdLine": config.Minutes(5)},
+			Specs:        noSpecs,
+		},
+	} {
+		require.NoError(t, r.Register(s))
+	}
+	return r
+}
+
+func decisionsTable(t *testing.T, decisions []*suites.Decision) string {
+	table := &strings.Builder{}
+	require.NoError(t, suites.WriteTable(table, decisions))
+	return table.String()
+}
+
+func TestSelectByNameAndTag(t *testing.T) {
+	r := newRegistry(t)
+	var checked []suites.Capability
+	decisions, err := r.Select(suites.ParseSelectors("verify_pods, nightly"), func(c suites.Capability) error {
+		checked = append(checked, c)
+		if c == suites.CapabilityQuickstarts {
+			return errors.New("jx get quickstarts failed")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `SUITE                      SELECTED  TAGS     REASON
+create_quickstarts         false     nightly  missing capability quickstarts: jx get quickstarts failed
+create_spring_application  true      nightly  selected by nightly
+verify_pods                true      smoke    selected by verify_pods
+`, decisionsTable(t, decisions))
+	assert.Equal(t, []suites.Capability{suites.CapabilityCluster, suites.CapabilityQuickstarts}, checked, "each capability should be checked once")
+
+	assert.Equal(t, map[string]config.Duration{
+		"timeouts.buildCompletes": config.Minutes(60),
+		"timeouts.cmdLine":        config.Minutes(5),
+	}, suites.DefaultTimeouts(decisions), "only the timeouts of selected suites should be used")
+}
+
+func TestSelectOnlyChecksCapabilitiesOfMatchingSuites(t *testing.T) {
+	r := newRegistry(t)
+	decisions, err := r.Select([]string{"smoke"}, func(c suites.Capability) error {
+		assert.Equal(t, suites.CapabilityCluster, c)
+		return nil
+	})
+	require.NoError(t, err)
+	for _, d := range decisions {
+		assert.Equal(t, d.Suite.Name == "verify_pods", d.Selected, "suite %s", d.Suite.Name)
+	}
+	assert.Equal(t, "not selected", decisions[0].Reason)
+}
+
+func TestSelectAll(t *testing.T) {
+	r := newRegistry(t)
+	decisions, err := r.Select([]string{suites.SelectAll}, nil)
+	require.NoError(t, err)
+	for _, d := range decisions {
+		assert.True(t, d.Selected, "suite %s", d.Suite.Name)
+	}
+	assert.Equal(t, 60*time.Minute, suites.DefaultTimeouts(decisions)["timeouts.buildCompletes"].Duration())
+}
+
+func TestMissingCapabilitiesOfNamedSuites(t *testing.T) {
+	r := newRegistry(t)
+	noQuickstarts := func(c suites.Capability) error {
+		if c == suites.CapabilityQuickstarts {
+			return errors.New("jx get quickstarts failed")
+		}
+		return nil
+	}
+
+	decisions, err := r.Select([]string{"nightly"}, noQuickstarts)
+	require.NoError(t, err)
+	assert.NoError(t, suites.MissingCapabilities(decisions), "a suite selected by a tag should be skipped")
+
+	decisions, err = r.Select([]string{suites.SelectAll}, noQuickstarts)
+	require.NoError(t, err)
+	assert.NoError(t, suites.MissingCapabilities(decisions), "a suite selected by all should be skipped")
+
+	decisions, err = r.Select(suites.ParseSelectors("nightly,create_quickstarts"), noQuickstarts)
+	require.NoError(t, err)
+	assert.True(t, decisions[0].Named)
+	assert.False(t, decisions[1].Named)
+	err = suites.MissingCapabilities(decisions)
+	require.Error(t, err)
+	assert.Equal(t, "suite create_quickstarts cannot run: missing capability quickstarts: jx get quickstarts failed", err.Error())
+}
+
+func TestSelectUnknownSuite(t *testing.T) {
+	r := newRegistry(t)
+	_, err := r.Select([]string{"create_quickstart"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "create_quickstarts")
+
+	_, err = r.Select(suites.ParseSelectors(" , "), nil)
+	assert.Error(t, err)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	r := newRegistry(t)
+	err := r.Register(&suites.Suite{Name: "verify_pods", Specs: func() {}})
+	assert.Error(t, err)
+	err = r.Register(&suites.Suite{Name: "no_specs"})
+	assert.Error(t, err)
+}
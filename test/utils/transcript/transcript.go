@@ -0,0 +1,372 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/config"
+)
+
+const mask = "********"
+
+// Entry is a single recorded command invocation
+type Entry struct {
+	// Command is the name of the command such as jx or kubectl
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	// Env are the environment variables set for the command which differ from the environment of the tests
+	Env      []string        `json:"env,omitempty"`
+	ExitCode int             `json:"exitCode"`
+	Stdout   string          `json:"stdout,omitempty"`
+	Stderr   string          `json:"stderr,omitempty"`
+	Start    time.Time       `json:"start"`
+	Duration config.Duration `json:"duration"`
+}
+
+// Key returns the command and arguments which identify the invocation when replaying
+func (e *Entry) Key() string {
+	return e.Command + " " + strings.Join(e.Args, " ")
+}
+
+// Recorder appends every invocation to a transcript file as a line of JSON
+type Recorder struct {
+	lock    sync.Mutex
+	file    *os.File
+	secrets []string
+}
+
+// NewRecorder creates a recorder appending to the given file. Any of the given secrets are masked in the transcript.
+func NewRecorder(path string, secrets []string) (*Recorder, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the directory of transcript %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript %s: %w", path, err)
+	}
+	return &Recorder{file: f, secrets: secrets}, nil
+}
+
+// Record appends the entry to the transcript with any secrets masked
+func (r *Recorder) Record(e *Entry) error {
+	masked := maskEntry(withAddedSecrets(r.secrets), e)
+	data, err := json.Marshal(masked)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the transcript entry for %s: %w", e.Key(), err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, err = r.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write to transcript %s: %w", r.file.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the transcript file
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// Player returns the recorded outputs of invocations with the same command and arguments. Invocations which are
+// repeated, such as when polling, are returned in the order they were recorded and the last one is returned once
+// they have all been used.
+type Player struct {
+	lock    sync.Mutex
+	entries map[string][]*Entry
+	secrets []string
+}
+
+// Load loads all the entries of a transcript file
+func Load(path string) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript %s: %w", path, err)
+	}
+	defer f.Close()
+	var answer []*Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		e := &Entry{}
+		err = json.Unmarshal([]byte(text), e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of transcript %s: %w", line, path, err)
+		}
+		answer = append(answer, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript %s: %w", path, err)
+	}
+	return answer, nil
+}
+
+// NewPlayer creates a player of the given entries. The secrets are masked in the arguments of invocations before
+// they are matched, as they are masked in recorded transcripts.
+func NewPlayer(entries []*Entry, secrets []string) *Player {
+	p := &Player{
+		entries: map[string][]*Entry{},
+		secrets: secrets,
+	}
+	for _, e := range entries {
+		p.entries[e.Key()] = append(p.entries[e.Key()], e)
+	}
+	return p
+}
+
+// Next returns the next recorded invocation of the command with the given arguments
+func (p *Player) Next(command string, args []string) (*Entry, error) {
+	key := (&Entry{Command: command, Args: maskAll(withAddedSecrets(p.secrets), args)}).Key()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	entries := p.entries[key]
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no recorded invocation of %s in the transcript", key)
+	}
+	e := entries[0]
+	if len(entries) > 1 {
+		p.entries[key] = entries[1:]
+	}
+	return e, nil
+}
+
+var (
+	lock       sync.Mutex
+	configured bool
+	recorder   *Recorder
+	player     *Player
+	observers  []func(e *Entry)
+)
+
+var (
+	secretsLock  sync.Mutex
+	addedSecrets []string
+)
+
+// AddSecret masks the value in every invocation recorded or passed to observers from now on, for secrets which are
+// not settings, such as a token read from a secret in the cluster
+func AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+	if !slices.Contains(addedSecrets, secret) {
+		addedSecrets = append(addedSecrets, secret)
+	}
+}
+
+// withAddedSecrets returns the secrets along with those added with AddSecret
+func withAddedSecrets(secrets []string) []string {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+	if len(addedSecrets) == 0 {
+		return secrets
+	}
+	return append(slices.Clone(secrets), addedSecrets...)
+}
+
+// AddObserver adds a function which is called with every invocation once it has completed, or been replayed, with
+// any secrets masked
+func AddObserver(observer func(e *Entry)) {
+	lock.Lock()
+	defer lock.Unlock()
+	observers = append(observers, observer)
+}
+
+// Configure starts recording to the record file and replaying the replay file. Either may be empty to disable it.
+// It replaces the settings of the transcript configuration which are otherwise used.
+func Configure(record string, replay string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return configure(record, replay)
+}
+
+func configure(record string, replay string) error {
+	if recorder != nil {
+		_ = recorder.Close()
+	}
+	configured = true
+	recorder = nil
+	player = nil
+	secrets := config.Get().SecretValues()
+	if replay != "" {
+		entries, err := Load(replay)
+		if err != nil {
+			return err
+		}
+		player = NewPlayer(entries, secrets)
+	}
+	if record != "" {
+		r, err := NewRecorder(record, secrets)
+		if err != nil {
+			return err
+		}
+		recorder = r
+	}
+	return nil
+}
+
+// current returns the recorder and player, configuring them from the configuration the first time
+func current() (*Recorder, *Player, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if !configured {
+		c := config.Get().Transcript
+		err := configure(c.Record, c.Replay)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return recorder, player, nil
+}
+
+// Run runs the command, or replays its recorded output, recording the invocation if a transcript is being recorded.
+// The name is the logical name of the command, such as jx, which is recorded rather than the path of the binary so
+// that transcripts can be replayed on other machines. Output is written to the Stdout and Stderr of the command as it
+// would be when running it. The returned error is only for failures to run the command, the exit code of the entry
+// should be used to check it succeeded.
+func Run(name string, cmd *exec.Cmd) (*Entry, error) {
+	rec, p, err := current()
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{
+		Command: name,
+		Args:    cmd.Args[1:],
+		Dir:     cmd.Dir,
+		Env:     envDiff(cmd.Env),
+		Start:   time.Now(),
+	}
+	if p != nil {
+		recorded, err := p.Next(name, e.Args)
+		if err != nil {
+			return nil, err
+		}
+		e.ExitCode, e.Stdout, e.Stderr = recorded.ExitCode, recorded.Stdout, recorded.Stderr
+		err = replayOutput(cmd.Stdout, e.Stdout)
+		if err == nil {
+			err = replayOutput(cmd.Stderr, e.Stderr)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd.Stdout = tee(cmd.Stdout, stdout)
+		cmd.Stderr = tee(cmd.Stderr, stderr)
+		err = cmd.Run()
+		e.ExitCode = -1
+		if cmd.ProcessState != nil {
+			e.ExitCode = cmd.ProcessState.ExitCode()
+			err = nil
+		}
+		e.Stdout, e.Stderr = stdout.String(), stderr.String()
+		if err != nil {
+			return e, err
+		}
+	}
+	e.Duration = config.Duration(time.Since(e.Start))
+	notifyObservers(e)
+	if rec != nil {
+		err = rec.Record(e)
+		if err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+func notifyObservers(e *Entry) {
+	lock.Lock()
+	current := append([]func(e *Entry){}, observers...)
+	lock.Unlock()
+	if len(current) == 0 {
+		return
+	}
+	masked := maskEntry(withAddedSecrets(config.Get().SecretValues()), e)
+	for _, observer := range current {
+		observer(masked)
+	}
+}
+
+func replayOutput(w io.Writer, output string) error {
+	if w == nil || output == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, output)
+	return err
+}
+
+func tee(w io.Writer, buffer *bytes.Buffer) io.Writer {
+	if w == nil {
+		return buffer
+	}
+	return io.MultiWriter(w, buffer)
+}
+
+// envDiff returns the environment variables which are not the same in the current environment
+func envDiff(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	current := map[string]bool{}
+	for _, e := range os.Environ() {
+		current[e] = true
+	}
+	var answer []string
+	for _, e := range env {
+		if !current[e] {
+			answer = append(answer, e)
+		}
+	}
+	return answer
+}
+
+// maskEntry returns a copy of the entry with the secrets masked
+func maskEntry(secrets []string, e *Entry) *Entry {
+	masked := *e
+	masked.Args = maskAll(secrets, e.Args)
+	masked.Env = maskAll(secrets, e.Env)
+	masked.Stdout = maskSecrets(secrets, e.Stdout)
+	masked.Stderr = maskSecrets(secrets, e.Stderr)
+	return &masked
+}
+
+func maskSecrets(secrets []string, text string) string {
+	for _, s := range secrets {
+		if s != "" {
+			text = strings.ReplaceAll(text, s, mask)
+		}
+	}
+	return text
+}
+
+func maskAll(secrets []string, values []string) []string {
+	if len(secrets) == 0 || values == nil {
+		return values
+	}
+	answer := make([]string, 0, len(values))
+	for _, v := range values {
+		answer = append(answer, maskSecrets(secrets, v))
+	}
+	return answer
+}
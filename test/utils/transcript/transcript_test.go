@@ -0,0 +1,150 @@
+package transcript_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/bdd-jx3/test/utils/transcript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// configure records and replays the given files for the duration of the test
+func configure(t *testing.T, record, replay string) {
+	require.NoError(t, transcript.Configure(record, replay))
+	t.Cleanup(func() {
+		_ = transcript.Configure("", "")
+	})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "transcript.jsonl")
+	configure(t, file, "")
+
+	cmd := exec.Command("sh", "-c", "echo out $BDD_GREETING; echo err >&2; exit 3")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "BDD_GREETING=hello")
+	stdout := &strings.Builder{}
+	cmd.Stdout = stdout
+	entry, err := transcript.Run("sh", cmd)
+	require.NoError(t, err)
+	assert.Equal(t, 3, entry.ExitCode)
+	assert.Equal(t, "out hello\n", stdout.String(), "the output should still be written to the command")
+
+	entries, err := transcript.Load(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	recorded := entries[0]
+	assert.Equal(t, "sh", recorded.Command)
+	assert.Equal(t, []string{"-c", "echo out $BDD_GREETING; echo err >&2; exit 3"}, recorded.Args)
+	assert.Equal(t, dir, recorded.Dir)
+	assert.Equal(t, []string{"BDD_GREETING=hello"}, recorded.Env)
+	assert.Equal(t, 3, recorded.ExitCode)
+	assert.Equal(t, "out hello\n", recorded.Stdout)
+	assert.Equal(t, "err\n", recorded.Stderr)
+	assert.False(t, recorded.Start.IsZero())
+	assert.Positive(t, recorded.Duration.Duration())
+
+	configure(t, "", file)
+	cmd = exec.Command("does-not-exist", "-c", "echo out $BDD_GREETING; echo err >&2; exit 3")
+	stdout.Reset()
+	stderr := &strings.Builder{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	entry, err = transcript.Run("sh", cmd)
+	require.NoError(t, err)
+	assert.Equal(t, 3, entry.ExitCode)
+	assert.Equal(t, "out hello\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+
+	_, err = transcript.Run("sh", exec.Command("sh", "-c", "true"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no recorded invocation of sh -c true")
+}
+
+func TestPlayerReturnsRepeatedInvocationsInOrder(t *testing.T) {
+	p := transcript.NewPlayer([]*transcript.Entry{
+		{Command: "jx", Args: []string{"get", "activities"}, Stdout: "Pending"},
+		{Command: "jx", Args: []string{"version"}, Stdout: "3.10.0"},
+		{Command: "jx", Args: []string{"get", "activities"}, Stdout: "Running"},
+		{Command: "jx", Args: []string{"get", "activities"}, Stdout: "Succeeded"},
+	}, nil)
+
+	var outputs []string
+	for i := 0; i < 4; i++ {
+		e, err := p.Next("jx", []string{"get", "activities"})
+		require.NoError(t, err)
+		outputs = append(outputs, e.Stdout)
+	}
+	assert.Equal(t, []string{"Pending", "Running", "Succeeded", "Succeeded"}, outputs)
+
+	_, err := p.Next("kubectl", []string{"version"})
+	assert.Error(t, err)
+}
+
+func TestSecretsAreMasked(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transcript.jsonl")
+	r, err := transcript.NewRecorder(file, []string{"s3cr3t"})
+	require.NoError(t, err)
+	err = r.Record(&transcript.Entry{
+		Command: "jx",
+		Args:    []string{"create", "git", "token", "-t", "s3cr3t"},
+		Env:     []string{"GIT_TOKEN=s3cr3t"},
+		Stdout:  "using token s3cr3t",
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t")
+
+	entries, err := transcript.Load(file)
+	require.NoError(t, err)
+	p := transcript.NewPlayer(entries, []string{"s3cr3t"})
+	e, err := p.Next("jx", []string{"create", "git", "token", "-t", "s3cr3t"})
+	require.NoError(t, err, "the secret should be masked before matching the arguments")
+	assert.Equal(t, "using token ********", e.Stdout)
+}
+
+func TestObserversSeeMaskedInvocations(t *testing.T) {
+	configure(t, "", "")
+	var observed []*transcript.Entry
+	transcript.AddObserver(func(e *transcript.Entry) {
+		observed = append(observed, e)
+	})
+
+	_, err := transcript.Run("sh", exec.Command("sh", "-c", "exit 2"))
+	require.NoError(t, err)
+	require.Len(t, observed, 1)
+	assert.Equal(t, "sh", observed[0].Command)
+	assert.Equal(t, []string{"-c", "exit 2"}, observed[0].Args)
+	assert.Equal(t, 2, observed[0].ExitCode)
+}
+
+func TestAddSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transcript.jsonl")
+	configure(t, file, "")
+	var observed []*transcript.Entry
+	transcript.AddObserver(func(e *transcript.Entry) {
+		observed = append(observed, e)
+	})
+	transcript.AddSecret("t0k3n")
+
+	cmd := exec.Command("sh", "-c", "echo using $BDD_TOKEN", "t0k3n")
+	cmd.Env = append(os.Environ(), "BDD_TOKEN=t0k3n")
+	_, err := transcript.Run("sh", cmd)
+	require.NoError(t, err)
+	require.Len(t, observed, 1)
+	assert.Equal(t, []string{"-c", "echo using $BDD_TOKEN", "********"}, observed[0].Args)
+	assert.Equal(t, []string{"BDD_TOKEN=********"}, observed[0].Env)
+	assert.Equal(t, "using ********\n", observed[0].Stdout)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "t0k3n")
+}
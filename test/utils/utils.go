@@ -6,27 +6,9 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
-	"strconv"
 	"time"
 )
 
-// GetEnv fetches a timeout value from an environment variable, and returns the fallback value if that variable does not exist
-func GetTimeoutFromEnv(key string, fallback int) time.Duration {
-	if value, ok := os.LookupEnv(key); ok {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return time.Duration(intVal)
-		}
-	}
-	return time.Duration(fallback) * time.Minute
-}
-
-func GetEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
-
 func GetFileAsString(path string) (string, error) {
 	buf, err := ioutil.ReadFile(path)
 	if err != nil {